@@ -17,13 +17,16 @@
 package abi
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"reflect"
 	"strings"
 
 	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/crypto"
 )
 
 // The ABI holds information about a contract's context and available
@@ -220,3 +223,28 @@ func (abi *ABI) UnmarshalJSON(data []byte) error {
 
 	return nil
 }
+
+// revertSelector is the selector of the Error(string) function, which Solidity
+// uses to encode the reason passed to revert and require.
+var revertSelector = crypto.Keccak256([]byte("Error(string)"))[:4]
+
+// errInvalidRevert is returned by UnpackRevert for data which is not an
+// encoded Error(string).
+var errInvalidRevert = errors.New("abi: invalid revert data")
+
+// UnpackRevert decodes the reason from the data a call reverted with, which
+// Solidity encodes as if it were a call to Error(string).
+func UnpackRevert(data []byte) (string, error) {
+	if len(data) < 4 || !bytes.Equal(data[:4], revertSelector) {
+		return "", errInvalidRevert
+	}
+	typ, err := NewType("string")
+	if err != nil {
+		return "", err
+	}
+	reason, err := toGoType(0, Argument{Type: typ}, data[4:])
+	if err != nil {
+		return "", err
+	}
+	return reason.(string), nil
+}
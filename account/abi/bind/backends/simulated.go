@@ -63,7 +63,7 @@ func NewSimulatedBackend(alloc bc.GenesisAlloc) *SimulatedBackend {
 	database, _ := hpbdb.NewMemDatabase()
 	genesis := bc.Genesis{Config: config.MainnetChainConfig, Alloc: alloc}
 	genesis.MustCommit(database)
-	blockchain, _ := bc.NewBlockChain(database, genesis.Config, solo.New())
+	blockchain, _ := bc.NewBlockChain(database, nil, genesis.Config, solo.New())
 	backend := &SimulatedBackend{database: database, blockchain: blockchain, config: genesis.Config}
 	backend.rollback()
 	return backend
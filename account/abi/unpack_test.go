@@ -679,3 +679,26 @@ func TestUnmarshal(t *testing.T) {
 		t.Fatal("expected error:", err)
 	}
 }
+
+func TestUnpackRevert(t *testing.T) {
+	for i, test := range []struct {
+		input  string
+		reason string
+		fail   bool
+	}{
+		{"", "", true},
+		{"08c379a1", "", true},
+		{"08c379a00000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000000d72657665727420726561736f6e00000000000000000000000000000000000000", "revert reason", false},
+		{"08c379a00000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000000d7265", "", true},
+		{"08c379a0ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", "", true},
+	} {
+		reason, err := UnpackRevert(common.Hex2Bytes(test.input))
+		if test.fail != (err != nil) {
+			t.Errorf("test %d: failure mismatch: have %v, want failure %v", i, err, test.fail)
+			continue
+		}
+		if reason != test.reason {
+			t.Errorf("test %d: reason mismatch: have %q, want %q", i, reason, test.reason)
+		}
+	}
+}
@@ -131,3 +131,22 @@ func CalcGasLimit(parent *types.Block) *big.Int {
 	}
 	return config.TargetGasLimit //fo testnet
 }
+
+// CalcGasLimitTarget computes the gas limit of the next block after parent,
+// moving it toward target as far as the GasLimitBoundDivisor rule allows.
+func CalcGasLimitTarget(parent *types.Block, target *big.Int) *big.Int {
+	// delta = parentGasLimit / 1024 - 1, the largest step a block may take
+	delta := new(big.Int).Div(parent.GasLimit(), config.GasLimitBoundDivisor)
+	delta.Sub(delta, big.NewInt(1))
+
+	limit := new(big.Int).Set(parent.GasLimit())
+	switch limit.Cmp(target) {
+	case -1:
+		limit.Add(limit, delta)
+		limit.Set(math.BigMin(limit, target))
+	case 1:
+		limit.Sub(limit, delta)
+		limit.Set(math.BigMax(limit, target))
+	}
+	return math.BigMax(limit, config.MinGasLimit)
+}
@@ -0,0 +1,44 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package bc
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/hpb-project/go-hpb/blockchain/types"
+)
+
+// Tests that the gas limit moves toward the target by at most the bound step.
+func TestCalcGasLimitTarget(t *testing.T) {
+	tests := []struct {
+		parent, target, want int64
+	}{
+		{1024000, 1024000, 1024000}, // at target
+		{1024000, 2048000, 1024999}, // raise by parent/1024 - 1
+		{1024000, 1024500, 1024500}, // raise right onto a close target
+		{1024000, 512000, 1023001},  // lower by parent/1024 - 1
+		{1024000, 1023500, 1023500}, // lower right onto a close target
+		{5002, 1000, 5000},          // never below the minimum gas limit
+	}
+	for i, tt := range tests {
+		parent := types.NewBlockWithHeader(&types.Header{GasLimit: big.NewInt(tt.parent)})
+		if have := CalcGasLimitTarget(parent, big.NewInt(tt.target)); have.Cmp(big.NewInt(tt.want)) != 0 {
+			t.Errorf("test %d: gas limit mismatch: have %v, want %v", i, have, tt.want)
+		}
+	}
+}
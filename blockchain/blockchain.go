@@ -28,6 +28,7 @@ import (
 
 	"github.com/hashicorp/golang-lru"
 	"github.com/hpb-project/go-hpb/blockchain/state"
+	"github.com/hpb-project/go-hpb/blockchain/state/snapshot"
 	"github.com/hpb-project/go-hpb/blockchain/storage"
 	"github.com/hpb-project/go-hpb/blockchain/types"
 	"github.com/hpb-project/go-hpb/common"
@@ -40,7 +41,9 @@ import (
 	"github.com/hpb-project/go-hpb/config"
 	"github.com/hpb-project/go-hpb/consensus"
 	"github.com/hpb-project/go-hpb/event/sub"
+	"github.com/hpb-project/go-hpb/hvm/evm"
 	"github.com/hpb-project/go-hpb/node/db"
+	"gopkg.in/karalabe/cookiejar.v2/collections/prque"
 )
 
 var (
@@ -59,8 +62,27 @@ const (
 
 	// BlockChainVersion ensures that an incompatible database forces a resync from scratch.
 	BlockChainVersion = 3
+
+	// TriesInMemory is the number of recent block states kept in memory before
+	// they are garbage collected or flushed to disk.
+	TriesInMemory = 128
 )
 
+// CacheConfig contains the configuration of the trie node cache of the chain.
+type CacheConfig struct {
+	Disabled          bool               // Whether to write every state straight to disk (archive mode)
+	TrieNodeLimit     common.StorageSize // Memory allowance after which a cached state is flushed to disk
+	TrieFlushInterval uint64             // Number of blocks after which a cached state is flushed to disk
+	Snapshot          bool               // Whether to keep a flat snapshot of the recent states for fast reads
+}
+
+// DefaultCacheConfig is the trie node cache configuration of a garbage
+// collecting node.
+var DefaultCacheConfig = &CacheConfig{
+	TrieNodeLimit:     256 * 1024 * 1024,
+	TrieFlushInterval: 3600,
+}
+
 // BlockChain represents the canonical chain given a database with a genesis
 // block. The Blockchain manages chain imports, reverts, chain reorganisations.
 //
@@ -95,7 +117,11 @@ type BlockChain struct {
 	currentBlock     *types.Block // Current head of the block chain
 	currentFastBlock *types.Block // Current head of the fast-sync chain (may be above the block chain!)
 
+	cacheConfig  *CacheConfig   // Trie node cache configuration, garbage collection is disabled if nil
 	stateCache   state.Database // State database to reuse between imports (contains state cache)
+	snaps        *snapshot.Tree // Flat snapshot of the recent states, nil if disabled
+	triegc       *prque.Prque   // Priority queue mapping block numbers to tries to garbage collect
+	lastFlush    uint64         // Number of the last block whose state was flushed to disk
 	bodyCache    *lru.Cache     // Cache for the most recent block bodies
 	bodyRLPCache *lru.Cache     // Cache for the most recent block bodies in RLP encoded format
 	blockCache   *lru.Cache     // Cache for the most recent entire blocks
@@ -108,8 +134,9 @@ type BlockChain struct {
 	wg            sync.WaitGroup // chain processing wait group for shutting down
 
 	engine    consensus.Engine
-	processor Processor // block processor interface
-	validator Validator // block and state validator interface
+	vmConfig  evm.Config // configuration of the EVM the blocks are processed on
+	processor Processor  // block processor interface
+	validator Validator  // block and state validator interface
 
 	badBlocks *lru.Cache // Bad block cache
 }
@@ -117,7 +144,16 @@ type BlockChain struct {
 // InstanceBlockChain returns the singleton of BlockChain.
 func InstanceBlockChain() *BlockChain {
 	once.Do(func() {
-		bcInstance = NewBlockChain(db.GetHpbDbInstance(), &config.GetHpbConfigInstance().BlockChain)
+		hpbconfig := config.GetHpbConfigInstance()
+
+		cacheConfig := &CacheConfig{
+			Disabled:          hpbconfig.Node.NoPruning,
+			TrieNodeLimit:     common.StorageSize(hpbconfig.Node.TrieCache) * 1024 * 1024,
+			TrieFlushInterval: hpbconfig.Node.TrieFlushInterval,
+			Snapshot:          !hpbconfig.Node.NoSnapshot && hpbconfig.Node.SyncMode != config.LightSync,
+		}
+		bcInstance = NewBlockChain(db.GetHpbDbInstance(), cacheConfig, &hpbconfig.BlockChain)
+		bcInstance.vmConfig = evm.Config{Profile: hpbconfig.Node.VMProfile}
 	})
 	return bcInstance
 }
@@ -139,6 +175,12 @@ func (bc *BlockChain) InitWithEngine(engine consensus.Engine) (*BlockChain, erro
 	if err := bc.loadLastState(); err != nil {
 		return nil, err
 	}
+	if err := bc.checkChainConfig(); err != nil {
+		return nil, err
+	}
+	if bc.cacheConfig != nil && bc.cacheConfig.Snapshot {
+		bc.snaps = snapshot.New(bc.chainDb, bc.TrieDB(), bc.currentBlock.Root())
+	}
 
 	// Take ownership of this particular state
 	go bc.update()
@@ -147,8 +189,8 @@ func (bc *BlockChain) InitWithEngine(engine consensus.Engine) (*BlockChain, erro
 
 // NewBlockChain returns a fully initialised block chain using information
 // available in the database. It initialises the default Hpb Validator and
-// Processor.
-func NewBlockChain(chainDb hpbdb.Database, config *config.ChainConfig) *BlockChain {
+// Processor. A nil cacheConfig writes every state straight to disk.
+func NewBlockChain(chainDb hpbdb.Database, cacheConfig *CacheConfig, config *config.ChainConfig) *BlockChain {
 	bodyCache, _ := lru.New(bodyCacheLimit)
 	bodyRLPCache, _ := lru.New(bodyCacheLimit)
 	blockCache, _ := lru.New(blockCacheLimit)
@@ -158,7 +200,9 @@ func NewBlockChain(chainDb hpbdb.Database, config *config.ChainConfig) *BlockCha
 	bc := &BlockChain{
 		config:       config,
 		chainDb:      chainDb,
-		stateCache:   state.NewDatabase(chainDb),
+		cacheConfig:  cacheConfig,
+		stateCache:   newStateCache(chainDb, cacheConfig),
+		triegc:       prque.New(),
 		quit:         make(chan struct{}),
 		bodyCache:    bodyCache,
 		bodyRLPCache: bodyRLPCache,
@@ -173,7 +217,7 @@ func NewBlockChain(chainDb hpbdb.Database, config *config.ChainConfig) *BlockCha
 // NewBlockChain returns a fully initialised block chain using information
 // available in the database. It initialises the default Hpb Validator and
 // Processor.
-func NewBlockChainWithEngine(chainDb hpbdb.Database, config *config.ChainConfig, engine consensus.Engine) (*BlockChain, error) {
+func NewBlockChainWithEngine(chainDb hpbdb.Database, cacheConfig *CacheConfig, config *config.ChainConfig, engine consensus.Engine) (*BlockChain, error) {
 	bodyCache, _ := lru.New(bodyCacheLimit)
 	bodyRLPCache, _ := lru.New(bodyCacheLimit)
 	blockCache, _ := lru.New(blockCacheLimit)
@@ -183,7 +227,9 @@ func NewBlockChainWithEngine(chainDb hpbdb.Database, config *config.ChainConfig,
 	bc := &BlockChain{
 		config:       config,
 		chainDb:      chainDb,
-		stateCache:   state.NewDatabase(chainDb),
+		cacheConfig:  cacheConfig,
+		stateCache:   newStateCache(chainDb, cacheConfig),
+		triegc:       prque.New(),
 		quit:         make(chan struct{}),
 		bodyCache:    bodyCache,
 		bodyRLPCache: bodyRLPCache,
@@ -208,12 +254,87 @@ func NewBlockChainWithEngine(chainDb hpbdb.Database, config *config.ChainConfig,
 	if err := bc.loadLastState(); err != nil {
 		return nil, err
 	}
+	if err := bc.checkChainConfig(); err != nil {
+		return nil, err
+	}
+	if bc.cacheConfig != nil && bc.cacheConfig.Snapshot {
+		bc.snaps = snapshot.New(bc.chainDb, bc.TrieDB(), bc.currentBlock.Root())
+	}
 
 	// Take ownership of this particular state
 	go bc.update()
 	return bc, nil
 }
 
+// checkChainConfig compares the chain configuration against the one the chain
+// was built with, rewinding the chain past any fork rescheduled below the head,
+// and stores it as the new one.
+func (bc *BlockChain) checkChainConfig() error {
+	if err := bc.config.CheckConfigForkOrder(); err != nil {
+		return err
+	}
+	genesis := bc.genesisBlock.Hash()
+	stored, err := GetChainConfig(bc.chainDb, genesis)
+	if err != nil && err != ErrChainConfigNotFound {
+		return err
+	}
+	if stored != nil {
+		if compat := stored.CheckCompatible(bc.config, bc.CurrentHeader().Number.Uint64()); compat != nil {
+			log.Warn("Rewinding chain to upgrade configuration", "err", compat)
+			if err := bc.SetHead(compat.RewindTo); err != nil {
+				return err
+			}
+		}
+	}
+	log.Info("Initialised chain configuration", "config", bc.config)
+	return WriteChainConfig(bc.chainDb, genesis, bc.config)
+}
+
+// ForkID returns the fork ID of the chain at the current head.
+func (bc *BlockChain) ForkID() config.ForkID {
+	return config.NewForkID(bc.config, bc.genesisBlock.Hash(), bc.CurrentHeader().Number.Uint64())
+}
+
+// ForkFilter checks the fork ID of a remote node against the forks of the
+// chain, returning an error if the nodes follow incompatible rules.
+func (bc *BlockChain) ForkFilter(id config.ForkID) error {
+	filter := config.NewForkFilter(bc.config, bc.genesisBlock.Hash(), func() uint64 {
+		return bc.CurrentHeader().Number.Uint64()
+	})
+	return filter(id)
+}
+
+// newStateCache creates the state database of the chain, backed by a trie node
+// cache unless garbage collection is disabled.
+func newStateCache(chainDb hpbdb.Database, cacheConfig *CacheConfig) state.Database {
+	if cacheConfig == nil || cacheConfig.Disabled {
+		return state.NewDatabase(chainDb)
+	}
+	return state.NewDatabaseWithCache(trie.NewNodeCache(chainDb))
+}
+
+// TrieDB returns the database the state tries are read from, the trie node
+// cache if there is one.
+func (bc *BlockChain) TrieDB() trie.Database {
+	if nodes := bc.stateCache.NodeCache(); nodes != nil {
+		return nodes
+	}
+	return bc.chainDb
+}
+
+// syncSnapshot rebuilds the state snapshot if it has no layer for the state
+// root of a new head, as after a fast sync, a rewind or a deep reorg.
+func (bc *BlockChain) syncSnapshot(root common.Hash) {
+	if bc.snaps != nil && bc.snaps.Snapshot(root) == nil {
+		bc.snaps.Rebuild(root)
+	}
+}
+
+// Snapshots returns the flat state snapshot of the chain, nil if disabled.
+func (bc *BlockChain) Snapshots() *snapshot.Tree {
+	return bc.snaps
+}
+
 func (bc *BlockChain) getProcInterrupt() bool {
 	return atomic.LoadInt32(&bc.procInterrupt) == 1
 }
@@ -237,12 +358,20 @@ func (bc *BlockChain) loadLastState() error {
 	}
 	// Make sure the state associated with the block is available
 	if _, err := state.New(currentBlock.Root(), bc.stateCache); err != nil {
-		// Dangling block without a state associated, init from scratch
-		log.Warn("Head state missing, resetting chain", "number", currentBlock.Number(), "hash", currentBlock.Hash())
-		return bc.Reset()
+		// Dangling block without a state associated, rewind to the last block
+		// having one, as states kept in memory are lost on a crash
+		log.Warn("Head state missing, repairing chain", "number", currentBlock.Number(), "hash", currentBlock.Hash())
+		if err := bc.repair(&currentBlock); err != nil {
+			return err
+		}
+		if err := WriteHeadBlockHash(bc.chainDb, currentBlock.Hash()); err != nil {
+			return err
+		}
 	}
 	// Everything seems to be fine, set as the head block
 	bc.currentBlock = currentBlock
+	bc.lastFlush = currentBlock.NumberU64()
+	bc.syncSnapshot(currentBlock.Root())
 
 	// Restore the last known head header
 	currentHeader := bc.currentBlock.Header()
@@ -273,6 +402,22 @@ func (bc *BlockChain) loadLastState() error {
 	return nil
 }
 
+// repair walks back from head to the most recent block having its state
+// available, moving head to it.
+func (bc *BlockChain) repair(head **types.Block) error {
+	for {
+		if _, err := state.New((*head).Root(), bc.stateCache); err == nil {
+			log.Info("Rewound blockchain to past state", "number", (*head).Number(), "hash", (*head).Hash())
+			return nil
+		}
+		block := bc.GetBlock((*head).ParentHash(), (*head).NumberU64()-1)
+		if block == nil {
+			return fmt.Errorf("missing block %d [%x]", (*head).NumberU64()-1, (*head).ParentHash())
+		}
+		*head = block
+	}
+}
+
 // SetHead rewinds the local chain to a new head. In the case of headers, everything
 // above the new head will be deleted and the new one set. In the case of blocks
 // though, the head may be further rewound if block bodies are missing (non-archive
@@ -290,6 +435,13 @@ func (bc *BlockChain) SetHead(head uint64) error {
 	bc.hc.SetHead(head, delFn)
 	currentHeader := bc.hc.CurrentHeader()
 
+	// Drop the rewound blocks from the ancient block store too
+	if store, ok := bc.chainDb.(hpbdb.AncientStore); ok && store.Ancients() > head+1 {
+		if err := store.Freezer().TruncateAncients(head + 1); err != nil {
+			return err
+		}
+	}
+
 	// Clear out any stale content from the caches
 	bc.bodyCache.Purge()
 	bc.bodyRLPCache.Purge()
@@ -340,6 +492,7 @@ func (bc *BlockChain) FastSyncCommitHead(hash common.Hash) error {
 	// If all checks out, manually set the head block
 	bc.mu.Lock()
 	bc.currentBlock = block
+	bc.syncSnapshot(block.Root())
 	bc.mu.Unlock()
 
 	log.Info("Committed new head block", "number", block.Number(), "hash", hash)
@@ -424,7 +577,7 @@ func (bc *BlockChain) State() (*state.StateDB, error) {
 
 // StateAt returns a new mutable state based on a particular point in time.
 func (bc *BlockChain) StateAt(root common.Hash) (*state.StateDB, error) {
-	return state.New(root, bc.stateCache)
+	return state.NewWithSnapshot(root, bc.stateCache, bc.snaps)
 }
 
 // Reset purges the entire blockchain, restoring it to its genesis state.
@@ -561,8 +714,7 @@ func (bc *BlockChain) HasBlock(hash common.Hash, number uint64) bool {
 	if bc.blockCache.Contains(hash) {
 		return true
 	}
-	ok, _ := bc.chainDb.Has(blockBodyKey(hash, number))
-	return ok
+	return HasBody(bc.chainDb, hash, number)
 }
 
 // HasBlockAndState checks if a block and associated state trie is fully present
@@ -648,6 +800,22 @@ func (bc *BlockChain) Stop() {
 	atomic.StoreInt32(&bc.procInterrupt, 1)
 
 	bc.wg.Wait()
+
+	// Flatten the state snapshot down to the head, the diff layers only live
+	// in memory
+	if bc.snaps != nil {
+		if err := bc.snaps.Cap(bc.CurrentBlock().Root(), 0); err != nil {
+			log.Error("Failed to flatten state snapshot", "err", err)
+		}
+		bc.snaps.Release()
+	}
+	// Persist the head state, everything newer than the last flush would be
+	// lost otherwise
+	if nodes := bc.stateCache.NodeCache(); nodes != nil {
+		if err := nodes.Commit(bc.CurrentBlock().Root()); err != nil {
+			log.Error("Failed to commit head state", "err", err)
+		}
+	}
 	log.Info("Blockchain manager stopped")
 }
 
@@ -852,7 +1020,11 @@ func (bc *BlockChain) WriteBlockAndState(block *types.Block, receipts []*types.R
 	if err := WriteBlock(batch, block); err != nil {
 		return NonStatTy, err
 	}
-	if _, err := state.CommitTo(batch, true); err != nil {
+	if nodes := bc.stateCache.NodeCache(); nodes == nil {
+		if _, err := state.CommitTo(batch, true); err != nil {
+			return NonStatTy, err
+		}
+	} else if err := bc.commitToCache(nodes, block, state); err != nil {
 		return NonStatTy, err
 	}
 	if err := WriteBlockReceipts(batch, block.Hash(), block.NumberU64(), receipts); err != nil {
@@ -888,11 +1060,52 @@ func (bc *BlockChain) WriteBlockAndState(block *types.Block, receipts []*types.R
 	// Set new head.
 	if status == CanonStatTy {
 		bc.insert(block)
+		bc.syncSnapshot(block.Root())
 	}
 	bc.futureBlocks.Remove(block.Hash())
 	return status, nil
 }
 
+// commitToCache commits the state of a block into the trie node cache. States
+// older than TriesInMemory blocks are dropped from memory, except that one is
+// flushed to disk every TrieFlushInterval blocks or when the cache outgrows its
+// memory allowance.
+func (bc *BlockChain) commitToCache(nodes *trie.NodeCache, block *types.Block, statedb *state.StateDB) error {
+	root, err := statedb.CommitTo(nodes, true)
+	if err != nil {
+		return err
+	}
+	nodes.Reference(root, common.Hash{})
+	bc.triegc.Push(root, -float32(block.NumberU64()))
+
+	current := block.NumberU64()
+	if current <= TriesInMemory {
+		return nil
+	}
+	chosen := current - TriesInMemory
+
+	if nodes.Size() > bc.cacheConfig.TrieNodeLimit || chosen >= bc.lastFlush+bc.cacheConfig.TrieFlushInterval {
+		if header := bc.GetHeaderByNumber(chosen); header == nil {
+			log.Warn("Reorg in progress, trie commit postponed", "number", chosen)
+		} else {
+			if err := nodes.Commit(header.Root); err != nil {
+				return err
+			}
+			bc.lastFlush = chosen
+		}
+	}
+	// Garbage collect the states that fell out of the in-memory window
+	for !bc.triegc.Empty() {
+		root, number := bc.triegc.Pop()
+		if uint64(-number) > chosen {
+			bc.triegc.Push(root, number)
+			break
+		}
+		nodes.Dereference(root.(common.Hash))
+	}
+	return nil
+}
+
 // InsertChain attempts to insert the given batch of blocks in to the canonical
 // chain or, otherwise, create a fork. If an error is returned it will return
 // the index number of the failing block as well an error describing what went
@@ -1007,7 +1220,7 @@ func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*ty
 		} else {
 			parent = chain[i-1]
 		}
-		state, err := state.New(parent.Root(), bc.stateCache)
+		state, err := state.NewWithSnapshot(parent.Root(), bc.stateCache, bc.snaps)
 		if err != nil {
 			return i, events, coalescedLogs, err
 		}
@@ -1415,6 +1628,9 @@ func (bc *BlockChain) GetRandom() string {
 // Config retrieves the blockchain's chain configuration.
 func (bc *BlockChain) Config() *config.ChainConfig { return bc.config }
 
+// VMConfig returns the configuration of the EVM the blocks are processed on.
+func (bc *BlockChain) VMConfig() evm.Config { return bc.vmConfig }
+
 // Engine retrieves the blockchain's consensus engine.
 func (bc *BlockChain) Engine() consensus.Engine { return bc.engine }
 
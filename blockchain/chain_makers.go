@@ -217,7 +217,7 @@ func newCanonical(n int, full bool) (hpbdb.Database, *BlockChain, error) {
 	db, _ := hpbdb.NewMemDatabase()
 	genesis := gspec.MustCommit(db)
 
-	blockchain, _ := NewBlockChain(db, config.MainnetChainConfig, prometheus.New(nil,nil))
+	blockchain, _ := NewBlockChain(db, nil, config.MainnetChainConfig, prometheus.New(nil,nil))
 	// Create and inject the requested chain
 	if n == 0 {
 		return db, blockchain, nil
@@ -0,0 +1,208 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package bc
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/hpb-project/go-hpb/blockchain/state/snapshot"
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/log"
+	"github.com/hpb-project/go-hpb/common/rlp"
+)
+
+var (
+	// Keys written outside of this package, kept here to account for them.
+	hpbSnapPrefix     = []byte("prometheus-")  // prometheus- + hash -> signer snapshot (consensus/snapshots)
+	cadNodeSnapPrefix = []byte("codnodesnap-") // codnodesnap- + hash -> candidate snapshot (consensus/snapshots)
+	minedBlockPrefix  = []byte("miner-mined-") // miner-mined- + num (uint64 big endian) -> mined block record (worker)
+	chtPrefix         = []byte("cht")          // cht-, chtIndex-, chtRoot- -> canonical hash trie (light)
+
+	// metadataKeys are the single keys holding chain metadata.
+	metadataKeys = [][]byte{
+		headHeaderKey, headBlockKey, headFastKey, snapshotSyncStatusKey, voteResultKey, randomPrefix, []byte("BlockchainVersion"),
+		snapshot.SnapshotRootKey, snapshot.SnapshotGeneratorKey,
+	}
+)
+
+// DatabaseStat is the number of entries of a category of the chain database
+// and their total size in bytes.
+type DatabaseStat struct {
+	Category string `json:"category"`
+	Count    uint64 `json:"count"`
+	Size     uint64 `json:"size"`
+}
+
+// DatabaseStats is the breakdown of the chain database by category.
+type DatabaseStats struct {
+	Categories []*DatabaseStat `json:"categories"`
+	Total      DatabaseStat    `json:"total"`
+}
+
+// Categories of the database inspection, in reporting order.
+const (
+	statHeaders = iota
+	statBodies
+	statReceipts
+	statTds
+	statCanonical
+	statHashNumbers
+	statTxLookups
+	statBloomBits
+	statChainIndex
+	statCht
+	statTrieNodes
+	statCode
+	statSnapAccounts
+	statSnapStorage
+	statPreimages
+	statSnapshots
+	statCadSnapshots
+	statMinedBlocks
+	statConfig
+	statMetadata
+	statUnaccounted
+	statCategories
+)
+
+var statNames = [statCategories]string{
+	statHeaders:      "Headers",
+	statBodies:       "Bodies",
+	statReceipts:     "Receipts",
+	statTds:          "Difficulties",
+	statCanonical:    "Canonical hashes",
+	statHashNumbers:  "Hash to number",
+	statTxLookups:    "Transaction lookups",
+	statBloomBits:    "Bloom bits",
+	statChainIndex:   "Chain indexer",
+	statCht:          "Canonical hash trie",
+	statTrieNodes:    "Trie nodes",
+	statCode:         "Contract code",
+	statSnapAccounts: "Snapshot accounts",
+	statSnapStorage:  "Snapshot storage",
+	statPreimages:    "Trie preimages",
+	statSnapshots:    "Signer snapshots",
+	statCadSnapshots: "Candidate snapshots",
+	statMinedBlocks:  "Mined blocks",
+	statConfig:       "Chain config",
+	statMetadata:     "Metadata",
+	statUnaccounted:  "Unaccounted",
+}
+
+// InspectDatabase iterates over the whole chain database and reports the
+// number and size of the entries of every category of keys, followed by the
+// tables of the ancient block store if there is one.
+func InspectDatabase(db hpbdb.Database) (*DatabaseStats, error) {
+	var (
+		stats  [statCategories]DatabaseStat
+		start  = time.Now()
+		logged = time.Now()
+		count  uint64
+	)
+	it := db.NewIteratorWithPrefix(nil)
+	defer it.Release()
+
+	for it.Next() {
+		key, value := it.Key(), it.Value()
+
+		stat := &stats[classifyKey(key, value)]
+		stat.Count++
+		stat.Size += uint64(len(key) + len(value))
+
+		if count++; time.Since(logged) > 8*time.Second {
+			log.Info("Inspecting database", "count", count, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	result := new(DatabaseStats)
+	for i := range stats {
+		stats[i].Category = statNames[i]
+		result.Categories = append(result.Categories, &stats[i])
+	}
+	if store, ok := db.(hpbdb.AncientStore); ok && store.Freezer() != nil {
+		result.Categories = append(result.Categories, &DatabaseStat{
+			Category: "Ancient blocks",
+			Count:    store.Ancients(),
+			Size:     store.Freezer().Size(),
+		})
+	}
+	for _, stat := range result.Categories {
+		result.Total.Count += stat.Count
+		result.Total.Size += stat.Size
+	}
+	result.Total.Category = "Total"
+	return result, nil
+}
+
+// classifyKey returns the category of a database entry.
+func classifyKey(key, value []byte) int {
+	size := len(key)
+	switch {
+	case bytes.HasPrefix(key, headerPrefix) && size == len(headerPrefix)+8+common.HashLength:
+		return statHeaders
+	case bytes.HasPrefix(key, headerPrefix) && size == len(headerPrefix)+8+common.HashLength+len(tdSuffix) && bytes.HasSuffix(key, tdSuffix):
+		return statTds
+	case bytes.HasPrefix(key, headerPrefix) && size == len(headerPrefix)+8+len(numSuffix) && bytes.HasSuffix(key, numSuffix):
+		return statCanonical
+	case bytes.HasPrefix(key, blockHashPrefix) && size == len(blockHashPrefix)+common.HashLength:
+		return statHashNumbers
+	case bytes.HasPrefix(key, bodyPrefix) && size == len(bodyPrefix)+8+common.HashLength:
+		return statBodies
+	case bytes.HasPrefix(key, blockReceiptsPrefix) && size == len(blockReceiptsPrefix)+8+common.HashLength:
+		return statReceipts
+	case bytes.HasPrefix(key, lookupPrefix) && size == len(lookupPrefix)+common.HashLength:
+		return statTxLookups
+	case bytes.HasPrefix(key, bloomBitsPrefix) && size == len(bloomBitsPrefix)+2+8+common.HashLength:
+		return statBloomBits
+	case bytes.HasPrefix(key, BloomBitsIndexPrefix):
+		return statChainIndex
+	case bytes.HasPrefix(key, chtPrefix):
+		return statCht
+	case bytes.HasPrefix(key, snapshot.SnapshotAccountPrefix) && size == len(snapshot.SnapshotAccountPrefix)+common.HashLength:
+		return statSnapAccounts
+	case bytes.HasPrefix(key, snapshot.SnapshotStoragePrefix) && size == len(snapshot.SnapshotStoragePrefix)+2*common.HashLength:
+		return statSnapStorage
+	case bytes.HasPrefix(key, []byte(preimagePrefix)) && size == len(preimagePrefix)+common.HashLength:
+		return statPreimages
+	case bytes.HasPrefix(key, hpbSnapPrefix):
+		return statSnapshots
+	case bytes.HasPrefix(key, cadNodeSnapPrefix):
+		return statCadSnapshots
+	case bytes.HasPrefix(key, minedBlockPrefix):
+		return statMinedBlocks
+	case bytes.HasPrefix(key, configPrefix):
+		return statConfig
+	case size == common.HashLength:
+		// Trie nodes and code are both keyed by their hash, tell them apart
+		// by trie nodes always being a single RLP list
+		if kind, _, rest, err := rlp.Split(value); err == nil && kind == rlp.List && len(rest) == 0 {
+			return statTrieNodes
+		}
+		return statCode
+	}
+	for _, meta := range metadataKeys {
+		if bytes.Equal(key, meta) {
+			return statMetadata
+		}
+	}
+	return statUnaccounted
+}
@@ -50,6 +50,8 @@ var (
 	headBlockKey  = []byte("LastBlock")
 	headFastKey   = []byte("LastFast")
 
+	snapshotSyncStatusKey = []byte("SnapshotSyncStatus")
+
 	// Data item prefixes (use single byte to avoid mixing data types, avoid `i`).
 	headerPrefix        = []byte("h") // headerPrefix + num (uint64 big endian) + hash -> header
 	tdSuffix            = []byte("t") // headerPrefix + num (uint64 big endian) + hash + tdSuffix -> td
@@ -96,12 +98,32 @@ func encodeBlockNumber(number uint64) []byte {
 // GetCanonicalHash retrieves a hash assigned to a canonical block number.
 func GetCanonicalHash(db DatabaseReader, number uint64) common.Hash {
 	data, _ := db.Get(append(append(headerPrefix, encodeBlockNumber(number)...), numSuffix...))
+	if len(data) == 0 {
+		if ancients, ok := db.(hpbdb.AncientReader); ok {
+			data, _ = ancients.Ancient(hpbdb.FreezerHashTable, number)
+		}
+	}
 	if len(data) == 0 {
 		return common.Hash{}
 	}
 	return common.BytesToHash(data)
 }
 
+// getAncient retrieves an item of a block from the ancient block store backing
+// db, if any. The store only holds canonical blocks, nil is returned for any
+// other block.
+func getAncient(db DatabaseReader, kind string, hash common.Hash, number uint64) []byte {
+	ancients, ok := db.(hpbdb.AncientReader)
+	if !ok || number >= ancients.Ancients() {
+		return nil
+	}
+	if data, _ := ancients.Ancient(hpbdb.FreezerHashTable, number); common.BytesToHash(data) != hash {
+		return nil
+	}
+	data, _ := ancients.Ancient(kind, number)
+	return data
+}
+
 func StoreCadNodes(db hpbdb.Putter,blob []byte, Hash common.Hash) error {
 	return db.Put(append([]byte("codnodesnap-"), Hash[:]...), blob)
 }
@@ -156,6 +178,28 @@ func DeleteVoteResult(db DatabaseDeleter)  {
 	db.Delete(voteResultKey)
 }
 
+// GetSnapshotSyncStatus retrieves the serialized progress of a state snapshot
+// sync, if one was started.
+func GetSnapshotSyncStatus(db DatabaseReader) []byte {
+	data, _ := db.Get(snapshotSyncStatusKey)
+	return data
+}
+
+// WriteSnapshotSyncStatus stores the serialized progress of a state snapshot
+// sync, allowing an interrupted sync to resume.
+func WriteSnapshotSyncStatus(db hpbdb.Putter, status []byte) error {
+	if err := db.Put(snapshotSyncStatusKey, status); err != nil {
+		log.Crit("Failed to store snapshot sync status", "err", err)
+	}
+	return nil
+}
+
+// DeleteSnapshotSyncStatus removes the progress of a finished state snapshot
+// sync.
+func DeleteSnapshotSyncStatus(db DatabaseDeleter) {
+	db.Delete(snapshotSyncStatusKey)
+}
+
 // missingNumber is returned by GetBlockNumber if no header with the
 // given block hash has been stored in the database
 const missingNumber = uint64(0xffffffffffffffff)
@@ -208,6 +252,9 @@ func GetHeadFastBlockHash(db DatabaseReader) common.Hash {
 // if the header's not found.
 func GetHeaderRLP(db DatabaseReader, hash common.Hash, number uint64) rlp.RawValue {
 	data, _ := db.Get(headerKey(hash, number))
+	if len(data) == 0 {
+		data = getAncient(db, hpbdb.FreezerHeaderTable, hash, number)
+	}
 	return data
 }
 
@@ -229,6 +276,9 @@ func GetHeader(db DatabaseReader, hash common.Hash, number uint64) *types.Header
 // GetBodyRLP retrieves the block body (transactions and uncles) in RLP encoding.
 func GetBodyRLP(db DatabaseReader, hash common.Hash, number uint64) rlp.RawValue {
 	data, _ := db.Get(blockBodyKey(hash, number))
+	if len(data) == 0 {
+		data = getAncient(db, hpbdb.FreezerBodiesTable, hash, number)
+	}
 	return data
 }
 
@@ -240,6 +290,32 @@ func blockBodyKey(hash common.Hash, number uint64) []byte {
 	return append(append(bodyPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
 }
 
+func tdKey(hash common.Hash, number uint64) []byte {
+	return append(append(append(headerPrefix, encodeBlockNumber(number)...), hash.Bytes()...), tdSuffix...)
+}
+
+func blockReceiptsKey(hash common.Hash, number uint64) []byte {
+	return append(append(blockReceiptsPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// HasHeader checks whether the header of a block is stored in the database or
+// its ancient block store.
+func HasHeader(db hpbdb.Database, hash common.Hash, number uint64) bool {
+	if ok, _ := db.Has(headerKey(hash, number)); ok {
+		return true
+	}
+	return len(getAncient(db, hpbdb.FreezerHashTable, hash, number)) > 0
+}
+
+// HasBody checks whether the body of a block is stored in the database or its
+// ancient block store.
+func HasBody(db hpbdb.Database, hash common.Hash, number uint64) bool {
+	if ok, _ := db.Has(blockBodyKey(hash, number)); ok {
+		return true
+	}
+	return len(getAncient(db, hpbdb.FreezerHashTable, hash, number)) > 0
+}
+
 // GetBody retrieves the block body (transactons, uncles) corresponding to the
 // hash, nil if none found.
 func GetBody(db DatabaseReader, hash common.Hash, number uint64) *types.Body {
@@ -258,7 +334,7 @@ func GetBody(db DatabaseReader, hash common.Hash, number uint64) *types.Body {
 // GetTd retrieves a block's total difficulty corresponding to the hash, nil if
 // none found.
 func GetTd(db DatabaseReader, hash common.Hash, number uint64) *big.Int {
-	data, _ := db.Get(append(append(append(headerPrefix, encodeBlockNumber(number)...), hash[:]...), tdSuffix...))
+	data := GetTdRLP(db, hash, number)
 	if len(data) == 0 {
 		return nil
 	}
@@ -293,7 +369,7 @@ func GetBlock(db DatabaseReader, hash common.Hash, number uint64) *types.Block {
 // GetBlockReceipts retrieves the receipts generated by the transactions included
 // in a block given by its hash.
 func GetBlockReceipts(db DatabaseReader, hash common.Hash, number uint64) types.Receipts {
-	data, _ := db.Get(append(append(blockReceiptsPrefix, encodeBlockNumber(number)...), hash[:]...))
+	data := GetBlockReceiptsRLP(db, hash, number)
 	if len(data) == 0 {
 		return nil
 	}
@@ -309,6 +385,26 @@ func GetBlockReceipts(db DatabaseReader, hash common.Hash, number uint64) types.
 	return receipts
 }
 
+// GetBlockReceiptsRLP retrieves the receipts of a block in their raw RLP
+// database encoding.
+func GetBlockReceiptsRLP(db DatabaseReader, hash common.Hash, number uint64) rlp.RawValue {
+	data, _ := db.Get(blockReceiptsKey(hash, number))
+	if len(data) == 0 {
+		data = getAncient(db, hpbdb.FreezerReceiptTable, hash, number)
+	}
+	return data
+}
+
+// GetTdRLP retrieves the total difficulty of a block in its raw RLP database
+// encoding.
+func GetTdRLP(db DatabaseReader, hash common.Hash, number uint64) rlp.RawValue {
+	data, _ := db.Get(tdKey(hash, number))
+	if len(data) == 0 {
+		data = getAncient(db, hpbdb.FreezerDifficultyTable, hash, number)
+	}
+	return data
+}
+
 // GetTxLookupEntry retrieves the positional metadata associated with a transaction
 // hash to allow retrieving the transaction or receipt by hash.
 func GetTxLookupEntry(db DatabaseReader, hash common.Hash) (common.Hash, uint64, uint64) {
@@ -17,10 +17,16 @@
 package bc
 
 import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
 	"github.com/hpb-project/go-hpb/blockchain/storage"
 	"github.com/hpb-project/go-hpb/blockchain/types"
 	"github.com/hpb-project/go-hpb/common"
-	"testing"
+	"github.com/hpb-project/go-hpb/config"
 )
 
 
@@ -48,3 +54,141 @@ func TestVoteResultStorage(t *testing.T) {
 		t.Fatalf("Deleted vote returned: %v", entry)
 	}
 }
+
+// Tests that blocks migrated to the ancient store are still readable through the
+// accessors, both before and after reopening the store.
+func TestAncientStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ancient-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := hpbdb.NewLDBDatabase(filepath.Join(dir, "chaindata"), 16, 16)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	freezer, err := hpbdb.NewFreezer(filepath.Join(dir, "ancient"))
+	if err != nil {
+		t.Fatalf("failed to open ancient store: %v", err)
+	}
+	db.SetFreezer(freezer)
+
+	var blocks []*types.Block
+	parent := common.Hash{}
+	for i := uint64(0); i < 10; i++ {
+		block := types.NewBlockWithHeader(&types.Header{Number: new(big.Int).SetUint64(i), ParentHash: parent, Extra: []byte("ancient")})
+		WriteBlock(db, block)
+		WriteCanonicalHash(db, block.Hash(), i)
+		WriteTd(db, block.Hash(), i, big.NewInt(int64(i+1)))
+		WriteBlockReceipts(db, block.Hash(), i, types.Receipts{})
+		blocks = append(blocks, block)
+		parent = block.Hash()
+	}
+	if more, err := freezeBlocks(db, 9, 4); err != nil || more {
+		t.Fatalf("migration failed: more %v, err %v", more, err)
+	}
+	if frozen := db.Ancients(); frozen != 5 {
+		t.Fatalf("frozen block count mismatch: have %d, want 5", frozen)
+	}
+	check := func() {
+		for i, block := range blocks {
+			number := uint64(i)
+			if hash := GetCanonicalHash(db, number); hash != block.Hash() {
+				t.Errorf("block #%d: canonical hash mismatch: have %x", i, hash)
+			}
+			if header := GetHeader(db, block.Hash(), number); header == nil || header.Hash() != block.Hash() {
+				t.Errorf("block #%d: header mismatch: have %v", i, header)
+			}
+			if body := GetBody(db, block.Hash(), number); body == nil {
+				t.Errorf("block #%d: body missing", i)
+			}
+			if td := GetTd(db, block.Hash(), number); td == nil || td.Uint64() != number+1 {
+				t.Errorf("block #%d: td mismatch: have %v", i, td)
+			}
+			if !HasHeader(db, block.Hash(), number) {
+				t.Errorf("block #%d: header not reported", i)
+			}
+		}
+	}
+	check()
+	if data, _ := db.Get(headerKey(blocks[0].Hash(), 0)); len(data) != 0 {
+		t.Errorf("migrated header left in key-value store")
+	}
+	// Reopen the store and check it is still consistent
+	freezer.Close()
+	if freezer, err = hpbdb.NewFreezer(filepath.Join(dir, "ancient")); err != nil {
+		t.Fatalf("failed to reopen ancient store: %v", err)
+	}
+	db.SetFreezer(freezer)
+	check()
+
+	// Blocks of another chain must not be served from the ancient store
+	fork := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(2), Extra: []byte("fork")})
+	if header := GetHeader(db, fork.Hash(), 2); header != nil {
+		t.Errorf("non-canonical header served from the ancient store")
+	}
+	if err := freezer.TruncateAncients(3); err != nil {
+		t.Fatalf("failed to truncate ancient store: %v", err)
+	}
+	if header := GetHeader(db, blocks[3].Hash(), 3); header != nil {
+		t.Errorf("truncated header still served")
+	}
+}
+
+// Tests that the freezer refuses to move blocks still within reorg range.
+func TestFreezerMinimumDepth(t *testing.T) {
+	chain := new(BlockChain)
+	if err := chain.StartFreezer(1); err == nil {
+		t.Errorf("freezer started one block behind the head")
+	}
+	if err := chain.StartFreezer(config.MinAncientDepth - 1); err == nil {
+		t.Errorf("freezer started below the minimum depth")
+	}
+}
+
+// Tests that the database inspection puts the entries in the right categories.
+func TestInspectDatabase(t *testing.T) {
+	db, _ := hpbdb.NewMemDatabase()
+
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1), Extra: []byte("inspect")})
+	WriteBlock(db, block)
+	WriteCanonicalHash(db, block.Hash(), 1)
+	WriteTd(db, block.Hash(), 1, big.NewInt(1))
+	WriteBlockReceipts(db, block.Hash(), 1, types.Receipts{})
+	WriteHeadBlockHash(db, block.Hash())
+
+	db.Put(common.Hash{1}.Bytes(), []byte{0xc2, 0x80, 0x80}) // trie node, an RLP list
+	db.Put(common.Hash{2}.Bytes(), []byte{0x60, 0x00})       // contract code
+	db.Put(append([]byte("prometheus-"), common.Hash{3}.Bytes()...), []byte("{}"))
+	db.Put(append([]byte("codnodesnap-"), common.Hash{4}.Bytes()...), []byte("{}"))
+	db.Put([]byte("unknown"), []byte("?"))
+
+	stats, err := InspectDatabase(db)
+	if err != nil {
+		t.Fatalf("inspection failed: %v", err)
+	}
+	want := map[string]uint64{
+		"Headers":             1,
+		"Bodies":              1,
+		"Receipts":            1,
+		"Difficulties":        1,
+		"Canonical hashes":    1,
+		"Hash to number":      1,
+		"Trie nodes":          1,
+		"Contract code":       1,
+		"Signer snapshots":    1,
+		"Candidate snapshots": 1,
+		"Metadata":            1,
+		"Unaccounted":         1,
+	}
+	for _, stat := range stats.Categories {
+		if stat.Count != want[stat.Category] {
+			t.Errorf("%s: count mismatch: have %d, want %d", stat.Category, stat.Count, want[stat.Category])
+		}
+	}
+	if stats.Total.Count != 12 {
+		t.Errorf("total count mismatch: have %d, want 12", stats.Total.Count)
+	}
+}
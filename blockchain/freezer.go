@@ -0,0 +1,127 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package bc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/log"
+	"github.com/hpb-project/go-hpb/config"
+)
+
+const (
+	// freezerRecheckInterval is the time between two checks for blocks to
+	// migrate into the ancient block store.
+	freezerRecheckInterval = time.Minute
+
+	// freezerBatchLimit is the maximum number of blocks migrated in one go.
+	freezerBatchLimit = 30000
+)
+
+// StartFreezer starts migrating the canonical blocks more than depth blocks
+// behind the head from the chain database into its ancient block store. It
+// does nothing if the database has no ancient block store. As the ancient
+// store cannot be rewound, depths within the reorg range are rejected.
+func (bc *BlockChain) StartFreezer(depth uint64) error {
+	if depth < config.MinAncientDepth {
+		return fmt.Errorf("ancient store depth %d below minimum %d", depth, config.MinAncientDepth)
+	}
+	store, ok := bc.chainDb.(hpbdb.AncientStore)
+	if !ok || store.Freezer() == nil {
+		return nil
+	}
+	bc.wg.Add(1)
+	go bc.freezeLoop(store, depth)
+	return nil
+}
+
+func (bc *BlockChain) freezeLoop(db hpbdb.AncientStore, depth uint64) {
+	defer bc.wg.Done()
+
+	for {
+		wait := freezerRecheckInterval
+		if more, err := freezeBlocks(db, bc.CurrentBlock().NumberU64(), depth); err != nil {
+			log.Error("Failed to migrate ancient blocks", "err", err)
+		} else if more {
+			wait = time.Second
+		}
+		select {
+		case <-bc.quit:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// freezeBlocks migrates up to freezerBatchLimit canonical blocks more than depth
+// blocks behind head into the ancient block store, reporting whether more are
+// waiting. The blocks are only deleted from the key-value store once the store
+// is synced to disk.
+func freezeBlocks(db hpbdb.AncientStore, head, depth uint64) (bool, error) {
+	if head < depth {
+		return false, nil
+	}
+	var (
+		freezer = db.Freezer()
+		frozen  = freezer.Ancients()
+		target  = head - depth
+		limit   = target
+	)
+	if frozen >= limit {
+		return false, nil
+	}
+	if limit-frozen > freezerBatchLimit {
+		limit = frozen + freezerBatchLimit
+	}
+	start := time.Now()
+
+	hashes := make([]common.Hash, 0, limit-frozen)
+	for number := frozen; number < limit; number++ {
+		hash := GetCanonicalHash(db, number)
+		var (
+			header   = GetHeaderRLP(db, hash, number)
+			body     = GetBodyRLP(db, hash, number)
+			receipts = GetBlockReceiptsRLP(db, hash, number)
+			td       = GetTdRLP(db, hash, number)
+		)
+		if hash == (common.Hash{}) || len(header) == 0 || len(body) == 0 || len(receipts) == 0 || len(td) == 0 {
+			return false, fmt.Errorf("block #%d [%x] incomplete", number, hash)
+		}
+		if err := freezer.AppendAncient(number, hash[:], header, body, receipts, td); err != nil {
+			return false, err
+		}
+		hashes = append(hashes, hash)
+	}
+	if err := freezer.Sync(); err != nil {
+		return false, err
+	}
+	for i, hash := range hashes {
+		number := frozen + uint64(i)
+
+		DeleteCanonicalHash(db, number)
+		db.Delete(headerKey(hash, number))
+		DeleteBody(db, hash, number)
+		DeleteBlockReceipts(db, hash, number)
+		DeleteTd(db, hash, number)
+	}
+	log.Info("Migrated ancient blocks", "blocks", len(hashes), "number", limit-1, "elapsed", common.PrettyDuration(time.Since(start)))
+
+	return limit < target, nil
+}
@@ -22,6 +22,7 @@ import (
 
 	"github.com/hpb-project/go-hpb/common"
 	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/common/rlp"
 	"github.com/hpb-project/go-hpb/common/trie"
 	lru "github.com/hashicorp/golang-lru"
 )
@@ -50,6 +51,9 @@ type Database interface {
 	ContractCodeSize(addrHash, codeHash common.Hash) (int, error)
 	// CopyTrie returns an independent copy of the given trie.
 	CopyTrie(Trie) Trie
+	// NodeCache returns the in-memory trie node cache, nil if tries are
+	// written straight to disk.
+	NodeCache() *trie.NodeCache
 }
 
 // Trie is a Hpb Merkle Trie.
@@ -58,9 +62,13 @@ type Trie interface {
 	TryUpdate(key, value []byte) error
 	TryDelete(key []byte) error
 	CommitTo(trie.DatabaseWriter) (common.Hash, error)
+	CommitToCallback(trie.DatabaseWriter, trie.LeafCallback) (common.Hash, error)
 	Hash() common.Hash
 	NodeIterator(startKey []byte) trie.NodeIterator
 	GetKey([]byte) []byte
+	// Prove constructs a merkle proof for key, nil if the trie could not be
+	// resolved.
+	Prove(key []byte) []rlp.RawValue
 }
 
 // NewDatabase creates a backing store for state. The returned database is safe for
@@ -70,8 +78,16 @@ func NewDatabase(db hpbdb.Database) Database {
 	return &cachingDB{db: db, codeSizeCache: csc}
 }
 
+// NewDatabaseWithCache creates a backing store for state that reads and writes
+// tries through the given trie node cache instead of the disk database.
+func NewDatabaseWithCache(nodes *trie.NodeCache) Database {
+	csc, _ := lru.New(codeSizeCacheSize)
+	return &cachingDB{db: nodes, nodes: nodes, codeSizeCache: csc}
+}
+
 type cachingDB struct {
-	db            hpbdb.Database
+	db            trie.Database
+	nodes         *trie.NodeCache
 	mu            sync.Mutex
 	pastTries     []*trie.SecureTrie
 	codeSizeCache *lru.Cache
@@ -120,6 +136,10 @@ func (db *cachingDB) CopyTrie(t Trie) Trie {
 	}
 }
 
+func (db *cachingDB) NodeCache() *trie.NodeCache {
+	return db.nodes
+}
+
 func (db *cachingDB) ContractCode(addrHash, codeHash common.Hash) ([]byte, error) {
 	code, err := db.db.Get(codeHash[:])
 	if err == nil {
@@ -152,3 +172,11 @@ func (m cachedTrie) CommitTo(dbw trie.DatabaseWriter) (common.Hash, error) {
 	}
 	return root, err
 }
+
+func (m cachedTrie) CommitToCallback(dbw trie.DatabaseWriter, onleaf trie.LeafCallback) (common.Hash, error) {
+	root, err := m.SecureTrie.CommitToCallback(dbw, onleaf)
+	if err == nil {
+		m.db.pushTrie(m.SecureTrie)
+	}
+	return root, err
+}
@@ -0,0 +1,121 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/trie"
+)
+
+// commitToCache modifies every account of the state and commits it into the
+// node cache, referencing the new root.
+func commitToCache(t *testing.T, sdb Database, root common.Hash, tweak byte) common.Hash {
+	state, err := New(root, sdb)
+	if err != nil {
+		t.Fatalf("failed to open state %x: %v", root, err)
+	}
+	for i := byte(0); i < 64; i++ {
+		addr := common.BytesToAddress([]byte{i})
+		state.SetBalance(addr, big.NewInt(int64(i)+int64(tweak)))
+		state.SetState(addr, common.Hash{i, tweak}, common.Hash{i, i, tweak})
+		if i%4 == 0 {
+			state.SetCode(addr, []byte{i, tweak})
+		}
+	}
+	nodes := sdb.NodeCache()
+	root, err = state.CommitTo(nodes, true)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	nodes.Reference(root, common.Hash{})
+	return root
+}
+
+// checkState verifies that every account and storage slot written by
+// commitToCache with the given tweak is retrievable.
+func checkState(t *testing.T, sdb Database, root common.Hash, tweak byte) {
+	state, err := New(root, sdb)
+	if err != nil {
+		t.Fatalf("failed to open state %x: %v", root, err)
+	}
+	for i := byte(0); i < 64; i++ {
+		addr := common.BytesToAddress([]byte{i})
+		if balance := state.GetBalance(addr); balance.Cmp(big.NewInt(int64(i)+int64(tweak))) != 0 {
+			t.Errorf("account %x: balance mismatch: have %v", addr, balance)
+		}
+		if value := state.GetState(addr, common.Hash{i, tweak}); value != (common.Hash{i, i, tweak}) {
+			t.Errorf("account %x: storage mismatch: have %x", addr, value)
+		}
+		if i%4 == 0 && !bytes.Equal(state.GetCode(addr), []byte{i, tweak}) {
+			t.Errorf("account %x: code mismatch: have %x", addr, state.GetCode(addr))
+		}
+	}
+	if err := state.Error(); err != nil {
+		t.Errorf("state %x: %v", root, err)
+	}
+}
+
+// Tests that dereferencing a state from the node cache keeps the ones built on
+// top of it intact and that no node reaches the disk until committed.
+func TestNodeCacheGarbageCollection(t *testing.T) {
+	diskdb, _ := hpbdb.NewMemDatabase()
+	sdb := NewDatabaseWithCache(trie.NewNodeCache(diskdb))
+
+	first := commitToCache(t, sdb, common.Hash{}, 1)
+	second := commitToCache(t, sdb, first, 2)
+	if len(diskdb.Keys()) != 0 {
+		t.Fatalf("cached state leaked to disk: %d keys", len(diskdb.Keys()))
+	}
+	sdb.NodeCache().Dereference(first)
+	checkState(t, sdb, second, 2)
+
+	if err := sdb.NodeCache().Commit(second); err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if size := sdb.NodeCache().Size(); size != 0 {
+		t.Errorf("nodes left in the cache after commit: %v", size)
+	}
+	checkState(t, NewDatabase(diskdb), second, 2)
+	if _, err := New(first, NewDatabase(diskdb)); err == nil {
+		t.Errorf("dereferenced state reached the disk")
+	}
+}
+
+// Tests that dereferencing every state empties the node cache.
+func TestNodeCacheDereferenceAll(t *testing.T) {
+	diskdb, _ := hpbdb.NewMemDatabase()
+	sdb := NewDatabaseWithCache(trie.NewNodeCache(diskdb))
+
+	roots := []common.Hash{commitToCache(t, sdb, common.Hash{}, 1)}
+	for tweak := byte(2); tweak < 5; tweak++ {
+		roots = append(roots, commitToCache(t, sdb, roots[len(roots)-1], tweak))
+	}
+	for i, root := range roots {
+		sdb.NodeCache().Dereference(root)
+		if i < len(roots)-1 {
+			checkState(t, sdb, roots[len(roots)-1], byte(len(roots)))
+		}
+	}
+	if size := sdb.NodeCache().Size(); size != 0 {
+		t.Errorf("nodes left in the cache: %v", size)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+// bloomHashes is the number of bit positions set per key.
+const bloomHashes = 4
+
+var (
+	bloomMagic = []byte("hpb-state-bloom1")
+
+	errBloomCorrupt = errors.New("corrupt state bloom file")
+	errBloomSize    = errors.New("state bloom size must be at least 1 MB")
+)
+
+// stateBloom is a bloom filter over the database keys of trie nodes and code.
+// The keys are hashes themselves, so the bit positions are taken straight from
+// the key instead of hashing it again.
+type stateBloom struct {
+	bits []uint64
+}
+
+// newStateBloom creates a bloom filter of the given size in megabytes.
+func newStateBloom(size uint64) (*stateBloom, error) {
+	if size == 0 {
+		return nil, errBloomSize
+	}
+	return &stateBloom{bits: make([]uint64, size*1024*1024/8)}, nil
+}
+
+func (b *stateBloom) positions(key []byte) [bloomHashes]uint64 {
+	var pos [bloomHashes]uint64
+	for i := range pos {
+		pos[i] = binary.BigEndian.Uint64(key[i*8:]) % uint64(len(b.bits)*64)
+	}
+	return pos
+}
+
+// add marks a 32 byte key as present.
+func (b *stateBloom) add(key []byte) {
+	for _, pos := range b.positions(key) {
+		b.bits[pos/64] |= 1 << (pos % 64)
+	}
+}
+
+// contains reports whether a 32 byte key may have been added.
+func (b *stateBloom) contains(key []byte) bool {
+	for _, pos := range b.positions(key) {
+		if b.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// commit atomically writes the filter to path, so that a file present at path
+// always holds a complete filter.
+func (b *stateBloom) commit(path string) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	w.Write(bloomMagic)
+	binary.Write(w, binary.BigEndian, uint64(len(b.bits)))
+	binary.Write(w, binary.BigEndian, b.bits)
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// loadStateBloom reads a filter written by commit.
+func loadStateBloom(path string) (*stateBloom, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	magic := make([]byte, len(bloomMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != string(bloomMagic) {
+		return nil, errBloomCorrupt
+	}
+	var words uint64
+	if err := binary.Read(r, binary.BigEndian, &words); err != nil || words == 0 {
+		return nil, errBloomCorrupt
+	}
+	bloom := &stateBloom{bits: make([]uint64, words)}
+	if err := binary.Read(r, binary.BigEndian, bloom.bits); err != nil {
+		return nil, errBloomCorrupt
+	}
+	return bloom, nil
+}
@@ -0,0 +1,226 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+// Package pruner implements offline deletion of the state trie nodes that are
+// no longer reachable from the recent states of the chain.
+package pruner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hpb-project/go-hpb/blockchain/state"
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/crypto"
+	"github.com/hpb-project/go-hpb/common/log"
+	"github.com/hpb-project/go-hpb/common/rlp"
+	"github.com/hpb-project/go-hpb/common/trie"
+)
+
+// BloomFileName is the name of the file, next to the chain database, holding
+// the filter of reachable nodes while a pruning is in progress.
+const BloomFileName = "statebloom.bin"
+
+var (
+	// emptyRoot is the known root hash of an empty trie.
+	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+	// emptyCode is the known hash of the empty EVM bytecode.
+	emptyCode = crypto.Keccak256(nil)
+
+	errNoRoots = errors.New("no state roots to keep")
+)
+
+// Pruner deletes every trie node and contract code from the database that is
+// not reachable from a set of state roots.
+//
+// Pruning runs in two phases. The reachable nodes are first marked in a bloom
+// filter, which is then persisted. The database is then swept, deleting every
+// node missing from the filter. An interrupted marking phase is simply started
+// over, an interrupted sweep resumes from the persisted filter. The node must
+// not be run before an interrupted sweep is finished.
+type Pruner struct {
+	db        hpbdb.Database
+	bloomPath string
+	bloomSize uint64 // Size of the bloom filter in megabytes
+}
+
+// NewPruner creates a pruner for the given database, keeping its bloom filter
+// at bloomPath.
+func NewPruner(db hpbdb.Database, bloomPath string, bloomSize uint64) *Pruner {
+	return &Pruner{db: db, bloomPath: bloomPath, bloomSize: bloomSize}
+}
+
+// Interrupted reports whether a previous pruning left a sweep to finish.
+func Interrupted(bloomPath string) bool {
+	return common.FileExist(bloomPath)
+}
+
+// Prune keeps the states of the given roots and deletes every other trie node
+// and contract code. The first root is walked in full; for the others, the
+// subtries already marked are skipped. A false positive of the filter may thus
+// leave an older state incomplete, but never the first one.
+//
+// If a previous pruning was interrupted while sweeping, the roots are ignored
+// and that pruning is finished instead.
+func (p *Pruner) Prune(roots []common.Hash) error {
+	if Interrupted(p.bloomPath) {
+		bloom, err := loadStateBloom(p.bloomPath)
+		if err != nil {
+			return err
+		}
+		log.Info("Resuming interrupted state pruning", "bloom", p.bloomPath)
+		return p.sweep(bloom)
+	}
+	if len(roots) == 0 {
+		return errNoRoots
+	}
+	bloom, err := newStateBloom(p.bloomSize)
+	if err != nil {
+		return err
+	}
+	for i, root := range roots {
+		start := time.Now()
+		nodes, err := p.markState(bloom, root, i > 0)
+		if err != nil {
+			return fmt.Errorf("state %x: %v", root, err)
+		}
+		log.Info("Marked reachable state", "root", root, "nodes", nodes, "elapsed", common.PrettyDuration(time.Since(start)))
+	}
+	if err := bloom.commit(p.bloomPath); err != nil {
+		return err
+	}
+	return p.sweep(bloom)
+}
+
+// markState adds the nodes and code reachable from a state root to the filter,
+// returning the number of nodes marked.
+func (p *Pruner) markState(bloom *stateBloom, root common.Hash, skip bool) (int, error) {
+	var (
+		nodes  int
+		logged = time.Now()
+	)
+	onAccount := func(leaf []byte) error {
+		var account state.Account
+		if err := rlp.DecodeBytes(leaf, &account); err != nil {
+			return err
+		}
+		if !bytes.Equal(account.CodeHash, emptyCode) {
+			bloom.add(account.CodeHash)
+		}
+		if account.Root == emptyRoot {
+			return nil
+		}
+		marked, err := p.markTrie(bloom, account.Root, skip, nil)
+		nodes += marked
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Marking reachable state", "root", root, "nodes", nodes)
+			logged = time.Now()
+		}
+		return err
+	}
+	marked, err := p.markTrie(bloom, root, skip, onAccount)
+	return nodes + marked, err
+}
+
+// markTrie adds the nodes of a trie to the filter, calling onleaf for every
+// value reached. Subtries already in the filter are skipped if skip is set.
+func (p *Pruner) markTrie(bloom *stateBloom, root common.Hash, skip bool, onleaf func([]byte) error) (int, error) {
+	if skip && bloom.contains(root[:]) {
+		return 0, nil
+	}
+	tr, err := trie.New(root, p.db)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		nodes   int
+		descend = true
+	)
+	it := tr.NodeIterator(nil)
+	for it.Next(descend) {
+		descend = true
+		if hash := it.Hash(); hash != (common.Hash{}) {
+			if skip && bloom.contains(hash[:]) {
+				descend = false
+				continue
+			}
+			bloom.add(hash[:])
+			nodes++
+		}
+		if it.Leaf() && onleaf != nil {
+			if err := onleaf(it.LeafBlob()); err != nil {
+				return nodes, err
+			}
+		}
+	}
+	return nodes, it.Error()
+}
+
+// sweep deletes every node and code missing from the filter, then compacts the
+// database and removes the filter.
+func (p *Pruner) sweep(bloom *stateBloom) error {
+	var (
+		start   = time.Now()
+		logged  = time.Now()
+		deleted int
+		size    common.StorageSize
+		batch   = p.db.NewBatch()
+	)
+	it := p.db.NewIteratorWithPrefix(nil)
+	for it.Next() {
+		key := it.Key()
+		if len(key) != common.HashLength || bloom.contains(key) {
+			continue
+		}
+		batch.Delete(key)
+		deleted++
+		size += common.StorageSize(len(key) + len(it.Value()))
+
+		if batch.ValueSize() >= hpbdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				it.Release()
+				return err
+			}
+			batch.Reset()
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Pruning state data", "deleted", deleted, "size", size, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	log.Info("Pruned state data", "deleted", deleted, "size", size, "elapsed", common.PrettyDuration(time.Since(start)))
+
+	log.Info("Compacting database")
+	cstart := time.Now()
+	if err := p.db.Compact(nil, nil); err != nil {
+		return err
+	}
+	log.Info("Compacted database", "elapsed", common.PrettyDuration(time.Since(cstart)))
+
+	return os.Remove(p.bloomPath)
+}
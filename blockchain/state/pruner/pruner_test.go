@@ -0,0 +1,153 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hpb-project/go-hpb/blockchain/state"
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/common"
+)
+
+func newTestDatabase(t *testing.T) (*hpbdb.LDBDatabase, string) {
+	dir, err := ioutil.TempDir("", "pruner-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	db, err := hpbdb.NewLDBDatabase(filepath.Join(dir, "chaindata"), 16, 16)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	return db, dir
+}
+
+// writeState modifies every account of the state at root and commits it.
+func writeState(t *testing.T, db hpbdb.Database, root common.Hash, tweak byte) common.Hash {
+	statedb, err := state.New(root, state.NewDatabase(db))
+	if err != nil {
+		t.Fatalf("failed to open state: %v", err)
+	}
+	for i := byte(0); i < 32; i++ {
+		addr := common.BytesToAddress([]byte{i})
+		statedb.SetBalance(addr, big.NewInt(int64(i)+int64(tweak)))
+		statedb.SetState(addr, common.Hash{i}, common.Hash{i, tweak})
+		statedb.SetCode(addr, []byte{i, tweak})
+	}
+	root, err = statedb.CommitTo(db, true)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	return root
+}
+
+func checkState(t *testing.T, db hpbdb.Database, root common.Hash, tweak byte) {
+	statedb, err := state.New(root, state.NewDatabase(db))
+	if err != nil {
+		t.Fatalf("failed to open state %x: %v", root, err)
+	}
+	for i := byte(0); i < 32; i++ {
+		addr := common.BytesToAddress([]byte{i})
+		if balance := statedb.GetBalance(addr); balance.Cmp(big.NewInt(int64(i)+int64(tweak))) != 0 {
+			t.Errorf("account %x: balance mismatch: have %v", addr, balance)
+		}
+		if value := statedb.GetState(addr, common.Hash{i}); value != (common.Hash{i, tweak}) {
+			t.Errorf("account %x: storage mismatch: have %x", addr, value)
+		}
+		if code := statedb.GetCode(addr); !bytes.Equal(code, []byte{i, tweak}) {
+			t.Errorf("account %x: code mismatch: have %x", addr, code)
+		}
+	}
+	if err := statedb.Error(); err != nil {
+		t.Errorf("state %x: %v", root, err)
+	}
+}
+
+// Tests that pruning keeps the requested states and deletes the stale ones.
+func TestPruneState(t *testing.T) {
+	db, dir := newTestDatabase(t)
+	defer os.RemoveAll(dir)
+	defer db.Close()
+
+	stale := writeState(t, db, common.Hash{}, 1)
+	kept := writeState(t, db, stale, 2)
+	head := writeState(t, db, kept, 3)
+
+	bloomPath := filepath.Join(dir, BloomFileName)
+	if err := NewPruner(db, bloomPath, 1).Prune([]common.Hash{head, kept}); err != nil {
+		t.Fatalf("pruning failed: %v", err)
+	}
+	checkState(t, db, head, 3)
+	checkState(t, db, kept, 2)
+	if ok, _ := db.Has(stale[:]); ok {
+		t.Errorf("stale state root not pruned")
+	}
+	if Interrupted(bloomPath) {
+		t.Errorf("bloom filter left behind")
+	}
+}
+
+// Tests that an interrupted sweep is finished from the persisted filter,
+// regardless of the roots passed.
+func TestPruneResume(t *testing.T) {
+	db, dir := newTestDatabase(t)
+	defer os.RemoveAll(dir)
+	defer db.Close()
+
+	stale := writeState(t, db, common.Hash{}, 1)
+	head := writeState(t, db, stale, 2)
+
+	// Mark the head state and persist the filter as an interrupted run would
+	bloomPath := filepath.Join(dir, BloomFileName)
+	pruner := NewPruner(db, bloomPath, 1)
+
+	bloom, err := newStateBloom(1)
+	if err != nil {
+		t.Fatalf("failed to create filter: %v", err)
+	}
+	if _, err := pruner.markState(bloom, head, false); err != nil {
+		t.Fatalf("marking failed: %v", err)
+	}
+	if err := bloom.commit(bloomPath); err != nil {
+		t.Fatalf("failed to persist filter: %v", err)
+	}
+	if err := pruner.Prune(nil); err != nil {
+		t.Fatalf("resumed pruning failed: %v", err)
+	}
+	checkState(t, db, head, 2)
+	if ok, _ := db.Has(stale[:]); ok {
+		t.Errorf("stale state root not pruned")
+	}
+}
+
+// Tests that an empty bloom filter is rejected instead of failing on first use.
+func TestPruneBloomSize(t *testing.T) {
+	db, dir := newTestDatabase(t)
+	defer os.RemoveAll(dir)
+	defer db.Close()
+
+	head := writeState(t, db, common.Hash{}, 1)
+	if err := NewPruner(db, filepath.Join(dir, BloomFileName), 0).Prune([]common.Hash{head}); err != errBloomSize {
+		t.Fatalf("pruning with an empty filter: have %v, want %v", err, errBloomSize)
+	}
+	checkState(t, db, head, 1)
+}
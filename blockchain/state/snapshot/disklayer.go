@@ -0,0 +1,205 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/log"
+	"github.com/hpb-project/go-hpb/common/trie"
+)
+
+// diskLayer is the flat state of a block persisted in the database. While it
+// is being generated, only the accounts up to the generation marker are
+// served.
+type diskLayer struct {
+	diskdb hpbdb.Database
+	triedb trie.Database
+	root   common.Hash
+	stale  bool
+
+	genMarker []byte             // Last account hash generated, nil if the layer is complete
+	genAbort  chan chan struct{} // Channel to stop the generation, nil if it isn't running
+
+	lock sync.RWMutex
+}
+
+// loadDiskLayer opens the disk layer persisted in the database, resuming its
+// generation if it was interrupted.
+func loadDiskLayer(diskdb hpbdb.Database, triedb trie.Database, root common.Hash) (*diskLayer, error) {
+	stored, _ := diskdb.Get(SnapshotRootKey)
+	if len(stored) == 0 {
+		return nil, errors.New("no snapshot in the database")
+	}
+	if common.BytesToHash(stored) != root {
+		return nil, fmt.Errorf("snapshot of state %x, want %x", stored, root)
+	}
+	status := readGeneratorStatus(diskdb)
+	if status == nil {
+		return nil, errors.New("missing generation status")
+	}
+	base := &diskLayer{diskdb: diskdb, triedb: triedb, root: root}
+	if !status.Done {
+		base.genMarker = append([]byte{}, status.Marker...)
+		log.Info("Resuming state snapshot generation", "root", root, "at", common.BytesToHash(base.genMarker))
+		base.startGeneration()
+	}
+	return base, nil
+}
+
+// Root implements Snapshot.
+func (dl *diskLayer) Root() common.Hash {
+	return dl.root
+}
+
+// Stale implements snapshot.
+func (dl *diskLayer) Stale() bool {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	return dl.stale
+}
+
+func (dl *diskLayer) markStale() {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	dl.stale = true
+}
+
+// covered returns whether an account is already generated. The caller must
+// hold the lock or have stopped the generation.
+func (dl *diskLayer) covered(hash common.Hash) bool {
+	return dl.genMarker == nil || bytes.Compare(hash[:], dl.genMarker) <= 0
+}
+
+// AccountRLP implements Snapshot.
+func (dl *diskLayer) AccountRLP(hash common.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.stale {
+		return nil, ErrSnapshotStale
+	}
+	if !dl.covered(hash) {
+		return nil, ErrNotCoveredYet
+	}
+	blob, _ := dl.diskdb.Get(accountKey(hash))
+	return blob, nil
+}
+
+// Storage implements Snapshot.
+func (dl *diskLayer) Storage(accountHash, storageHash common.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.stale {
+		return nil, ErrSnapshotStale
+	}
+	if !dl.covered(accountHash) {
+		return nil, ErrNotCoveredYet
+	}
+	blob, _ := dl.diskdb.Get(storageKey(accountHash, storageHash))
+	return blob, nil
+}
+
+// diffToDisk merges a diff layer into the disk layer beneath it, returning the
+// new disk layer. The changes of the accounts not generated yet are skipped,
+// the generation picks them up from the trie of the new root.
+func diffToDisk(base *diskLayer, diff *diffLayer) *diskLayer {
+	base.stopGeneration()
+	base.markStale()
+	diff.markStale()
+
+	// Drop the persisted root first, a crash half way through leaves no
+	// snapshot rather than a corrupt one
+	if err := base.diskdb.Delete(SnapshotRootKey); err != nil {
+		log.Crit("Failed to remove snapshot root", "err", err)
+	}
+	batch := base.diskdb.NewBatch()
+	flush := func() {
+		if batch.ValueSize() >= hpbdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				log.Crit("Failed to write state snapshot", "err", err)
+			}
+			batch.Reset()
+		}
+	}
+	for hash := range diff.destructs {
+		if base.covered(hash) {
+			batch.Delete(accountKey(hash))
+			wipeStorage(base.diskdb, batch, hash)
+			flush()
+		}
+	}
+	for hash, data := range diff.accounts {
+		if base.covered(hash) {
+			if len(data) == 0 {
+				batch.Delete(accountKey(hash))
+			} else {
+				batch.Put(accountKey(hash), data)
+			}
+			flush()
+		}
+	}
+	for accountHash, slots := range diff.storage {
+		if !base.covered(accountHash) {
+			continue
+		}
+		for storageHash, data := range slots {
+			if len(data) == 0 {
+				batch.Delete(storageKey(accountHash, storageHash))
+			} else {
+				batch.Put(storageKey(accountHash, storageHash), data)
+			}
+		}
+		flush()
+	}
+	batch.Put(SnapshotRootKey, diff.root[:])
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to write state snapshot", "err", err)
+	}
+	res := &diskLayer{
+		diskdb:    base.diskdb,
+		triedb:    base.triedb,
+		root:      diff.root,
+		genMarker: base.genMarker,
+	}
+	if res.genMarker != nil {
+		res.startGeneration()
+	}
+	return res
+}
+
+// wipeStorage deletes the storage slots of an account from the snapshot.
+func wipeStorage(db hpbdb.Database, batch hpbdb.Batch, accountHash common.Hash) {
+	prefix := append(append([]byte{}, SnapshotStoragePrefix...), accountHash[:]...)
+
+	it := db.NewIteratorWithPrefix(prefix)
+	defer it.Release()
+
+	for it.Next() {
+		if len(it.Key()) == len(prefix)+common.HashLength {
+			batch.Delete(common.CopyBytes(it.Key()))
+		}
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"math/big"
+	"time"
+
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/log"
+	"github.com/hpb-project/go-hpb/common/rlp"
+	"github.com/hpb-project/go-hpb/common/trie"
+)
+
+// emptyRoot is the known root hash of an empty trie.
+var emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+// account mirrors state.Account, which can't be imported from here.
+type account struct {
+	Nonce    uint64
+	Balance  *big.Int
+	Root     common.Hash
+	CodeHash []byte
+}
+
+// generatorStatus is the persisted progress of the disk layer generation.
+type generatorStatus struct {
+	Done   bool
+	Marker []byte
+}
+
+func readGeneratorStatus(db hpbdb.Database) *generatorStatus {
+	data, _ := db.Get(SnapshotGeneratorKey)
+	if len(data) == 0 {
+		return nil
+	}
+	status := new(generatorStatus)
+	if err := rlp.DecodeBytes(data, status); err != nil {
+		log.Error("Invalid snapshot generation status", "err", err)
+		return nil
+	}
+	return status
+}
+
+func writeGeneratorStatus(db hpbdb.Putter, marker []byte) {
+	data, _ := rlp.EncodeToBytes(&generatorStatus{Done: marker == nil, Marker: marker})
+	if err := db.Put(SnapshotGeneratorKey, data); err != nil {
+		log.Crit("Failed to store snapshot generation status", "err", err)
+	}
+}
+
+// generateSnapshot creates an empty disk layer of root and starts generating
+// it from the trie. Leftovers of an earlier snapshot are cleaned up on the way.
+func generateSnapshot(diskdb hpbdb.Database, triedb trie.Database, root common.Hash) *diskLayer {
+	batch := diskdb.NewBatch()
+	batch.Put(SnapshotRootKey, root[:])
+	writeGeneratorStatus(batch, []byte{})
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to start snapshot generation", "err", err)
+	}
+	base := &diskLayer{
+		diskdb:    diskdb,
+		triedb:    triedb,
+		root:      root,
+		genMarker: []byte{},
+	}
+	base.startGeneration()
+	return base
+}
+
+func (dl *diskLayer) startGeneration() {
+	dl.genAbort = make(chan chan struct{})
+	go dl.generate(dl.genAbort)
+}
+
+// stopGeneration stops the generation, if any, waiting for its progress to be
+// persisted.
+func (dl *diskLayer) stopGeneration() {
+	if dl.genAbort == nil {
+		return
+	}
+	done := make(chan struct{})
+	dl.genAbort <- done
+	<-done
+	dl.genAbort = nil
+}
+
+// generate iterates the account trie of the layer from the generation marker
+// on, writing every account and its storage slots into the database. Once done
+// or failed, it waits for the abort request.
+func (dl *diskLayer) generate(abort chan chan struct{}) {
+	var (
+		marker   = dl.genMarker
+		batch    = dl.diskdb.NewBatch()
+		start    = time.Now()
+		logged   = time.Now()
+		accounts int
+		slots    int
+	)
+	// flush writes the batch, moving the marker to the last account completed
+	flush := func(last []byte) {
+		writeGeneratorStatus(batch, last)
+
+		dl.lock.Lock()
+		defer dl.lock.Unlock()
+
+		if err := batch.Write(); err != nil {
+			log.Crit("Failed to write state snapshot", "err", err)
+		}
+		batch.Reset()
+		dl.genMarker = last
+	}
+	// fail reports a generation that can't go on and waits to be stopped
+	fail := func(err error) {
+		log.Warn("State snapshot generation failed", "root", dl.root, "err", err)
+		done := <-abort
+		done <- struct{}{}
+	}
+	tr, err := trie.New(dl.root, dl.triedb)
+	if err != nil {
+		fail(err)
+		return
+	}
+	it := trie.NewIterator(tr.NodeIterator(marker))
+	last := marker
+	for it.Next() {
+		if len(marker) > 0 && bytes.Equal(it.Key, marker) {
+			continue
+		}
+		select {
+		case done := <-abort:
+			flush(last)
+			done <- struct{}{}
+			return
+		default:
+		}
+		accountHash := common.BytesToHash(it.Key)
+
+		// Drop the accounts of an earlier generation missing from the trie
+		wipeAccounts(dl.diskdb, batch, last, accountHash[:])
+
+		var acc account
+		if err := rlp.DecodeBytes(it.Value, &acc); err != nil {
+			fail(err)
+			return
+		}
+		batch.Put(accountKey(accountHash), common.CopyBytes(it.Value))
+		wipeStorage(dl.diskdb, batch, accountHash)
+
+		if acc.Root != emptyRoot {
+			stTrie, err := trie.New(acc.Root, dl.triedb)
+			if err != nil {
+				fail(err)
+				return
+			}
+			sit := trie.NewIterator(stTrie.NodeIterator(nil))
+			for sit.Next() {
+				batch.Put(storageKey(accountHash, common.BytesToHash(sit.Key)), common.CopyBytes(sit.Value))
+				slots++
+
+				// Large contracts are written out in parts, they are not
+				// covered until the marker moves past them
+				if batch.ValueSize() >= hpbdb.IdealBatchSize {
+					if err := batch.Write(); err != nil {
+						log.Crit("Failed to write state snapshot", "err", err)
+					}
+					batch.Reset()
+				}
+			}
+			if sit.Err != nil {
+				fail(sit.Err)
+				return
+			}
+		}
+		accounts++
+		last = accountHash.Bytes()
+
+		if batch.ValueSize() >= hpbdb.IdealBatchSize {
+			flush(last)
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Generating state snapshot", "root", dl.root, "at", accountHash, "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if it.Err != nil {
+		fail(it.Err)
+		return
+	}
+	wipeAccounts(dl.diskdb, batch, last, nil)
+	flush(nil)
+	log.Info("Generated state snapshot", "root", dl.root, "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+
+	done := <-abort
+	done <- struct{}{}
+}
+
+// wipeAccounts deletes the accounts and their storage from the snapshot whose
+// hashes lie after from and before to. A nil to deletes everything after from.
+func wipeAccounts(db hpbdb.Database, batch hpbdb.Batch, from, to []byte) {
+	start := append(append([]byte{}, SnapshotAccountPrefix...), from...)
+	if len(from) > 0 {
+		start = append(start, 0x00)
+	}
+	var limit []byte
+	if to != nil {
+		limit = append(append([]byte{}, SnapshotAccountPrefix...), to...)
+	} else {
+		limit = []byte{SnapshotAccountPrefix[0] + 1}
+	}
+	it := db.NewIteratorWithRange(start, limit)
+	defer it.Release()
+
+	for it.Next() {
+		if key := it.Key(); len(key) == len(SnapshotAccountPrefix)+common.HashLength {
+			batch.Delete(common.CopyBytes(key))
+			wipeStorage(db, batch, common.BytesToHash(key[len(SnapshotAccountPrefix):]))
+		}
+	}
+}
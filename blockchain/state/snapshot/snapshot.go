@@ -0,0 +1,279 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+// Package snapshot implements a flat key-value view of the state of recent
+// blocks, serving account and storage reads without walking the state trie.
+//
+// The snapshot of the state of a block is a stack of layers: a disk layer
+// holding the flat state of an older block in the database, and in-memory diff
+// layers on top of it, one for each block after it. Diff layers beyond the
+// configured depth are merged into the disk layer as new blocks are committed.
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/log"
+	"github.com/hpb-project/go-hpb/common/trie"
+)
+
+var (
+	SnapshotAccountPrefix = []byte("a") // SnapshotAccountPrefix + account hash -> account trie value
+	SnapshotStoragePrefix = []byte("o") // SnapshotStoragePrefix + account hash + storage hash -> storage trie value
+
+	SnapshotRootKey      = []byte("SnapshotRoot")      // SnapshotRootKey -> state root of the disk layer
+	SnapshotGeneratorKey = []byte("SnapshotGenerator") // SnapshotGeneratorKey -> generation progress of the disk layer
+)
+
+var (
+	// ErrSnapshotStale is returned from data accessors if the layer was merged
+	// into the disk layer or dropped as part of a fork.
+	ErrSnapshotStale = errors.New("snapshot stale")
+
+	// ErrNotCoveredYet is returned from data accessors if the key is beyond
+	// the progress of the snapshot generation.
+	ErrNotCoveredYet = errors.New("not covered yet")
+
+	// ErrNotConstructed is returned if the disk layer is still being generated.
+	ErrNotConstructed = errors.New("snapshot is not constructed")
+)
+
+// Snapshot is the flat state of a block.
+type Snapshot interface {
+	// Root returns the state root the snapshot belongs to.
+	Root() common.Hash
+
+	// AccountRLP returns the RLP encoded account of an account hash, nil if
+	// the account doesn't exist.
+	AccountRLP(hash common.Hash) ([]byte, error)
+
+	// Storage returns the RLP encoded value of a storage slot hash of an
+	// account hash, nil if the slot is empty.
+	Storage(accountHash, storageHash common.Hash) ([]byte, error)
+}
+
+// snapshot is a layer of the snapshot tree.
+type snapshot interface {
+	Snapshot
+
+	// Stale returns whether the layer was merged into the disk layer or
+	// dropped as part of a fork.
+	Stale() bool
+}
+
+func accountKey(hash common.Hash) []byte {
+	return append(append([]byte{}, SnapshotAccountPrefix...), hash[:]...)
+}
+
+func storageKey(accountHash, storageHash common.Hash) []byte {
+	key := append(append([]byte{}, SnapshotStoragePrefix...), accountHash[:]...)
+	return append(key, storageHash[:]...)
+}
+
+// Tree is the set of snapshot layers of the recent blocks, keyed by the state
+// root of the blocks. It is safe for concurrent use.
+type Tree struct {
+	diskdb hpbdb.Database // Database holding the disk layer
+	triedb trie.Database  // Database the tries are read from during generation
+
+	layers map[common.Hash]snapshot
+	lock   sync.RWMutex
+}
+
+// New opens the snapshot tree of the state root of the head block. If the disk
+// layer doesn't match the head, it is rebuilt in the background from the trie,
+// with reads falling back to the trie until it is done.
+func New(diskdb hpbdb.Database, triedb trie.Database, root common.Hash) *Tree {
+	t := &Tree{
+		diskdb: diskdb,
+		triedb: triedb,
+		layers: make(map[common.Hash]snapshot),
+	}
+	base, err := loadDiskLayer(diskdb, triedb, root)
+	if err != nil {
+		log.Warn("Rebuilding state snapshot", "root", root, "reason", err)
+		t.Rebuild(root)
+		return t
+	}
+	t.layers[root] = base
+	return t
+}
+
+// Snapshot returns the snapshot of a state root, nil if there is none.
+func (t *Tree) Snapshot(root common.Hash) Snapshot {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if layer, ok := t.layers[root]; ok {
+		return layer
+	}
+	return nil
+}
+
+// Update adds the diff layer of a new block on top of the snapshot of its
+// parent. The maps are owned by the snapshot afterwards.
+func (t *Tree) Update(root, parentRoot common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) error {
+	// Blocks not changing the state have no layer of their own
+	if root == parentRoot {
+		return nil
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if _, ok := t.layers[root]; ok {
+		return nil
+	}
+	parent := t.layers[parentRoot]
+	if parent == nil {
+		return fmt.Errorf("parent [%#x] snapshot missing", parentRoot)
+	}
+	t.layers[root] = newDiffLayer(parent, root, destructs, accounts, storage)
+	return nil
+}
+
+// Cap merges the diff layers below the given number of layers beneath the
+// snapshot of root into the disk layer, dropping the layers on forks that no
+// longer lead to it. A zero number merges every layer including root's.
+func (t *Tree) Cap(root common.Hash, layers int) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	snap := t.layers[root]
+	if snap == nil {
+		return fmt.Errorf("snapshot [%#x] missing", root)
+	}
+	diff, ok := snap.(*diffLayer)
+	if !ok {
+		return nil
+	}
+	// Find the bottom-most layer to keep, everything beneath goes to disk
+	var (
+		keep   *diffLayer
+		bottom = diff
+	)
+	if layers > 0 {
+		keep = diff
+		for i := 0; i < layers; i++ {
+			parent, ok := keep.parent.(*diffLayer)
+			if !ok {
+				return nil
+			}
+			if i == layers-1 {
+				bottom = parent
+				break
+			}
+			keep = parent
+		}
+	}
+	// Merge the layers bottom-up into the disk layer
+	var merge []*diffLayer
+	for layer := bottom; ; {
+		merge = append(merge, layer)
+		parent, ok := layer.parent.(*diffLayer)
+		if !ok {
+			break
+		}
+		layer = parent
+	}
+	base := merge[len(merge)-1].parent.(*diskLayer)
+	for i := len(merge) - 1; i >= 0; i-- {
+		base = diffToDisk(base, merge[i])
+	}
+	if keep != nil {
+		keep.lock.Lock()
+		keep.parent = base
+		keep.lock.Unlock()
+	}
+	// Keep only the layers still built on the new disk layer
+	layerSet := map[common.Hash]snapshot{base.root: base}
+	for root, layer := range t.layers {
+		if reachesDisk(layer, base) {
+			layerSet[root] = layer
+		} else if diff, ok := layer.(*diffLayer); ok {
+			diff.markStale()
+		}
+	}
+	t.layers = layerSet
+	return nil
+}
+
+// reachesDisk returns whether a layer is built on the given disk layer.
+func reachesDisk(layer snapshot, base *diskLayer) bool {
+	for {
+		switch l := layer.(type) {
+		case *diskLayer:
+			return l == base
+		case *diffLayer:
+			if l.Stale() {
+				return false
+			}
+			l.lock.RLock()
+			layer = l.parent
+			l.lock.RUnlock()
+		}
+	}
+}
+
+// Rebuild drops every layer and regenerates the disk layer in the background
+// from the trie of root.
+func (t *Tree) Rebuild(root common.Hash) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, layer := range t.layers {
+		switch layer := layer.(type) {
+		case *diskLayer:
+			layer.stopGeneration()
+			layer.markStale()
+		case *diffLayer:
+			layer.markStale()
+		}
+	}
+	log.Info("Rebuilding state snapshot", "root", root)
+	t.layers = map[common.Hash]snapshot{root: generateSnapshot(t.diskdb, t.triedb, root)}
+}
+
+// Release stops the background generation, persisting its progress.
+func (t *Tree) Release() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, layer := range t.layers {
+		if base, ok := layer.(*diskLayer); ok {
+			base.stopGeneration()
+		}
+	}
+}
+
+// DiskRoot returns the state root of the disk layer and whether it is still
+// being generated.
+func (t *Tree) DiskRoot() (common.Hash, bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	for _, layer := range t.layers {
+		if base, ok := layer.(*diskLayer); ok {
+			base.lock.RLock()
+			defer base.lock.RUnlock()
+			return base.root, base.genMarker != nil
+		}
+	}
+	return common.Hash{}, false
+}
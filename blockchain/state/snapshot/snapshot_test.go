@@ -0,0 +1,300 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/crypto"
+	"github.com/hpb-project/go-hpb/common/rlp"
+	"github.com/hpb-project/go-hpb/common/trie"
+)
+
+// testState is a state trie along with its contents, changed block by block.
+type testState struct {
+	db       *hpbdb.MemDatabase
+	accounts map[common.Hash]*account
+	storage  map[common.Hash]map[common.Hash][]byte
+}
+
+func newTestState(t *testing.T, n int) (*testState, common.Hash) {
+	db, _ := hpbdb.NewMemDatabase()
+	s := &testState{
+		db:       db,
+		accounts: make(map[common.Hash]*account),
+		storage:  make(map[common.Hash]map[common.Hash][]byte),
+	}
+	for i := 0; i < n; i++ {
+		hash := crypto.Keccak256Hash([]byte{byte(i), byte(i >> 8)})
+		s.accounts[hash] = &account{Nonce: uint64(i), Balance: big.NewInt(int64(i)), CodeHash: crypto.Keccak256(nil)}
+		if i%3 == 0 {
+			s.storage[hash] = make(map[common.Hash][]byte)
+			for j := 0; j < i%17+1; j++ {
+				value, _ := rlp.EncodeToBytes([]byte{byte(i), byte(j)})
+				s.storage[hash][crypto.Keccak256Hash([]byte{byte(j)})] = value
+			}
+		}
+	}
+	return s, s.commit(t)
+}
+
+// commit writes the tries of the current contents, returning the state root.
+func (s *testState) commit(t *testing.T) common.Hash {
+	accTrie, _ := trie.New(common.Hash{}, s.db)
+	for hash, acc := range s.accounts {
+		stTrie, _ := trie.New(common.Hash{}, s.db)
+		for slot, value := range s.storage[hash] {
+			stTrie.Update(slot[:], value)
+		}
+		root, err := stTrie.CommitTo(s.db)
+		if err != nil {
+			t.Fatalf("failed to commit storage trie: %v", err)
+		}
+		acc.Root = root
+
+		data, _ := rlp.EncodeToBytes(acc)
+		accTrie.Update(hash[:], data)
+	}
+	root, err := accTrie.CommitTo(s.db)
+	if err != nil {
+		t.Fatalf("failed to commit account trie: %v", err)
+	}
+	return root
+}
+
+func waitGeneration(t *testing.T, tree *Tree) {
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if _, generating := tree.DiskRoot(); !generating {
+			return
+		}
+	}
+	t.Fatalf("snapshot generation timed out")
+}
+
+// checkSnapshot checks every account and slot of the state against a snapshot.
+func checkSnapshot(t *testing.T, s *testState, snap Snapshot) {
+	for hash, acc := range s.accounts {
+		want, _ := rlp.EncodeToBytes(acc)
+		have, err := snap.AccountRLP(hash)
+		if err != nil {
+			t.Fatalf("account %x: failed to read: %v", hash, err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Errorf("account %x: have %x, want %x", hash, have, want)
+		}
+		for slot, want := range s.storage[hash] {
+			have, err := snap.Storage(hash, slot)
+			if err != nil {
+				t.Fatalf("slot %x of %x: failed to read: %v", slot, hash, err)
+			}
+			if !bytes.Equal(have, want) {
+				t.Errorf("slot %x of %x: have %x, want %x", slot, hash, have, want)
+			}
+		}
+	}
+}
+
+// Tests that the snapshot generated from a trie holds the same data and
+// verifies against the trie root.
+func TestGeneration(t *testing.T) {
+	s, root := newTestState(t, 500)
+
+	tree := New(s.db, s.db, root)
+	waitGeneration(t, tree)
+
+	checkSnapshot(t, s, tree.Snapshot(root))
+	if err := tree.Verify(root); err != nil {
+		t.Fatalf("failed to verify snapshot: %v", err)
+	}
+	// Reopening the completed snapshot must not regenerate it
+	tree.Release()
+	if reopened := New(s.db, s.db, root); reopened.layers[root].(*diskLayer).genMarker != nil {
+		t.Fatalf("complete snapshot regenerated on reopen")
+	}
+	if err := tree.Verify(common.Hash{1}); err == nil {
+		t.Fatalf("verified missing snapshot")
+	}
+}
+
+// Tests that diff layers serve the changes of their block on top of their
+// parent, and that merging them into the disk layer keeps the data intact.
+func TestDiffLayers(t *testing.T) {
+	s, root := newTestState(t, 100)
+
+	tree := New(s.db, s.db, root)
+	waitGeneration(t, tree)
+
+	// Apply a few blocks of changes, each one a diff layer
+	roots := []common.Hash{root}
+	for block := 0; block < 4; block++ {
+		var (
+			destructs = make(map[common.Hash]struct{})
+			accounts  = make(map[common.Hash][]byte)
+			storage   = make(map[common.Hash]map[common.Hash][]byte)
+			i         int
+		)
+		for hash, acc := range s.accounts {
+			switch i++; {
+			case i%7 == block:
+				// Delete the account along with its storage
+				delete(s.accounts, hash)
+				delete(s.storage, hash)
+				destructs[hash] = struct{}{}
+			case i%5 == block:
+				// Change a slot, clear another and add a new one
+				if s.storage[hash] == nil {
+					s.storage[hash] = make(map[common.Hash][]byte)
+				}
+				storage[hash] = make(map[common.Hash][]byte)
+				for slot := range s.storage[hash] {
+					delete(s.storage[hash], slot)
+					storage[hash][slot] = nil
+					break
+				}
+				value, _ := rlp.EncodeToBytes([]byte{0xff, byte(block)})
+				slot := crypto.Keccak256Hash([]byte{0xff, byte(block)})
+				s.storage[hash][slot], storage[hash][slot] = value, value
+				fallthrough
+			case i%3 == block:
+				acc.Balance = new(big.Int).Add(acc.Balance, big.NewInt(1))
+				accounts[hash] = nil // filled in after the commit
+			}
+		}
+		newRoot := s.commit(t)
+		for hash := range accounts {
+			accounts[hash], _ = rlp.EncodeToBytes(s.accounts[hash])
+		}
+		if err := tree.Update(newRoot, roots[len(roots)-1], destructs, accounts, storage); err != nil {
+			t.Fatalf("block %d: failed to update snapshot: %v", block, err)
+		}
+		roots = append(roots, newRoot)
+
+		checkSnapshot(t, s, tree.Snapshot(newRoot))
+		if err := tree.Verify(newRoot); err != nil {
+			t.Fatalf("block %d: failed to verify snapshot: %v", block, err)
+		}
+	}
+	// Keep two layers in memory, the older ones go to disk
+	head := roots[len(roots)-1]
+	if err := tree.Cap(head, 2); err != nil {
+		t.Fatalf("failed to cap snapshot: %v", err)
+	}
+	if diskRoot, _ := tree.DiskRoot(); diskRoot != roots[len(roots)-3] {
+		t.Fatalf("disk layer mismatch: have %x, want %x", diskRoot, roots[len(roots)-3])
+	}
+	if tree.Snapshot(roots[0]) != nil {
+		t.Fatalf("merged layer still present")
+	}
+	checkSnapshot(t, s, tree.Snapshot(head))
+	if err := tree.Verify(head); err != nil {
+		t.Fatalf("failed to verify capped snapshot: %v", err)
+	}
+	// Flatten everything, the disk layer must be the head state
+	if err := tree.Cap(head, 0); err != nil {
+		t.Fatalf("failed to flatten snapshot: %v", err)
+	}
+	if diskRoot, _ := tree.DiskRoot(); diskRoot != head {
+		t.Fatalf("disk layer mismatch: have %x, want %x", diskRoot, head)
+	}
+	checkSnapshot(t, s, tree.Snapshot(head))
+	if err := tree.Verify(head); err != nil {
+		t.Fatalf("failed to verify flattened snapshot: %v", err)
+	}
+	if stored, _ := s.db.Get(SnapshotRootKey); common.BytesToHash(stored) != head {
+		t.Fatalf("persisted root mismatch: have %x, want %x", stored, head)
+	}
+}
+
+// Tests that capping drops the layers of forks not built on the new disk layer
+// and that their readers are told the data is stale.
+func TestCapDropsForks(t *testing.T) {
+	s, root := newTestState(t, 10)
+
+	tree := New(s.db, s.db, root)
+	waitGeneration(t, tree)
+
+	var (
+		hash  = crypto.Keccak256Hash([]byte{1, 0})
+		rootA = common.Hash{0xa}
+		rootB = common.Hash{0xb}
+		rootC = common.Hash{0xc}
+	)
+	tree.Update(rootA, root, nil, map[common.Hash][]byte{hash: {0x01}}, nil)
+	tree.Update(rootB, root, nil, map[common.Hash][]byte{hash: {0x02}}, nil)
+	tree.Update(rootC, rootA, nil, map[common.Hash][]byte{hash: {0x03}}, nil)
+
+	fork := tree.Snapshot(rootB)
+	if data, err := fork.AccountRLP(hash); err != nil || !bytes.Equal(data, []byte{0x02}) {
+		t.Fatalf("fork read mismatch: have %x, %v", data, err)
+	}
+	if err := tree.Cap(rootC, 1); err != nil {
+		t.Fatalf("failed to cap snapshot: %v", err)
+	}
+	if tree.Snapshot(rootB) != nil {
+		t.Fatalf("forked layer still present")
+	}
+	if _, err := fork.AccountRLP(hash); err != ErrSnapshotStale {
+		t.Fatalf("fork read error mismatch: have %v, want %v", err, ErrSnapshotStale)
+	}
+	if data, err := tree.Snapshot(rootC).AccountRLP(hash); err != nil || !bytes.Equal(data, []byte{0x03}) {
+		t.Fatalf("head read mismatch: have %x, %v", data, err)
+	}
+	if data, _ := s.db.Get(accountKey(hash)); !bytes.Equal(data, []byte{0x01}) {
+		t.Fatalf("disk layer mismatch: have %x, want %x", data, []byte{0x01})
+	}
+}
+
+// Tests that rebuilding from another root drops the leftovers of the old
+// snapshot.
+func TestRebuild(t *testing.T) {
+	s, root := newTestState(t, 200)
+
+	tree := New(s.db, s.db, root)
+	waitGeneration(t, tree)
+
+	// Drop most accounts from the state and rebuild over the old snapshot
+	for hash := range s.accounts {
+		if hash[0] < 0xc0 {
+			delete(s.accounts, hash)
+			delete(s.storage, hash)
+		}
+	}
+	newRoot := s.commit(t)
+	tree.Rebuild(newRoot)
+	waitGeneration(t, tree)
+
+	checkSnapshot(t, s, tree.Snapshot(newRoot))
+	if err := tree.Verify(newRoot); err != nil {
+		t.Fatalf("failed to verify rebuilt snapshot: %v", err)
+	}
+	it := s.db.NewIteratorWithPrefix(SnapshotAccountPrefix)
+	defer it.Release()
+	for it.Next() {
+		// Trie nodes sharing the prefix are keyed by their bare hash
+		if len(it.Key()) != len(SnapshotAccountPrefix)+common.HashLength {
+			continue
+		}
+		if hash := common.BytesToHash(it.Key()[1:]); s.accounts[hash] == nil {
+			t.Errorf("leftover account %x", hash)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"fmt"
+
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/rlp"
+	"github.com/hpb-project/go-hpb/common/trie"
+)
+
+// Verify rebuilds the account and storage tries from the snapshot of root and
+// checks that they hash to the roots committed by the state.
+func (t *Tree) Verify(root common.Hash) error {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	snap := t.layers[root]
+	if snap == nil {
+		return fmt.Errorf("snapshot [%#x] missing", root)
+	}
+	// Collect the diff layers above the disk layer, top-down
+	var diffs []*diffLayer
+	for {
+		diff, ok := snap.(*diffLayer)
+		if !ok {
+			break
+		}
+		diffs = append(diffs, diff)
+		snap = diff.parent
+	}
+	base := snap.(*diskLayer)
+	base.lock.RLock()
+	defer base.lock.RUnlock()
+
+	if base.genMarker != nil {
+		return ErrNotConstructed
+	}
+	// Squash the diff layers bottom-up into a single set of changes
+	var (
+		destructs = make(map[common.Hash]struct{})
+		accounts  = make(map[common.Hash][]byte)
+		storage   = make(map[common.Hash]map[common.Hash][]byte)
+	)
+	for i := len(diffs) - 1; i >= 0; i-- {
+		for hash := range diffs[i].destructs {
+			destructs[hash] = struct{}{}
+			delete(accounts, hash)
+			delete(storage, hash)
+		}
+		for hash, data := range diffs[i].accounts {
+			accounts[hash] = data
+		}
+		for hash, slots := range diffs[i].storage {
+			if storage[hash] == nil {
+				storage[hash] = make(map[common.Hash][]byte)
+			}
+			for slot, data := range slots {
+				storage[hash][slot] = data
+			}
+		}
+	}
+	accTrie, _ := trie.New(common.Hash{}, nil)
+
+	// Insert the accounts of the disk layer untouched by the diffs
+	it := base.diskdb.NewIteratorWithPrefix(SnapshotAccountPrefix)
+	defer it.Release()
+
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(SnapshotAccountPrefix)+common.HashLength {
+			continue
+		}
+		hash := common.BytesToHash(key[len(SnapshotAccountPrefix):])
+		if _, ok := accounts[hash]; ok {
+			continue
+		}
+		if _, ok := destructs[hash]; ok {
+			continue
+		}
+		if err := base.verifyAccount(hash, it.Value(), false, storage[hash]); err != nil {
+			return err
+		}
+		accTrie.Update(hash[:], common.CopyBytes(it.Value()))
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	// Insert the accounts changed by the diffs
+	for hash, data := range accounts {
+		if len(data) == 0 {
+			continue
+		}
+		_, destructed := destructs[hash]
+		if err := base.verifyAccount(hash, data, destructed, storage[hash]); err != nil {
+			return err
+		}
+		accTrie.Update(hash[:], data)
+	}
+	if have := accTrie.Hash(); have != root {
+		return fmt.Errorf("state root mismatch: have %x, want %x", have, root)
+	}
+	return nil
+}
+
+// verifyAccount rebuilds the storage trie of an account from the disk layer,
+// unless the account was destructed, overlaid by the slots of the diff layers.
+func (dl *diskLayer) verifyAccount(hash common.Hash, data []byte, destructed bool, slots map[common.Hash][]byte) error {
+	var acc account
+	if err := rlp.DecodeBytes(data, &acc); err != nil {
+		return fmt.Errorf("invalid account %x: %v", hash, err)
+	}
+	stTrie, _ := trie.New(common.Hash{}, nil)
+	if !destructed {
+		prefix := append(append([]byte{}, SnapshotStoragePrefix...), hash[:]...)
+
+		it := dl.diskdb.NewIteratorWithPrefix(prefix)
+		for it.Next() {
+			key := it.Key()
+			if len(key) != len(prefix)+common.HashLength {
+				continue
+			}
+			if _, ok := slots[common.BytesToHash(key[len(prefix):])]; ok {
+				continue
+			}
+			stTrie.Update(key[len(prefix):], common.CopyBytes(it.Value()))
+		}
+		err := it.Error()
+		it.Release()
+		if err != nil {
+			return err
+		}
+	}
+	for slot, value := range slots {
+		if len(value) > 0 {
+			stTrie.Update(slot[:], value)
+		}
+	}
+	if have := stTrie.Hash(); have != acc.Root {
+		return fmt.Errorf("storage root mismatch of account %x: have %x, want %x", hash, have, acc.Root)
+	}
+	return nil
+}
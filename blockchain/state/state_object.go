@@ -78,8 +78,10 @@ type stateObject struct {
 	trie Trie // storage trie, which becomes non-nil on first access
 	code Code // contract bytecode, which gets set when code is loaded
 
+	originStorage Storage // Storage entries as of the start of the transaction
 	cachedStorage Storage // Storage entry cache to avoid duplicate reads
 	dirtyStorage  Storage // Storage entries that need to be flushed to disk
+	fakeStorage   Storage // Storage replacing the one in the trie, set by call simulations only
 
 	// Cache flags.
 	// When an object is marked suicided it will be delete from the trie
@@ -118,6 +120,7 @@ func newObject(db *StateDB, address common.Address, data Account, onDirty func(a
 		address:       address,
 		addrHash:      crypto.Keccak256Hash(address[:]),
 		data:          data,
+		originStorage: make(Storage),
 		cachedStorage: make(Storage),
 		dirtyStorage:  make(Storage),
 		onDirty:       onDirty,
@@ -175,8 +178,42 @@ func (self *stateObject) GetState(db Database, key common.Hash) common.Hash {
 	if exists {
 		return value
 	}
-	// Load from DB in case it is missing.
-	enc, err := self.getTrie(db).TryGet(key[:])
+	value = self.GetCommittedState(db, key)
+	if (value != common.Hash{}) {
+		self.cachedStorage[key] = value
+	}
+	return value
+}
+
+// GetCommittedState returns a value in account storage as of the start of the
+// current transaction, ignoring the changes made since.
+func (self *stateObject) GetCommittedState(db Database, key common.Hash) common.Hash {
+	value, exists := self.originStorage[key]
+	if exists {
+		return value
+	}
+	if self.fakeStorage != nil {
+		return self.fakeStorage[key]
+	}
+	// Load from the snapshot if this state didn't touch the slot, from the
+	// trie otherwise or if the snapshot can't serve it.
+	var (
+		enc      []byte
+		err      error
+		fromSnap bool
+	)
+	if snap := self.db.snap; snap != nil {
+		if _, destructed := self.db.snapDestructs[self.addrHash]; !destructed {
+			slot := crypto.Keccak256Hash(key[:])
+			if _, updated := self.db.snapStorage[self.addrHash][slot]; !updated {
+				enc, err = snap.Storage(self.addrHash, slot)
+				fromSnap = err == nil
+			}
+		}
+	}
+	if !fromSnap {
+		enc, err = self.getTrie(db).TryGet(key[:])
+	}
 	if err != nil {
 		self.setError(err)
 		return common.Hash{}
@@ -188,9 +225,7 @@ func (self *stateObject) GetState(db Database, key common.Hash) common.Hash {
 		}
 		value.SetBytes(content)
 	}
-	if (value != common.Hash{}) {
-		self.cachedStorage[key] = value
-	}
+	self.originStorage[key] = value
 	return value
 }
 
@@ -214,18 +249,51 @@ func (self *stateObject) setState(key, value common.Hash) {
 	}
 }
 
+// SetStorage replaces the whole storage of the account, the storage in the
+// trie is ignored from then on. It is meant for call simulations, the state
+// can't be committed afterwards.
+func (self *stateObject) SetStorage(storage map[common.Hash]common.Hash) {
+	self.fakeStorage = make(Storage, len(storage))
+	for key, value := range storage {
+		self.fakeStorage[key] = value
+	}
+	// Forget the values read or written so far, they came from the old storage
+	self.originStorage = make(Storage)
+	self.cachedStorage = make(Storage)
+	self.dirtyStorage = make(Storage)
+
+	if self.onDirty != nil {
+		self.onDirty(self.Address())
+		self.onDirty = nil
+	}
+}
+
 // updateTrie writes cached storage modifications into the object's storage trie.
 func (self *stateObject) updateTrie(db Database) Trie {
 	tr := self.getTrie(db)
+
+	var storage map[common.Hash][]byte
+	if self.db.snap != nil && len(self.dirtyStorage) > 0 {
+		if storage = self.db.snapStorage[self.addrHash]; storage == nil {
+			storage = make(map[common.Hash][]byte)
+			self.db.snapStorage[self.addrHash] = storage
+		}
+	}
 	for key, value := range self.dirtyStorage {
 		delete(self.dirtyStorage, key)
+		self.originStorage[key] = value
+
+		var v []byte
 		if (value == common.Hash{}) {
 			self.setError(tr.TryDelete(key[:]))
-			continue
+		} else {
+			// Encoding []byte cannot fail, ok to ignore the error.
+			v, _ = rlp.EncodeToBytes(bytes.TrimLeft(value[:], "\x00"))
+			self.setError(tr.TryUpdate(key[:], v))
+		}
+		if storage != nil {
+			storage[crypto.Keccak256Hash(key[:])] = v
 		}
-		// Encoding []byte cannot fail, ok to ignore the error.
-		v, _ := rlp.EncodeToBytes(bytes.TrimLeft(value[:], "\x00"))
-		self.setError(tr.TryUpdate(key[:], v))
 	}
 	return tr
 }
@@ -301,6 +369,10 @@ func (self *stateObject) deepCopy(db *StateDB, onDirty func(addr common.Address)
 	stateObject.code = self.code
 	stateObject.dirtyStorage = self.dirtyStorage.Copy()
 	stateObject.cachedStorage = self.dirtyStorage.Copy()
+	stateObject.originStorage = self.originStorage.Copy()
+	if self.fakeStorage != nil {
+		stateObject.fakeStorage = self.fakeStorage.Copy()
+	}
 	stateObject.suicided = self.suicided
 	stateObject.dirtyCode = self.dirtyCode
 	stateObject.deleted = self.deleted
@@ -23,6 +23,7 @@ import (
 	"sort"
 	"sync"
 
+	"github.com/hpb-project/go-hpb/blockchain/state/snapshot"
 	"github.com/hpb-project/go-hpb/blockchain/types"
 	"github.com/hpb-project/go-hpb/common"
 	"github.com/hpb-project/go-hpb/common/crypto"
@@ -31,6 +32,19 @@ import (
 	"github.com/hpb-project/go-hpb/common/trie"
 )
 
+var (
+	// emptyRoot is the known root hash of an empty trie.
+	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+	// emptyCode is the known hash of the empty EVM bytecode.
+	emptyCode = crypto.Keccak256Hash(nil)
+)
+
+// snapshotLayers is the number of diff layers kept in memory on top of the disk
+// snapshot. It stays below the number of tries kept in memory by the chain, so
+// the trie of the disk layer is around if it needs to be generated.
+const snapshotLayers = 64
+
 type revision struct {
 	id           int
 	journalIndex int
@@ -45,6 +59,14 @@ type StateDB struct {
 	db   Database
 	trie Trie
 
+	// Flat state snapshot serving the reads of untouched accounts and slots,
+	// along with the changes to apply to it on commit.
+	snaps         *snapshot.Tree
+	snap          snapshot.Snapshot
+	snapDestructs map[common.Hash]struct{}
+	snapAccounts  map[common.Hash][]byte
+	snapStorage   map[common.Hash]map[common.Hash][]byte
+
 	// This map holds 'live' objects, which will get modified while processing a state transition.
 	stateObjects      map[common.Address]*stateObject
 	stateObjectsDirty map[common.Address]struct{}
@@ -92,6 +114,30 @@ func New(root common.Hash, db Database) (*StateDB, error) {
 	}, nil
 }
 
+// NewWithSnapshot creates a new state from a given trie, reading the accounts
+// and storage from the snapshot of root if the tree has one.
+func NewWithSnapshot(root common.Hash, db Database, snaps *snapshot.Tree) (*StateDB, error) {
+	sdb, err := New(root, db)
+	if err != nil {
+		return nil, err
+	}
+	if snaps != nil {
+		sdb.snaps = snaps
+		sdb.openSnapshot(root)
+	}
+	return sdb, nil
+}
+
+// openSnapshot switches to the snapshot of root, if there is one.
+func (self *StateDB) openSnapshot(root common.Hash) {
+	self.snap, self.snapDestructs, self.snapAccounts, self.snapStorage = nil, nil, nil, nil
+	if self.snap = self.snaps.Snapshot(root); self.snap != nil {
+		self.snapDestructs = make(map[common.Hash]struct{})
+		self.snapAccounts = make(map[common.Hash][]byte)
+		self.snapStorage = make(map[common.Hash]map[common.Hash][]byte)
+	}
+}
+
 // setError remembers the first non-nil error it is called with.
 func (self *StateDB) setError(err error) {
 	if self.dbErr == nil {
@@ -119,6 +165,9 @@ func (self *StateDB) Reset(root common.Hash) error {
 	self.logs = make(map[common.Hash][]*types.Log)
 	self.logSize = 0
 	self.preimages = make(map[common.Hash][]byte)
+	if self.snaps != nil {
+		self.openSnapshot(root)
+	}
 	self.clearJournalAndRefund()
 	return nil
 }
@@ -166,6 +215,16 @@ func (self *StateDB) AddRefund(gas *big.Int) {
 	self.refund.Add(self.refund, gas)
 }
 
+// SubRefund removes gas from the refund counter. It panics if the counter
+// would go below zero.
+func (self *StateDB) SubRefund(gas *big.Int) {
+	self.journal = append(self.journal, refundChange{prev: new(big.Int).Set(self.refund)})
+	if gas.Cmp(self.refund) > 0 {
+		panic("refund counter below zero")
+	}
+	self.refund.Sub(self.refund, gas)
+}
+
 // Exist reports whether the given account address exists in the state.
 // Notably this also returns true for suicided accounts.
 func (self *StateDB) Exist(addr common.Address) bool {
@@ -236,6 +295,51 @@ func (self *StateDB) GetState(a common.Address, b common.Hash) common.Hash {
 	return common.Hash{}
 }
 
+// GetCommittedState retrieves a value from the storage of an account as of the
+// start of the current transaction.
+func (self *StateDB) GetCommittedState(a common.Address, b common.Hash) common.Hash {
+	stateObject := self.getStateObject(a)
+	if stateObject != nil {
+		return stateObject.GetCommittedState(self.db, b)
+	}
+	return common.Hash{}
+}
+
+// GetStorageRoot returns the storage trie root of an account as of the last
+// commit, the empty root for non-existent accounts.
+func (self *StateDB) GetStorageRoot(addr common.Address) common.Hash {
+	stateObject := self.getStateObject(addr)
+	if stateObject == nil {
+		return emptyRoot
+	}
+	return stateObject.data.Root
+}
+
+// GetProof returns the merkle proof of an account in the state trie as of the
+// last commit, proving its absence for non-existent accounts.
+func (self *StateDB) GetProof(addr common.Address) ([]rlp.RawValue, error) {
+	proof := self.trie.Prove(addr[:])
+	if proof == nil {
+		return nil, fmt.Errorf("can't prove account %x: missing trie node", addr)
+	}
+	return proof, nil
+}
+
+// GetStorageProof returns the merkle proof of a storage slot in the storage
+// trie of an account, proving its absence for empty slots. The proof is empty
+// for non-existent accounts, their storage trie being empty.
+func (self *StateDB) GetStorageProof(addr common.Address, key common.Hash) ([]rlp.RawValue, error) {
+	stateObject := self.getStateObject(addr)
+	if stateObject == nil {
+		return []rlp.RawValue{}, nil
+	}
+	proof := stateObject.getTrie(self.db).Prove(key[:])
+	if proof == nil {
+		return nil, fmt.Errorf("can't prove storage %x of account %x: missing trie node", key, addr)
+	}
+	return proof, nil
+}
+
 // StorageTrie returns the storage trie of an account.
 // The return value is a copy and is nil for non-existent accounts.
 func (self *StateDB) StorageTrie(a common.Address) Trie {
@@ -313,6 +417,15 @@ func (self *StateDB) SetState(addr common.Address, key common.Hash, value common
 	}
 }
 
+// SetStorage replaces the entire storage of the given account with the given
+// one. It is meant for call simulations, see stateObject.SetStorage.
+func (self *StateDB) SetStorage(addr common.Address, storage map[common.Hash]common.Hash) {
+	stateObject := self.GetOrNewStateObject(addr)
+	if stateObject != nil {
+		stateObject.SetStorage(storage)
+	}
+}
+
 // Suicide marks the given account as suicided.
 // This clears the account balance.
 //
@@ -346,6 +459,10 @@ func (self *StateDB) updateStateObject(stateObject *stateObject) {
 		panic(fmt.Errorf("can't encode object at %x: %v", addr[:], err))
 	}
 	self.setError(self.trie.TryUpdate(addr[:], data))
+
+	if self.snap != nil {
+		self.snapAccounts[stateObject.addrHash] = data
+	}
 }
 
 // deleteStateObject removes the given object from the state trie.
@@ -353,6 +470,12 @@ func (self *StateDB) deleteStateObject(stateObject *stateObject) {
 	stateObject.deleted = true
 	addr := stateObject.Address()
 	self.setError(self.trie.TryDelete(addr[:]))
+
+	if self.snap != nil {
+		self.snapDestructs[stateObject.addrHash] = struct{}{}
+		delete(self.snapAccounts, stateObject.addrHash)
+		delete(self.snapStorage, stateObject.addrHash)
+	}
 }
 
 // Retrieve a state object given my the address. Returns nil if not found.
@@ -365,8 +488,25 @@ func (self *StateDB) getStateObject(addr common.Address) (stateObject *stateObje
 		return obj
 	}
 
-	// Load the object from the database.
-	enc, err := self.trie.TryGet(addr[:])
+	// Load the object from the snapshot if this state didn't touch it, from
+	// the trie otherwise or if the snapshot can't serve it.
+	var (
+		enc      []byte
+		err      error
+		fromSnap bool
+	)
+	if self.snap != nil {
+		addrHash := crypto.Keccak256Hash(addr[:])
+		_, destructed := self.snapDestructs[addrHash]
+		_, updated := self.snapAccounts[addrHash]
+		if !destructed && !updated {
+			enc, err = self.snap.AccountRLP(addrHash)
+			fromSnap = err == nil
+		}
+	}
+	if !fromSnap {
+		enc, err = self.trie.TryGet(addr[:])
+	}
 	if len(enc) == 0 {
 		self.setError(err)
 		return nil
@@ -410,7 +550,14 @@ func (self *StateDB) createObject(addr common.Address) (newobj, prev *stateObjec
 	if prev == nil {
 		self.journal = append(self.journal, createObjectChange{account: &addr})
 	} else {
-		self.journal = append(self.journal, resetObjectChange{prev: prev})
+		// The storage of the replaced account is dropped from the snapshot
+		var prevdestruct bool
+		if self.snap != nil {
+			if _, prevdestruct = self.snapDestructs[prev.addrHash]; !prevdestruct {
+				self.snapDestructs[prev.addrHash] = struct{}{}
+			}
+		}
+		self.journal = append(self.journal, resetObjectChange{prev: prev, prevdestruct: prevdestruct})
 	}
 	self.setStateObject(newobj)
 	return newobj, prev
@@ -463,7 +610,9 @@ func (self *StateDB) Copy() *StateDB {
 	// Copy all the basic fields, initialize the memory ones
 	state := &StateDB{
 		db:                self.db,
-		trie:              self.trie,
+		trie:              self.db.CopyTrie(self.trie),
+		snaps:             self.snaps,
+		snap:              self.snap,
 		stateObjects:      make(map[common.Address]*stateObject, len(self.stateObjectsDirty)),
 		stateObjectsDirty: make(map[common.Address]struct{}, len(self.stateObjectsDirty)),
 		refund:            new(big.Int).Set(self.refund),
@@ -483,6 +632,24 @@ func (self *StateDB) Copy() *StateDB {
 	for hash, preimage := range self.preimages {
 		state.preimages[hash] = preimage
 	}
+	if self.snap != nil {
+		state.snapDestructs = make(map[common.Hash]struct{}, len(self.snapDestructs))
+		for hash := range self.snapDestructs {
+			state.snapDestructs[hash] = struct{}{}
+		}
+		state.snapAccounts = make(map[common.Hash][]byte, len(self.snapAccounts))
+		for hash, data := range self.snapAccounts {
+			state.snapAccounts[hash] = data
+		}
+		state.snapStorage = make(map[common.Hash]map[common.Hash][]byte, len(self.snapStorage))
+		for hash, slots := range self.snapStorage {
+			cpy := make(map[common.Hash][]byte, len(slots))
+			for slot, data := range slots {
+				cpy[slot] = data
+			}
+			state.snapStorage[hash] = cpy
+		}
+	}
 	return state
 }
 
@@ -621,8 +788,38 @@ func (s *StateDB) CommitTo(dbw trie.DatabaseWriter, deleteEmptyObjects bool) (ro
 		}
 		delete(s.stateObjectsDirty, addr)
 	}
-	// Write trie changes.
-	root, err = s.trie.CommitTo(dbw)
+	// Write trie changes. Tries committed into a node cache must keep the storage
+	// tries and code of their accounts alive.
+	var onleaf trie.LeafCallback
+	if nodes, ok := dbw.(*trie.NodeCache); ok {
+		onleaf = func(leaf []byte, parent common.Hash) error {
+			var account Account
+			if err := rlp.DecodeBytes(leaf, &account); err != nil {
+				return nil
+			}
+			if account.Root != emptyRoot {
+				nodes.Reference(account.Root, parent)
+			}
+			if code := common.BytesToHash(account.CodeHash); code != emptyCode {
+				nodes.Reference(code, parent)
+			}
+			return nil
+		}
+	}
+	root, err = s.trie.CommitToCallback(dbw, onleaf)
 	log.Debug("Trie cache stats after commit", "misses", trie.CacheMisses(), "unloads", trie.CacheUnloads())
+
+	// Stack the changes onto the snapshot, merging the old layers into disk
+	if err == nil && s.snap != nil {
+		if parent := s.snap.Root(); parent != root {
+			if err := s.snaps.Update(root, parent, s.snapDestructs, s.snapAccounts, s.snapStorage); err != nil {
+				log.Warn("Failed to update state snapshot", "from", parent, "to", root, "err", err)
+			}
+			if err := s.snaps.Cap(root, snapshotLayers); err != nil {
+				log.Warn("Failed to cap state snapshot", "root", root, "err", err)
+			}
+		}
+		s.snap, s.snapDestructs, s.snapAccounts, s.snapStorage = nil, nil, nil, nil
+	}
 	return root, err
 }
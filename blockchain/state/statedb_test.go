@@ -27,11 +27,13 @@ import (
 	"strings"
 	"testing"
 	"testing/quick"
+	"time"
 
 	check "gopkg.in/check.v1"
 
 	"github.com/hpb-project/go-hpb/common"
 	"github.com/hpb-project/go-hpb/blockchain/types"
+	"github.com/hpb-project/go-hpb/blockchain/state/snapshot"
 	"github.com/hpb-project/go-hpb/blockchain/storage"
 )
 
@@ -372,3 +374,137 @@ func (s *StateSuite) TestTouchDelete(c *check.C) {
 		c.Fatal("expected no dirty state object")
 	}
 }
+
+// Tests that states read through the flat snapshot match the trie, and that the
+// snapshot layers written on commit verify against the committed roots.
+func TestSnapshotReads(t *testing.T) {
+	db, _ := hpbdb.NewMemDatabase()
+	sdb := NewDatabase(db)
+
+	addr := func(i int) common.Address { return common.BytesToAddress([]byte{byte(i)}) }
+	slot := func(i int) common.Hash { return common.BytesToHash([]byte{byte(i)}) }
+
+	state, _ := New(common.Hash{}, sdb)
+	for i := 0; i < 64; i++ {
+		state.AddBalance(addr(i), big.NewInt(int64(i+1)))
+		if i%2 == 0 {
+			state.SetState(addr(i), slot(1), common.BytesToHash([]byte{byte(i)}))
+			state.SetState(addr(i), slot(2), common.BytesToHash([]byte{byte(i), 2}))
+		}
+	}
+	root, _ := state.CommitTo(db, false)
+
+	snaps := snapshot.New(db, db, root)
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if _, generating := snaps.DiskRoot(); !generating {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("snapshot generation timed out")
+		}
+	}
+	for block := 0; block < 4; block++ {
+		state, _ := NewWithSnapshot(root, sdb, snaps)
+		for i := block; i < 64; i += 4 {
+			switch i % 3 {
+			case 0:
+				// Destruct the account, resurrecting every other one
+				state.Suicide(addr(i))
+				if i%2 == 0 {
+					state.CreateAccount(addr(i))
+					state.SetState(addr(i), slot(3), common.BytesToHash([]byte{byte(block)}))
+				}
+			case 1:
+				state.SetState(addr(i), slot(1), common.Hash{})
+				state.SetState(addr(i), slot(2), common.BytesToHash([]byte{byte(block), 1}))
+			case 2:
+				state.AddBalance(addr(i), big.NewInt(1))
+			}
+		}
+		var err error
+		if root, err = state.CommitTo(db, false); err != nil {
+			t.Fatalf("block %d: failed to commit: %v", block, err)
+		}
+		if err := snaps.Verify(root); err != nil {
+			t.Fatalf("block %d: failed to verify snapshot: %v", block, err)
+		}
+		// Reads through the snapshot must match the trie
+		trieState, _ := New(root, sdb)
+		snapState, _ := NewWithSnapshot(root, sdb, snaps)
+		if snapState.snap == nil {
+			t.Fatalf("block %d: no snapshot of the committed root", block)
+		}
+		for i := 0; i < 64; i++ {
+			if have, want := snapState.Exist(addr(i)), trieState.Exist(addr(i)); have != want {
+				t.Errorf("block %d: account %d existence mismatch: have %v, want %v", block, i, have, want)
+			}
+			if have, want := snapState.GetBalance(addr(i)), trieState.GetBalance(addr(i)); have.Cmp(want) != 0 {
+				t.Errorf("block %d: account %d balance mismatch: have %v, want %v", block, i, have, want)
+			}
+			for j := 1; j <= 3; j++ {
+				if have, want := snapState.GetState(addr(i), slot(j)), trieState.GetState(addr(i), slot(j)); have != want {
+					t.Errorf("block %d: account %d slot %d mismatch: have %x, want %x", block, i, j, have, want)
+				}
+			}
+		}
+	}
+	snaps.Release()
+}
+
+// Tests that the committed state of a slot is its value as of the last
+// finalisation, regardless of the changes and reverts made since.
+func TestCommittedState(t *testing.T) {
+	db, _ := hpbdb.NewMemDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(db))
+
+	var (
+		addr = common.BytesToAddress([]byte("contract"))
+		key  = common.Hash{1}
+	)
+	state.AddBalance(addr, big.NewInt(1))
+	state.SetState(addr, key, common.Hash{1})
+	if have := state.GetCommittedState(addr, key); have != (common.Hash{}) {
+		t.Fatalf("committed state before finalisation: have %x, want empty", have)
+	}
+	state.Finalise(true)
+
+	state.SetState(addr, key, common.Hash{2})
+	snap := state.Snapshot()
+	state.SetState(addr, key, common.Hash{3})
+	if have := state.GetCommittedState(addr, key); have != (common.Hash{1}) {
+		t.Fatalf("committed state after change: have %x, want %x", have, common.Hash{1})
+	}
+	state.RevertToSnapshot(snap)
+	if have := state.GetState(addr, key); have != (common.Hash{2}) {
+		t.Fatalf("state after revert: have %x, want %x", have, common.Hash{2})
+	}
+	state.Finalise(true)
+	if have := state.GetCommittedState(addr, key); have != (common.Hash{2}) {
+		t.Fatalf("committed state after finalisation: have %x, want %x", have, common.Hash{2})
+	}
+}
+
+// Tests that replacing the storage of an account hides all of its old slots.
+func TestSetStorage(t *testing.T) {
+	db, _ := hpbdb.NewMemDatabase()
+	sdb := NewDatabase(db)
+	state, _ := New(common.Hash{}, sdb)
+
+	addr := common.BytesToAddress([]byte("contract"))
+	state.AddBalance(addr, big.NewInt(1))
+	state.SetState(addr, common.Hash{1}, common.Hash{1})
+	state.SetState(addr, common.Hash{2}, common.Hash{2})
+	root, _ := state.CommitTo(db, true)
+	state, _ = New(root, sdb)
+
+	state.SetStorage(addr, map[common.Hash]common.Hash{{2}: {0x22}})
+	if have := state.GetState(addr, common.Hash{1}); have != (common.Hash{}) {
+		t.Errorf("replaced slot 1: have %x, want empty", have)
+	}
+	if have := state.GetState(addr, common.Hash{2}); have != (common.Hash{0x22}) {
+		t.Errorf("replaced slot 2: have %x, want %x", have, common.Hash{0x22})
+	}
+	if have := state.Copy().GetState(addr, common.Hash{2}); have != (common.Hash{0x22}) {
+		t.Errorf("copied slot 2: have %x, want %x", have, common.Hash{0x22})
+	}
+}
@@ -19,13 +19,13 @@ package bc
 import (
 	"errors"
 	"math/big"
+	"time"
 
 	"github.com/hpb-project/go-hpb/blockchain/state"
 	"github.com/hpb-project/go-hpb/blockchain/types"
 	"github.com/hpb-project/go-hpb/common"
 	"github.com/hpb-project/go-hpb/common/log"
 	"github.com/hpb-project/go-hpb/common/math"
-	"github.com/hpb-project/go-hpb/config"
 	"github.com/hpb-project/go-hpb/hvm"
 	"github.com/hpb-project/go-hpb/hvm/evm"
 	"github.com/hpb-project/go-hpb/hvm/native"
@@ -66,6 +66,7 @@ type StateTransition struct {
 	native     bool
 	header     *types.Header
 	author     *common.Address
+	vmenv      *evm.EVM
 }
 
 // NewStateTransition initialises and returns a new state transition object.
@@ -93,10 +94,24 @@ func NewStateTransition(msg hvm.Message, gp *hvm.GasPool, db *state.StateDB, hea
 // indicates a core error meaning that the message would always fail for that particular
 // state and would never be accepted within a block.
 func ApplyMessage(header *types.Header, db *state.StateDB, author *common.Address, msg hvm.Message, gp *hvm.GasPool) ([]byte, *big.Int, bool, error) {
+	return NewStateTransition(msg, gp, db, header, author).apply()
+}
 
+// ApplyMessageOnEVM applies the message like ApplyMessage, but executes it on
+// the given EVM instead of one set up from the chain. It lets callers run the
+// message with their own block context or VM configuration, e.g. a tracer.
+// The gas fees are credited to the coinbase of the EVM context.
+func ApplyMessageOnEVM(vmenv *evm.EVM, header *types.Header, db *state.StateDB, msg hvm.Message, gp *hvm.GasPool) ([]byte, *big.Int, bool, error) {
+	coinbase := vmenv.Coinbase
+	st := NewStateTransition(msg, gp, db, header, &coinbase)
+	st.vmenv = vmenv
+	return st.apply()
+}
 
-	st := NewStateTransition(msg, gp, db, header, author)
-
+// apply runs the pre checks, pays the intrinsic gas and executes the message
+// either natively or on the EVM.
+func (st *StateTransition) apply() ([]byte, *big.Int, bool, error) {
+	msg := st.msg
 	if err := st.preCheck(); err != nil {
 		return nil, nil, false, err
 	}
@@ -217,6 +232,15 @@ func (st *StateTransition) TransitionOnNative() (ret []byte, requiredGas, usedGa
 	st.state.SetNonce(sender.Address(), st.state.GetNonce(sender.Address())+1)
 	requiredGas = new(big.Int).Set(st.gasUsed())
 
+	// A native transfer runs no code, but a tracer still sees it as a plain
+	// call frame with the same state as a call on the EVM would.
+	if st.vmenv != nil && st.vmenv.VMConfig().Debug {
+		tracer := st.vmenv.VMConfig().Tracer
+		start := time.Now()
+		tracer.CaptureStart(st.vmenv, from, to, false, st.data, st.gas, st.value)
+		tracer.CaptureEnd(nil, 0, time.Since(start), nil)
+	}
+
 	st.refundGas()
 
 	var beneficiary common.Address
@@ -234,11 +258,15 @@ func (st *StateTransition) TransitionOnNative() (ret []byte, requiredGas, usedGa
 // including the required gas for the operation as well as the used gas. It returns an error if it
 // failed. An error indicates a consensus issue.
 func (st *StateTransition) TransitionOnEVM() (ret []byte, requiredGas, usedGas *big.Int, failed bool, err error) {
-	// Create a new context to be used in the EVM environment
-	context := hvm.NewEVMContext(st.msg, st.header, InstanceBlockChain(), st.author)
-	// Create a new environment which holds all relevant information
-	// about the transaction and calling mechanisms.
-	ethereum_vm := evm.NewEVM(context, st.state, config.MainnetChainConfig, evm.Config{})
+	ethereum_vm := st.vmenv
+	if ethereum_vm == nil {
+		// Create a new context to be used in the EVM environment
+		chain := InstanceBlockChain()
+		context := hvm.NewEVMContext(st.msg, st.header, chain, st.author)
+		// Create a new environment which holds all relevant information
+		// about the transaction and calling mechanisms.
+		ethereum_vm = evm.NewEVM(context, st.state, chain.Config(), chain.VMConfig())
+	}
 
 	msg := st.msg
 	sender := st.from() // err checked in preCheck
@@ -0,0 +1,326 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package hpbdb
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/dgraph-io/badger"
+	"github.com/dgraph-io/badger/options"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/log"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// badgerGCDiscardRatio is the share of stale data a value log file needs for
+// Compact to rewrite it.
+const badgerGCDiscardRatio = 0.5
+
+// BadgerDatabase is a database backed by Badger, a pure Go LSM engine keeping
+// the values apart from the keys in a value log. As compactions only move the
+// keys around, it writes far less than LevelDB for the large values of the
+// chain, trie nodes and receipts alike.
+type BadgerDatabase struct {
+	fn string     // filename for reporting
+	db *badger.DB // Badger instance
+
+	closeLock sync.Mutex
+	closed    bool
+
+	log log.Logger // Contextual logger tracking the database path
+
+	ancientStore // Ancient block store, if any
+}
+
+// NewBadgerDatabase opens or creates a Badger database in file.
+func NewBadgerDatabase(file string, cache int, handles int) (*BadgerDatabase, error) {
+	logger := log.New("database", file)
+
+	// Ensure we have some minimal caching, Badger keeps its files mapped and
+	// needs no handle limit
+	if cache < 16 {
+		cache = 16
+	}
+	logger.Info("Allocated cache and file handles", "cache", cache, "handles", handles, "engine", EngineBadger)
+
+	// Use the cache for two memory tables, the same share LevelDB gives to
+	// its write buffers, and leave the tables mapped instead of loaded
+	opts := badger.DefaultOptions
+	opts.Dir = file
+	opts.ValueDir = file
+	opts.SyncWrites = false
+	opts.Truncate = true
+	opts.TableLoadingMode = options.MemoryMap
+	opts.NumMemtables = 2
+	opts.MaxTableSize = int64(cache/4) * 1024 * 1024
+	opts.ValueLogFileSize = 256 * 1024 * 1024
+
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &BadgerDatabase{fn: file, db: db, log: logger}, nil
+}
+
+// Path returns the path to the database directory.
+func (db *BadgerDatabase) Path() string {
+	return db.fn
+}
+
+func (db *BadgerDatabase) Put(key []byte, value []byte) error {
+	return db.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(common.CopyBytes(key), common.CopyBytes(value))
+	})
+}
+
+func (db *BadgerDatabase) Has(key []byte) (bool, error) {
+	err := db.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(key)
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (db *BadgerDatabase) Get(key []byte) ([]byte, error) {
+	var dat []byte
+	err := db.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+		dat, err = item.ValueCopy(nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dat, nil
+}
+
+func (db *BadgerDatabase) Delete(key []byte) error {
+	return db.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(common.CopyBytes(key))
+	})
+}
+
+func (db *BadgerDatabase) Close() {
+	db.closeLock.Lock()
+	defer db.closeLock.Unlock()
+
+	if db.closed {
+		return
+	}
+	db.closed = true
+
+	if err := db.closeFreezer(); err != nil {
+		db.log.Error("Failed to close ancient store", "err", err)
+	}
+	if err := db.db.Close(); err != nil {
+		db.log.Error("Failed to close database", "err", err)
+	} else {
+		db.log.Info("Database closed")
+	}
+}
+
+// NewIteratorWithPrefix iterates over the keys starting with prefix.
+func (db *BadgerDatabase) NewIteratorWithPrefix(prefix []byte) Iterator {
+	bounds := util.BytesPrefix(prefix)
+	return db.newIterator(bounds.Start, bounds.Limit)
+}
+
+// NewIteratorWithRange iterates over the keys in [start, limit).
+func (db *BadgerDatabase) NewIteratorWithRange(start []byte, limit []byte) Iterator {
+	return db.newIterator(start, limit)
+}
+
+// newIterator iterates over a snapshot of the keys in [start, limit), which
+// later writes leave untouched.
+func (db *BadgerDatabase) newIterator(start, limit []byte) Iterator {
+	txn := db.db.NewTransaction(false)
+	return &badgerIterator{
+		txn:   txn,
+		it:    txn.NewIterator(badger.IteratorOptions{}),
+		start: common.CopyBytes(start),
+		limit: common.CopyBytes(limit),
+	}
+}
+
+// Stat returns the size of the Badger LSM tree and value log along with its
+// tables, whatever the property asked for.
+func (db *BadgerDatabase) Stat(property string) (string, error) {
+	lsm, vlog := db.db.Size()
+
+	var levels []int
+	for _, table := range db.db.Tables() {
+		for len(levels) <= table.Level {
+			levels = append(levels, 0)
+		}
+		levels[table.Level]++
+	}
+	stats := fmt.Sprintf("LSM size: %v, value log size: %v\n", common.StorageSize(lsm), common.StorageSize(vlog))
+	for level, tables := range levels {
+		stats += fmt.Sprintf("Level %d: %d tables\n", level, tables)
+	}
+	return stats, nil
+}
+
+// Compact reclaims the value log space of the deleted and overwritten values.
+// Badger compacts its LSM tree in the background and cannot flatten a key
+// range on demand, so the range is ignored and the whole value log rewritten
+// as far as it holds stale data.
+func (db *BadgerDatabase) Compact(start []byte, limit []byte) error {
+	for {
+		switch err := db.db.RunValueLogGC(badgerGCDiscardRatio); err {
+		case nil:
+		case badger.ErrNoRewrite, badger.ErrRejected:
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+func (db *BadgerDatabase) NewBatch() Batch {
+	return &badgerBatch{db: db.db}
+}
+
+// badgerOp is a write queued in a Badger batch, a delete if value is nil.
+type badgerOp struct {
+	key   []byte
+	value []byte
+}
+
+type badgerBatch struct {
+	db   *badger.DB
+	ops  []badgerOp
+	size int
+}
+
+func (b *badgerBatch) Put(key, value []byte) error {
+	b.ops = append(b.ops, badgerOp{common.CopyBytes(key), append([]byte{}, value...)})
+	b.size += len(value)
+	return nil
+}
+
+func (b *badgerBatch) Delete(key []byte) error {
+	b.ops = append(b.ops, badgerOp{common.CopyBytes(key), nil})
+	b.size += len(key)
+	return nil
+}
+
+// Write commits the queued writes, split over several transactions if they
+// exceed the Badger transaction size limit.
+func (b *badgerBatch) Write() error {
+	txn := b.db.NewTransaction(true)
+	defer func() { txn.Discard() }()
+
+	for i := 0; i < len(b.ops); {
+		var err error
+		if op := b.ops[i]; op.value == nil {
+			err = txn.Delete(op.key)
+		} else {
+			err = txn.Set(op.key, op.value)
+		}
+		switch err {
+		case nil:
+			i++
+		case badger.ErrTxnTooBig:
+			if err := txn.Commit(nil); err != nil {
+				return err
+			}
+			txn = b.db.NewTransaction(true)
+		default:
+			return err
+		}
+	}
+	return txn.Commit(nil)
+}
+
+func (b *badgerBatch) ValueSize() int {
+	return b.size
+}
+
+func (b *badgerBatch) Reset() {
+	b.ops = b.ops[:0]
+	b.size = 0
+}
+
+// badgerIterator adapts a Badger iterator, which has to be positioned on its
+// first key explicitly and runs in a read-only transaction, to the Iterator
+// interface.
+type badgerIterator struct {
+	txn   *badger.Txn
+	it    *badger.Iterator
+	start []byte
+	limit []byte
+	moved bool
+	value []byte
+	err   error
+}
+
+func (it *badgerIterator) Next() bool {
+	if it.it == nil || it.err != nil {
+		return false
+	}
+	if !it.moved {
+		it.moved = true
+		it.it.Seek(it.start)
+	} else {
+		it.it.Next()
+	}
+	if !it.it.Valid() {
+		return false
+	}
+	if it.limit != nil && bytes.Compare(it.it.Item().Key(), it.limit) >= 0 {
+		return false
+	}
+	// Copy the value out of the value log so the transaction holds no lock on
+	// its files while iterating
+	it.value, it.err = it.it.Item().ValueCopy(it.value[:0])
+	return it.err == nil
+}
+
+func (it *badgerIterator) Error() error {
+	return it.err
+}
+
+func (it *badgerIterator) Key() []byte {
+	if it.it == nil || !it.moved || !it.it.Valid() {
+		return nil
+	}
+	return it.it.Item().Key()
+}
+
+func (it *badgerIterator) Value() []byte {
+	if it.it == nil || !it.moved || !it.it.Valid() {
+		return nil
+	}
+	return it.value
+}
+
+func (it *badgerIterator) Release() {
+	if it.it != nil {
+		it.it.Close()
+		it.txn.Discard()
+		it.it, it.txn = nil, nil
+	}
+}
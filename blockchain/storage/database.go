@@ -29,6 +29,7 @@ import (
 	"github.com/syndtr/goleveldb/leveldb/filter"
 	"github.com/syndtr/goleveldb/leveldb/iterator"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 
 	gometrics "github.com/rcrowley/go-metrics"
 )
@@ -53,6 +54,8 @@ type LDBDatabase struct {
 	quitChan chan chan error // Quit channel to stop the metrics collection before closing the database
 
 	log log.Logger // Contextual logger tracking the database path
+
+	ancientStore // Ancient block store, if any
 }
 
 // NewLDBDatabase returns a LevelDB wrapped object.
@@ -149,6 +152,26 @@ func (db *LDBDatabase) NewIterator() iterator.Iterator {
 	return db.db.NewIterator(nil, nil)
 }
 
+// NewIteratorWithPrefix iterates over the keys starting with prefix.
+func (db *LDBDatabase) NewIteratorWithPrefix(prefix []byte) Iterator {
+	return db.db.NewIterator(util.BytesPrefix(prefix), nil)
+}
+
+// NewIteratorWithRange iterates over the keys in [start, limit).
+func (db *LDBDatabase) NewIteratorWithRange(start []byte, limit []byte) Iterator {
+	return db.db.NewIterator(&util.Range{Start: start, Limit: limit}, nil)
+}
+
+// Stat returns a leveldb property, such as "leveldb.stats".
+func (db *LDBDatabase) Stat(property string) (string, error) {
+	return db.db.GetProperty(property)
+}
+
+// Compact flattens the leveldb tables of the key range [start, limit).
+func (db *LDBDatabase) Compact(start []byte, limit []byte) error {
+	return db.db.CompactRange(util.Range{Start: start, Limit: limit})
+}
+
 func (db *LDBDatabase) Close() {
 	// Stop the metrics collection to avoid internal database races
 	db.quitLock.Lock()
@@ -161,6 +184,9 @@ func (db *LDBDatabase) Close() {
 			db.log.Error("Metrics collection failed", "err", err)
 		}
 	}
+	if err := db.closeFreezer(); err != nil {
+		db.log.Error("Failed to close ancient store", "err", err)
+	}
 	err := db.db.Close()
 	if err == nil {
 		db.log.Info("Database closed")
@@ -291,6 +317,12 @@ func (b *ldbBatch) Put(key, value []byte) error {
 	return nil
 }
 
+func (b *ldbBatch) Delete(key []byte) error {
+	b.b.Delete(key)
+	b.size += len(key)
+	return nil
+}
+
 func (b *ldbBatch) Write() error {
 	return b.db.Write(b.b, nil)
 }
@@ -299,6 +331,11 @@ func (b *ldbBatch) ValueSize() int {
 	return b.size
 }
 
+func (b *ldbBatch) Reset() {
+	b.b.Reset()
+	b.size = 0
+}
+
 type table struct {
 	db     Database
 	prefix string
@@ -333,6 +370,60 @@ func (dt *table) Close() {
 	// Do nothing; don't close the underlying DB.
 }
 
+func (dt *table) NewIteratorWithPrefix(prefix []byte) Iterator {
+	return &tableIterator{
+		it:     dt.db.NewIteratorWithPrefix(append([]byte(dt.prefix), prefix...)),
+		prefix: dt.prefix,
+	}
+}
+
+func (dt *table) NewIteratorWithRange(start []byte, limit []byte) Iterator {
+	start, limit = dt.keyRange(start, limit)
+	return &tableIterator{
+		it:     dt.db.NewIteratorWithRange(start, limit),
+		prefix: dt.prefix,
+	}
+}
+
+func (dt *table) Stat(property string) (string, error) {
+	return dt.db.Stat(property)
+}
+
+func (dt *table) Compact(start []byte, limit []byte) error {
+	start, limit = dt.keyRange(start, limit)
+	return dt.db.Compact(start, limit)
+}
+
+// keyRange maps a key range of the table onto the underlying database, open
+// bounds being replaced by the bounds of the prefix.
+func (dt *table) keyRange(start, limit []byte) ([]byte, []byte) {
+	bounds := util.BytesPrefix([]byte(dt.prefix))
+	if start == nil {
+		start = bounds.Start
+	} else {
+		start = append([]byte(dt.prefix), start...)
+	}
+	if limit == nil {
+		limit = bounds.Limit
+	} else {
+		limit = append([]byte(dt.prefix), limit...)
+	}
+	return start, limit
+}
+
+// tableIterator strips the table prefix from the keys of an iterator over the
+// underlying database.
+type tableIterator struct {
+	it     Iterator
+	prefix string
+}
+
+func (it *tableIterator) Next() bool    { return it.it.Next() }
+func (it *tableIterator) Error() error  { return it.it.Error() }
+func (it *tableIterator) Key() []byte   { return it.it.Key()[len(it.prefix):] }
+func (it *tableIterator) Value() []byte { return it.it.Value() }
+func (it *tableIterator) Release()      { it.it.Release() }
+
 type tableBatch struct {
 	batch  Batch
 	prefix string
@@ -351,6 +442,10 @@ func (tb *tableBatch) Put(key, value []byte) error {
 	return tb.batch.Put(append([]byte(tb.prefix), key...), value)
 }
 
+func (tb *tableBatch) Delete(key []byte) error {
+	return tb.batch.Delete(append([]byte(tb.prefix), key...))
+}
+
 func (tb *tableBatch) Write() error {
 	return tb.batch.Write()
 }
@@ -358,3 +453,7 @@ func (tb *tableBatch) Write() error {
 func (tb *tableBatch) ValueSize() int {
 	return tb.batch.ValueSize()
 }
+
+func (tb *tableBatch) Reset() {
+	tb.batch.Reset()
+}
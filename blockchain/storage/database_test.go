@@ -0,0 +1,153 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package hpbdb_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/blockchain/storage/dbtest"
+)
+
+// newTestEngine returns a constructor of empty databases of the given engine
+// for the conformance suite.
+func newTestEngine(t *testing.T, engine string) func() (hpbdb.Database, func()) {
+	return func() (hpbdb.Database, func()) {
+		dir, err := ioutil.TempDir("", "hpbdb-test")
+		if err != nil {
+			t.Fatalf("failed to create temp dir: %v", err)
+		}
+		db, err := hpbdb.Open(engine, dir, 0, 0)
+		if err != nil {
+			os.RemoveAll(dir)
+			t.Fatalf("failed to open database: %v", err)
+		}
+		return db, func() {
+			db.Close()
+			os.RemoveAll(dir)
+		}
+	}
+}
+
+func TestLevelDB(t *testing.T) {
+	dbtest.TestDatabaseSuite(t, newTestEngine(t, hpbdb.EngineLevelDB))
+}
+
+func TestBadger(t *testing.T) {
+	dbtest.TestDatabaseSuite(t, newTestEngine(t, hpbdb.EngineBadger))
+}
+
+// Tests that a batch too large for a single Badger transaction is committed
+// over several ones.
+func TestBadgerLargeBatch(t *testing.T) {
+	db, release := newTestEngine(t, hpbdb.EngineBadger)()
+	defer release()
+
+	// The smallest cache admits about ten thousand writes per transaction
+	key := func(i int) []byte { return []byte{byte(i >> 16), byte(i >> 8), byte(i)} }
+
+	batch := db.NewBatch()
+	for i := 0; i < 50000; i++ {
+		batch.Put(key(i), key(i))
+	}
+	if err := batch.Write(); err != nil {
+		t.Fatalf("batch write failed: %v", err)
+	}
+	for i := 0; i < 50000; i++ {
+		if value, err := db.Get(key(i)); err != nil || !bytes.Equal(value, key(i)) {
+			t.Fatalf("entry %d mismatch: have %x, err %v", i, value, err)
+		}
+	}
+}
+
+func TestMemoryDatabase(t *testing.T) {
+	dbtest.TestDatabaseSuite(t, func() (hpbdb.Database, func()) {
+		db, _ := hpbdb.NewMemDatabase()
+		return db, func() {}
+	})
+}
+
+func TestTable(t *testing.T) {
+	dbtest.TestDatabaseSuite(t, func() (hpbdb.Database, func()) {
+		db, _ := hpbdb.NewMemDatabase()
+		// Keys around the prefix must stay invisible through the table
+		db.Put([]byte("s"), []byte("before"))
+		db.Put([]byte("t."), []byte("other"))
+		db.Put([]byte("u"), []byte("after"))
+		return hpbdb.NewTable(db, "t-"), func() {}
+	})
+}
+
+// Tests that a database cannot be reopened with another engine than the one it
+// was created with, and that the recorded engine is used by default.
+func TestEngineRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hpbdb-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "chaindata")
+	db, err := hpbdb.Open("", path, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	db.Close()
+
+	if engine, err := hpbdb.DatabaseEngine(path); err != nil || engine != hpbdb.DefaultEngine {
+		t.Fatalf("recorded engine mismatch: have %q, want %q, err %v", engine, hpbdb.DefaultEngine, err)
+	}
+	if db, err := hpbdb.Open(hpbdb.EngineBadger, path, 0, 0); err == nil {
+		db.Close()
+		t.Fatalf("database opened with another engine")
+	}
+	if engine, err := hpbdb.DatabaseEngine(path); err != nil || engine != hpbdb.DefaultEngine {
+		t.Fatalf("recorded engine changed by the refused open: have %q, err %v", engine, err)
+	}
+	if _, err := hpbdb.Open("unknown", filepath.Join(dir, "other"), 0, 0); err == nil {
+		t.Fatalf("database created with an unknown engine")
+	}
+	db, err = hpbdb.Open("", path, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to reopen database: %v", err)
+	}
+	db.Close()
+
+	// The same holds the other way around for a database of the other engine
+	path = filepath.Join(dir, "badger")
+	if db, err = hpbdb.Open(hpbdb.EngineBadger, path, 0, 0); err != nil {
+		t.Fatalf("failed to create badger database: %v", err)
+	}
+	db.Put([]byte("key"), []byte("value"))
+	db.Close()
+
+	if db, err := hpbdb.Open(hpbdb.EngineLevelDB, path, 0, 0); err == nil {
+		db.Close()
+		t.Fatalf("badger database opened with leveldb")
+	}
+	if db, err = hpbdb.Open("", path, 0, 0); err != nil {
+		t.Fatalf("failed to reopen badger database: %v", err)
+	}
+	defer db.Close()
+	if value, err := db.Get([]byte("key")); err != nil || string(value) != "value" {
+		t.Fatalf("value mismatch after reopen: have %q, err %v", value, err)
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+// Package dbtest implements a conformance test suite for the hpbdb.Database
+// implementations.
+package dbtest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+)
+
+// TestDatabaseSuite runs the conformance tests against databases created by
+// New, which must return an empty database and a function releasing it.
+func TestDatabaseSuite(t *testing.T, New func() (hpbdb.Database, func())) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, db hpbdb.Database)
+	}{
+		{"KeyValue", testKeyValue},
+		{"Iteration", testIteration},
+		{"Batch", testBatch},
+		{"Compact", testCompact},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, release := New()
+			defer release()
+			tt.test(t, db)
+		})
+	}
+}
+
+func testKeyValue(t *testing.T, db hpbdb.Database) {
+	if ok, err := db.Has([]byte("missing")); ok || err != nil {
+		t.Errorf("missing key reported: ok %v, err %v", ok, err)
+	}
+	if _, err := db.Get([]byte("missing")); err == nil {
+		t.Errorf("missing key retrieved without error")
+	}
+	for _, value := range []string{"value", "", "overwritten"} {
+		if err := db.Put([]byte("key"), []byte(value)); err != nil {
+			t.Fatalf("put %q failed: %v", value, err)
+		}
+		if ok, err := db.Has([]byte("key")); !ok || err != nil {
+			t.Errorf("stored key not reported: ok %v, err %v", ok, err)
+		}
+		if have, err := db.Get([]byte("key")); err != nil || !bytes.Equal(have, []byte(value)) {
+			t.Errorf("value mismatch: have %q, want %q, err %v", have, value, err)
+		}
+	}
+	// The database must not keep a reference to the caller's buffers
+	buf := []byte("before")
+	db.Put([]byte("key"), buf)
+	copy(buf, "after!")
+	if have, _ := db.Get([]byte("key")); string(have) != "before" {
+		t.Errorf("stored value changed with the caller's buffer: have %q", have)
+	}
+	if err := db.Delete([]byte("key")); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if ok, _ := db.Has([]byte("key")); ok {
+		t.Errorf("deleted key still reported")
+	}
+	if err := db.Delete([]byte("missing")); err != nil {
+		t.Errorf("deleting a missing key failed: %v", err)
+	}
+}
+
+// collect drains an iterator into a "key=value,..." listing.
+func collect(t *testing.T, it hpbdb.Iterator) string {
+	defer it.Release()
+
+	var pairs []string
+	for it.Next() {
+		pairs = append(pairs, string(it.Key())+"="+string(it.Value()))
+	}
+	if err := it.Error(); err != nil {
+		t.Fatalf("iteration failed: %v", err)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func testIteration(t *testing.T, db hpbdb.Database) {
+	if have := collect(t, db.NewIteratorWithPrefix(nil)); have != "" {
+		t.Errorf("empty database iterated: %q", have)
+	}
+	for _, key := range []string{"b2", "a1", "b1", "c", "a2", "\xff"} {
+		db.Put([]byte(key), []byte(key[:1]))
+	}
+	tests := []struct {
+		it   hpbdb.Iterator
+		want string
+	}{
+		{db.NewIteratorWithPrefix(nil), "a1=a,a2=a,b1=b,b2=b,c=c,\xff=\xff"},
+		{db.NewIteratorWithPrefix([]byte("b")), "b1=b,b2=b"},
+		{db.NewIteratorWithPrefix([]byte("\xff")), "\xff=\xff"},
+		{db.NewIteratorWithPrefix([]byte("d")), ""},
+		{db.NewIteratorWithRange([]byte("a2"), []byte("c")), "a2=a,b1=b,b2=b"},
+		{db.NewIteratorWithRange(nil, []byte("b1")), "a1=a,a2=a"},
+		{db.NewIteratorWithRange([]byte("b2"), nil), "b2=b,c=c,\xff=\xff"},
+		{db.NewIteratorWithRange([]byte("c"), []byte("c")), ""},
+	}
+	for i, tt := range tests {
+		if have := collect(t, tt.it); have != tt.want {
+			t.Errorf("test %d: iteration mismatch: have %q, want %q", i, have, tt.want)
+		}
+	}
+	// Writes after the creation of an iterator must not break it
+	it := db.NewIteratorWithPrefix([]byte("a"))
+	db.Put([]byte("a3"), []byte("a"))
+	db.Delete([]byte("a1"))
+	for it.Next() {
+		if !bytes.HasPrefix(it.Key(), []byte("a")) {
+			t.Errorf("iterator out of its prefix: %q", it.Key())
+		}
+	}
+	if err := it.Error(); err != nil {
+		t.Errorf("iteration failed after writes: %v", err)
+	}
+	it.Release()
+}
+
+func testBatch(t *testing.T, db hpbdb.Database) {
+	db.Put([]byte("a"), []byte("1"))
+
+	batch := db.NewBatch()
+	batch.Put([]byte("b"), []byte("2"))
+	if batch.ValueSize() == 0 {
+		t.Errorf("batch size not accounted")
+	}
+	if ok, _ := db.Has([]byte("b")); ok {
+		t.Errorf("batch written before Write")
+	}
+	batch.Reset()
+	if size := batch.ValueSize(); size != 0 {
+		t.Errorf("reset batch size: have %d, want 0", size)
+	}
+	batch.Delete([]byte("a"))
+	batch.Put([]byte("c"), []byte("3"))
+	batch.Put([]byte("d"), []byte("4"))
+	batch.Delete([]byte("d"))
+	if err := batch.Write(); err != nil {
+		t.Fatalf("batch write failed: %v", err)
+	}
+	if have := collect(t, db.NewIteratorWithPrefix(nil)); have != "c=3" {
+		t.Errorf("database contents mismatch: have %q, want %q", have, "c=3")
+	}
+	// A reset batch can be reused
+	batch.Reset()
+	batch.Put([]byte("e"), []byte("5"))
+	if err := batch.Write(); err != nil {
+		t.Fatalf("reused batch write failed: %v", err)
+	}
+	if have := collect(t, db.NewIteratorWithPrefix(nil)); have != "c=3,e=5" {
+		t.Errorf("database contents mismatch: have %q, want %q", have, "c=3,e=5")
+	}
+}
+
+func testCompact(t *testing.T, db hpbdb.Database) {
+	for i := 0; i < 256; i++ {
+		db.Put([]byte{byte(i)}, bytes.Repeat([]byte{byte(i)}, 64))
+	}
+	for i := 0; i < 128; i++ {
+		db.Delete([]byte{byte(i)})
+	}
+	if err := db.Compact(nil, []byte{0x80}); err != nil {
+		t.Errorf("range compaction failed: %v", err)
+	}
+	if err := db.Compact(nil, nil); err != nil {
+		t.Errorf("full compaction failed: %v", err)
+	}
+	it := db.NewIteratorWithPrefix(nil)
+	defer it.Release()
+
+	for i := 128; i < 256; i++ {
+		if !it.Next() || !bytes.Equal(it.Key(), []byte{byte(i)}) {
+			t.Fatalf("key %d missing after compaction", i)
+		}
+	}
+	if it.Next() {
+		t.Errorf("deleted keys left after compaction")
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package hpbdb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hpb-project/go-hpb/common"
+)
+
+// Storage engines a database can be opened with.
+const (
+	EngineLevelDB = "leveldb" // goleveldb, the default engine
+	EngineBadger  = "badger"  // Badger, a pure Go LSM engine with a separate value log
+)
+
+// DefaultEngine is the engine new databases are created with if none is given.
+const DefaultEngine = EngineLevelDB
+
+// engineFile is the file in the database directory recording the engine the
+// database was created with.
+const engineFile = "ENGINE"
+
+// OpenFunc opens or creates an on-disk database with the given megabytes of
+// cache and number of file handles.
+type OpenFunc func(file string, cache int, handles int) (AncientStore, error)
+
+// engines holds the storage engines compiled into the binary.
+var engines = map[string]OpenFunc{
+	EngineLevelDB: func(file string, cache int, handles int) (AncientStore, error) {
+		return NewLDBDatabase(file, cache, handles)
+	},
+	EngineBadger: func(file string, cache int, handles int) (AncientStore, error) {
+		return NewBadgerDatabase(file, cache, handles)
+	},
+}
+
+// Engines returns the names of the storage engines compiled into the binary.
+func Engines() []string {
+	names := make([]string, 0, len(engines))
+	for name := range engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DatabaseEngine returns the engine the database in dir was created with, or
+// an empty string if there is no database. Databases predating the engine
+// record are LevelDB ones.
+func DatabaseEngine(dir string) (string, error) {
+	blob, err := ioutil.ReadFile(filepath.Join(dir, engineFile))
+	switch {
+	case err == nil:
+		return strings.TrimSpace(string(blob)), nil
+	case !os.IsNotExist(err):
+		return "", err
+	case common.FileExist(filepath.Join(dir, "CURRENT")):
+		return EngineLevelDB, nil
+	default:
+		return "", nil
+	}
+}
+
+// Open opens the database in dir with the given engine, creating it if needed.
+// An empty engine selects the engine of the existing database, or the default
+// one for a new database. Opening a database with another engine than the one
+// it was created with fails.
+func Open(engine string, dir string, cache int, handles int) (AncientStore, error) {
+	existing, err := DatabaseEngine(dir)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case engine == "" && existing != "":
+		engine = existing
+	case engine == "":
+		engine = DefaultEngine
+	case existing != "" && engine != existing:
+		return nil, fmt.Errorf("database %s was created with the %s engine, cannot open it with %s", dir, existing, engine)
+	}
+	open, ok := engines[engine]
+	if !ok {
+		return nil, fmt.Errorf("unsupported database engine %q, available: %s", engine, strings.Join(Engines(), ", "))
+	}
+	db, err := open(dir, cache, handles)
+	if err != nil {
+		return nil, err
+	}
+	if existing == "" || !common.FileExist(filepath.Join(dir, engineFile)) {
+		if err := ioutil.WriteFile(filepath.Join(dir, engineFile), []byte(engine+"\n"), 0644); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return db, nil
+}
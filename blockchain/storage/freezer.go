@@ -0,0 +1,222 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package hpbdb
+
+import (
+	"errors"
+	"os"
+	"sync/atomic"
+
+	"github.com/hpb-project/go-hpb/common/log"
+)
+
+// Tables of the ancient block store, each holding one item per block number.
+const (
+	FreezerHashTable       = "hashes"   // Canonical block hashes
+	FreezerHeaderTable     = "headers"  // Block headers
+	FreezerBodiesTable     = "bodies"   // Block bodies
+	FreezerReceiptTable    = "receipts" // Block receipts
+	FreezerDifficultyTable = "diffs"    // Block total difficulties
+)
+
+// freezerTables lists the tables of the ancient block store and whether their
+// items are compressed.
+var freezerTables = map[string]bool{
+	FreezerHashTable:       false,
+	FreezerHeaderTable:     true,
+	FreezerBodiesTable:     true,
+	FreezerReceiptTable:    true,
+	FreezerDifficultyTable: false,
+}
+
+var errUnknownTable = errors.New("unknown table")
+
+// Freezer is an append-only store of the canonical blocks old enough not to be
+// reorganised anymore, keeping them out of LevelDB. Blocks are stored in flat
+// files per table, indexed by block number.
+type Freezer struct {
+	frozen uint64 // Number of blocks stored, must be accessed atomically
+
+	tables map[string]*freezerTable
+}
+
+// NewFreezer opens the ancient block store in dir, creating it if needed.
+// Tables left with different lengths by a crash are cut back to the shortest.
+func NewFreezer(dir string) (*Freezer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	f := &Freezer{tables: make(map[string]*freezerTable)}
+	for name, compress := range freezerTables {
+		table, err := newFreezerTable(dir, name, compress)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		f.tables[name] = table
+	}
+	frozen := ^uint64(0)
+	for _, table := range f.tables {
+		if items := table.Items(); items < frozen {
+			frozen = items
+		}
+	}
+	f.frozen = frozen
+	if err := f.TruncateAncients(frozen); err != nil {
+		f.Close()
+		return nil, err
+	}
+	log.Info("Opened ancient block store", "path", dir, "blocks", frozen)
+	return f, nil
+}
+
+// AncientStore is implemented by the on-disk databases an ancient block store
+// can be attached to.
+type AncientStore interface {
+	Database
+	AncientReader
+
+	// SetFreezer attaches the ancient block store holding the blocks migrated
+	// out of the database. It is closed along with the database.
+	SetFreezer(freezer *Freezer)
+
+	// Freezer returns the attached ancient block store, nil if none.
+	Freezer() *Freezer
+}
+
+// ancientStore implements the ancient block store attachment of AncientStore,
+// to be embedded in the database implementations.
+type ancientStore struct {
+	freezer *Freezer
+}
+
+func (s *ancientStore) SetFreezer(freezer *Freezer) {
+	s.freezer = freezer
+}
+
+func (s *ancientStore) Freezer() *Freezer {
+	return s.freezer
+}
+
+// Ancient retrieves an item of the attached ancient block store.
+func (s *ancientStore) Ancient(kind string, number uint64) ([]byte, error) {
+	if s.freezer == nil {
+		return nil, errOutOfBounds
+	}
+	return s.freezer.Ancient(kind, number)
+}
+
+// Ancients returns the number of blocks in the attached ancient block store.
+func (s *ancientStore) Ancients() uint64 {
+	if s.freezer == nil {
+		return 0
+	}
+	return s.freezer.Ancients()
+}
+
+func (s *ancientStore) closeFreezer() error {
+	if s.freezer == nil {
+		return nil
+	}
+	return s.freezer.Close()
+}
+
+// Ancient retrieves the item of the given table for a block number.
+func (f *Freezer) Ancient(kind string, number uint64) ([]byte, error) {
+	table, ok := f.tables[kind]
+	if !ok {
+		return nil, errUnknownTable
+	}
+	if number >= atomic.LoadUint64(&f.frozen) {
+		return nil, errOutOfBounds
+	}
+	return table.Retrieve(number)
+}
+
+// Ancients returns the number of blocks in the store.
+func (f *Freezer) Ancients() uint64 {
+	return atomic.LoadUint64(&f.frozen)
+}
+
+// AppendAncient stores the next block. The items are only visible once all of
+// them are written.
+func (f *Freezer) AppendAncient(number uint64, hash, header, body, receipts, td []byte) error {
+	items := map[string][]byte{
+		FreezerHashTable:       hash,
+		FreezerHeaderTable:     header,
+		FreezerBodiesTable:     body,
+		FreezerReceiptTable:    receipts,
+		FreezerDifficultyTable: td,
+	}
+	for name, item := range items {
+		if err := f.tables[name].Append(number, item); err != nil {
+			// Roll the tables back so they stay the same length
+			for _, table := range f.tables {
+				table.truncate(number)
+			}
+			return err
+		}
+	}
+	atomic.StoreUint64(&f.frozen, number+1)
+	return nil
+}
+
+// TruncateAncients drops the blocks from the given number onwards.
+func (f *Freezer) TruncateAncients(items uint64) error {
+	if items < atomic.LoadUint64(&f.frozen) {
+		atomic.StoreUint64(&f.frozen, items)
+	}
+	for _, table := range f.tables {
+		if err := table.truncate(items); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Size returns the total size of the store files.
+func (f *Freezer) Size() uint64 {
+	var size uint64
+	for _, table := range f.tables {
+		size += table.Size()
+	}
+	return size
+}
+
+// Sync flushes all tables to disk.
+func (f *Freezer) Sync() error {
+	for _, table := range f.tables {
+		if err := table.Sync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes all tables.
+func (f *Freezer) Close() error {
+	var errs []error
+	for _, table := range f.tables {
+		if err := table.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
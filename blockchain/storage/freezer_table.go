@@ -0,0 +1,247 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package hpbdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/golang/snappy"
+)
+
+// indexEntrySize is the size of an index entry, the big endian end offset of
+// the item in the data file.
+const indexEntrySize = 8
+
+var (
+	errOutOfBounds       = errors.New("out of bounds")
+	errOutOrderInsertion = errors.New("the append operation is out-order")
+	errClosed            = errors.New("closed")
+)
+
+// freezerTable is an append-only table of items numbered from zero, stored in a
+// flat data file with an index of their end offsets.
+type freezerTable struct {
+	name     string
+	compress bool // Whether items are snappy compressed
+
+	index *os.File // Index file, the end offset of every item
+	data  *os.File // Data file, the items back to back
+	items uint64   // Number of items stored
+	size  uint64   // Size of the data file
+
+	lock sync.RWMutex
+}
+
+// newFreezerTable opens the table of the given name in dir, repairing a data
+// file or index left inconsistent by a crash.
+func newFreezerTable(dir, name string, compress bool) (*freezerTable, error) {
+	ext := ".rdat"
+	if compress {
+		ext = ".cdat"
+	}
+	index, err := os.OpenFile(filepath.Join(dir, name+".idx"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.OpenFile(filepath.Join(dir, name+ext), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		index.Close()
+		return nil, err
+	}
+	t := &freezerTable{name: name, compress: compress, index: index, data: data}
+	if err := t.repair(); err != nil {
+		t.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// repair drops the trailing items whose index entry or data is incomplete.
+func (t *freezerTable) repair() error {
+	istat, err := t.index.Stat()
+	if err != nil {
+		return err
+	}
+	dstat, err := t.data.Stat()
+	if err != nil {
+		return err
+	}
+	items := uint64(istat.Size()) / indexEntrySize
+	for ; items > 0; items-- {
+		end, err := t.offset(items)
+		if err != nil {
+			return err
+		}
+		if end <= uint64(dstat.Size()) {
+			break
+		}
+	}
+	return t.truncateFiles(items)
+}
+
+// offset returns the end offset of the given item count, 0 for no items.
+func (t *freezerTable) offset(items uint64) (uint64, error) {
+	if items == 0 {
+		return 0, nil
+	}
+	buf := make([]byte, indexEntrySize)
+	if _, err := t.index.ReadAt(buf, int64((items-1)*indexEntrySize)); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buf), nil
+}
+
+// truncateFiles cuts the table down to the given number of items.
+func (t *freezerTable) truncateFiles(items uint64) error {
+	end, err := t.offset(items)
+	if err != nil {
+		return err
+	}
+	if err := t.index.Truncate(int64(items * indexEntrySize)); err != nil {
+		return err
+	}
+	if err := t.data.Truncate(int64(end)); err != nil {
+		return err
+	}
+	t.items, t.size = items, end
+	return nil
+}
+
+// truncate drops the items from the given number onwards.
+func (t *freezerTable) truncate(items uint64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil {
+		return errClosed
+	}
+	if items >= t.items {
+		return nil
+	}
+	return t.truncateFiles(items)
+}
+
+// Append adds the next item to the table.
+func (t *freezerTable) Append(item uint64, blob []byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil {
+		return errClosed
+	}
+	if item != t.items {
+		return fmt.Errorf("%s: appending item %d, have %d: %v", t.name, item, t.items, errOutOrderInsertion)
+	}
+	if t.compress {
+		blob = snappy.Encode(nil, blob)
+	}
+	if _, err := t.data.WriteAt(blob, int64(t.size)); err != nil {
+		return err
+	}
+	entry := make([]byte, indexEntrySize)
+	binary.BigEndian.PutUint64(entry, t.size+uint64(len(blob)))
+	if _, err := t.index.WriteAt(entry, int64(t.items*indexEntrySize)); err != nil {
+		return err
+	}
+	t.items, t.size = t.items+1, t.size+uint64(len(blob))
+	return nil
+}
+
+// Retrieve returns the item with the given number.
+func (t *freezerTable) Retrieve(item uint64) ([]byte, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if t.index == nil {
+		return nil, errClosed
+	}
+	if item >= t.items {
+		return nil, errOutOfBounds
+	}
+	start, err := t.offset(item)
+	if err != nil {
+		return nil, err
+	}
+	end, err := t.offset(item + 1)
+	if err != nil {
+		return nil, err
+	}
+	blob := make([]byte, end-start)
+	if _, err := t.data.ReadAt(blob, int64(start)); err != nil {
+		return nil, err
+	}
+	if t.compress {
+		return snappy.Decode(nil, blob)
+	}
+	return blob, nil
+}
+
+// Items returns the number of items in the table.
+func (t *freezerTable) Items() uint64 {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.items
+}
+
+// Size returns the total size of the data and index files.
+func (t *freezerTable) Size() uint64 {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.size + t.items*indexEntrySize
+}
+
+// Sync flushes the table files to disk, data first.
+func (t *freezerTable) Sync() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil {
+		return errClosed
+	}
+	if err := t.data.Sync(); err != nil {
+		return err
+	}
+	return t.index.Sync()
+}
+
+// Close closes the table files.
+func (t *freezerTable) Close() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var errs []error
+	for _, f := range []*os.File{t.index, t.data} {
+		if f == nil {
+			continue
+		}
+		if err := f.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	t.index, t.data = nil, nil
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package hpbdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testItem returns a blob of the given item filled with a repetitive pattern,
+// growing with the item number to exercise varying sizes.
+func testItem(item uint64) []byte {
+	return bytes.Repeat([]byte{byte(item)}, int(item%7)*16+1)
+}
+
+// fillTable appends the given number of test items to the table.
+func fillTable(t *testing.T, table *freezerTable, items uint64) {
+	for i := uint64(0); i < items; i++ {
+		if err := table.Append(i, testItem(i)); err != nil {
+			t.Fatalf("failed to append item %d: %v", i, err)
+		}
+	}
+}
+
+// checkTable verifies that the table holds exactly the given number of test items.
+func checkTable(t *testing.T, table *freezerTable, items uint64) {
+	if have := table.Items(); have != items {
+		t.Fatalf("item count mismatch: have %d, want %d", have, items)
+	}
+	for i := uint64(0); i < items; i++ {
+		blob, err := table.Retrieve(i)
+		if err != nil {
+			t.Fatalf("failed to retrieve item %d: %v", i, err)
+		}
+		if !bytes.Equal(blob, testItem(i)) {
+			t.Fatalf("item %d mismatch: have %x, want %x", i, blob, testItem(i))
+		}
+	}
+	if _, err := table.Retrieve(items); err != errOutOfBounds {
+		t.Fatalf("item past the end: have error %v, want %v", err, errOutOfBounds)
+	}
+}
+
+// Tests that items appended to a table can be retrieved, both raw and
+// compressed, and that out of order appends are rejected.
+func TestFreezerTableAppendRetrieve(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		dir, err := ioutil.TempDir("", "freezer-table")
+		if err != nil {
+			t.Fatalf("failed to create temp dir: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		table, err := newFreezerTable(dir, "test", compress)
+		if err != nil {
+			t.Fatalf("failed to open table: %v", err)
+		}
+		fillTable(t, table, 100)
+		checkTable(t, table, 100)
+
+		if err := table.Append(101, testItem(101)); err == nil {
+			t.Errorf("compress %v: gapped append accepted", compress)
+		}
+		if err := table.Append(99, testItem(99)); err == nil {
+			t.Errorf("compress %v: repeated append accepted", compress)
+		}
+		table.Close()
+
+		if _, err := table.Retrieve(0); err != errClosed {
+			t.Errorf("compress %v: retrieval from closed table: have error %v, want %v", compress, err, errClosed)
+		}
+	}
+}
+
+// Tests that a table reopened after being closed serves all its items and
+// continues appending where it left off.
+func TestFreezerTableReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer-table")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	table, err := newFreezerTable(dir, "test", true)
+	if err != nil {
+		t.Fatalf("failed to open table: %v", err)
+	}
+	fillTable(t, table, 50)
+	if err := table.Sync(); err != nil {
+		t.Fatalf("failed to sync table: %v", err)
+	}
+	table.Close()
+
+	if table, err = newFreezerTable(dir, "test", true); err != nil {
+		t.Fatalf("failed to reopen table: %v", err)
+	}
+	defer table.Close()
+	checkTable(t, table, 50)
+
+	for i := uint64(50); i < 60; i++ {
+		if err := table.Append(i, testItem(i)); err != nil {
+			t.Fatalf("failed to append item %d after reopen: %v", i, err)
+		}
+	}
+	checkTable(t, table, 60)
+}
+
+// Tests that a table whose data or index file was cut short by a crash drops
+// the incomplete items on reopen and accepts them again afterwards.
+func TestFreezerTableTruncatedTail(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		cut   func(size int64) int64
+		items uint64
+	}{
+		// Half written last item in the data file
+		{"data", "test.rdat", func(size int64) int64 { return size - 1 }, 9},
+		// Half written last index entry
+		{"index", "test.idx", func(size int64) int64 { return size - indexEntrySize/2 }, 9},
+		// Index entries written but the data of the last three lost
+		{"data-lost", "test.rdat", func(size int64) int64 {
+			end := int64(0)
+			for i := uint64(0); i < 7; i++ {
+				end += int64(len(testItem(i)))
+			}
+			return end
+		}, 7},
+	}
+	for _, tt := range tests {
+		dir, err := ioutil.TempDir("", "freezer-table")
+		if err != nil {
+			t.Fatalf("failed to create temp dir: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		table, err := newFreezerTable(dir, "test", false)
+		if err != nil {
+			t.Fatalf("%s: failed to open table: %v", tt.name, err)
+		}
+		fillTable(t, table, 10)
+		table.Close()
+
+		path := filepath.Join(dir, tt.file)
+		stat, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("%s: failed to stat file: %v", tt.name, err)
+		}
+		if err := os.Truncate(path, tt.cut(stat.Size())); err != nil {
+			t.Fatalf("%s: failed to truncate file: %v", tt.name, err)
+		}
+		if table, err = newFreezerTable(dir, "test", false); err != nil {
+			t.Fatalf("%s: failed to reopen table: %v", tt.name, err)
+		}
+		checkTable(t, table, tt.items)
+
+		for i := tt.items; i < 10; i++ {
+			if err := table.Append(i, testItem(i)); err != nil {
+				t.Fatalf("%s: failed to append item %d after repair: %v", tt.name, i, err)
+			}
+		}
+		checkTable(t, table, 10)
+		table.Close()
+	}
+}
+
+// Tests that truncating a table drops its tail items, also across a reopen.
+func TestFreezerTableTruncate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer-table")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	table, err := newFreezerTable(dir, "test", true)
+	if err != nil {
+		t.Fatalf("failed to open table: %v", err)
+	}
+	fillTable(t, table, 20)
+	if err := table.truncate(30); err != nil {
+		t.Fatalf("failed to truncate beyond the end: %v", err)
+	}
+	checkTable(t, table, 20)
+	if err := table.truncate(12); err != nil {
+		t.Fatalf("failed to truncate table: %v", err)
+	}
+	checkTable(t, table, 12)
+	table.Close()
+
+	if table, err = newFreezerTable(dir, "test", true); err != nil {
+		t.Fatalf("failed to reopen table: %v", err)
+	}
+	defer table.Close()
+	checkTable(t, table, 12)
+}
@@ -25,20 +25,70 @@ type Putter interface {
 	Put(key []byte, value []byte) error
 }
 
+// Deleter wraps the database delete operation supported by both batches and regular databases.
+type Deleter interface {
+	Delete(key []byte) error
+}
+
 // Database wraps all database operations. All methods are safe for concurrent use.
 type Database interface {
 	Putter
+	Deleter
+	Iteratee
 	Get(key []byte) ([]byte, error)
 	Has(key []byte) (bool, error)
-	Delete(key []byte) error
 	Close()
 	NewBatch() Batch
+
+	// Stat returns a database specific statistic, such as "leveldb.stats".
+	Stat(property string) (string, error)
+
+	// Compact flattens the underlying storage of the key range [start, limit).
+	// A nil start is before all keys and a nil limit after all keys.
+	Compact(start []byte, limit []byte) error
 }
 
 // Batch is a write-only database that commits changes to its host database
 // when Write is called. Batch cannot be used concurrently.
 type Batch interface {
 	Putter
+	Deleter
 	ValueSize() int // amount of data in the batch
 	Write() error
+	Reset() // drops the queued changes so the batch can be reused
+}
+
+// Iterator iterates over the key/value pairs of a database in ascending key
+// order. The key and value returned must not be modified and are only valid
+// until the next call to Next. An iterator must be released after use.
+type Iterator interface {
+	// Next moves to the next pair, returning whether there is one.
+	Next() bool
+	// Error returns the error the iteration stopped on, if any.
+	Error() error
+	// Key returns the key of the current pair.
+	Key() []byte
+	// Value returns the value of the current pair.
+	Value() []byte
+	// Release releases the resources held by the iterator.
+	Release()
+}
+
+// Iteratee wraps the iterator creation of a database.
+type Iteratee interface {
+	// NewIteratorWithPrefix iterates over the keys starting with prefix, all
+	// keys for an empty prefix.
+	NewIteratorWithPrefix(prefix []byte) Iterator
+
+	// NewIteratorWithRange iterates over the keys in [start, limit). A nil
+	// start is before all keys and a nil limit after all keys.
+	NewIteratorWithRange(start []byte, limit []byte) Iterator
+}
+
+// AncientReader is implemented by databases backed by an ancient block store.
+type AncientReader interface {
+	// Ancient retrieves the item of the given freezer table for a block number.
+	Ancient(kind string, number uint64) ([]byte, error)
+	// Ancients returns the number of blocks in the ancient store.
+	Ancients() uint64
 }
@@ -17,7 +17,9 @@
 package hpbdb
 
 import (
+	"bytes"
 	"errors"
+	"sort"
 	"sync"
 
 	"github.com/hpb-project/go-hpb/common"
@@ -92,11 +94,96 @@ func (db *MemDatabase) Delete(key []byte) error {
 
 func (db *MemDatabase) Close() {}
 
+// NewIteratorWithPrefix iterates over a snapshot of the keys starting with
+// prefix.
+func (db *MemDatabase) NewIteratorWithPrefix(prefix []byte) Iterator {
+	return db.newIterator(func(key []byte) bool {
+		return bytes.HasPrefix(key, prefix)
+	})
+}
+
+// NewIteratorWithRange iterates over a snapshot of the keys in [start, limit).
+func (db *MemDatabase) NewIteratorWithRange(start []byte, limit []byte) Iterator {
+	return db.newIterator(func(key []byte) bool {
+		return bytes.Compare(key, start) >= 0 && (limit == nil || bytes.Compare(key, limit) < 0)
+	})
+}
+
+func (db *MemDatabase) newIterator(match func(key []byte) bool) Iterator {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	it := &memIterator{index: -1}
+	for key, value := range db.db {
+		if match([]byte(key)) {
+			it.keys = append(it.keys, key)
+			it.values = append(it.values, value)
+		}
+	}
+	sort.Sort(it)
+	return it
+}
+
+// Stat returns nothing, the memory database keeps no statistics.
+func (db *MemDatabase) Stat(property string) (string, error) {
+	return "", errors.New("unknown property")
+}
+
+// Compact does nothing, there is nothing to compact in memory.
+func (db *MemDatabase) Compact(start []byte, limit []byte) error {
+	return nil
+}
+
 func (db *MemDatabase) NewBatch() Batch {
 	return &memBatch{db: db}
 }
 
-type kv struct{ k, v []byte }
+// memIterator iterates over a sorted snapshot of the memory database.
+type memIterator struct {
+	keys   []string
+	values [][]byte
+	index  int
+}
+
+func (it *memIterator) Len() int           { return len(it.keys) }
+func (it *memIterator) Less(i, j int) bool { return it.keys[i] < it.keys[j] }
+func (it *memIterator) Swap(i, j int) {
+	it.keys[i], it.keys[j] = it.keys[j], it.keys[i]
+	it.values[i], it.values[j] = it.values[j], it.values[i]
+}
+
+func (it *memIterator) Next() bool {
+	if it.index >= len(it.keys) {
+		return false
+	}
+	it.index++
+	return it.index < len(it.keys)
+}
+
+func (it *memIterator) Error() error { return nil }
+
+func (it *memIterator) Key() []byte {
+	if it.index < 0 || it.index >= len(it.keys) {
+		return nil
+	}
+	return []byte(it.keys[it.index])
+}
+
+func (it *memIterator) Value() []byte {
+	if it.index < 0 || it.index >= len(it.keys) {
+		return nil
+	}
+	return it.values[it.index]
+}
+
+func (it *memIterator) Release() {
+	it.keys, it.values = nil, nil
+}
+
+type kv struct {
+	k, v []byte
+	del  bool
+}
 
 type memBatch struct {
 	db     *MemDatabase
@@ -105,16 +192,26 @@ type memBatch struct {
 }
 
 func (b *memBatch) Put(key, value []byte) error {
-	b.writes = append(b.writes, kv{common.CopyBytes(key), common.CopyBytes(value)})
+	b.writes = append(b.writes, kv{k: common.CopyBytes(key), v: common.CopyBytes(value)})
 	b.size += len(value)
 	return nil
 }
 
+func (b *memBatch) Delete(key []byte) error {
+	b.writes = append(b.writes, kv{k: common.CopyBytes(key), del: true})
+	b.size += len(key)
+	return nil
+}
+
 func (b *memBatch) Write() error {
 	b.db.lock.Lock()
 	defer b.db.lock.Unlock()
 
 	for _, kv := range b.writes {
+		if kv.del {
+			delete(b.db.db, string(kv.k))
+			continue
+		}
 		b.db.db[string(kv.k)] = kv.v
 	}
 	return nil
@@ -123,3 +220,8 @@ func (b *memBatch) Write() error {
 func (b *memBatch) ValueSize() int {
 	return b.size
 }
+
+func (b *memBatch) Reset() {
+	b.writes = b.writes[:0]
+	b.size = 0
+}
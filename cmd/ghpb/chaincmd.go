@@ -32,10 +32,10 @@ import (
 	"github.com/hpb-project/go-hpb/common"
 	"github.com/hpb-project/go-hpb/common/console"
 	"github.com/hpb-project/go-hpb/blockchain/state"
+	"github.com/hpb-project/go-hpb/blockchain/state/pruner"
 	"github.com/hpb-project/go-hpb/blockchain/types"
 	"github.com/hpb-project/go-hpb/common/log"
 	"github.com/hpb-project/go-hpb/common/trie"
-	"github.com/syndtr/goleveldb/leveldb/util"
 	"gopkg.in/urfave/cli.v1"
 	
 	//"path/filepath"
@@ -144,6 +144,37 @@ The first argument must be the directory containing the blockchain to download f
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
 Remove blockchain and state databases`,
+	}
+	pruneRecentFlag = cli.Uint64Flag{
+		Name:  "prune.recent",
+		Usage: "Number of recent block states to keep besides the head state",
+		Value: bc.TriesInMemory,
+	}
+	pruneBloomFlag = cli.Uint64Flag{
+		Name:  "prune.bloomsize",
+		Usage: fmt.Sprintf("Megabytes of memory allocated to the filter of reachable state nodes (min %d)", minPruneBloomSize),
+		Value: 1024,
+	}
+	pruneStateCommand = cli.Command{
+		Action:    utils.MigrateFlags(pruneState),
+		Name:      "prune-state",
+		Usage:     "Delete the state trie nodes unreachable from the recent states",
+		ArgsUsage: " ",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.CacheFlag,
+			pruneRecentFlag,
+			pruneBloomFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+The prune-state command marks every trie node and contract code reachable from
+the head state and the states of the recent blocks, then deletes every other
+node from the chain database. The node must be stopped while pruning.
+
+Pruning may be interrupted at any time. Running the command again restarts the
+marking or finishes the interrupted deletion, the node refuses to start until
+then.`,
 	}
 	dumpCommand = cli.Command{
 		Action:    utils.MigrateFlags(dump),
@@ -359,9 +390,7 @@ func importChain(ctx *cli.Context) error {
 	fmt.Printf("Import done in %v.\n\n", time.Since(start))
 
 	// Output pre-compaction stats mostly to see the import trashing
-	importChaindb := chainDb.(*hpbdb.LDBDatabase)
-
-	stats, err := importChaindb.LDB().GetProperty("leveldb.stats")
+	stats, err := chainDb.Stat("leveldb.stats")
 	if err != nil {
 		utils.Fatalf("Failed to read database stats: %v", err)
 	}
@@ -385,12 +414,12 @@ func importChain(ctx *cli.Context) error {
 	// Compact the entire database to more accurately measure disk io and print the stats
 	start = time.Now()
 	fmt.Println("Compacting entire database...")
-	if err = importChaindb.LDB().CompactRange(util.Range{}); err != nil {
+	if err = chainDb.Compact(nil, nil); err != nil {
 		utils.Fatalf("Compaction failed: %v", err)
 	}
 	fmt.Printf("Compaction done in %v.\n\n", time.Since(start))
 
-	stats, err = importChaindb.LDB().GetProperty("leveldb.stats")
+	stats, err = chainDb.Stat("leveldb.stats")
 	if err != nil {
 		utils.Fatalf("Failed to read database stats: %v", err)
 	}
@@ -482,7 +511,7 @@ func copyDb(ctx *cli.Context) error {
 	// Compact the entire database to remove any sync overhead
 	start = time.Now()
 	fmt.Println("Compacting entire database...")
-	if err = chainDb.(*hpbdb.LDBDatabase).LDB().CompactRange(util.Range{}); err != nil {
+	if err = chainDb.Compact(nil, nil); err != nil {
 		utils.Fatalf("Compaction failed: %v", err)
 	}
 	fmt.Printf("Compaction done in %v.\n\n", time.Since(start))
@@ -526,6 +555,67 @@ func removeDB(ctx *cli.Context) error {
 	return nil
 }
 
+// minPruneBloomSize is the smallest state bloom filter in megabytes, smaller
+// ones mark too many stale nodes as reachable to prune much.
+const minPruneBloomSize = 256
+
+func pruneState(ctx *cli.Context) error {
+	if size := ctx.Uint64(pruneBloomFlag.Name); size < minPruneBloomSize {
+		utils.Fatalf("State bloom size %d MB below the minimum of %d MB", size, minPruneBloomSize)
+	}
+	conf := MakeConfigNode(ctx)
+
+	stack, nodeerror := createNode(conf)
+	if nodeerror != nil {
+		utils.Fatalf("Failed to create node")
+		return nodeerror
+	}
+	chainDb := utils.MakeChainDatabase(ctx, stack)
+	defer chainDb.Close()
+
+	bloomPath := stack.ResolvePath(pruner.BloomFileName)
+
+	var roots []common.Hash
+	if !pruner.Interrupted(bloomPath) {
+		roots = recentStateRoots(chainDb, ctx.Uint64(pruneRecentFlag.Name))
+	}
+	start := time.Now()
+	if err := pruner.NewPruner(chainDb, bloomPath, ctx.Uint64(pruneBloomFlag.Name)).Prune(roots); err != nil {
+		utils.Fatalf("State pruning failed: %v", err)
+	}
+	log.Info("State pruning successful", "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// recentStateRoots returns the state root of the head block followed by the
+// distinct ones of up to recent blocks before it that are present on disk.
+func recentStateRoots(chainDb hpbdb.Database, recent uint64) []common.Hash {
+	hash := bc.GetHeadBlockHash(chainDb)
+	header := bc.GetHeader(chainDb, hash, bc.GetBlockNumber(chainDb, hash))
+	if header == nil {
+		utils.Fatalf("Head block missing")
+	}
+	if ok, _ := chainDb.Has(header.Root[:]); !ok {
+		utils.Fatalf("Head state missing, root %x", header.Root)
+	}
+	var (
+		roots = []common.Hash{header.Root}
+		known = map[common.Hash]bool{header.Root: true}
+	)
+	for i := uint64(0); i < recent && header.Number.Uint64() > 0; i++ {
+		if header = bc.GetHeader(chainDb, header.ParentHash, header.Number.Uint64()-1); header == nil {
+			break
+		}
+		if known[header.Root] {
+			continue
+		}
+		if ok, _ := chainDb.Has(header.Root[:]); ok {
+			roots, known[header.Root] = append(roots, header.Root), true
+		}
+	}
+	return roots
+}
+
 func dump(ctx *cli.Context) error {
 	// Initialize a new chain for the running node to sync into
 	conf := MakeConfigNode(ctx)
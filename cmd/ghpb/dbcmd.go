@@ -0,0 +1,220 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hpb-project/go-hpb/blockchain"
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/cmd/utils"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/log"
+	"github.com/olekukonko/tablewriter"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	dbCommand = cli.Command{
+		Name:      "db",
+		Usage:     "Low level chain database operations",
+		ArgsUsage: "",
+		Category:  "DATABASE COMMANDS",
+		Subcommands: []cli.Command{
+			{
+				Name:      "inspect",
+				Usage:     "Report the size of the chain database per category of data",
+				ArgsUsage: " ",
+				Action:    utils.MigrateFlags(inspectDB),
+				Category:  "DATABASE COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.CacheFlag,
+				},
+				Description: `
+	ghpb db inspect
+
+iterates over the whole chain database and reports the number of entries and
+their size for every category of data: headers, bodies, receipts, trie nodes,
+consensus snapshots and so on. The node must be stopped while inspecting.`,
+			},
+			{
+				Name:      "convert",
+				Usage:     "Convert the chain database to another storage engine",
+				ArgsUsage: "<engine>",
+				Action:    utils.MigrateFlags(convertDB),
+				Category:  "DATABASE COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.CacheFlag,
+				},
+				Description: `
+	ghpb db convert <engine>
+
+copies every entry of the chain database into a new database of the given
+storage engine, which then replaces it. The old database is kept next to it
+until removed by hand. The ancient block store is moved over as is. The node
+must be stopped while converting.`,
+			},
+		},
+	}
+)
+
+func convertDB(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires the target engine as argument")
+	}
+	engine := ctx.Args().First()
+
+	conf := MakeConfigNode(ctx)
+	stack, nodeerror := createNode(conf)
+	if nodeerror != nil {
+		utils.Fatalf("Failed to create node")
+		return nodeerror
+	}
+	var (
+		srcDir    = stack.ResolvePath("chaindata")
+		dstDir    = srcDir + ".convert"
+		backupDir = srcDir + ".old"
+	)
+	current, err := hpbdb.DatabaseEngine(srcDir)
+	if err != nil {
+		utils.Fatalf("Failed to read database engine: %v", err)
+	}
+	switch {
+	case !hasEngine(engine):
+		utils.Fatalf("Unsupported database engine %q, available: %s", engine, strings.Join(hpbdb.Engines(), ", "))
+	case current == "":
+		utils.Fatalf("No chain database at %s", srcDir)
+	case current == engine:
+		utils.Fatalf("Chain database already uses the %s engine", engine)
+	case common.FileExist(backupDir):
+		utils.Fatalf("Previous database still kept at %s, remove it first", backupDir)
+	}
+	if common.FileExist(dstDir) {
+		log.Warn("Removing unfinished conversion", "path", dstDir)
+		if err := os.RemoveAll(dstDir); err != nil {
+			utils.Fatalf("Failed to remove unfinished conversion: %v", err)
+		}
+	}
+	src := utils.MakeChainDatabase(ctx, stack)
+	dst, err := hpbdb.Open(engine, dstDir, ctx.GlobalInt(utils.CacheFlag.Name), 256)
+	if err != nil {
+		src.Close()
+		utils.Fatalf("Failed to create %s database: %v", engine, err)
+	}
+	log.Info("Converting chain database", "from", current, "to", engine)
+
+	entries, size, err := copyDatabase(dst, src)
+	dst.Close()
+	src.Close()
+	if err != nil {
+		utils.Fatalf("Conversion failed: %v", err)
+	}
+	log.Info("Copied chain database", "entries", entries, "size", size)
+
+	// Move the ancient block store along if it lives inside the database
+	if ancient := filepath.Join(srcDir, "ancient"); conf.Node.AncientDir == "" && common.FileExist(ancient) {
+		if err := os.Rename(ancient, filepath.Join(dstDir, "ancient")); err != nil {
+			utils.Fatalf("Failed to move ancient block store: %v", err)
+		}
+	}
+	if err := os.Rename(srcDir, backupDir); err != nil {
+		utils.Fatalf("Failed to move old database aside: %v", err)
+	}
+	if err := os.Rename(dstDir, srcDir); err != nil {
+		utils.Fatalf("Failed to move new database in place: %v", err)
+	}
+	fmt.Printf("Chain database converted to %s, the old one is kept at %s\n", engine, backupDir)
+	return nil
+}
+
+func inspectDB(ctx *cli.Context) error {
+	conf := MakeConfigNode(ctx)
+	stack, nodeerror := createNode(conf)
+	if nodeerror != nil {
+		utils.Fatalf("Failed to create node")
+		return nodeerror
+	}
+	chainDb := utils.MakeChainDatabase(ctx, stack)
+	defer chainDb.Close()
+
+	stats, err := bc.InspectDatabase(chainDb)
+	if err != nil {
+		utils.Fatalf("Inspection failed: %v", err)
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetAutoFormatHeaders(false)
+	table.SetHeader([]string{"Category", "Entries", "Size"})
+	for _, stat := range stats.Categories {
+		table.Append([]string{stat.Category, fmt.Sprint(stat.Count), common.StorageSize(stat.Size).String()})
+	}
+	table.SetFooter([]string{stats.Total.Category, fmt.Sprint(stats.Total.Count), common.StorageSize(stats.Total.Size).String()})
+	table.Render()
+	return nil
+}
+
+// hasEngine reports whether the storage engine is compiled into the binary.
+func hasEngine(engine string) bool {
+	for _, name := range hpbdb.Engines() {
+		if name == engine {
+			return true
+		}
+	}
+	return false
+}
+
+// copyDatabase copies every entry of src into dst, returning the number of
+// entries and bytes copied.
+func copyDatabase(dst, src hpbdb.Database) (int, common.StorageSize, error) {
+	var (
+		start   = time.Now()
+		logged  = time.Now()
+		entries int
+		size    common.StorageSize
+		batch   = dst.NewBatch()
+	)
+	it := src.NewIteratorWithPrefix(nil)
+	defer it.Release()
+
+	for it.Next() {
+		if err := batch.Put(it.Key(), it.Value()); err != nil {
+			return entries, size, err
+		}
+		entries++
+		size += common.StorageSize(len(it.Key()) + len(it.Value()))
+
+		if batch.ValueSize() >= hpbdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return entries, size, err
+			}
+			batch.Reset()
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Copying chain database", "entries", entries, "size", size, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return entries, size, err
+	}
+	return entries, size, batch.Write()
+}
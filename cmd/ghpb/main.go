@@ -27,6 +27,7 @@ import (
 
 	"github.com/hpb-project/go-hpb/account"
 	"github.com/hpb-project/go-hpb/account/keystore"
+	"github.com/hpb-project/go-hpb/blockchain/state/pruner"
 	"github.com/hpb-project/go-hpb/cmd/utils"
 	"github.com/hpb-project/go-hpb/common"
 	"github.com/hpb-project/go-hpb/common/console"
@@ -77,7 +78,13 @@ var (
 		utils.LightPeersFlag,
 		utils.LightKDFFlag,
 		utils.CacheFlag,
+		utils.DBEngineFlag,
 		utils.TrieCacheGenFlag,
+		utils.GCModeFlag,
+		utils.TrieCacheFlag,
+		utils.NoSnapshotFlag,
+		utils.AncientDepthFlag,
+		utils.AncientDirFlag,
 		utils.ListenPortFlag,
 		utils.MaxPeersFlag,
 		utils.MaxPendingPeersFlag,
@@ -96,6 +103,7 @@ var (
 		utils.TestnetFlag,
 		utils.RinkebyFlag,
 		utils.VMEnableDebugFlag,
+		utils.VMProfileFlag,
 		utils.NetworkIdFlag,
 		utils.RPCCORSDomainFlag,
 		utils.HpbStatsURLFlag,
@@ -139,6 +147,8 @@ func init() {
 		exportCommand,
 		copydbCommand,
 		removedbCommand,
+		pruneStateCommand,
+		dbCommand,
 		dumpCommand,
 		// See monitorcmd.go:
 		monitorCommand,
@@ -195,6 +205,9 @@ func main() {
 // blocking mode, waiting for it to be shut down.
 func ghpb(ctx *cli.Context) error {
 	cfg := MakeConfigNode(ctx)
+	if pruner.Interrupted(cfg.Node.ResolvePath(pruner.BloomFileName)) {
+		utils.Fatalf("State pruning was interrupted, finish it with 'ghpb prune-state' first")
+	}
 	hpbnode, err := createNode(cfg)
 	if err != nil {
 		utils.Fatalf("Failed to create node")
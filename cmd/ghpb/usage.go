@@ -100,7 +100,13 @@ var AppHelpFlagGroups = []flagGroup{
 		Name: "PERFORMANCE TUNING",
 		Flags: []cli.Flag{
 			utils.CacheFlag,
+			utils.DBEngineFlag,
 			utils.TrieCacheGenFlag,
+			utils.GCModeFlag,
+			utils.TrieCacheFlag,
+			utils.NoSnapshotFlag,
+			utils.AncientDepthFlag,
+			utils.AncientDirFlag,
 		},
 	},
 	{
@@ -171,6 +177,7 @@ var AppHelpFlagGroups = []flagGroup{
 		Name: "VIRTUAL MACHINE",
 		Flags: []cli.Flag{
 			utils.VMEnableDebugFlag,
+			utils.VMProfileFlag,
 		},
 	},
 	{
@@ -0,0 +1,69 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/hpb-project/go-hpb/common/hexutil"
+	"github.com/hpb-project/go-hpb/hvm/evm"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var disasmCommand = cli.Command{
+	Action:    disasmCmd,
+	Name:      "disasm",
+	Usage:     "disassembles hvm binary",
+	ArgsUsage: "<file>",
+}
+
+func disasmCmd(ctx *cli.Context) error {
+	if len(ctx.Args().First()) == 0 {
+		return fmt.Errorf("filename required")
+	}
+	data, err := ioutil.ReadFile(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	code, err := hexutil.Decode(ensurePrefix(strings.TrimSpace(string(data))))
+	if err != nil {
+		return fmt.Errorf("invalid code: %v", err)
+	}
+	return disassemble(code)
+}
+
+// disassemble prints one instruction per line, together with the data pushed
+// by the PUSH instructions.
+func disassemble(code []byte) error {
+	for pc := 0; pc < len(code); pc++ {
+		op := evm.OpCode(code[pc])
+		if !op.IsPush() {
+			fmt.Printf("%05x: %v\n", pc, op)
+			continue
+		}
+		size := int(op-evm.PUSH1) + 1
+		if pc+size >= len(code) {
+			fmt.Printf("%05x: %v 0x%x\n", pc, op, code[pc+1:])
+			return fmt.Errorf("incomplete push instruction at %d", pc)
+		}
+		fmt.Printf("%05x: %v 0x%x\n", pc, op, code[pc+1:pc+1+size])
+		pc += size
+	}
+	return nil
+}
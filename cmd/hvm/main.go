@@ -0,0 +1,134 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+// hvm executes HVM code snippets and state tests outside of a node.
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/hpb-project/go-hpb/cmd/utils"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var gitCommit = "" // Git SHA1 commit hash of the release (set via linker flags)
+
+var (
+	app = utils.NewApp(gitCommit, "the hvm command line interface")
+
+	DebugFlag = cli.BoolFlag{
+		Name:  "debug",
+		Usage: "output full trace logs",
+	}
+	JSONFlag = cli.BoolFlag{
+		Name:  "json",
+		Usage: "output trace logs in machine readable format (json)",
+	}
+	DisableMemoryFlag = cli.BoolFlag{
+		Name:  "nomemory",
+		Usage: "disable memory output",
+	}
+	DisableStackFlag = cli.BoolFlag{
+		Name:  "nostack",
+		Usage: "disable stack output",
+	}
+	CodeFlag = cli.StringFlag{
+		Name:  "code",
+		Usage: "HVM code",
+	}
+	CodeFileFlag = cli.StringFlag{
+		Name:  "codefile",
+		Usage: "File containing HVM code. If '-' is specified, code is read from stdin",
+	}
+	InputFlag = cli.StringFlag{
+		Name:  "input",
+		Usage: "input for the HVM",
+	}
+	GasFlag = cli.Uint64Flag{
+		Name:  "gas",
+		Usage: "gas limit for the HVM",
+		Value: 10000000000,
+	}
+	PriceFlag = utils.BigFlag{
+		Name:  "price",
+		Usage: "price set for the HVM",
+		Value: new(big.Int),
+	}
+	ValueFlag = utils.BigFlag{
+		Name:  "value",
+		Usage: "value set for the HVM",
+		Value: new(big.Int),
+	}
+	CreateFlag = cli.BoolFlag{
+		Name:  "create",
+		Usage: "indicates the action should be create rather than call",
+	}
+	GenesisFlag = cli.StringFlag{
+		Name:  "prestate",
+		Usage: "JSON file with prestate (genesis) config",
+	}
+	SenderFlag = cli.StringFlag{
+		Name:  "sender",
+		Usage: "The transaction origin",
+	}
+	ReceiverFlag = cli.StringFlag{
+		Name:  "receiver",
+		Usage: "The transaction receiver (execution context)",
+	}
+	DumpFlag = cli.BoolFlag{
+		Name:  "dump",
+		Usage: "dumps the state after the run",
+	}
+	ProfileFlag = cli.BoolFlag{
+		Name:  "profile",
+		Usage: "prints the execution time and gas of the opcodes and contracts after the run",
+	}
+)
+
+func init() {
+	app.Flags = []cli.Flag{
+		DebugFlag,
+		JSONFlag,
+		DisableMemoryFlag,
+		DisableStackFlag,
+		CodeFlag,
+		CodeFileFlag,
+		InputFlag,
+		GasFlag,
+		PriceFlag,
+		ValueFlag,
+		CreateFlag,
+		GenesisFlag,
+		SenderFlag,
+		ReceiverFlag,
+		DumpFlag,
+		ProfileFlag,
+	}
+	app.Commands = []cli.Command{
+		runCommand,
+		stateTestCommand,
+		disasmCommand,
+	}
+}
+
+func main() {
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"time"
+
+	bc "github.com/hpb-project/go-hpb/blockchain"
+	"github.com/hpb-project/go-hpb/blockchain/state"
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/cmd/utils"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/hexutil"
+	"github.com/hpb-project/go-hpb/hvm/evm"
+	"github.com/hpb-project/go-hpb/hvm/evm/runtime"
+	"github.com/hpb-project/go-hpb/hvm/tests"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var runCommand = cli.Command{
+	Action:      runCmd,
+	Name:        "run",
+	Usage:       "run arbitrary hvm binary",
+	ArgsUsage:   "<code>",
+	Description: `The run command runs arbitrary HVM code.`,
+}
+
+// execResult is the outcome of a run printed in json mode.
+type execResult struct {
+	Output  hexutil.Bytes  `json:"output"`
+	GasUsed hexutil.Uint64 `json:"gasUsed"`
+	Time    time.Duration  `json:"time"`
+	Error   string         `json:"error,omitempty"`
+}
+
+func runCmd(ctx *cli.Context) error {
+	var (
+		logger      *evm.StructLogger
+		chainConfig = tests.Forks["Istanbul"]
+		sender      = common.StringToAddress("sender")
+		receiver    = common.StringToAddress("receiver")
+		cfg         = &runtime.Config{}
+	)
+	if ctx.GlobalBool(DebugFlag.Name) || ctx.GlobalBool(JSONFlag.Name) {
+		logger = evm.NewStructLogger(&evm.LogConfig{
+			DisableMemory: ctx.GlobalBool(DisableMemoryFlag.Name),
+			DisableStack:  ctx.GlobalBool(DisableStackFlag.Name),
+		})
+		cfg.EVMConfig = evm.Config{Debug: true, Tracer: logger}
+	}
+	cfg.EVMConfig.Profile = ctx.GlobalBool(ProfileFlag.Name)
+
+	db, _ := hpbdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	if ctx.GlobalString(GenesisFlag.Name) != "" {
+		genesis, err := readGenesis(ctx.GlobalString(GenesisFlag.Name))
+		if err != nil {
+			return err
+		}
+		for addr, account := range genesis.Alloc {
+			statedb.AddBalance(addr, account.Balance)
+			statedb.SetCode(addr, account.Code)
+			statedb.SetNonce(addr, account.Nonce)
+			for key, value := range account.Storage {
+				statedb.SetState(addr, key, value)
+			}
+		}
+		if genesis.Config != nil {
+			chainConfig = genesis.Config
+		}
+		cfg.Coinbase = genesis.Coinbase
+		cfg.Time = new(big.Int).SetUint64(genesis.Timestamp)
+		cfg.Difficulty = genesis.Difficulty
+		cfg.BlockNumber = new(big.Int).SetUint64(genesis.Number)
+	}
+	if ctx.GlobalString(SenderFlag.Name) != "" {
+		sender = common.HexToAddress(ctx.GlobalString(SenderFlag.Name))
+	}
+	if ctx.GlobalString(ReceiverFlag.Name) != "" {
+		receiver = common.HexToAddress(ctx.GlobalString(ReceiverFlag.Name))
+	}
+	statedb.CreateAccount(sender)
+
+	code, err := readCode(ctx)
+	if err != nil {
+		return err
+	}
+	cfg.ChainConfig = chainConfig
+	cfg.State = statedb
+	cfg.Origin = sender
+	cfg.GasLimit = ctx.GlobalUint64(GasFlag.Name)
+	cfg.GasPrice = utils.GlobalBig(ctx, PriceFlag.Name)
+	cfg.Value = utils.GlobalBig(ctx, ValueFlag.Name)
+
+	var (
+		input    = common.FromHex(ctx.GlobalString(InputFlag.Name))
+		output   []byte
+		leftOver uint64
+		start    = time.Now()
+	)
+	if ctx.GlobalBool(CreateFlag.Name) {
+		output, _, leftOver, err = runtime.Create(append(code, input...), cfg)
+	} else {
+		if len(code) > 0 {
+			statedb.SetCode(receiver, code)
+		}
+		output, leftOver, err = runtime.Call(receiver, input, cfg)
+	}
+	elapsed := time.Since(start)
+
+	if ctx.GlobalBool(DumpFlag.Name) {
+		if _, err := statedb.CommitTo(db, true); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, string(statedb.Dump()))
+	}
+	if ctx.GlobalBool(ProfileFlag.Name) {
+		profile, _ := json.MarshalIndent(evm.DefaultProfiler.Profile(), "", "  ")
+		fmt.Fprintln(os.Stderr, string(profile))
+	}
+	if ctx.GlobalBool(JSONFlag.Name) {
+		enc := json.NewEncoder(os.Stdout)
+		for _, log := range logger.StructLogs() {
+			enc.Encode(log)
+		}
+		res := execResult{Output: output, GasUsed: hexutil.Uint64(cfg.GasLimit - leftOver), Time: elapsed}
+		if err != nil {
+			res.Error = err.Error()
+		}
+		return enc.Encode(res)
+	}
+	if logger != nil {
+		fmt.Fprintln(os.Stderr, "#### TRACE ####")
+		evm.WriteTrace(os.Stderr, logger.StructLogs())
+		fmt.Fprintln(os.Stderr, "#### LOGS ####")
+		evm.WriteLogs(os.Stderr, statedb.Logs())
+	}
+	fmt.Printf("0x%x\n", output)
+	if err != nil {
+		fmt.Printf(" error: %v\n", err)
+	}
+	fmt.Fprintf(os.Stderr, "gas used: %d\nexecution time: %v\n", cfg.GasLimit-leftOver, elapsed)
+	return nil
+}
+
+// readGenesis loads the prestate from a genesis specification.
+func readGenesis(path string) (*bc.Genesis, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	genesis := new(bc.Genesis)
+	if err := json.Unmarshal(data, genesis); err != nil {
+		return nil, fmt.Errorf("invalid prestate %s: %v", path, err)
+	}
+	return genesis, nil
+}
+
+// readCode returns the code given on the command line, in a file or on stdin.
+// No code means the receiver runs the code it has in the prestate.
+func readCode(ctx *cli.Context) ([]byte, error) {
+	var hexcode []byte
+	switch {
+	case ctx.GlobalString(CodeFlag.Name) != "":
+		hexcode = []byte(ctx.GlobalString(CodeFlag.Name))
+	case ctx.GlobalString(CodeFileFlag.Name) == "-":
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("could not load code from stdin: %v", err)
+		}
+		hexcode = data
+	case ctx.GlobalString(CodeFileFlag.Name) != "":
+		data, err := ioutil.ReadFile(ctx.GlobalString(CodeFileFlag.Name))
+		if err != nil {
+			return nil, fmt.Errorf("could not load code from file: %v", err)
+		}
+		hexcode = data
+	case len(ctx.Args()) > 0:
+		hexcode = []byte(ctx.Args().First())
+	default:
+		return nil, nil
+	}
+	code, err := hexutil.Decode(ensurePrefix(string(bytes.TrimSpace(hexcode))))
+	if err != nil {
+		return nil, fmt.Errorf("invalid code: %v", err)
+	}
+	return code, nil
+}
+
+func ensurePrefix(s string) string {
+	if len(s) >= 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		return s
+	}
+	return "0x" + s
+}
@@ -0,0 +1,122 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/hvm/evm"
+	"github.com/hpb-project/go-hpb/hvm/tests"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var stateTestCommand = cli.Command{
+	Action:    stateTestCmd,
+	Name:      "statetest",
+	Usage:     "executes the given state tests",
+	ArgsUsage: "<file>",
+}
+
+// StatetestResult contains the execution status after running a state test,
+// any error that might have occurred and a dump of the final state if
+// requested.
+type StatetestResult struct {
+	Name  string           `json:"name"`
+	Pass  bool             `json:"pass"`
+	Root  common.Hash      `json:"stateRoot,omitempty"`
+	Fork  string           `json:"fork"`
+	Error string           `json:"error,omitempty"`
+	State *json.RawMessage `json:"state,omitempty"`
+}
+
+func stateTestCmd(ctx *cli.Context) error {
+	if len(ctx.Args().First()) == 0 {
+		return fmt.Errorf("path-to-test argument required")
+	}
+	src, err := ioutil.ReadFile(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	var stateTests map[string]tests.StateTest
+	if err := json.Unmarshal(src, &stateTests); err != nil {
+		return err
+	}
+	var (
+		debug     = ctx.GlobalBool(DebugFlag.Name) || ctx.GlobalBool(JSONFlag.Name)
+		logConfig = &evm.LogConfig{
+			DisableMemory: ctx.GlobalBool(DisableMemoryFlag.Name),
+			DisableStack:  ctx.GlobalBool(DisableStackFlag.Name),
+		}
+	)
+	names := make([]string, 0, len(stateTests))
+	for name := range stateTests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Run each subtest of every test, the tracer is recreated for every run
+	results := make([]StatetestResult, 0, len(stateTests))
+	failed := false
+	for _, name := range names {
+		test := stateTests[name]
+		for _, st := range test.Subtests() {
+			var (
+				logger *evm.StructLogger
+				cfg    evm.Config
+			)
+			if debug {
+				logger = evm.NewStructLogger(logConfig)
+				cfg = evm.Config{Debug: true, Tracer: logger}
+			}
+			result := StatetestResult{Name: name, Fork: st.Fork, Pass: true}
+			statedb, err := test.Run(st, cfg)
+			if err != nil {
+				result.Pass, result.Error = false, err.Error()
+				failed = true
+			}
+			if statedb != nil {
+				result.Root = statedb.IntermediateRoot(true)
+				if ctx.GlobalBool(DumpFlag.Name) {
+					dump := json.RawMessage(statedb.Dump())
+					result.State = &dump
+				}
+			}
+			if logger != nil {
+				if ctx.GlobalBool(JSONFlag.Name) {
+					enc := json.NewEncoder(os.Stderr)
+					for _, log := range logger.StructLogs() {
+						enc.Encode(log)
+					}
+				} else {
+					evm.WriteTrace(os.Stderr, logger.StructLogs())
+				}
+			}
+			results = append(results, result)
+		}
+	}
+	out, _ := json.MarshalIndent(results, "", "  ")
+	fmt.Println(string(out))
+	if failed {
+		return fmt.Errorf("state tests failed")
+	}
+	return nil
+}
@@ -227,6 +227,33 @@ var (
 		Usage: "Megabytes of memory allocated to internal caching (min 16MB / database forced)",
 		Value: 128,
 	}
+	DBEngineFlag = cli.StringFlag{
+		Name:  "db.engine",
+		Usage: "Backing database engine of new databases (" + strings.Join(hpbdb.Engines(), ", ") + ")",
+	}
+	GCModeFlag = cli.StringFlag{
+		Name:  "gcmode",
+		Usage: `Blockchain garbage collection mode ("full", "archive")`,
+		Value: "full",
+	}
+	TrieCacheFlag = cli.IntFlag{
+		Name:  "cache.trie",
+		Usage: "Megabytes of memory allocated to recent state tries before they are flushed to disk",
+		Value: config.DefaultConfig.TrieCache,
+	}
+	NoSnapshotFlag = cli.BoolFlag{
+		Name:  "nosnapshot",
+		Usage: "Disables the flat state snapshot serving fast state reads",
+	}
+	AncientDepthFlag = cli.Uint64Flag{
+		Name:  "ancient.depth",
+		Usage: fmt.Sprintf("Number of blocks behind the head before a block is moved to the ancient store (0 = disabled, minimum %d)", config.MinAncientDepth),
+		Value: config.DefaultConfig.AncientDepth,
+	}
+	AncientDirFlag = DirectoryFlag{
+		Name:  "datadir.ancient",
+		Usage: "Data directory for the ancient block store (default = inside chaindata)",
+	}
 	TrieCacheGenFlag = cli.IntFlag{
 		Name:  "trie-cache-gens",
 		Usage: "Number of trie node generations to keep in memory",
@@ -244,7 +271,7 @@ var (
 	}
 	TargetGasLimitFlag = cli.Uint64Flag{
 		Name:  "targetgaslimit",
-		Usage: "Target gas limit sets the artificial target gas floor for the blocks to mine",
+		Usage: "Target gas limit the blocks to mine are moved toward (also settable via miner_setGasTarget)",
 		Value: params.GenesisGasLimit.Uint64(),
 	}
 	HpberbaseFlag = cli.StringFlag{
@@ -277,6 +304,10 @@ var (
 		Name:  "vmdebug",
 		Usage: "Record information useful for VM and contract debugging",
 	}
+	VMProfileFlag = cli.BoolFlag{
+		Name:  "vmprofile",
+		Usage: "Record the execution time and gas of VM opcodes and contracts",
+	}
 	// Logging and debug settings
 	HpbStatsURLFlag = cli.StringFlag{
 		Name:  "ethstats",
@@ -850,6 +881,28 @@ func SetNodeConfig(ctx *cli.Context, cfg *config.HpbConfig) {
 	if ctx.GlobalIsSet(CacheFlag.Name) {
 		cfg.Node.DatabaseCache = ctx.GlobalInt(CacheFlag.Name)
 	}
+	if gcmode := ctx.GlobalString(GCModeFlag.Name); gcmode != "full" && gcmode != "archive" {
+		Fatalf("--%s must be either 'full' or 'archive'", GCModeFlag.Name)
+	}
+	cfg.Node.NoPruning = ctx.GlobalString(GCModeFlag.Name) == "archive"
+	if ctx.GlobalIsSet(DBEngineFlag.Name) {
+		cfg.Node.DatabaseEngine = ctx.GlobalString(DBEngineFlag.Name)
+	}
+	if ctx.GlobalIsSet(TrieCacheFlag.Name) {
+		cfg.Node.TrieCache = ctx.GlobalInt(TrieCacheFlag.Name)
+	}
+	if ctx.GlobalIsSet(NoSnapshotFlag.Name) {
+		cfg.Node.NoSnapshot = ctx.GlobalBool(NoSnapshotFlag.Name)
+	}
+	if ctx.GlobalIsSet(AncientDepthFlag.Name) {
+		cfg.Node.AncientDepth = ctx.GlobalUint64(AncientDepthFlag.Name)
+		if depth := cfg.Node.AncientDepth; depth != 0 && depth < config.MinAncientDepth {
+			Fatalf("--%s must be 0 or at least %d", AncientDepthFlag.Name, config.MinAncientDepth)
+		}
+	}
+	if ctx.GlobalIsSet(AncientDirFlag.Name) {
+		cfg.Node.AncientDir = expandPath(ctx.GlobalString(AncientDirFlag.Name))
+	}
 	cfg.Node.DatabaseHandles = makeDatabaseHandles()
 
 	if ctx.GlobalIsSet(MinerThreadsFlag.Name) {
@@ -864,10 +917,16 @@ func SetNodeConfig(ctx *cli.Context, cfg *config.HpbConfig) {
 	if ctx.GlobalIsSet(GasPriceFlag.Name) {
 		cfg.Node.GasPrice = GlobalBig(ctx, GasPriceFlag.Name)
 	}
+	if ctx.GlobalIsSet(TargetGasLimitFlag.Name) {
+		cfg.Node.GasTarget = new(big.Int).SetUint64(ctx.GlobalUint64(TargetGasLimitFlag.Name))
+	}
 	if ctx.GlobalIsSet(VMEnableDebugFlag.Name) {
 		// TODO(fjl): force-enable this in --dev mode
 		cfg.Node.EnablePreimageRecording = ctx.GlobalBool(VMEnableDebugFlag.Name)
 	}
+	if ctx.GlobalIsSet(VMProfileFlag.Name) {
+		cfg.Node.VMProfile = ctx.GlobalBool(VMProfileFlag.Name)
+	}
 	if ctx.GlobalBool(TestModeFlag.Name) {
 		cfg.Node.TestMode = 1
 	}
@@ -963,8 +1022,7 @@ func checkExclusive(ctx *cli.Context, flags ...cli.Flag) {
 
 // SetupNetwork configures the system for either the main net or some test network.
 func SetupNetwork(ctx *cli.Context) {
-	// TODO(fjl): move target gas limit into config
-	params.TargetGasLimit = new(big.Int).SetUint64(ctx.GlobalUint64(TargetGasLimitFlag.Name))
+	config.TargetGasLimit = new(big.Int).SetUint64(ctx.GlobalUint64(TargetGasLimitFlag.Name))
 }
 
 // MakeChainDatabase open an LevelDB using the flags passed to the client and will hard crash if it fails.
@@ -1008,7 +1066,12 @@ func MakeChain(ctx *cli.Context, stack *node.Node) (chain *bc.BlockChain, chainD
 	
 	engine = prometheus.New(cfg.Prometheus, chainDb)
 
-	chain, err = bc.NewBlockChainWithEngine(chainDb, cfg, engine)
+	cacheConfig := &bc.CacheConfig{
+		Disabled:          stack.Hpbconfig.Node.NoPruning,
+		TrieNodeLimit:     common.StorageSize(ctx.GlobalInt(TrieCacheFlag.Name)) * 1024 * 1024,
+		TrieFlushInterval: stack.Hpbconfig.Node.TrieFlushInterval,
+	}
+	chain, err = bc.NewBlockChainWithEngine(chainDb, cacheConfig, cfg, engine)
 	if err != nil {
 		Fatalf("Can't create BlockChain: %v", err)
 	}
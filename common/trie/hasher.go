@@ -30,6 +30,7 @@ type hasher struct {
 	tmp                  *bytes.Buffer
 	sha                  hash.Hash
 	cachegen, cachelimit uint16
+	onleaf               LeafCallback
 }
 
 // hashers live in a global pool.
@@ -39,9 +40,9 @@ var hasherPool = sync.Pool{
 	},
 }
 
-func newHasher(cachegen, cachelimit uint16) *hasher {
+func newHasher(cachegen, cachelimit uint16, onleaf LeafCallback) *hasher {
 	h := hasherPool.Get().(*hasher)
-	h.cachegen, h.cachelimit = cachegen, cachelimit
+	h.cachegen, h.cachelimit, h.onleaf = cachegen, cachelimit, onleaf
 	return h
 }
 
@@ -167,7 +168,37 @@ func (h *hasher) store(n node, db DatabaseWriter, force bool) (node, error) {
 		hash = hashNode(h.sha.Sum(nil))
 	}
 	if db != nil {
-		return hash, db.Put(hash, h.tmp.Bytes())
+		if err := db.Put(hash, h.tmp.Bytes()); err != nil {
+			return hash, err
+		}
+		if h.onleaf != nil {
+			if err := h.reportLeaves(n, common.BytesToHash(hash)); err != nil {
+				return hash, err
+			}
+		}
 	}
 	return hash, nil
 }
+
+// reportLeaves passes the values held directly by a stored node to the leaf
+// callback.
+func (h *hasher) reportLeaves(n node, parent common.Hash) error {
+	switch n := n.(type) {
+	case *shortNode:
+		if val, ok := n.Val.(valueNode); ok && len(val) > 0 {
+			return h.onleaf(val, parent)
+		}
+	case *fullNode:
+		for i := 0; i < 16; i++ {
+			if child, ok := n.Children[i].(*shortNode); ok {
+				if err := h.reportLeaves(child, parent); err != nil {
+					return err
+				}
+			}
+		}
+		if val, ok := n.Children[16].(valueNode); ok && len(val) > 0 {
+			return h.onleaf(val, parent)
+		}
+	}
+	return nil
+}
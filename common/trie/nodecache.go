@@ -0,0 +1,295 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/log"
+)
+
+// cachedNode is a trie node (or contract code) held by the node cache along
+// with the references it holds and is held by.
+type cachedNode struct {
+	blob     []byte              // Encoded node
+	parents  int                 // Number of live nodes (or roots) referencing this one
+	children map[common.Hash]int // Nodes referenced by this one, with multiplicity
+}
+
+// NodeCache is an intermediate write layer between the tries and the disk
+// database. Committed trie nodes are kept in memory and reference counted, so
+// that the nodes of states no longer needed can be dropped again before they
+// ever reach the disk. Nodes are only written out when a state root is
+// explicitly committed.
+//
+// NodeCache implements Database, reads fall through to the disk database.
+type NodeCache struct {
+	diskdb hpbdb.Database
+
+	nodes     map[common.Hash]*cachedNode // Cached nodes, the zero hash holds the root references
+	preimages map[string][]byte           // Secure key preimages awaiting a flush
+	size      common.StorageSize          // Storage size of the cached nodes
+
+	gcnodes uint64             // Nodes dropped since the last flush
+	gcsize  common.StorageSize // Storage size of the dropped nodes
+
+	lock sync.RWMutex
+}
+
+// NewNodeCache creates a node cache on top of the given disk database.
+func NewNodeCache(diskdb hpbdb.Database) *NodeCache {
+	return &NodeCache{
+		diskdb:    diskdb,
+		nodes:     map[common.Hash]*cachedNode{{}: {children: make(map[common.Hash]int)}},
+		preimages: make(map[string][]byte),
+	}
+}
+
+// DiskDB returns the persistent database below the cache.
+func (c *NodeCache) DiskDB() hpbdb.Database {
+	return c.diskdb
+}
+
+// Put inserts a node or a secure key preimage into the cache. Nodes are keyed
+// by their hash; any other key is treated as a preimage.
+func (c *NodeCache) Put(key, value []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if len(key) != common.HashLength {
+		c.preimages[string(key)] = common.CopyBytes(value)
+		return nil
+	}
+	c.insert(common.BytesToHash(key), common.CopyBytes(value))
+	return nil
+}
+
+// insert adds a node to the cache, referencing the cached nodes it points to.
+// The lock must be held by the caller.
+func (c *NodeCache) insert(hash common.Hash, blob []byte) {
+	if _, ok := c.nodes[hash]; ok {
+		return
+	}
+	node := &cachedNode{blob: blob, children: make(map[common.Hash]int)}
+
+	// Contract code is stored the same way as nodes, but won't decode
+	if n, err := decodeNode(hash[:], blob, 0); err == nil {
+		gatherChildren(n, node.children)
+	}
+	for child, n := range node.children {
+		if cached, ok := c.nodes[child]; ok {
+			cached.parents += n
+		}
+	}
+	c.nodes[hash] = node
+	c.size += common.StorageSize(common.HashLength + len(blob))
+}
+
+// gatherChildren collects the hashes of the nodes referenced from n, including
+// the ones referenced from nodes embedded into n.
+func gatherChildren(n node, children map[common.Hash]int) {
+	switch n := n.(type) {
+	case *shortNode:
+		gatherChildren(n.Val, children)
+	case *fullNode:
+		for i := 0; i < 16; i++ {
+			gatherChildren(n.Children[i], children)
+		}
+	case hashNode:
+		children[common.BytesToHash(n)]++
+	}
+}
+
+// Get retrieves a node or preimage from the cache, falling back to the disk.
+func (c *NodeCache) Get(key []byte) ([]byte, error) {
+	c.lock.RLock()
+	if len(key) == common.HashLength {
+		if node, ok := c.nodes[common.BytesToHash(key)]; ok {
+			c.lock.RUnlock()
+			return common.CopyBytes(node.blob), nil
+		}
+	} else if preimage, ok := c.preimages[string(key)]; ok {
+		c.lock.RUnlock()
+		return common.CopyBytes(preimage), nil
+	}
+	c.lock.RUnlock()
+
+	return c.diskdb.Get(key)
+}
+
+// Has reports whether a node or preimage is in the cache or on disk.
+func (c *NodeCache) Has(key []byte) (bool, error) {
+	c.lock.RLock()
+	if len(key) == common.HashLength {
+		if _, ok := c.nodes[common.BytesToHash(key)]; ok {
+			c.lock.RUnlock()
+			return true, nil
+		}
+	} else if _, ok := c.preimages[string(key)]; ok {
+		c.lock.RUnlock()
+		return true, nil
+	}
+	c.lock.RUnlock()
+
+	return c.diskdb.Has(key)
+}
+
+// Reference adds a reference from parent to child. A zero parent references
+// child as a state root that must be kept until dereferenced. References to or
+// from nodes no longer in the cache are ignored.
+func (c *NodeCache) Reference(child common.Hash, parent common.Hash) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	node, ok := c.nodes[child]
+	if !ok {
+		return
+	}
+	owner, ok := c.nodes[parent]
+	if !ok {
+		return
+	}
+	// Account leaves are re-reported on every commit, count them only once
+	if _, ok := owner.children[child]; ok && parent != (common.Hash{}) {
+		return
+	}
+	owner.children[child]++
+	node.parents++
+}
+
+// Dereference drops a root reference added by Reference, removing every cached
+// node that becomes unreachable.
+func (c *NodeCache) Dereference(root common.Hash) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	meta := c.nodes[common.Hash{}]
+	if meta.children[root] == 0 {
+		return
+	}
+	if meta.children[root]--; meta.children[root] == 0 {
+		delete(meta.children, root)
+	}
+	nodes, size, start := len(c.nodes), c.size, time.Now()
+	c.dereference(root)
+
+	c.gcnodes += uint64(nodes - len(c.nodes))
+	c.gcsize += size - c.size
+
+	log.Debug("Dereferenced trie from memory", "nodes", nodes-len(c.nodes), "size", size-c.size, "time", time.Since(start),
+		"gcnodes", c.gcnodes, "gcsize", c.gcsize, "livenodes", len(c.nodes)-1, "livesize", c.size)
+}
+
+// dereference drops a single reference to a node, recursively removing it and
+// its children once no references are left. The lock must be held by the caller.
+func (c *NodeCache) dereference(hash common.Hash) {
+	node, ok := c.nodes[hash]
+	if !ok {
+		return
+	}
+	if node.parents > 0 {
+		node.parents--
+	}
+	if node.parents > 0 {
+		return
+	}
+	for child, n := range node.children {
+		for i := 0; i < n; i++ {
+			c.dereference(child)
+		}
+	}
+	delete(c.nodes, hash)
+	c.size -= common.StorageSize(common.HashLength + len(node.blob))
+}
+
+// Commit writes the trie rooted at root, as far as it is cached, to disk along
+// with all pending preimages, and drops the written nodes from the cache.
+func (c *NodeCache) Commit(root common.Hash) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	start := time.Now()
+	batch := c.diskdb.NewBatch()
+
+	// Preimages first, then nodes children first, so that a partially flushed
+	// trie never references missing nodes
+	var keys, values [][]byte
+	for key, preimage := range c.preimages {
+		keys, values = append(keys, []byte(key)), append(values, preimage)
+	}
+	c.collect(root, &keys, &values)
+
+	for i, key := range keys {
+		if err := batch.Put(key, values[i]); err != nil {
+			return err
+		}
+		if batch.ValueSize() >= hpbdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	nodes, size := len(c.nodes), c.size
+	c.preimages = make(map[string][]byte)
+	c.uncache(root)
+
+	log.Info("Persisted trie from memory to disk", "nodes", nodes-len(c.nodes), "size", size-c.size, "time", time.Since(start),
+		"gcnodes", c.gcnodes, "gcsize", c.gcsize, "livenodes", len(c.nodes)-1, "livesize", c.size)
+
+	c.gcnodes, c.gcsize = 0, 0
+	return nil
+}
+
+// collect gathers a node and its cached children, children first.
+func (c *NodeCache) collect(hash common.Hash, keys, values *[][]byte) {
+	node, ok := c.nodes[hash]
+	if !ok {
+		return
+	}
+	for child := range node.children {
+		c.collect(child, keys, values)
+	}
+	*keys, *values = append(*keys, common.CopyBytes(hash[:])), append(*values, node.blob)
+}
+
+// uncache drops a flushed node and its cached children from the cache.
+func (c *NodeCache) uncache(hash common.Hash) {
+	node, ok := c.nodes[hash]
+	if !ok {
+		return
+	}
+	for child := range node.children {
+		c.uncache(child)
+	}
+	delete(c.nodes, hash)
+	c.size -= common.StorageSize(common.HashLength + len(node.blob))
+}
+
+// Size returns the storage size of the nodes held in the cache.
+func (c *NodeCache) Size() common.StorageSize {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.size
+}
@@ -67,7 +67,7 @@ func (t *Trie) Prove(key []byte) []rlp.RawValue {
 			panic(fmt.Sprintf("%T: invalid node: %v", tn, tn))
 		}
 	}
-	hasher := newHasher(0, 0)
+	hasher := newHasher(0, 0, nil)
 	proof := make([]rlp.RawValue, 0, len(nodes))
 	for i, n := range nodes {
 		// Don't bother checking for errors here since hasher panics
@@ -102,7 +102,7 @@ func VerifyProof(rootHash common.Hash, key []byte, proof []rlp.RawValue) (value
 		if err != nil {
 			return nil, fmt.Errorf("bad proof node %d: %v", i, err)
 		}
-		keyrest, cld := get(n, key)
+		keyrest, cld := get(n, key, true)
 		switch cld := cld.(type) {
 		case nil:
 			if i != len(proof)-1 {
@@ -124,7 +124,10 @@ func VerifyProof(rootHash common.Hash, key []byte, proof []rlp.RawValue) (value
 	return nil, errors.New("unexpected end of proof")
 }
 
-func get(tn node, key []byte) ([]byte, node) {
+// get returns the child of tn at the path of key along with the rest of the
+// key. If skipResolved is set, resolved nodes are descended into until a hash
+// or value node is reached, otherwise the direct child is returned.
+func get(tn node, key []byte, skipResolved bool) ([]byte, node) {
 	for {
 		switch n := tn.(type) {
 		case *shortNode:
@@ -133,9 +136,15 @@ func get(tn node, key []byte) ([]byte, node) {
 			}
 			tn = n.Val
 			key = key[len(n.Key):]
+			if !skipResolved {
+				return key, tn
+			}
 		case *fullNode:
 			tn = n.Children[key[0]]
 			key = key[1:]
+			if !skipResolved {
+				return key, tn
+			}
 		case hashNode:
 			return key, n
 		case nil:
@@ -147,3 +156,349 @@ func get(tn node, key []byte) ([]byte, node) {
 		}
 	}
 }
+
+// VerifyRangeProof checks that the given leaves are exactly the leaves of the
+// trie with the given root between firstKey and lastKey. The proof must hold
+// the nodes on the paths to both edge keys, which may be absent from the trie,
+// and the keys must be sorted and unique. A nil proof asserts that the leaves
+// form the whole trie.
+//
+// The returned flag reports whether the trie holds more leaves to the right
+// of the range.
+func VerifyRangeProof(rootHash common.Hash, firstKey, lastKey []byte, keys, values [][]byte, proof []rlp.RawValue) (bool, error) {
+	if len(keys) != len(values) {
+		return false, fmt.Errorf("inconsistent proof data, keys: %d, values: %d", len(keys), len(values))
+	}
+	for i := 0; i < len(keys)-1; i++ {
+		if bytes.Compare(keys[i], keys[i+1]) >= 0 {
+			return false, errors.New("range is not monotonically increasing")
+		}
+	}
+	for _, value := range values {
+		if len(value) == 0 {
+			return false, errors.New("range contains deletion")
+		}
+	}
+	// Without edge proofs the leaves must rebuild the whole trie
+	if proof == nil {
+		tr := new(Trie)
+		for i, key := range keys {
+			tr.Update(key, values[i])
+		}
+		if have := tr.Hash(); have != rootHash {
+			return false, fmt.Errorf("invalid proof, want hash %x, got %x", rootHash, have)
+		}
+		return false, nil
+	}
+	nodes := make(map[common.Hash][]byte, len(proof))
+	sha := sha3.NewKeccak256()
+	for _, buf := range proof {
+		sha.Reset()
+		sha.Write(buf)
+		nodes[common.BytesToHash(sha.Sum(nil))] = buf
+	}
+	// Without leaves the proof must show there is nothing from firstKey on
+	if len(keys) == 0 {
+		root, val, err := proofToPath(rootHash, nil, firstKey, nodes, true)
+		if err != nil {
+			return false, err
+		}
+		if val != nil || hasRightElement(root, firstKey) {
+			return false, errors.New("more entries available")
+		}
+		return false, nil
+	}
+	// A single leaf proven by itself
+	if len(keys) == 1 && bytes.Equal(firstKey, lastKey) {
+		root, val, err := proofToPath(rootHash, nil, firstKey, nodes, false)
+		if err != nil {
+			return false, err
+		}
+		if !bytes.Equal(firstKey, keys[0]) {
+			return false, errors.New("correct proof but invalid key")
+		}
+		if !bytes.Equal(val, values[0]) {
+			return false, errors.New("correct proof but invalid data")
+		}
+		return hasRightElement(root, firstKey), nil
+	}
+	if bytes.Compare(firstKey, lastKey) >= 0 {
+		return false, errors.New("invalid edge keys")
+	}
+	if len(firstKey) != len(lastKey) {
+		return false, errors.New("inconsistent edge keys")
+	}
+	if bytes.Compare(firstKey, keys[0]) > 0 || bytes.Compare(keys[len(keys)-1], lastKey) > 0 {
+		return false, errors.New("keys out of range")
+	}
+	// Resolve both edge paths into a single partial trie, drop everything in
+	// between and refill it from the leaves. The hash only matches if nothing
+	// was left out.
+	root, _, err := proofToPath(rootHash, nil, firstKey, nodes, true)
+	if err != nil {
+		return false, err
+	}
+	root, _, err = proofToPath(rootHash, root, lastKey, nodes, true)
+	if err != nil {
+		return false, err
+	}
+	empty, err := unsetInternal(root, firstKey, lastKey)
+	if err != nil {
+		return false, err
+	}
+	tr := &Trie{root: root}
+	if empty {
+		tr.root = nil
+	}
+	for i, key := range keys {
+		if err := tr.TryUpdate(key, values[i]); err != nil {
+			return false, err
+		}
+	}
+	if have := tr.Hash(); have != rootHash {
+		return false, fmt.Errorf("invalid proof, want hash %x, got %x", rootHash, have)
+	}
+	return hasRightElement(tr.root, keys[len(keys)-1]), nil
+}
+
+// proofToPath resolves the path to key from the proof nodes into a trie
+// rooted at root, which is decoded from the proof if nil. The nodes beside
+// the path are left as hash nodes. If allowNonExistent is set, the key may be
+// absent from the trie, otherwise its value is returned.
+func proofToPath(rootHash common.Hash, root node, key []byte, nodes map[common.Hash][]byte, allowNonExistent bool) (node, []byte, error) {
+	resolve := func(hash common.Hash) (node, error) {
+		buf := nodes[hash]
+		if buf == nil {
+			return nil, fmt.Errorf("proof node (hash %064x) missing", hash)
+		}
+		n, err := decodeNode(hash[:], buf, 0)
+		if err != nil {
+			return nil, fmt.Errorf("bad proof node %v", err)
+		}
+		return n, nil
+	}
+	if root == nil {
+		n, err := resolve(rootHash)
+		if err != nil {
+			return nil, nil, err
+		}
+		root = n
+	}
+	var (
+		err     error
+		child   node
+		parent  = root
+		keyrest []byte
+		valnode []byte
+	)
+	key = keybytesToHex(key)
+	for {
+		keyrest, child = get(parent, key, false)
+		switch cld := child.(type) {
+		case nil:
+			// The path ends before the key, so it's not in the trie
+			if allowNonExistent {
+				return root, nil, nil
+			}
+			return nil, nil, errors.New("the node is not contained in trie")
+		case *shortNode, *fullNode:
+			// Already resolved by the other edge path
+			key, parent = keyrest, child
+			continue
+		case hashNode:
+			if child, err = resolve(common.BytesToHash(cld)); err != nil {
+				return nil, nil, err
+			}
+		case valueNode:
+			valnode = cld
+		}
+		// Link the resolved child into its parent
+		switch pnode := parent.(type) {
+		case *shortNode:
+			pnode.Val = child
+		case *fullNode:
+			pnode.Children[key[0]] = child
+		default:
+			panic(fmt.Sprintf("%T: invalid node: %v", pnode, pnode))
+		}
+		if len(valnode) > 0 {
+			return root, valnode, nil
+		}
+		key, parent = keyrest, child
+	}
+}
+
+// unsetInternal removes all the nodes between the two edge paths, which must
+// have been resolved by proofToPath. It reports whether the whole trie was
+// removed.
+func unsetInternal(n node, left []byte, right []byte) (bool, error) {
+	left, right = keybytesToHex(left), keybytesToHex(right)
+
+	// Find the fork point of the two edge paths
+	var (
+		pos                           = 0
+		parent                        node
+		shortForkLeft, shortForkRight int
+	)
+findFork:
+	for {
+		switch rn := n.(type) {
+		case *shortNode:
+			rn.flags = nodeFlag{dirty: true}
+
+			// The edge keys may be absent, in which case the paths fork
+			// against the key of the short node
+			if len(left)-pos < len(rn.Key) {
+				shortForkLeft = bytes.Compare(left[pos:], rn.Key)
+			} else {
+				shortForkLeft = bytes.Compare(left[pos:pos+len(rn.Key)], rn.Key)
+			}
+			if len(right)-pos < len(rn.Key) {
+				shortForkRight = bytes.Compare(right[pos:], rn.Key)
+			} else {
+				shortForkRight = bytes.Compare(right[pos:pos+len(rn.Key)], rn.Key)
+			}
+			if shortForkLeft != 0 || shortForkRight != 0 {
+				break findFork
+			}
+			parent = n
+			n, pos = rn.Val, pos+len(rn.Key)
+		case *fullNode:
+			rn.flags = nodeFlag{dirty: true}
+
+			if left[pos] != right[pos] || rn.Children[left[pos]] == nil {
+				break findFork
+			}
+			parent = n
+			n, pos = rn.Children[left[pos]], pos+1
+		default:
+			panic(fmt.Sprintf("%T: invalid node: %v", n, n))
+		}
+	}
+	switch rn := n.(type) {
+	case *shortNode:
+		// Both edges are on the same side of the short node
+		if shortForkLeft == -1 && shortForkRight == -1 {
+			return false, errors.New("empty range")
+		}
+		if shortForkLeft == 1 && shortForkRight == 1 {
+			return false, errors.New("empty range")
+		}
+		// The short node lies in between the edges, remove it entirely
+		if shortForkLeft != 0 && shortForkRight != 0 {
+			if parent == nil {
+				return true, nil
+			}
+			parent.(*fullNode).Children[left[pos-1]] = nil
+			return false, nil
+		}
+		// Only the left edge runs through the short node
+		if shortForkRight != 0 {
+			if _, ok := rn.Val.(valueNode); ok {
+				if parent == nil {
+					return true, nil
+				}
+				parent.(*fullNode).Children[left[pos-1]] = nil
+				return false, nil
+			}
+			return false, unset(rn, rn.Val, left[pos:], len(rn.Key), false)
+		}
+		// Only the right edge runs through the short node
+		if shortForkLeft != 0 {
+			if _, ok := rn.Val.(valueNode); ok {
+				if parent == nil {
+					return true, nil
+				}
+				parent.(*fullNode).Children[right[pos-1]] = nil
+				return false, nil
+			}
+			return false, unset(rn, rn.Val, right[pos:], len(rn.Key), true)
+		}
+		return false, nil
+	case *fullNode:
+		for i := left[pos] + 1; i < right[pos]; i++ {
+			rn.Children[i] = nil
+		}
+		if err := unset(rn, rn.Children[left[pos]], left[pos:], 1, false); err != nil {
+			return false, err
+		}
+		if err := unset(rn, rn.Children[right[pos]], right[pos:], 1, true); err != nil {
+			return false, err
+		}
+		return false, nil
+	default:
+		panic(fmt.Sprintf("%T: invalid node: %v", n, n))
+	}
+}
+
+// unset removes the nodes on one side of the path to key below child, the
+// right side if removeLeft is false and the left side otherwise.
+func unset(parent node, child node, key []byte, pos int, removeLeft bool) error {
+	switch cld := child.(type) {
+	case *fullNode:
+		if removeLeft {
+			for i := 0; i < int(key[pos]); i++ {
+				cld.Children[i] = nil
+			}
+		} else {
+			for i := key[pos] + 1; i < 16; i++ {
+				cld.Children[i] = nil
+			}
+		}
+		cld.flags = nodeFlag{dirty: true}
+		return unset(cld, cld.Children[key[pos]], key, pos+1, removeLeft)
+	case *shortNode:
+		if len(key[pos:]) < len(cld.Key) || !bytes.Equal(cld.Key, key[pos:pos+len(cld.Key)]) {
+			// The path forks off here, the whole short node is either in
+			// the range or outside of it
+			if removeLeft {
+				if bytes.Compare(cld.Key, key[pos:]) < 0 {
+					parent.(*fullNode).Children[key[pos-1]] = nil
+				}
+			} else {
+				if bytes.Compare(cld.Key, key[pos:]) > 0 {
+					parent.(*fullNode).Children[key[pos-1]] = nil
+				}
+			}
+			return nil
+		}
+		if _, ok := cld.Val.(valueNode); ok {
+			parent.(*fullNode).Children[key[pos-1]] = nil
+			return nil
+		}
+		cld.flags = nodeFlag{dirty: true}
+		return unset(cld, cld.Val, key, pos+len(cld.Key), removeLeft)
+	case nil:
+		// The edge key is absent from the trie
+		return nil
+	default:
+		panic(fmt.Sprintf("%T: invalid node: %v", child, child))
+	}
+}
+
+// hasRightElement reports whether the resolved path to key has any node to
+// the right of it.
+func hasRightElement(node node, key []byte) bool {
+	pos, key := 0, keybytesToHex(key)
+	for node != nil {
+		switch rn := node.(type) {
+		case *fullNode:
+			for i := key[pos] + 1; i < 16; i++ {
+				if rn.Children[i] != nil {
+					return true
+				}
+			}
+			node, pos = rn.Children[key[pos]], pos+1
+		case *shortNode:
+			if len(key)-pos < len(rn.Key) || !bytes.Equal(rn.Key, key[pos:pos+len(rn.Key)]) {
+				return bytes.Compare(rn.Key, key[pos:]) > 0
+			}
+			node, pos = rn.Val, pos+len(rn.Key)
+		case valueNode:
+			return false
+		default:
+			panic(fmt.Sprintf("%T: invalid node: %v", node, node))
+		}
+	}
+	return false
+}
@@ -20,6 +20,7 @@ import (
 	"bytes"
 	crand "crypto/rand"
 	mrand "math/rand"
+	"sort"
 	"testing"
 	"time"
 
@@ -84,6 +85,142 @@ func TestVerifyBadProof(t *testing.T) {
 }
 
 // mutateByte changes one byte in b.
+func TestRangeProof(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := sortedEntries(vals)
+	for i := 0; i < 500; i++ {
+		start := mrand.Intn(len(entries))
+		end := mrand.Intn(len(entries)-start) + start + 1
+
+		keys, values := rangeKeys(entries[start:end])
+		proof := rangeProof(trie, keys[0], keys[len(keys)-1])
+		more, err := VerifyRangeProof(trie.Hash(), keys[0], keys[len(keys)-1], keys, values, proof)
+		if err != nil {
+			t.Fatalf("range %d-%d: valid proof rejected: %v", start, end, err)
+		}
+		if more != (end < len(entries)) {
+			t.Fatalf("range %d-%d: more elements mismatch: have %v", start, end, more)
+		}
+	}
+}
+
+func TestRangeProofWithNonExistentEdges(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := sortedEntries(vals)
+	for i := 0; i < 500; i++ {
+		start := mrand.Intn(len(entries)-2) + 1
+		end := mrand.Intn(len(entries)-start-1) + start + 2
+
+		// Prove from just after the preceding key, which isn't in the trie
+		first := increaseKey(common.CopyBytes(entries[start-1].k))
+		if bytes.Equal(first, entries[start].k) {
+			continue
+		}
+		keys, values := rangeKeys(entries[start:end])
+		last := keys[len(keys)-1]
+		proof := rangeProof(trie, first, last)
+		if _, err := VerifyRangeProof(trie.Hash(), first, last, keys, values, proof); err != nil {
+			t.Fatalf("range %d-%d: valid proof rejected: %v", start, end, err)
+		}
+	}
+}
+
+func TestRangeProofWholeTrie(t *testing.T) {
+	trie, vals := randomTrie(1024)
+	keys, values := rangeKeys(sortedEntries(vals))
+
+	more, err := VerifyRangeProof(trie.Hash(), nil, nil, keys, values, nil)
+	if err != nil {
+		t.Fatalf("whole trie rejected: %v", err)
+	}
+	if more {
+		t.Fatalf("more elements reported after the whole trie")
+	}
+	if _, err := VerifyRangeProof(trie.Hash(), nil, nil, keys[1:], values[1:], nil); err == nil {
+		t.Fatalf("incomplete trie accepted")
+	}
+}
+
+func TestEmptyRangeProof(t *testing.T) {
+	trie, vals := randomTrie(1024)
+	entries := sortedEntries(vals)
+
+	last := entries[len(entries)-1].k
+	first := increaseKey(common.CopyBytes(last))
+	if _, err := VerifyRangeProof(trie.Hash(), first, nil, nil, nil, trie.Prove(first)); err != nil {
+		t.Fatalf("empty tail rejected: %v", err)
+	}
+	first = entries[len(entries)-2].k
+	if _, err := VerifyRangeProof(trie.Hash(), first, nil, nil, nil, trie.Prove(first)); err == nil {
+		t.Fatalf("empty range accepted over existing elements")
+	}
+}
+
+func TestBadRangeProof(t *testing.T) {
+	trie, vals := randomTrie(4096)
+	entries := sortedEntries(vals)
+	for i := 0; i < 500; i++ {
+		start := mrand.Intn(len(entries))
+		end := mrand.Intn(len(entries)-start) + start + 1
+		if end-start < 3 {
+			continue
+		}
+		keys, values := rangeKeys(entries[start:end])
+		first, last := keys[0], keys[len(keys)-1]
+		proof := rangeProof(trie, first, last)
+
+		index := mrand.Intn(len(keys)-2) + 1
+		switch mrand.Intn(3) {
+		case 0:
+			// Modified value
+			values[index] = randBytes(20)
+		case 1:
+			// Gapped entry
+			keys = append(keys[:index], keys[index+1:]...)
+			values = append(values[:index], values[index+1:]...)
+		case 2:
+			// Out of order
+			keys[index], keys[index+1] = keys[index+1], keys[index]
+			values[index], values[index+1] = values[index+1], values[index]
+		}
+		if _, err := VerifyRangeProof(trie.Hash(), first, last, keys, values, proof); err == nil {
+			t.Fatalf("range %d-%d: invalid proof accepted", start, end)
+		}
+	}
+}
+
+func sortedEntries(vals map[string]*kv) []*kv {
+	entries := make([]*kv, 0, len(vals))
+	for _, kv := range vals {
+		entries = append(entries, kv)
+	}
+	sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].k, entries[j].k) < 0 })
+	return entries
+}
+
+func rangeKeys(entries []*kv) ([][]byte, [][]byte) {
+	var keys, values [][]byte
+	for _, kv := range entries {
+		keys = append(keys, common.CopyBytes(kv.k))
+		values = append(values, common.CopyBytes(kv.v))
+	}
+	return keys, values
+}
+
+func rangeProof(trie *Trie, first, last []byte) []rlp.RawValue {
+	return append(trie.Prove(first), trie.Prove(last)...)
+}
+
+func increaseKey(key []byte) []byte {
+	for i := len(key) - 1; i >= 0; i-- {
+		key[i]++
+		if key[i] != 0x0 {
+			break
+		}
+	}
+	return key
+}
+
 func mutateByte(b []byte) {
 	for r := mrand.Intn(len(b)); ; {
 		new := byte(mrand.Intn(255))
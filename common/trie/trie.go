@@ -77,6 +77,11 @@ type DatabaseWriter interface {
 	Put(key, value []byte) error
 }
 
+// LeafCallback is called for each value stored by a commit, along with the hash
+// of the node holding it. It is used to link the storage tries and code of
+// accounts to the account trie node referencing them.
+type LeafCallback func(leaf []byte, parent common.Hash) error
+
 // Trie is a Merkle Patricia Trie.
 // The zero value is an empty trie with no database.
 // Use New to create a trie that sits on top of a database.
@@ -462,7 +467,7 @@ func (t *Trie) Root() []byte { return t.Hash().Bytes() }
 // Hash returns the root hash of the trie. It does not write to the
 // database and can be used even if the trie doesn't have one.
 func (t *Trie) Hash() common.Hash {
-	hash, cached, _ := t.hashRoot(nil)
+	hash, cached, _ := t.hashRoot(nil, nil)
 	t.root = cached
 	return common.BytesToHash(hash.(hashNode))
 }
@@ -487,7 +492,13 @@ func (t *Trie) Commit() (root common.Hash, err error) {
 // the changes made to db are written back to the trie's attached
 // database before using the trie.
 func (t *Trie) CommitTo(db DatabaseWriter) (root common.Hash, err error) {
-	hash, cached, err := t.hashRoot(db)
+	return t.CommitToCallback(db, nil)
+}
+
+// CommitToCallback writes all nodes to the given database like CommitTo, passing
+// every value held by a written node to onleaf.
+func (t *Trie) CommitToCallback(db DatabaseWriter, onleaf LeafCallback) (root common.Hash, err error) {
+	hash, cached, err := t.hashRoot(db, onleaf)
 	if err != nil {
 		return (common.Hash{}), err
 	}
@@ -496,11 +507,11 @@ func (t *Trie) CommitTo(db DatabaseWriter) (root common.Hash, err error) {
 	return common.BytesToHash(hash.(hashNode)), nil
 }
 
-func (t *Trie) hashRoot(db DatabaseWriter) (node, node, error) {
+func (t *Trie) hashRoot(db DatabaseWriter, onleaf LeafCallback) (node, node, error) {
 	if t.root == nil {
 		return hashNode(emptyRoot.Bytes()), nil, nil
 	}
-	h := newHasher(t.cachegen, t.cachelimit)
+	h := newHasher(t.cachegen, t.cachelimit, onleaf)
 	defer returnHasherToPool(h)
 	return h.hash(t.root, db, true)
 }
@@ -20,6 +20,7 @@ package config
 import (
 	"math/big"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/hpb-project/go-hpb/common"
@@ -33,6 +34,7 @@ var (
 	// MainnetChainConfig is the chain parameters to run a node on the main network.
 var	MainnetChainConfig = &ChainConfig{
 		ChainId: big.NewInt(1),
+		GasLimitBoundBlock: big.NewInt(5000000),
 		Prometheus: &PrometheusConfig{
 			Period: 3,
 			Epoch:  30000,
@@ -90,6 +92,7 @@ var (
 	MaxStateFetch   = 384 // Amount of node state values to allow fetching per request
 
 	MaxForkAncestry  = 3 * EpochDuration // Maximum chain reorganisation
+	MinAncientDepth  = MaxForkAncestry   // Minimum distance from the head of blocks moved to the ancient store
 	rttMinEstimate   = 2 * time.Second          // Minimum round-trip time to target for sync requests
 	rttMaxEstimate   = 20 * time.Second         // Maximum rount-trip time to target for sync requests
 	rttMinConfidence = 0.1                      // Worse confidence factor in our estimated RTT value
@@ -113,11 +116,132 @@ var (
 )
 type ChainConfig struct {
 	ChainId *big.Int `json:"chainId"` // Chain id identifies the current chain and is used for replay protection
+
+	// Protocol upgrades are scheduled by the number of their first block. A nil
+	// block leaves the fork unscheduled, zero activates it from the genesis on.
+	ExactRewardBlock     *big.Int `json:"exactRewardBlock,omitempty"`     // Block rewards computed in integer arithmetic
+	ConstantinopleBlock  *big.Int `json:"constantinopleBlock,omitempty"`  // Bitwise shifts, CREATE2 and EXTCODEHASH in the HVM
+	IstanbulBlock        *big.Int `json:"istanbulBlock,omitempty"`        // CHAINID, SELFBALANCE, net gas metered SSTORE and repricing
+	SystemContractsBlock *big.Int `json:"systemContractsBlock,omitempty"` // Precompiles exposing the HPB consensus data to contracts
+	GasLimitBoundBlock   *big.Int `json:"gasLimitBoundBlock,omitempty"`   // Gas limit of a block bound to the one of its parent
+
 	Prometheus *PrometheusConfig `json:"prometheus"`
 }
 
+// fork is a named protocol upgrade of the chain configuration. Optional forks
+// may be scheduled independently of the ones before them.
+type fork struct {
+	name     string
+	block    *big.Int
+	optional bool
+}
+
+// forks returns the protocol upgrades of the configuration in the order they
+// must activate. New forks are appended here.
+func (c *ChainConfig) forks() []fork {
+	return []fork{
+		{name: "exactRewardBlock", block: c.ExactRewardBlock, optional: true},
+		{name: "constantinopleBlock", block: c.ConstantinopleBlock},
+		{name: "istanbulBlock", block: c.IstanbulBlock},
+		{name: "systemContractsBlock", block: c.SystemContractsBlock, optional: true},
+		{name: "gasLimitBoundBlock", block: c.GasLimitBoundBlock, optional: true},
+	}
+}
+
+// IsExactReward returns whether num is at or beyond the ExactReward fork.
+func (c *ChainConfig) IsExactReward(num *big.Int) bool {
+	return isForked(c.ExactRewardBlock, num)
+}
+
+// IsConstantinople returns whether num is at or beyond the Constantinople fork.
+func (c *ChainConfig) IsConstantinople(num *big.Int) bool {
+	return isForked(c.ConstantinopleBlock, num)
+}
+
+// IsIstanbul returns whether num is at or beyond the Istanbul fork.
+func (c *ChainConfig) IsIstanbul(num *big.Int) bool {
+	return isForked(c.IstanbulBlock, num)
+}
+
+// IsSystemContracts returns whether num is at or beyond the fork adding the
+// HPB system precompiles.
+func (c *ChainConfig) IsSystemContracts(num *big.Int) bool {
+	return isForked(c.SystemContractsBlock, num)
+}
+
+// IsGasLimitBound returns whether num is at or beyond the fork bounding the
+// gas limit of a block to the one of its parent.
+func (c *ChainConfig) IsGasLimitBound(num *big.Int) bool {
+	return isForked(c.GasLimitBoundBlock, num)
+}
+
+// CheckConfigForkOrder checks that the scheduled forks activate in order.
+func (c *ChainConfig) CheckConfigForkOrder() error {
+	var last fork
+	for _, cur := range c.forks() {
+		if cur.optional {
+			continue
+		}
+		if cur.block == nil {
+			last = cur
+			continue
+		}
+		if last.name != "" && (last.block == nil || last.block.Cmp(cur.block) > 0) {
+			return fmt.Errorf("unsupported fork ordering: %v enabled at %v, but %v enabled at %v", last.name, last.block, cur.name, cur.block)
+		}
+		last = cur
+	}
+	return nil
+}
+
+// ForkBlocks returns the distinct non-genesis block numbers forks activate at,
+// in ascending order.
+func (c *ChainConfig) ForkBlocks() []uint64 {
+	var blocks []uint64
+	for _, f := range c.forks() {
+		if f.block != nil && f.block.Sign() > 0 {
+			blocks = append(blocks, f.block.Uint64())
+		}
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i] < blocks[j] })
+
+	var unique []uint64
+	for _, n := range blocks {
+		if len(unique) == 0 || unique[len(unique)-1] != n {
+			unique = append(unique, n)
+		}
+	}
+	return unique
+}
+
+// Rules is a one-time view of the forks active at a block, for code paths
+// checking many of them.
+type Rules struct {
+	ChainId          *big.Int
+	IsExactReward    bool
+	IsConstantinople bool
+	IsIstanbul        bool
+	IsSystemContracts bool
+}
+
+// Rules returns the forks active at num.
+func (c *ChainConfig) Rules(num *big.Int) Rules {
+	chainId := c.ChainId
+	if chainId == nil {
+		chainId = new(big.Int)
+	}
+	return Rules{
+		ChainId:          new(big.Int).Set(chainId),
+		IsExactReward:    c.IsExactReward(num),
+		IsConstantinople: c.IsConstantinople(num),
+		IsIstanbul:        c.IsIstanbul(num),
+		IsSystemContracts: c.IsSystemContracts(num),
+	}
+}
+
 var DefaultBlockChainConfig = ChainConfig{
 	ChainId: MainnetChainConfig.ChainId,
+	GasLimitBoundBlock: MainnetChainConfig.GasLimitBoundBlock,
 	Prometheus: &DefaultPrometheusConfig,
 }
 
@@ -152,9 +276,39 @@ func (c *ChainConfig) CheckCompatible(newcfg *ChainConfig, height uint64) *Confi
 }
 
 func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int) *ConfigCompatError {
+	stored, updated := c.forks(), newcfg.forks()
+	for i := range stored {
+		if isForkIncompatible(stored[i].block, updated[i].block, head) {
+			return newCompatError(stored[i].name, stored[i].block, updated[i].block)
+		}
+	}
 	return nil
 }
 
+// isForkIncompatible returns true if a fork scheduled at s1 cannot be rescheduled to
+// block s2 because head is already past the fork.
+func isForkIncompatible(s1, s2, head *big.Int) bool {
+	return (isForked(s1, head) || isForked(s2, head)) && !configNumEqual(s1, s2)
+}
+
+// isForked returns whether a fork scheduled at block s is active at the given head block.
+func isForked(s, head *big.Int) bool {
+	if s == nil || head == nil {
+		return false
+	}
+	return s.Cmp(head) <= 0
+}
+
+func configNumEqual(x, y *big.Int) bool {
+	if x == nil {
+		return y == nil
+	}
+	if y == nil {
+		return x == nil
+	}
+	return x.Cmp(y) == 0
+}
+
 // ConfigCompatError is raised if the locally-stored blockchain is initialised with a
 // ChainConfig that would alter the past.
 type ConfigCompatError struct {
@@ -165,17 +319,42 @@ type ConfigCompatError struct {
 	RewindTo uint64
 }
 
-// GasTable returns the gas table corresponding to the current phase (homestead or homestead reprice).
+func newCompatError(what string, storedblock, newblock *big.Int) *ConfigCompatError {
+	var rew *big.Int
+	switch {
+	case storedblock == nil:
+		rew = newblock
+	case newblock == nil || storedblock.Cmp(newblock) < 0:
+		rew = storedblock
+	default:
+		rew = newblock
+	}
+	err := &ConfigCompatError{what, storedblock, newblock, 0}
+	if rew != nil && rew.Sign() > 0 {
+		err.RewindTo = rew.Uint64() - 1
+	}
+	return err
+}
+
+// GasTable returns the gas table corresponding to the current phase (homestead reprice or Istanbul).
 //
 // The returned GasTable's fields shouldn't, under any circumstances, be changed.
 func (c *ChainConfig) GasTable(num *big.Int) GasTable {
+	if c.IsIstanbul(num) {
+		return GasTableIstanbul
+	}
 	return GasTableEIP158
 }
 
 // String implements the fmt.Stringer interface.
 func (c *ChainConfig) String() string {
-	return fmt.Sprintf("{ChainID: %v Engine: %v}",
+	var forks string
+	for _, f := range c.forks() {
+		forks += fmt.Sprintf(" %v: %v", f.name, f.block)
+	}
+	return fmt.Sprintf("{ChainID: %v%v Engine: %v}",
 		c.ChainId,
+		forks,
 		"Prometheus",
 	)
 }
@@ -57,6 +57,13 @@ const (
 	SstoreResetGas   	  uint64 = 5000  // Once per SSTORE operation if the zeroness changes from zero.
 	SstoreClearGas   	  uint64 = 5000  // Once per SSTORE operation if the zeroness doesn't change.
 	SstoreRefundGas 	  uint64 = 15000 // Once per SSTORE operation if the zeroness changes to zero.
+
+	SstoreSentryGasEIP2200            uint64 = 2300  // Minimum gas required to be present for an SSTORE call, not consumed
+	SstoreSetGasEIP2200               uint64 = 20000 // Once per SSTORE operation from clean zero to non-zero
+	SstoreResetGasEIP2200             uint64 = 5000  // Once per SSTORE operation from clean non-zero to something else
+	SstoreClearsScheduleRefundEIP2200 uint64 = 15000 // Once per SSTORE operation for clearing an originally existing storage slot
+	SloadGasEIP2200                   uint64 = 800   // Cost of SLOAD, also charged for SSTORE on a dirty slot
+
 	JumpdestGas      	  uint64 = 1     // Refunded gas, once per SSTORE operation if the zeroness changes to zero.
 	EpochDuration    	  uint64 = 30000 // Duration between proof-of-work epochs.
 	CallGas         	  uint64 = 40    // Once per CALL operation & message call transaction.
@@ -69,6 +76,7 @@ const (
 	TierStepGas      	  uint64 = 0     // Once per operation, for a selection of them.
 	LogTopicGas      	  uint64 = 375   // Multiplied by the * of the LOG*, per LOG transaction. e.g. LOG0 incurs 0 * c_txLogTopicGas, LOG4 incurs 4 * c_txLogTopicGas.
 	CreateGas       	  uint64 = 32000 // Once per CREATE operation & contract-creation transaction.
+	Create2Gas       	  uint64 = 32000 // Once per CREATE2 operation
 	SuicideRefundGas 	  uint64 = 24000 // Refunded following a suicide operation.
 	MemoryGas        	  uint64 = 3     // Times the address of the (highest referenced byte in memory + 1). NOTE: referencing happens on read, write and in instructions such as RETURN and CALL.
 	TxDataNonZeroGas 	  uint64 = 1    // Per byte of data attached to a transaction that is not equal to zero. NOTE: Not payable on data of calls between transactions. //for testnet
@@ -89,6 +97,10 @@ const (
 	Bn256ScalarMulGas       uint64 = 40000  // Gas needed for an elliptic curve scalar multiplication
 	Bn256PairingBaseGas     uint64 = 100000 // Base price for an elliptic curve pairing check
 	Bn256PairingPerPointGas uint64 = 80000  // Per-point price for an elliptic curve pairing check
+
+	HardwareRandomGas uint64 = 100  // Price of reading the hardware random of the current block
+	HpbNodesGas       uint64 = 2000 // Price of reading the HpNode set of the current block
+	CandidateNodesGas uint64 = 4000 // Price of reading the candidate set and votes of the current block
 )
 const (
 	// These are the multipliers for ether denominations.
@@ -0,0 +1,122 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"math"
+
+	"github.com/hpb-project/go-hpb/common"
+)
+
+var (
+	// ErrRemoteStale is returned by the fork filter if a remote fork ID is a
+	// subset of the local one, but the remote node doesn't know of a fork the
+	// local chain already passed.
+	ErrRemoteStale = errors.New("remote needs update")
+
+	// ErrLocalIncompatibleOrStale is returned by the fork filter if a remote
+	// fork ID doesn't match the local chain, or announces a fork the local
+	// chain passed without knowing about it.
+	ErrLocalIncompatibleOrStale = errors.New("local incompatible or needs update")
+)
+
+// ForkID is a compact digest of the genesis block and the forks a chain passed,
+// exchanged in the handshake so that nodes on diverging rules drop each other
+// early.
+type ForkID struct {
+	Hash [4]byte // CRC32 checksum of the genesis block and passed fork blocks
+	Next uint64  // Block number of the next upcoming fork, or 0 if none is known
+}
+
+// NewForkID calculates the fork ID of a chain at the given head block.
+func NewForkID(c *ChainConfig, genesis common.Hash, head uint64) ForkID {
+	hash := crc32.ChecksumIEEE(genesis[:])
+	for _, fork := range c.ForkBlocks() {
+		if fork > head {
+			return ForkID{Hash: checksumToBytes(hash), Next: fork}
+		}
+		hash = checksumUpdate(hash, fork)
+	}
+	return ForkID{Hash: checksumToBytes(hash), Next: 0}
+}
+
+// NewForkFilter creates a validator of remote fork IDs against the local chain,
+// with headfn returning the current local head.
+func NewForkFilter(c *ChainConfig, genesis common.Hash, headfn func() uint64) func(id ForkID) error {
+	// Calculate the checksums of every fork set once, with a sentinel fork
+	// at the end that is never reached
+	var (
+		forks = append(c.ForkBlocks(), math.MaxUint64)
+		sums  = make([][4]byte, len(forks))
+	)
+	hash := crc32.ChecksumIEEE(genesis[:])
+	sums[0] = checksumToBytes(hash)
+	for i, fork := range forks[:len(forks)-1] {
+		hash = checksumUpdate(hash, fork)
+		sums[i+1] = checksumToBytes(hash)
+	}
+	return func(id ForkID) error {
+		head := headfn()
+		for i, fork := range forks {
+			// Find the fork set the local head is in
+			if head >= fork {
+				continue
+			}
+			// Same fork set: the remote must not have passed a fork we haven't
+			if sums[i] == id.Hash {
+				if id.Next > 0 && head >= id.Next {
+					return ErrLocalIncompatibleOrStale
+				}
+				return nil
+			}
+			// The remote is behind: it must be on our past fork set and know
+			// the fork that follows it
+			for j := 0; j < i; j++ {
+				if sums[j] == id.Hash {
+					if forks[j] != id.Next {
+						return ErrRemoteStale
+					}
+					return nil
+				}
+			}
+			// The remote is ahead: it must be on a fork set we know of
+			for j := i + 1; j < len(sums); j++ {
+				if sums[j] == id.Hash {
+					return nil
+				}
+			}
+			return ErrLocalIncompatibleOrStale
+		}
+		return nil
+	}
+}
+
+// checksumUpdate extends a fork checksum with the block number of a fork.
+func checksumUpdate(hash uint32, fork uint64) uint32 {
+	var blob [8]byte
+	binary.BigEndian.PutUint64(blob[:], fork)
+	return crc32.Update(hash, crc32.IEEETable, blob[:])
+}
+
+func checksumToBytes(hash uint32) [4]byte {
+	var blob [4]byte
+	binary.BigEndian.PutUint32(blob[:], hash)
+	return blob
+}
@@ -0,0 +1,147 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/hpb-project/go-hpb/common"
+)
+
+func TestCheckCompatible(t *testing.T) {
+	type test struct {
+		stored, new *ChainConfig
+		head        uint64
+		wantErr     *ConfigCompatError
+	}
+	tests := []test{
+		{stored: &ChainConfig{}, new: &ChainConfig{}, head: 0, wantErr: nil},
+		{stored: &ChainConfig{}, new: &ChainConfig{}, head: 100, wantErr: nil},
+		{
+			stored:  &ChainConfig{ExactRewardBlock: big.NewInt(10)},
+			new:     &ChainConfig{ExactRewardBlock: big.NewInt(20)},
+			head:    9,
+			wantErr: nil,
+		},
+		{
+			stored: &ChainConfig{ExactRewardBlock: big.NewInt(10)},
+			new:    &ChainConfig{ExactRewardBlock: big.NewInt(20)},
+			head:   25,
+			wantErr: &ConfigCompatError{
+				What:         "exactRewardBlock",
+				StoredConfig: big.NewInt(10),
+				NewConfig:    big.NewInt(20),
+				RewindTo:     9,
+			},
+		},
+		{
+			stored: &ChainConfig{},
+			new:    &ChainConfig{ExactRewardBlock: big.NewInt(20)},
+			head:   25,
+			wantErr: &ConfigCompatError{
+				What:         "exactRewardBlock",
+				StoredConfig: nil,
+				NewConfig:    big.NewInt(20),
+				RewindTo:     19,
+			},
+		},
+		{
+			stored: &ChainConfig{ExactRewardBlock: big.NewInt(30)},
+			new:    &ChainConfig{},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "exactRewardBlock",
+				StoredConfig: big.NewInt(30),
+				NewConfig:    nil,
+				RewindTo:     29,
+			},
+		},
+	}
+	for i, test := range tests {
+		err := test.stored.CheckCompatible(test.new, test.head)
+		if !reflect.DeepEqual(err, test.wantErr) {
+			t.Errorf("test %d: error mismatch:\nstored: %v\nnew: %v\nhead: %v\nerr: %v\nwant: %v", i, test.stored, test.new, test.head, err, test.wantErr)
+		}
+	}
+}
+
+func TestForkFilter(t *testing.T) {
+	var (
+		genesis = common.HexToHash("0x01")
+		local   = &ChainConfig{ExactRewardBlock: big.NewInt(100)}
+		head    uint64
+	)
+	filter := NewForkFilter(local, genesis, func() uint64 { return head })
+
+	var (
+		before  = NewForkID(local, genesis, 0)
+		after   = NewForkID(local, genesis, 100)
+		unaware = NewForkID(&ChainConfig{}, genesis, 200)
+		other   = NewForkID(local, common.HexToHash("0x02"), 0)
+	)
+	if before.Next != 100 || after.Next != 0 || before.Hash == after.Hash || unaware.Hash != before.Hash {
+		t.Fatalf("unexpected fork ids: before %x, after %x, unaware %x", before, after, unaware)
+	}
+	tests := []struct {
+		head uint64
+		id   ForkID
+		err  error
+	}{
+		// Same fork set, whether or not the fork is announced
+		{0, before, nil},
+		{0, ForkID{Hash: before.Hash}, nil},
+		{150, after, nil},
+
+		// Remote passed the fork, local is behind but knows about it
+		{50, after, nil},
+
+		// Local passed the fork, remote is behind and announces it
+		{150, before, nil},
+
+		// Local passed the fork, remote doesn't know about it
+		{150, unaware, ErrRemoteStale},
+
+		// Remote announces a fork the local chain passed unaware of
+		{150, ForkID{Hash: NewForkID(local, genesis, 100).Hash, Next: 120}, ErrLocalIncompatibleOrStale},
+
+		// Different chain
+		{0, other, ErrLocalIncompatibleOrStale},
+	}
+	for i, tt := range tests {
+		head = tt.head
+		if err := filter(tt.id); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
+func TestForkOrder(t *testing.T) {
+	if err := (&ChainConfig{ExactRewardBlock: big.NewInt(1)}).CheckConfigForkOrder(); err != nil {
+		t.Fatalf("valid fork order rejected: %v", err)
+	}
+	if err := (&ChainConfig{ConstantinopleBlock: big.NewInt(5)}).CheckConfigForkOrder(); err != nil {
+		t.Fatalf("valid fork order rejected: %v", err)
+	}
+	if err := (&ChainConfig{ConstantinopleBlock: big.NewInt(10), IstanbulBlock: big.NewInt(5)}).CheckConfigForkOrder(); err == nil {
+		t.Fatalf("istanbul before constantinople accepted")
+	}
+	if blocks := (&ChainConfig{ExactRewardBlock: big.NewInt(0)}).ForkBlocks(); len(blocks) != 0 {
+		t.Fatalf("genesis fork listed: %v", blocks)
+	}
+}
@@ -88,6 +88,9 @@ var DefaultConfig = Nodeconfig{
 	},
 	*/
 	MaxTrieCacheGen : uint16(120),
+	TrieCache:         256,
+	TrieFlushInterval: 3600,
+	AncientDepth:      90000,
 }
 
 //TODO: shanlin
@@ -136,12 +139,24 @@ type Nodeconfig struct {
 	SkipBcVersionCheck bool `toml:"-"`
 	DatabaseHandles    int  `toml:"-"`
 	DatabaseCache      int
+	DatabaseEngine     string `toml:",omitempty"` // Storage engine of new databases, existing ones keep theirs
+
+	// State garbage collection options
+	NoPruning         bool   // Whether to disable state garbage collection and keep every state (archive mode)
+	TrieCache         int    // Megabytes of memory the trie node cache may use before flushing to disk
+	TrieFlushInterval uint64 // Number of blocks after which a cached state is flushed to disk
+	NoSnapshot        bool   // Whether to disable the flat state snapshot
+
+	// Ancient block store options
+	AncientDepth uint64 // Number of blocks behind the head before a block is moved to the ancient store, 0 to disable
+	AncientDir   string `toml:",omitempty"` // Directory of the ancient store, defaults to "ancient" inside the chain database
 
 	// Mining-related options
 	Hpberbase    common.Address `toml:",omitempty"`
 	MinerThreads int            `toml:",omitempty"`
 	ExtraData    []byte         `toml:",omitempty"`
 	GasPrice     *big.Int
+	GasTarget    *big.Int       `toml:",omitempty"` // Gas limit the mined blocks are moved toward
 
 	// Gas Price Oracle options,HPB don't need dynamic gas price
 	//TODO: shanlin
@@ -150,6 +165,9 @@ type Nodeconfig struct {
 	// Enables tracking of SHA3 preimages in the VM
 	EnablePreimageRecording bool
 
+	// Enables profiling the opcodes and contracts executed by the VM
+	VMProfile bool
+
 	// Miscellaneous options
 	DocRoot   string `toml:"-"`
 
@@ -2,6 +2,7 @@ package config
 type GasTable struct {
 	ExtcodeSize uint64
 	ExtcodeCopy uint64
+	ExtcodeHash uint64
 	Balance     uint64
 	SLoad       uint64
 	Calls       uint64
@@ -21,6 +22,7 @@ var (
 	GasTableEIP158 = GasTable{
 		ExtcodeSize: 700,
 		ExtcodeCopy: 700,
+		ExtcodeHash: 400,
 		Balance:     400,
 		SLoad:       200,
 		Calls:       700,
@@ -29,4 +31,19 @@ var (
 
 		CreateBySuicide: 25000,
 	}
+
+	// GasTableIstanbul contains the gas prices for the Istanbul phase,
+	// repricing the state reads of EIP-1884.
+	GasTableIstanbul = GasTable{
+		ExtcodeSize: 700,
+		ExtcodeCopy: 700,
+		ExtcodeHash: 700,
+		Balance:     700,
+		SLoad:       800,
+		Calls:       700,
+		Suicide:     5000,
+		ExpByte:     50,
+
+		CreateBySuicide: 25000,
+	}
 )
\ No newline at end of file
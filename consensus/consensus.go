@@ -94,3 +94,14 @@ type Engine interface {
 	// APIs returns the RPC APIs this consensus engine provides.
 	APIs(chain ChainReader) []rpc.API
 }
+
+// NodeSetReader is implemented by engines able to report the node sets in
+// charge of a block, read by the system contracts of the HVM.
+type NodeSetReader interface {
+	// HpbNodes returns the HpNode set sealing the given block, sorted by address.
+	HpbNodes(chain ChainReader, header *types.Header) ([]common.Address, error)
+
+	// CandidateNodes returns the candidate set of the given block sorted by
+	// address, along with the votes each candidate received.
+	CandidateNodes(chain ChainReader, header *types.Header) ([]common.Address, []uint64, error)
+}
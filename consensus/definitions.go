@@ -18,6 +18,7 @@ package consensus
 
 import (
 	"errors"
+	"math/big"
 
 	"github.com/hpb-project/go-hpb/blockchain/types"
 	"github.com/hpb-project/go-hpb/common"
@@ -100,6 +101,9 @@ var (
 
 	ExtraVanity = 32 // Fixed number of extra-data prefix bytes reserved for signerHash vanity
 	ExtraSeal   = 65 // Fixed number of extra-data suffix bytes reserved for signerHash seal
+
+	DiffInTurn = big.NewInt(2) // Block difficulty for in-turn signatures
+	DiffNoTurn = big.NewInt(1) // Block difficulty for out-of-turn signatures
 )
 
 // 获取当前的签名者
@@ -56,8 +56,8 @@ var (
 	epochLength   = uint64(30000)            // 充值投票的时的间隔，默认 30000个
 	blockPeriod   = uint64(15)               // 两个区块之间的默认时间 15 秒
 	uncleHash     = types.CalcUncleHash(nil) //
-	diffInTurn    = big.NewInt(2)            // 当轮到的时候难度值设置 2
-	diffNoTurn    = big.NewInt(1)            // 当非轮到的时候难度设置 1
+	diffInTurn    = consensus.DiffInTurn     // 当轮到的时候难度值设置 2
+	diffNoTurn    = consensus.DiffNoTurn     // 当非轮到的时候难度设置 1
 	reentryMux    sync.Mutex
 	insPrometheus *Prometheus
 )
@@ -452,6 +452,9 @@ func (c *Prometheus) Finalize(chain consensus.ChainReader, header *types.Header,
 
 // 计算奖励
 func (c *Prometheus) CalculateRewards(chain consensus.ChainReader, state *state.StateDB, header *types.Header, uncles []*types.Header) error {
+	if chain.Config().IsExactReward(header.Number) {
+		return c.calculateExactRewards(chain, state, header)
+	}
 	// Select the correct block reward based on chain progression
 	//hobBlockReward := big.NewInt(300000000)
 	//canBlockReward := big.NewInt(100000000)
@@ -558,6 +561,61 @@ func (c *Prometheus) CalculateRewards(chain consensus.ChainReader, state *state.
 	return nil
 }
 
+// calculateExactRewards splits the block reward between the signer and the
+// candidate nodes like CalculateRewards, but in integer arithmetic, so the
+// amounts don't depend on floating-point rounding.
+func (c *Prometheus) calculateExactRewards(chain consensus.ChainReader, state *state.StateDB, header *types.Header) error {
+	number := header.Number.Uint64()
+	if number == 0 {
+		return consensus.ErrUnknownBlock
+	}
+	// Two thirds of the yearly issuance of 3% of the 100 million coins, spread
+	// over the blocks of a year
+	period := c.config.Period
+	if period == 0 {
+		period = blockPeriod
+	}
+	blocksPerYear := new(big.Int).SetUint64(60 * 60 * 24 * 365 / period)
+
+	reward := new(big.Int).Mul(big.NewInt(3000000), big.NewInt(config.Ether))
+	reward.Mul(reward, big.NewInt(2))
+	reward.Div(reward, new(big.Int).Mul(blocksPerYear, big.NewInt(3)))
+
+	// The signer gets 35% of it
+	hpbReward := new(big.Int).Mul(reward, big.NewInt(35))
+	hpbReward.Div(hpbReward, big.NewInt(100))
+	state.AddBalance(header.Coinbase, hpbReward)
+
+	// The candidates share 65% of it evenly, plus a third of it by their votes
+	csnap, err := voting.GetCadNodeSnap(c.db, c.recents, chain, number, header.ParentHash)
+	if err != nil {
+		return err
+	}
+	if csnap == nil || len(csnap.VotePercents) == 0 {
+		return nil
+	}
+	cadReward := new(big.Int).Mul(reward, big.NewInt(65))
+	cadReward.Div(cadReward, big.NewInt(int64(100*len(csnap.VotePercents))))
+
+	voteReward := new(big.Int).Div(reward, big.NewInt(3))
+	votecounts := new(big.Rat)
+	for _, votes := range csnap.VotePercents {
+		if share := new(big.Rat).SetFloat64(votes); share != nil {
+			votecounts.Add(votecounts, share)
+		}
+	}
+	for caddress, votes := range csnap.VotePercents {
+		amount := new(big.Int).Set(cadReward)
+		if share := new(big.Rat).SetFloat64(votes); share != nil && votecounts.Sign() > 0 {
+			share.Mul(share, new(big.Rat).SetInt(voteReward))
+			share.Quo(share, votecounts)
+			amount.Add(amount, new(big.Int).Quo(share.Num(), share.Denom()))
+		}
+		state.AddBalance(caddress, amount)
+	}
+	return nil
+}
+
 // 返回的API
 func (c *Prometheus) APIs(chain consensus.ChainReader) []rpc.API {
 	return []rpc.API{{
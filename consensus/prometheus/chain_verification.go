@@ -18,9 +18,11 @@ package prometheus
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"github.com/hpb-project/go-hpb/blockchain/types"
 	"github.com/hpb-project/go-hpb/common"
 	"github.com/hpb-project/go-hpb/common/log"
+	"github.com/hpb-project/go-hpb/config"
 	"github.com/hpb-project/go-hpb/consensus"
 	"github.com/hpb-project/go-hpb/consensus/voting"
 	"math/big"
@@ -154,6 +156,10 @@ func (c *Prometheus) verifyCascadingFields(chain consensus.ChainReader, header *
 	if parent.Time.Uint64()+c.config.Period > header.Time.Uint64() {
 		return consensus.ErrInvalidTimestamp
 	}
+	// Verify that the gas limit remains within allowed bounds
+	if err := verifyGasLimit(chain.Config(), header, parent); err != nil {
+		return err
+	}
 	// Retrieve the getHpbNodeSnap needed to verify this header and cache it
 	/*
 		snap, err := voting.GetHpbNodeSnap(c.db, c.recents,c.signatures,c.config,chain, number, header.ParentHash, parents)
@@ -178,6 +184,27 @@ func (c *Prometheus) verifyCascadingFields(chain consensus.ChainReader, header *
 	return c.verifySeal(chain, header, parents)
 }
 
+// verifyGasLimit checks that the gas used fits in the header's gas limit and
+// that the limit moved less than parentGasLimit / GasLimitBoundDivisor. The
+// bound only applies from the GasLimitBound fork on, block 5000000 of the main
+// network, so before it only the gas used is checked.
+func verifyGasLimit(chainConfig *config.ChainConfig, header, parent *types.Header) error {
+	if header.GasUsed.Cmp(header.GasLimit) > 0 {
+		return fmt.Errorf("invalid gasUsed: have %v, gasLimit %v", header.GasUsed, header.GasLimit)
+	}
+	if !chainConfig.IsGasLimitBound(header.Number) {
+		return nil
+	}
+	diff := new(big.Int).Sub(parent.GasLimit, header.GasLimit)
+	diff.Abs(diff)
+
+	limit := new(big.Int).Div(parent.GasLimit, config.GasLimitBoundDivisor)
+	if diff.Cmp(limit) >= 0 || header.GasLimit.Cmp(config.MinGasLimit) < 0 {
+		return fmt.Errorf("invalid gas limit: have %v, want %v += %v", header.GasLimit, parent.GasLimit, limit)
+	}
+	return nil
+}
+
 // VerifyUncles implements consensus.Engine, always returning an error for any
 // uncles as this consensus mechanism doesn't permit uncles.
 func (c *Prometheus) VerifyUncles(chain consensus.ChainReader, block *types.Block) error {
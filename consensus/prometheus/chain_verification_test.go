@@ -0,0 +1,71 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package prometheus
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/hpb-project/go-hpb/blockchain/types"
+	"github.com/hpb-project/go-hpb/config"
+)
+
+// Tests that the gas limit bound is only enforced from the GasLimitBound fork on,
+// while the gas used may never exceed the gas limit.
+func TestVerifyGasLimitFork(t *testing.T) {
+	chainConfig := &config.ChainConfig{GasLimitBoundBlock: big.NewInt(10)}
+
+	tests := []struct {
+		number, parent, limit, used int64
+		ok                          bool
+	}{
+		{9, 1024000, 2048000, 0, true},         // out of bound before the fork
+		{9, 1024000, 1000, 0, true},            // below the minimum before the fork
+		{9, 1024000, 1024000, 1024001, false},  // gas used above the limit before the fork
+		{10, 1024000, 1024999, 0, true},        // within the bound at the fork
+		{10, 1024000, 1025000, 0, false},       // out of bound at the fork
+		{11, 1024000, 1000, 0, false},          // below the minimum after the fork
+		{11, 1024000, 1024000, 1024001, false}, // gas used above the limit after the fork
+	}
+	for i, tt := range tests {
+		parent := &types.Header{Number: big.NewInt(tt.number - 1), GasLimit: big.NewInt(tt.parent), GasUsed: new(big.Int)}
+		header := &types.Header{Number: big.NewInt(tt.number), GasLimit: big.NewInt(tt.limit), GasUsed: big.NewInt(tt.used)}
+		if err := verifyGasLimit(chainConfig, header, parent); (err == nil) != tt.ok {
+			t.Errorf("test %d: verification mismatch: have %v, want ok %v", i, err, tt.ok)
+		}
+	}
+}
+
+// Tests that the shipped chain configurations enforce the gas limit bound from
+// their GasLimitBound fork on.
+func TestVerifyGasLimitShipped(t *testing.T) {
+	for name, chainConfig := range map[string]*config.ChainConfig{
+		"mainnet": config.MainnetChainConfig,
+		"default": &config.DefaultBlockChainConfig,
+	} {
+		fork := chainConfig.GasLimitBoundBlock
+		if fork == nil {
+			t.Errorf("%s: gas limit bound not scheduled", name)
+			continue
+		}
+		parent := &types.Header{Number: new(big.Int).Sub(fork, big.NewInt(1)), GasLimit: big.NewInt(1024000), GasUsed: new(big.Int)}
+		header := &types.Header{Number: fork, GasLimit: big.NewInt(2048000), GasUsed: new(big.Int)}
+		if err := verifyGasLimit(chainConfig, header, parent); err == nil {
+			t.Errorf("%s: gas limit out of bound accepted at block %v", name, fork)
+		}
+	}
+}
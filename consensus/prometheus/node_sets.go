@@ -0,0 +1,50 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package prometheus
+
+import (
+	"github.com/hpb-project/go-hpb/blockchain/types"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/consensus"
+	"github.com/hpb-project/go-hpb/consensus/voting"
+)
+
+var _ consensus.NodeSetReader = (*Prometheus)(nil)
+
+// HpbNodes implements consensus.NodeSetReader, returning the HpNode set of the
+// snapshot the block is sealed against.
+func (c *Prometheus) HpbNodes(chain consensus.ChainReader, header *types.Header) ([]common.Address, error) {
+	snap, err := voting.GetHpbNodeSnap(c.db, c.recents, c.signatures, c.config, chain, header.Number.Uint64(), header.ParentHash, nil)
+	if err != nil {
+		return nil, err
+	}
+	return snap.GetHpbNodes(), nil
+}
+
+// CandidateNodes implements consensus.NodeSetReader, returning the candidates
+// of the block along with their votes, as used for the rewards.
+func (c *Prometheus) CandidateNodes(chain consensus.ChainReader, header *types.Header) ([]common.Address, []uint64, error) {
+	csnap, err := voting.GetCadNodeSnap(c.db, c.recents, chain, header.Number.Uint64(), header.ParentHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	votes := make([]uint64, len(csnap.CanAddresses))
+	for i, addr := range csnap.CanAddresses {
+		votes[i] = uint64(csnap.VotePercents[addr])
+	}
+	return csnap.CanAddresses, votes, nil
+}
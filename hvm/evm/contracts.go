@@ -50,6 +50,32 @@ var PrecompiledContractsByzantium = map[common.Address]PrecompiledContract{
 	common.BytesToAddress([]byte{8}): &bn256Pairing{},
 }
 
+// Addresses of the HPB system contracts, exposing the consensus data of the
+// current block to contracts.
+var (
+	HardwareRandomAddress = common.BytesToAddress([]byte{0x08, 0x01})
+	HpbNodesAddress       = common.BytesToAddress([]byte{0x08, 0x02})
+	CandidateNodesAddress = common.BytesToAddress([]byte{0x08, 0x03})
+)
+
+var errNoConsensusData = errors.New("consensus data unavailable")
+
+// precompiledContractsFor returns the precompiled contracts of the forks
+// active in rules, with the system contracts reading from ctx.
+func precompiledContractsFor(rules config.Rules, ctx *Context) map[common.Address]PrecompiledContract {
+	if !rules.IsSystemContracts {
+		return PrecompiledContractsByzantium
+	}
+	contracts := make(map[common.Address]PrecompiledContract, len(PrecompiledContractsByzantium)+3)
+	for addr, p := range PrecompiledContractsByzantium {
+		contracts[addr] = p
+	}
+	contracts[HardwareRandomAddress] = &hardwareRandom{ctx}
+	contracts[HpbNodesAddress] = &hpbNodes{ctx}
+	contracts[CandidateNodesAddress] = &candidateNodes{ctx}
+	return contracts
+}
+
 // RunPrecompiledContract runs and evaluates the output of a precompiled contract.
 func RunPrecompiledContract(p PrecompiledContract, input []byte, contract *Contract) (ret []byte, err error) {
 	gas := p.RequiredGas(input)
@@ -368,3 +394,96 @@ func (c *bn256Pairing) Run(input []byte) ([]byte, error) {
 	}
 	return false32Byte, nil
 }
+
+// hardwareRandom implemented as a native contract, returning the hardware
+// random of the current block as a bytes32.
+type hardwareRandom struct {
+	ctx *Context
+}
+
+func (c *hardwareRandom) RequiredGas(input []byte) uint64 {
+	return config.HardwareRandomGas
+}
+
+func (c *hardwareRandom) Run(input []byte) ([]byte, error) {
+	return common.BytesToHash(c.ctx.HardwareRandom).Bytes(), nil
+}
+
+// hpbNodes implemented as a native contract, returning the HpNode set of the
+// current block ABI encoded as an address[].
+type hpbNodes struct {
+	ctx *Context
+}
+
+func (c *hpbNodes) RequiredGas(input []byte) uint64 {
+	return config.HpbNodesGas
+}
+
+func (c *hpbNodes) Run(input []byte) ([]byte, error) {
+	if c.ctx.GetHpbNodes == nil {
+		return nil, errNoConsensusData
+	}
+	nodes, err := c.ctx.GetHpbNodes()
+	if err != nil {
+		return nil, err
+	}
+	words := make([]*big.Int, len(nodes))
+	for i, node := range nodes {
+		words[i] = node.Big()
+	}
+	return append(common.LeftPadBytes(big.NewInt(32).Bytes(), 32), encodeWords(words)...), nil
+}
+
+// candidateNodes implemented as a native contract, returning the candidate set
+// of the current block and the share of the votes of each candidate in basis
+// points, ABI encoded as an (address[], uint256[]).
+type candidateNodes struct {
+	ctx *Context
+}
+
+func (c *candidateNodes) RequiredGas(input []byte) uint64 {
+	return config.CandidateNodesGas
+}
+
+func (c *candidateNodes) Run(input []byte) ([]byte, error) {
+	if c.ctx.GetCandidateNodes == nil {
+		return nil, errNoConsensusData
+	}
+	nodes, votes, err := c.ctx.GetCandidateNodes()
+	if err != nil {
+		return nil, err
+	}
+	total := new(big.Int)
+	for _, vote := range votes {
+		total.Add(total, new(big.Int).SetUint64(vote))
+	}
+	var (
+		addrs  = make([]*big.Int, len(nodes))
+		shares = make([]*big.Int, len(nodes))
+	)
+	for i, node := range nodes {
+		addrs[i] = node.Big()
+		shares[i] = new(big.Int)
+		if total.Sign() > 0 {
+			shares[i].SetUint64(votes[i])
+			shares[i].Mul(shares[i], big.NewInt(10000))
+			shares[i].Div(shares[i], total)
+		}
+	}
+	// Two offsets to the dynamic arrays, followed by the arrays
+	head := 64
+	ret := common.LeftPadBytes(big.NewInt(int64(head)).Bytes(), 32)
+	ret = append(ret, common.LeftPadBytes(big.NewInt(int64(head+32*(len(nodes)+1))).Bytes(), 32)...)
+	ret = append(ret, encodeWords(addrs)...)
+	return append(ret, encodeWords(shares)...), nil
+}
+
+// encodeWords ABI encodes words as the length followed by the words.
+func encodeWords(words []*big.Int) []byte {
+	enc := make([]byte, 0, 32*(len(words)+1))
+	enc = append(enc, common.LeftPadBytes(big.NewInt(int64(len(words))).Bytes(), 32)...)
+	for _, word := range words {
+		enc = append(enc, common.LeftPadBytes(word.Bytes(), 32)...)
+	}
+	return enc
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/config"
 )
 
 // precompiledTest defines the input/output pairs for precompiled contract tests.
@@ -465,3 +466,68 @@ func BenchmarkPrecompiledBn256Pairing(bench *testing.B) {
 		benchmarkPrecompiled("08", test, bench)
 	}
 }
+
+// Tests that the system contracts are only present after their fork and return
+// the consensus data of the context ABI encoded.
+func TestSystemContracts(t *testing.T) {
+	var (
+		nodeA = common.HexToAddress("0x0a")
+		nodeB = common.HexToAddress("0x0b")
+		ctx   = Context{
+			BlockNumber:    big.NewInt(10),
+			HardwareRandom: common.Hex2Bytes("0102030405060708091011121314151617181920212223242526272829303132"),
+			GetHpbNodes: func() ([]common.Address, error) {
+				return []common.Address{nodeA, nodeB}, nil
+			},
+			GetCandidateNodes: func() ([]common.Address, []uint64, error) {
+				return []common.Address{nodeA, nodeB}, []uint64{1, 3}, nil
+			},
+		}
+		chainConfig = &config.ChainConfig{SystemContractsBlock: big.NewInt(10)}
+	)
+	before := NewEVM(Context{BlockNumber: big.NewInt(9)}, nil, chainConfig, Config{})
+	if before.precompiles[HardwareRandomAddress] != nil {
+		t.Fatalf("system contracts present before the fork")
+	}
+	evm := NewEVM(ctx, nil, chainConfig, Config{})
+
+	tests := []struct {
+		addr     common.Address
+		gas      uint64
+		expected string
+	}{
+		{HardwareRandomAddress, config.HardwareRandomGas,
+			"0102030405060708091011121314151617181920212223242526272829303132"},
+		{HpbNodesAddress, config.HpbNodesGas,
+			"0000000000000000000000000000000000000000000000000000000000000020" +
+				"0000000000000000000000000000000000000000000000000000000000000002" +
+				"000000000000000000000000000000000000000000000000000000000000000a" +
+				"000000000000000000000000000000000000000000000000000000000000000b"},
+		{CandidateNodesAddress, config.CandidateNodesGas,
+			"0000000000000000000000000000000000000000000000000000000000000040" +
+				"00000000000000000000000000000000000000000000000000000000000000a0" +
+				"0000000000000000000000000000000000000000000000000000000000000002" +
+				"000000000000000000000000000000000000000000000000000000000000000a" +
+				"000000000000000000000000000000000000000000000000000000000000000b" +
+				"0000000000000000000000000000000000000000000000000000000000000002" +
+				"00000000000000000000000000000000000000000000000000000000000009c4" +
+				"0000000000000000000000000000000000000000000000000000000000001d4c"},
+	}
+	for i, test := range tests {
+		p := evm.precompiles[test.addr]
+		if p == nil {
+			t.Fatalf("test %d: system contract %x missing", i, test.addr)
+		}
+		contract := NewContract(AccountRef(common.HexToAddress("1337")), nil, new(big.Int), test.gas)
+		res, err := RunPrecompiledContract(p, nil, contract)
+		if err != nil {
+			t.Fatalf("test %d: failed to run: %v", i, err)
+		}
+		if common.Bytes2Hex(res) != test.expected {
+			t.Errorf("test %d: result mismatch: have %x, want %s", i, res, test.expected)
+		}
+		if contract.Gas != 0 {
+			t.Errorf("test %d: gas mismatch: %d left", i, contract.Gas)
+		}
+	}
+}
@@ -19,6 +19,7 @@ package evm
 import (
 	"math/big"
 	"sync/atomic"
+	"time"
 
 	"github.com/hpb-project/go-hpb/common"
 	"github.com/hpb-project/go-hpb/common/crypto"
@@ -35,13 +36,19 @@ type (
 	// GetHashFunc returns the nth block hash in the blockchain
 	// and is used by the BLOCKHASH EVM op code.
 	GetHashFunc func(uint64) common.Hash
+	// GetHpbNodesFunc returns the HpNode set of the current block and is
+	// used by the HpbNodes system contract.
+	GetHpbNodesFunc func() ([]common.Address, error)
+	// GetCandidateNodesFunc returns the candidate set of the current block
+	// with the votes of each candidate and is used by the CandidateNodes
+	// system contract.
+	GetCandidateNodesFunc func() ([]common.Address, []uint64, error)
 )
 
 // run runs the given contract and takes care of running precompiles with a fallback to the byte code interpreter.
 func run(evm *EVM, snapshot int, contract *Contract, input []byte) ([]byte, error) {
 	if contract.CodeAddr != nil {
-		precompiles := PrecompiledContractsByzantium
-		if p := precompiles[*contract.CodeAddr]; p != nil {
+		if p := evm.precompiles[*contract.CodeAddr]; p != nil {
 			return RunPrecompiledContract(p, input, contract)
 		}
 	}
@@ -69,6 +76,11 @@ type Context struct {
 	BlockNumber *big.Int       // Provides information for NUMBER
 	Time        *big.Int       // Provides information for TIME
 	Difficulty  *big.Int       // Provides information for DIFFICULTY
+
+	// HPB consensus information
+	HardwareRandom    []byte                // Provides information for the HardwareRandom system contract
+	GetHpbNodes       GetHpbNodesFunc       // Provides information for the HpbNodes system contract
+	GetCandidateNodes GetCandidateNodesFunc // Provides information for the CandidateNodes system contract
 }
 
 // EVM is the Hpb Virtual Machine base object and provides
@@ -90,6 +102,10 @@ type EVM struct {
 
 	// chainConfig contains information about the current chain
 	chainConfig *config.ChainConfig
+	// chainRules contains the forks active at the current block
+	chainRules config.Rules
+	// precompiles contains the precompiled contracts of the current block
+	precompiles map[common.Address]PrecompiledContract
 	// virtual machine configuration options used to initialise the
 	// evm.
 	vmConfig Config
@@ -109,7 +125,9 @@ func NewEVM(ctx Context, statedb StateDB, chainConfig *config.ChainConfig, vmCon
 		StateDB:     statedb,
 		vmConfig:    vmConfig,
 		chainConfig: chainConfig,
+		chainRules:  chainConfig.Rules(ctx.BlockNumber),
 	}
+	evm.precompiles = precompiledContractsFor(evm.chainRules, &evm.Context)
 
 	evm.interpreter = NewInterpreter(evm, vmConfig)
 	return evm
@@ -144,13 +162,19 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 		snapshot = evm.StateDB.Snapshot()
 	)
 	if !evm.StateDB.Exist(addr) {
-		precompiles := PrecompiledContractsByzantium
-		if precompiles[addr] == nil && value.Sign() == 0 {
+		if evm.precompiles[addr] == nil && value.Sign() == 0 {
+			if evm.vmConfig.Debug {
+				evm.captureBegin(CALL, caller.Address(), addr, input, gas, value)(nil, 0, nil)
+			}
 			return nil, gas, nil
 		}
 		evm.StateDB.CreateAccount(addr)
 	}
 	evm.Transfer(evm.StateDB, caller.Address(), to.Address(), value)
+	if evm.vmConfig.Debug {
+		captureEnd := evm.captureBegin(CALL, caller.Address(), addr, input, gas, value)
+		defer func() { captureEnd(ret, gas-leftOverGas, err) }()
+	}
 
 	// initialise a new contract and set the code that is to be used by the
 	// E The contract is a scoped environment for this execution context
@@ -164,7 +188,7 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 	// when we're in homestead this also counts for code storage gas errors.
 	if err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
-		if err != errExecutionReverted {
+		if err != ErrExecutionReverted {
 			contract.UseGas(contract.Gas)
 		}
 	}
@@ -196,6 +220,10 @@ func (evm *EVM) CallCode(caller ContractRef, addr common.Address, input []byte,
 		snapshot = evm.StateDB.Snapshot()
 		to       = AccountRef(caller.Address())
 	)
+	if evm.vmConfig.Debug {
+		captureEnd := evm.captureBegin(CALLCODE, caller.Address(), addr, input, gas, value)
+		defer func() { captureEnd(ret, gas-leftOverGas, err) }()
+	}
 	// initialise a new contract and set the code that is to be used by the
 	// E The contract is a scoped evmironment for this execution context
 	// only.
@@ -205,7 +233,7 @@ func (evm *EVM) CallCode(caller ContractRef, addr common.Address, input []byte,
 	ret, err = run(evm, snapshot, contract, input)
 	if err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
-		if err != errExecutionReverted {
+		if err != ErrExecutionReverted {
 			contract.UseGas(contract.Gas)
 		}
 	}
@@ -230,6 +258,10 @@ func (evm *EVM) DelegateCall(caller ContractRef, addr common.Address, input []by
 		snapshot = evm.StateDB.Snapshot()
 		to       = AccountRef(caller.Address())
 	)
+	if evm.vmConfig.Debug {
+		captureEnd := evm.captureBegin(DELEGATECALL, caller.Address(), addr, input, gas, nil)
+		defer func() { captureEnd(ret, gas-leftOverGas, err) }()
+	}
 
 	// Initialise a new contract and make initialise the delegate values
 	contract := NewContract(caller, to, nil, gas).AsDelegate()
@@ -238,7 +270,7 @@ func (evm *EVM) DelegateCall(caller ContractRef, addr common.Address, input []by
 	ret, err = run(evm, snapshot, contract, input)
 	if err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
-		if err != errExecutionReverted {
+		if err != ErrExecutionReverted {
 			contract.UseGas(contract.Gas)
 		}
 	}
@@ -269,6 +301,10 @@ func (evm *EVM) StaticCall(caller ContractRef, addr common.Address, input []byte
 		to       = AccountRef(addr)
 		snapshot = evm.StateDB.Snapshot()
 	)
+	if evm.vmConfig.Debug {
+		captureEnd := evm.captureBegin(STATICCALL, caller.Address(), addr, input, gas, nil)
+		defer func() { captureEnd(ret, gas-leftOverGas, err) }()
+	}
 	// Initialise a new contract and set the code that is to be used by the
 	// EVM. The contract is a scoped environment for this execution context
 	// only.
@@ -281,7 +317,7 @@ func (evm *EVM) StaticCall(caller ContractRef, addr common.Address, input []byte
 	ret, err = run(evm, snapshot, contract, input)
 	if err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
-		if err != errExecutionReverted {
+		if err != ErrExecutionReverted {
 			contract.UseGas(contract.Gas)
 		}
 	}
@@ -290,7 +326,22 @@ func (evm *EVM) StaticCall(caller ContractRef, addr common.Address, input []byte
 
 // Create creates a new contract using code as deployment code.
 func (evm *EVM) Create(caller ContractRef, code []byte, gas uint64, value *big.Int) (ret []byte, contractAddr common.Address, leftOverGas uint64, err error) {
+	contractAddr = crypto.CreateAddress(caller.Address(), evm.StateDB.GetNonce(caller.Address()))
+	return evm.create(caller, code, crypto.Keccak256Hash(code), gas, value, contractAddr, CREATE)
+}
+
+// Create2 creates a new contract using code as deployment code. The address
+// of the contract is derived from the caller, the salt and the code hash
+// instead of the nonce of the caller.
+func (evm *EVM) Create2(caller ContractRef, code []byte, gas uint64, endowment *big.Int, salt *big.Int) (ret []byte, contractAddr common.Address, leftOverGas uint64, err error) {
+	codeHash := crypto.Keccak256Hash(code)
+	contractAddr = crypto.CreateAddress2(caller.Address(), common.BigToHash(salt), codeHash[:])
+	return evm.create(caller, code, codeHash, gas, endowment, contractAddr, CREATE2)
+}
 
+// create creates a new contract at the given address using code as
+// deployment code.
+func (evm *EVM) create(caller ContractRef, code []byte, codeHash common.Hash, gas uint64, value *big.Int, contractAddr common.Address, typ OpCode) (ret []byte, addr common.Address, leftOverGas uint64, err error) {
 	// Depth check execution. Fail if we're trying to execute above the
 	// limit.
 	if evm.depth > int(config.CallCreateDepth) {
@@ -303,7 +354,6 @@ func (evm *EVM) Create(caller ContractRef, code []byte, gas uint64, value *big.I
 	nonce := evm.StateDB.GetNonce(caller.Address())
 	evm.StateDB.SetNonce(caller.Address(), nonce+1)
 
-	contractAddr = crypto.CreateAddress(caller.Address(), nonce)
 	contractHash := evm.StateDB.GetCodeHash(contractAddr)
 	if evm.StateDB.GetNonce(contractAddr) != 0 || (contractHash != (common.Hash{}) && contractHash != emptyCodeHash) {
 		return nil, common.Address{}, 0, ErrContractAddressCollision
@@ -318,8 +368,12 @@ func (evm *EVM) Create(caller ContractRef, code []byte, gas uint64, value *big.I
 	// E The contract is a scoped evmironment for this execution context
 	// only.
 	contract := NewContract(caller, AccountRef(contractAddr), value, gas)
-	contract.SetCallCode(&contractAddr, crypto.Keccak256Hash(code), code)
+	contract.SetCallCode(&contractAddr, codeHash, code)
 
+	if evm.vmConfig.Debug {
+		captureEnd := evm.captureBegin(typ, caller.Address(), contractAddr, code, gas, value)
+		defer func() { captureEnd(ret, gas-leftOverGas, err) }()
+	}
 	if evm.vmConfig.NoRecursion && evm.depth > 0 {
 		return nil, contractAddr, gas, nil
 	}
@@ -344,7 +398,7 @@ func (evm *EVM) Create(caller ContractRef, code []byte, gas uint64, value *big.I
 	// when we're in homestead this also counts for code storage gas errors.
 	if maxCodeSizeExceeded || err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
-		if err != errExecutionReverted {
+		if err != ErrExecutionReverted {
 			contract.UseGas(contract.Gas)
 		}
 	}
@@ -355,8 +409,29 @@ func (evm *EVM) Create(caller ContractRef, code []byte, gas uint64, value *big.I
 	return ret, contractAddr, contract.Gas, err
 }
 
+// captureBegin reports the start of a call frame to the configured tracer and
+// returns the function reporting its end. The outermost frame is bracketed by
+// CaptureStart and CaptureEnd, the nested ones by CaptureEnter and CaptureExit.
+func (evm *EVM) captureBegin(typ OpCode, from, to common.Address, input []byte, gas uint64, value *big.Int) func(output []byte, gasUsed uint64, err error) {
+	tracer := evm.vmConfig.Tracer
+	if evm.depth > 0 {
+		tracer.CaptureEnter(typ, from, to, input, gas, value)
+		return func(output []byte, gasUsed uint64, err error) {
+			tracer.CaptureExit(output, gasUsed, err)
+		}
+	}
+	start := time.Now()
+	tracer.CaptureStart(evm, from, to, typ == CREATE || typ == CREATE2, input, gas, value)
+	return func(output []byte, gasUsed uint64, err error) {
+		tracer.CaptureEnd(output, gasUsed, time.Since(start), err)
+	}
+}
+
 // ChainConfig returns the evmironment's chain configuration
 func (evm *EVM) ChainConfig() *config.ChainConfig { return evm.chainConfig }
 
+// VMConfig returns the configuration the EVM was created with.
+func (evm *EVM) VMConfig() Config { return evm.vmConfig }
+
 // Interpreter returns the EVM interpreter
 func (evm *EVM) Interpreter() *Interpreter { return evm.interpreter }
@@ -139,6 +139,65 @@ func gasSStore(gt config.GasTable, evm *EVM, contract *Contract, stack *Stack, m
 	}
 }
 
+// gasSStoreEIP2200 calculates the gas of SSTORE with the net gas metering of
+// EIP-2200, charging for a slot by comparing the new value with its value as
+// of the start of the transaction:
+//
+//   1. If current value equals new value (this is a no-op), SLOAD_GAS is deducted.
+//   2. If current value does not equal new value:
+//     2.1. If original value equals current value (this storage slot has not been changed by the current execution context):
+//       2.1.1. If original value is 0, SSTORE_SET_GAS (20K) gas is deducted.
+//       2.1.2. Otherwise, SSTORE_RESET_GAS gas is deducted. If new value is 0, add SSTORE_CLEARS_SCHEDULE to refund counter.
+//     2.2. If original value does not equal current value (this storage slot is dirty), SLOAD_GAS gas is deducted. Apply both of the following clauses:
+//       2.2.1. If original value is not 0:
+//         2.2.1.1. If current value is 0 (also means that new value is not 0), subtract SSTORE_CLEARS_SCHEDULE gas from refund counter.
+//         2.2.1.2. If new value is 0 (also means that current value is not 0), add SSTORE_CLEARS_SCHEDULE gas to refund counter.
+//       2.2.2. If original value equals new value (this storage slot is reset):
+//         2.2.2.1. If original value is 0, add SSTORE_SET_GAS - SLOAD_GAS to refund counter.
+//         2.2.2.2. Otherwise, add SSTORE_RESET_GAS - SLOAD_GAS gas to refund counter.
+//
+// The call fails without consuming anything if no more than the stipend of a
+// call is left, so that transfers can't modify state.
+func gasSStoreEIP2200(gt config.GasTable, evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	if contract.Gas <= config.SstoreSentryGasEIP2200 {
+		return 0, ErrSStoreSentry
+	}
+	var (
+		y, x    = stack.Back(1), stack.Back(0)
+		key     = common.BigToHash(x)
+		value   = common.BigToHash(y)
+		current = evm.StateDB.GetState(contract.Address(), key)
+	)
+	if current == value { // noop (1)
+		return config.SloadGasEIP2200, nil
+	}
+	original := evm.StateDB.GetCommittedState(contract.Address(), key)
+	if original == current {
+		if original == (common.Hash{}) { // create slot (2.1.1)
+			return config.SstoreSetGasEIP2200, nil
+		}
+		if value == (common.Hash{}) { // delete slot (2.1.2b)
+			evm.StateDB.AddRefund(new(big.Int).SetUint64(config.SstoreClearsScheduleRefundEIP2200))
+		}
+		return config.SstoreResetGasEIP2200, nil // write existing slot (2.1.2)
+	}
+	if original != (common.Hash{}) {
+		if current == (common.Hash{}) { // recreate slot (2.2.1.1)
+			evm.StateDB.SubRefund(new(big.Int).SetUint64(config.SstoreClearsScheduleRefundEIP2200))
+		} else if value == (common.Hash{}) { // delete slot (2.2.1.2)
+			evm.StateDB.AddRefund(new(big.Int).SetUint64(config.SstoreClearsScheduleRefundEIP2200))
+		}
+	}
+	if original == value {
+		if original == (common.Hash{}) { // reset to original inexistent slot (2.2.2.1)
+			evm.StateDB.AddRefund(new(big.Int).SetUint64(config.SstoreSetGasEIP2200 - config.SloadGasEIP2200))
+		} else { // reset to original existing slot (2.2.2.2)
+			evm.StateDB.AddRefund(new(big.Int).SetUint64(config.SstoreResetGasEIP2200 - config.SloadGasEIP2200))
+		}
+	}
+	return config.SloadGasEIP2200, nil // dirty update (2.2)
+}
+
 func makeGasLog(n uint64) gasFunc {
 	return func(gt config.GasTable, evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
 		requestedSize, overflow := bigUint64(stack.Back(1))
@@ -291,6 +350,29 @@ func gasCreate(gt config.GasTable, evm *EVM, contract *Contract, stack *Stack, m
 	return gas, nil
 }
 
+func gasCreate2(gt config.GasTable, evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	var overflow bool
+	gas, err := memoryGasCost(mem, memorySize)
+	if err != nil {
+		return 0, err
+	}
+	if gas, overflow = math.SafeAdd(gas, config.Create2Gas); overflow {
+		return 0, errGasUintOverflow
+	}
+	// The initcode is hashed for the address, charged like SHA3
+	wordGas, overflow := bigUint64(stack.Back(2))
+	if overflow {
+		return 0, errGasUintOverflow
+	}
+	if wordGas, overflow = math.SafeMul(toWordSize(wordGas), config.Sha3WordGas); overflow {
+		return 0, errGasUintOverflow
+	}
+	if gas, overflow = math.SafeAdd(gas, wordGas); overflow {
+		return 0, errGasUintOverflow
+	}
+	return gas, nil
+}
+
 func gasBalance(gt config.GasTable, evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
 	return gt.Balance, nil
 }
@@ -299,6 +381,10 @@ func gasExtCodeSize(gt config.GasTable, evm *EVM, contract *Contract, stack *Sta
 	return gt.ExtcodeSize, nil
 }
 
+func gasExtCodeHash(gt config.GasTable, evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	return gt.ExtcodeHash, nil
+}
+
 func gasSLoad(gt config.GasTable, evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
 	return gt.SLoad, nil
 }
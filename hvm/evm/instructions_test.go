@@ -10,7 +10,7 @@ import (
 
 func TestByteOp(t *testing.T) {
 	var (
-		env   = NewEVM(Context{}, nil, config.MainnetChainConfig, Config{EnableJit: false, ForceJit: false})
+		env   = NewEVM(Context{}, nil, config.MainnetChainConfig, Config{})
 		stack = newstack()
 	)
 	tests := []struct {
@@ -43,7 +43,7 @@ func TestByteOp(t *testing.T) {
 
 func opBenchmark(bench *testing.B, op func(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack *Stack) ([]byte, error), args ...string) {
 	var (
-		env   = NewEVM(Context{}, nil, config.MainnetChainConfig, Config{EnableJit: false, ForceJit: false})
+		env   = NewEVM(Context{}, nil, config.MainnetChainConfig, Config{})
 		stack = newstack()
 	)
 	// convert args
@@ -243,3 +243,31 @@ func BenchmarkOpMulmod(b *testing.B) {
 
 	opBenchmark(b, opMulmod, x, y, z)
 }
+
+func TestConstantinopleFork(t *testing.T) {
+	chainConfig := &config.ChainConfig{ConstantinopleBlock: big.NewInt(10)}
+	for _, op := range []OpCode{SHL, SHR, SAR, EXTCODEHASH, CREATE2} {
+		before := NewEVM(Context{BlockNumber: big.NewInt(9)}, nil, chainConfig, Config{})
+		if before.interpreter.cfg.JumpTable[op].valid {
+			t.Errorf("%v enabled before the fork", op)
+		}
+		after := NewEVM(Context{BlockNumber: big.NewInt(10)}, nil, chainConfig, Config{})
+		if !after.interpreter.cfg.JumpTable[op].valid {
+			t.Errorf("%v disabled after the fork", op)
+		}
+	}
+}
+
+func TestIstanbulFork(t *testing.T) {
+	chainConfig := &config.ChainConfig{ConstantinopleBlock: big.NewInt(0), IstanbulBlock: big.NewInt(10)}
+	for _, op := range []OpCode{CHAINID, SELFBALANCE} {
+		before := NewEVM(Context{BlockNumber: big.NewInt(9)}, nil, chainConfig, Config{})
+		if before.interpreter.cfg.JumpTable[op].valid {
+			t.Errorf("%v enabled before the fork", op)
+		}
+		after := NewEVM(Context{BlockNumber: big.NewInt(10)}, nil, chainConfig, Config{})
+		if !after.interpreter.cfg.JumpTable[op].valid {
+			t.Errorf("%v disabled after the fork", op)
+		}
+	}
+}
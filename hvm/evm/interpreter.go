@@ -19,6 +19,7 @@ package evm
 import (
 	"fmt"
 	"sync/atomic"
+	"time"
 
 	"github.com/hpb-project/go-hpb/common"
 	"github.com/hpb-project/go-hpb/common/crypto"
@@ -30,10 +31,9 @@ import (
 type Config struct {
 	// Debug enabled debugging Interpreter options
 	Debug bool
-	// EnableJit enabled the JIT VM
-	EnableJit bool
-	// ForceJit forces the JIT VM
-	ForceJit bool
+	// Profile enables recording the execution time and gas of every
+	// opcode and contract into the DefaultProfiler
+	Profile bool
 	// Tracer is the op code logger
 	Tracer Tracer
 	// NoRecursion disabled Interpreter call, callcode,
@@ -51,8 +51,7 @@ type Config struct {
 
 // Interpreter is used to run Hpb based contracts and will utilise the
 // passed evmironment to query external sources for state information.
-// The Interpreter will run the byte code VM or JIT VM based on the passed
-// configuration.
+// The Interpreter runs the byte code VM based on the passed configuration.
 type Interpreter struct {
 	evm      *EVM
 	cfg      Config
@@ -67,9 +66,9 @@ type Interpreter struct {
 func NewInterpreter(evm *EVM, cfg Config) *Interpreter {
 	// We use the STOP instruction whether to see
 	// the jump table was initialised. If it was not
-	// we'll set the default jump table.
+	// we'll set the jump table of the active forks.
 	if !cfg.JumpTable[STOP].valid {
-		cfg.JumpTable = byzantiumInstructionSet
+		cfg.JumpTable = instructionSetFor(evm.chainRules)
 	}
 
 	return &Interpreter{
@@ -133,9 +132,23 @@ func (in *Interpreter) Run(snapshot int, contract *Contract, input []byte) (ret
 		pcCopy    uint64       // needed for the deferred Tracer
 		gasCopy   uint64       // for Tracer to log gas remaining before execution
 		logged    bool         // deferred Tracer should ignore already logged steps
+		// state used by the profiler
+		opStart time.Time // start of the current operation
+		opGas   uint64    // gas available before the current operation
 	)
 	contract.Input = input
 
+	if in.cfg.Profile {
+		start, startGas := time.Now(), contract.Gas
+		defer func() {
+			addr := contract.Address()
+			if contract.CodeAddr != nil {
+				addr = *contract.CodeAddr
+			}
+			DefaultProfiler.recordContract(addr, time.Since(start), gasSpent(startGas, contract.Gas))
+		}()
+	}
+
 	defer func() {
 		if err != nil && !logged && in.cfg.Debug {
 			in.cfg.Tracer.CaptureState(in.evm, pcCopy, op, gasCopy, cost, mem, stackCopy, contract, in.evm.depth, err)
@@ -150,6 +163,9 @@ func (in *Interpreter) Run(snapshot int, contract *Contract, input []byte) (ret
 		// Get the memory location of pc
 		op = contract.GetOp(pc)
 
+		if in.cfg.Profile {
+			opStart, opGas = time.Now(), contract.Gas
+		}
 		if in.cfg.Debug {
 			logged = false
 			pcCopy = uint64(pc)
@@ -208,6 +224,9 @@ func (in *Interpreter) Run(snapshot int, contract *Contract, input []byte) (ret
 
 		// execute the operation
 		res, err := operation.execute(&pc, in.evm, contract, mem, stack)
+		if in.cfg.Profile {
+			DefaultProfiler.recordOp(op, time.Since(opStart), gasSpent(opGas, contract.Gas))
+		}
 		// verifyPool is a build flag. Pool verification makes sure the integrity
 		// of the integer pool by comparing values to a default value.
 		if verifyPool {
@@ -223,7 +242,7 @@ func (in *Interpreter) Run(snapshot int, contract *Contract, input []byte) (ret
 		case err != nil:
 			return nil, err
 		case operation.reverts:
-			return res, errExecutionReverted
+			return res, ErrExecutionReverted
 		case operation.halts:
 			return res, nil
 		case !operation.jumps:
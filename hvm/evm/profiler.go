@@ -0,0 +1,166 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package evm
+
+import (
+	"math/bits"
+	"sync"
+	"time"
+
+	"github.com/hpb-project/go-hpb/common"
+)
+
+// maxProfiledContracts is the number of contracts a Profiler keeps statistics
+// for. Once full, a new contract replaces the one with the least time spent.
+const maxProfiledContracts = 1024
+
+// histogramBuckets is the number of buckets of a Histogram. The last bucket
+// also holds all the values too large for it.
+const histogramBuckets = 32
+
+// Histogram counts values in buckets of exponentially growing size. Bucket 0
+// holds the zero values and bucket i the values in [2^(i-1), 2^i).
+type Histogram [histogramBuckets]uint64
+
+func (h *Histogram) add(v uint64) {
+	i := bits.Len64(v)
+	if i >= histogramBuckets {
+		i = histogramBuckets - 1
+	}
+	h[i]++
+}
+
+// ProfileStats contains the execution time and gas of an opcode or a contract,
+// both in total and distributed over histograms. The time is in nanoseconds.
+type ProfileStats struct {
+	Count         uint64        `json:"count"`
+	Time          time.Duration `json:"time"`
+	Gas           uint64        `json:"gas"`
+	TimeHistogram Histogram     `json:"timeHistogram"`
+	GasHistogram  Histogram     `json:"gasHistogram"`
+}
+
+func (s *ProfileStats) add(d time.Duration, gas uint64) {
+	s.Count++
+	s.Time += d
+	s.Gas += gas
+	s.TimeHistogram.add(uint64(d))
+	s.GasHistogram.add(gas)
+}
+
+// Profile is a snapshot of the statistics recorded by a Profiler. The stats of
+// an opcode making a call or a contract include the calls made by them.
+type Profile struct {
+	Opcodes   map[string]ProfileStats         `json:"opcodes"`
+	Contracts map[common.Address]ProfileStats `json:"contracts"`
+}
+
+// Profiler collects the execution time and gas of the opcodes and the
+// contracts run by interpreters with profiling enabled. Only the contracts
+// taking the most time are kept, up to maxProfiledContracts of them.
+type Profiler struct {
+	mu        sync.Mutex
+	opcodes   [256]*ProfileStats
+	contracts map[common.Address]*ProfileStats
+}
+
+// DefaultProfiler is the profiler interpreters record to when the Profile
+// option of their configuration is set.
+var DefaultProfiler = NewProfiler()
+
+// NewProfiler returns an empty profiler.
+func NewProfiler() *Profiler {
+	return &Profiler{contracts: make(map[common.Address]*ProfileStats)}
+}
+
+// recordOp adds an execution of the opcode to the profile.
+func (p *Profiler) recordOp(op OpCode, d time.Duration, gas uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.opcodes[op] == nil {
+		p.opcodes[op] = new(ProfileStats)
+	}
+	p.opcodes[op].add(d, gas)
+}
+
+// recordContract adds a run of the code of the contract to the profile.
+func (p *Profiler) recordContract(addr common.Address, d time.Duration, gas uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.contracts[addr] == nil {
+		if len(p.contracts) >= maxProfiledContracts {
+			p.evictContract()
+		}
+		p.contracts[addr] = new(ProfileStats)
+	}
+	p.contracts[addr].add(d, gas)
+}
+
+// evictContract drops the contract with the least time spent from the profile.
+func (p *Profiler) evictContract() {
+	var (
+		least   common.Address
+		minTime time.Duration = -1
+	)
+	for addr, stats := range p.contracts {
+		if minTime < 0 || stats.Time < minTime {
+			least, minTime = addr, stats.Time
+		}
+	}
+	delete(p.contracts, least)
+}
+
+// gasSpent returns the gas used between two readings of the gas available to
+// a contract. Calls made without gas metering can return more gas than they
+// were given, which counts as none used.
+func gasSpent(before, after uint64) uint64 {
+	if after > before {
+		return 0
+	}
+	return before - after
+}
+
+// Profile returns a copy of the statistics recorded so far.
+func (p *Profiler) Profile() *Profile {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	profile := &Profile{
+		Opcodes:   make(map[string]ProfileStats),
+		Contracts: make(map[common.Address]ProfileStats, len(p.contracts)),
+	}
+	for op, stats := range p.opcodes {
+		if stats != nil {
+			profile.Opcodes[OpCode(op).String()] = *stats
+		}
+	}
+	for addr, stats := range p.contracts {
+		profile.Contracts[addr] = *stats
+	}
+	return profile
+}
+
+// Reset drops all the statistics recorded so far.
+func (p *Profiler) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.opcodes = [256]*ProfileStats{}
+	p.contracts = make(map[common.Address]*ProfileStats)
+}
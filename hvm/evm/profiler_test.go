@@ -0,0 +1,101 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package evm
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/config"
+)
+
+func TestHistogram(t *testing.T) {
+	var h Histogram
+	for _, v := range []uint64{0, 1, 2, 3, 4, 1 << 40} {
+		h.add(v)
+	}
+	want := Histogram{0: 1, 1: 1, 2: 2, 3: 1, histogramBuckets - 1: 1}
+	if h != want {
+		t.Errorf("histogram mismatch: have %v, want %v", h, want)
+	}
+}
+
+// Tests that the profiler keeps at most maxProfiledContracts contracts, making
+// room for new ones by dropping those with the least time spent.
+func TestProfilerContractLimit(t *testing.T) {
+	p := NewProfiler()
+	for i := 0; i < maxProfiledContracts; i++ {
+		addr := common.BigToAddress(big.NewInt(int64(i)))
+		p.recordContract(addr, time.Duration(i+1)*time.Microsecond, 1)
+	}
+	// Adding time to a known contract must not evict anything
+	p.recordContract(common.BigToAddress(big.NewInt(0)), time.Millisecond, 1)
+	if n := len(p.Profile().Contracts); n != maxProfiledContracts {
+		t.Fatalf("contract count mismatch: have %d, want %d", n, maxProfiledContracts)
+	}
+	fresh := common.Address{0xff}
+	p.recordContract(fresh, time.Microsecond, 1)
+
+	contracts := p.Profile().Contracts
+	if len(contracts) != maxProfiledContracts {
+		t.Errorf("contract count mismatch: have %d, want %d", len(contracts), maxProfiledContracts)
+	}
+	if _, ok := contracts[fresh]; !ok {
+		t.Errorf("new contract not recorded")
+	}
+	if _, ok := contracts[common.BigToAddress(big.NewInt(1))]; ok {
+		t.Errorf("contract with the least time kept")
+	}
+	if stats := contracts[common.BigToAddress(big.NewInt(0))]; stats.Count != 2 {
+		t.Errorf("updated contract lost: count %d, want 2", stats.Count)
+	}
+}
+
+// Tests that the interpreter records every executed opcode and the contract
+// into the profiler when profiling is enabled.
+func TestInterpreterProfile(t *testing.T) {
+	DefaultProfiler.Reset()
+	defer DefaultProfiler.Reset()
+
+	var (
+		env      = NewEVM(Context{BlockNumber: big.NewInt(0)}, nil, config.MainnetChainConfig, Config{Profile: true})
+		contract = NewContract(&dummyContractRef{}, &dummyContractRef{}, new(big.Int), 100)
+	)
+	// PUSH1 1 PUSH1 2 ADD POP STOP
+	contract.Code = []byte{byte(PUSH1), 1, byte(PUSH1), 2, byte(ADD), byte(POP), byte(STOP)}
+	if _, err := env.interpreter.Run(0, contract, nil); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	profile := DefaultProfiler.Profile()
+	for op, want := range map[OpCode]uint64{PUSH1: 2, ADD: 1, POP: 1, STOP: 1} {
+		if have := profile.Opcodes[op.String()].Count; have != want {
+			t.Errorf("%v count mismatch: have %d, want %d", op, have, want)
+		}
+	}
+	if have := profile.Opcodes[ADD.String()].Gas; have != GasFastestStep {
+		t.Errorf("ADD gas mismatch: have %d, want %d", have, GasFastestStep)
+	}
+	stats, ok := profile.Contracts[contract.Address()]
+	if !ok {
+		t.Fatalf("contract missing from profile")
+	}
+	if stats.Count != 1 || stats.Gas != 100-contract.Gas {
+		t.Errorf("contract stats mismatch: have count %d gas %d, want 1 and %d", stats.Count, stats.Gas, 100-contract.Gas)
+	}
+}
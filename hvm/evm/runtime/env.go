@@ -19,16 +19,15 @@ package runtime
 import (
 	"math/big"
 
-	"github.com/hpb-project/ghpb/core"
-	"github.com/hpb-project/ghpb/core/vm"
-	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/hvm"
+	"github.com/hpb-project/go-hpb/hvm/evm"
 )
 
-func NewEnv(cfg *Config) *vm.EVM {
-	context := vm.Context{
-		CanTransfer: core.CanTransfer,
-		Transfer:    core.Transfer,
-		GetHash:     func(uint64) common.Hash { return common.Hash{} },
+func NewEnv(cfg *Config) *evm.EVM {
+	context := evm.Context{
+		CanTransfer: hvm.CanTransfer,
+		Transfer:    hvm.Transfer,
+		GetHash:     cfg.GetHashFn,
 
 		Origin:      cfg.Origin,
 		Coinbase:    cfg.Coinbase,
@@ -39,5 +38,5 @@ func NewEnv(cfg *Config) *vm.EVM {
 		GasPrice:    cfg.GasPrice,
 	}
 
-	return vm.NewEVM(context, cfg.State, cfg.ChainConfig, cfg.EVMConfig)
+	return evm.NewEVM(context, cfg.State, cfg.ChainConfig, cfg.EVMConfig)
 }
@@ -21,12 +21,12 @@ import (
 	"math/big"
 	"time"
 
-	"github.com/hpb-project/ghpb/core/vm"
+	"github.com/hpb-project/go-hpb/blockchain/state"
+	"github.com/hpb-project/go-hpb/blockchain/storage"
 	"github.com/hpb-project/go-hpb/common"
 	"github.com/hpb-project/go-hpb/common/crypto"
 	"github.com/hpb-project/go-hpb/config"
-	"github.com/hpb-project/go-hpb/storage"
-	"github.com/hpb-project/go-hpb/storage/state"
+	"github.com/hpb-project/go-hpb/hvm/evm"
 )
 
 // Config is a basic type specifying certain configuration flags for running
@@ -41,9 +41,8 @@ type Config struct {
 	GasLimit    uint64
 	GasPrice    *big.Int
 	Value       *big.Int
-	DisableJit  bool // "disable" so it's enabled by default
 	Debug       bool
-	EVMConfig   vm.Config
+	EVMConfig   evm.Config
 
 	State     *state.StateDB
 	GetHashFn func(n uint64) common.Hash
@@ -101,7 +100,7 @@ func Execute(code, input []byte, cfg *Config) ([]byte, *state.StateDB, error) {
 	var (
 		address = common.StringToAddress("contract")
 		vmenv   = NewEnv(cfg)
-		sender  = vm.AccountRef(cfg.Origin)
+		sender  = evm.AccountRef(cfg.Origin)
 	)
 	cfg.State.CreateAccount(address)
 	// set the receiver's (the executing contract) code for execution.
@@ -131,7 +130,7 @@ func Create(input []byte, cfg *Config) ([]byte, common.Address, uint64, error) {
 	}
 	var (
 		vmenv  = NewEnv(cfg)
-		sender = vm.AccountRef(cfg.Origin)
+		sender = evm.AccountRef(cfg.Origin)
 	)
 
 	// Call the code with the given configuration.
@@ -14,13 +14,13 @@
 // You should have received a copy of the GNU Lesser General Public License
 // along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
 
-package runtime
+package runtime_test
 
 import (
 	"fmt"
 
-	"github.com/hpb-project/ghpb/core/vm/runtime"
 	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/hvm/evm/runtime"
 )
 
 func ExampleExecute() {
@@ -21,11 +21,11 @@ import (
 	"strings"
 	"testing"
 
-	"github.com/hpb-project/ghpb/account/abi"
-	"github.com/hpb-project/ghpb/core/vm"
+	"github.com/hpb-project/go-hpb/account/abi"
+	"github.com/hpb-project/go-hpb/blockchain/state"
+	"github.com/hpb-project/go-hpb/blockchain/storage"
 	"github.com/hpb-project/go-hpb/common"
-	"github.com/hpb-project/go-hpb/storage"
-	"github.com/hpb-project/go-hpb/storage/state"
+	"github.com/hpb-project/go-hpb/hvm/evm"
 )
 
 func TestDefaults(t *testing.T) {
@@ -64,24 +64,24 @@ func TestEVM(t *testing.T) {
 	}()
 
 	Execute([]byte{
-		byte(vm.DIFFICULTY),
-		byte(vm.TIMESTAMP),
-		byte(vm.GASLIMIT),
-		byte(vm.PUSH1),
-		byte(vm.ORIGIN),
-		byte(vm.BLOCKHASH),
-		byte(vm.COINBASE),
+		byte(evm.DIFFICULTY),
+		byte(evm.TIMESTAMP),
+		byte(evm.GASLIMIT),
+		byte(evm.PUSH1),
+		byte(evm.ORIGIN),
+		byte(evm.BLOCKHASH),
+		byte(evm.COINBASE),
 	}, nil, nil)
 }
 
 func TestExecute(t *testing.T) {
 	ret, _, err := Execute([]byte{
-		byte(vm.PUSH1), 10,
-		byte(vm.PUSH1), 0,
-		byte(vm.MSTORE),
-		byte(vm.PUSH1), 32,
-		byte(vm.PUSH1), 0,
-		byte(vm.RETURN),
+		byte(evm.PUSH1), 10,
+		byte(evm.PUSH1), 0,
+		byte(evm.MSTORE),
+		byte(evm.PUSH1), 32,
+		byte(evm.PUSH1), 0,
+		byte(evm.RETURN),
 	}, nil, nil)
 	if err != nil {
 		t.Fatal("didn't expect error", err)
@@ -98,12 +98,12 @@ func TestCall(t *testing.T) {
 	state, _ := state.New(common.Hash{}, state.NewDatabase(db))
 	address := common.HexToAddress("0x0a")
 	state.SetCode(address, []byte{
-		byte(vm.PUSH1), 10,
-		byte(vm.PUSH1), 0,
-		byte(vm.MSTORE),
-		byte(vm.PUSH1), 32,
-		byte(vm.PUSH1), 0,
-		byte(vm.RETURN),
+		byte(evm.PUSH1), 10,
+		byte(evm.PUSH1), 0,
+		byte(evm.MSTORE),
+		byte(evm.PUSH1), 32,
+		byte(evm.PUSH1), 0,
+		byte(evm.RETURN),
 	})
 
 	ret, _, err := Call(address, nil, &Config{State: state})
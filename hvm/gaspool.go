@@ -41,6 +41,11 @@ func (gp *GasPool) SubGas(amount *big.Int) error {
 	return nil
 }
 
+// Gas returns the amount of gas remaining in the pool.
+func (gp *GasPool) Gas() *big.Int {
+	return new(big.Int).Set((*big.Int)(gp))
+}
+
 func (gp *GasPool) String() string {
 	return (*big.Int)(gp).String()
 }
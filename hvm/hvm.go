@@ -42,18 +42,32 @@ func NewEVMContext(msg Message, header *types.Header, chain ChainContext, author
 	} else {
 		beneficiary = *author
 	}
-	return evm.Context{
-		CanTransfer: CanTransfer,
-		Transfer:    Transfer,
-		GetHash:     GetHashFn(header, chain),
-		Origin:      msg.From(),
-		Coinbase:    beneficiary,
-		BlockNumber: new(big.Int).Set(header.Number),
-		Time:        new(big.Int).Set(header.Time),
-		Difficulty:  new(big.Int).Set(header.Difficulty),
-		GasLimit:    new(big.Int).Set(header.GasLimit),
-		GasPrice:    new(big.Int).Set(msg.GasPrice()),
+	ctx := evm.Context{
+		CanTransfer:    CanTransfer,
+		Transfer:       Transfer,
+		GetHash:        GetHashFn(header, chain),
+		Origin:         msg.From(),
+		Coinbase:       beneficiary,
+		BlockNumber:    new(big.Int).Set(header.Number),
+		Time:           new(big.Int).Set(header.Time),
+		Difficulty:     new(big.Int).Set(header.Difficulty),
+		GasLimit:       new(big.Int).Set(header.GasLimit),
+		GasPrice:       new(big.Int).Set(msg.GasPrice()),
+		HardwareRandom: common.CopyBytes(header.HardwareRandom),
 	}
+	// Give the system contracts access to the node sets if the engine can
+	// report them
+	if reader, ok := chain.Engine().(consensus.NodeSetReader); ok {
+		if chainReader, ok := chain.(consensus.ChainReader); ok {
+			ctx.GetHpbNodes = func() ([]common.Address, error) {
+				return reader.HpbNodes(chainReader, header)
+			}
+			ctx.GetCandidateNodes = func() ([]common.Address, []uint64, error) {
+				return reader.CandidateNodes(chainReader, header)
+			}
+		}
+	}
+	return ctx
 }
 
 // GetHashFn returns a GetHashFunc which retrieves header hashes by number
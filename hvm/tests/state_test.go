@@ -0,0 +1,66 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/hpb-project/go-hpb/hvm/evm"
+)
+
+var stateTestDir = filepath.Join("testdata", "StateTests")
+
+// TestState runs every subtest of the state tests and checks the post state.
+func TestState(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join(stateTestDir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("no tests in %s", stateTestDir)
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var tests map[string]StateTest
+		if err := json.Unmarshal(data, &tests); err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		names := make([]string, 0, len(tests))
+		for name := range tests {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			test := tests[name]
+			for _, st := range test.Subtests() {
+				t.Run(fmt.Sprintf("%s/%s/%s/%d", filepath.Base(file), name, st.Fork, st.Index), func(t *testing.T) {
+					if _, err := test.Run(st, evm.Config{}); err != nil {
+						t.Error(err)
+					}
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package tests
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	bc "github.com/hpb-project/go-hpb/blockchain"
+	"github.com/hpb-project/go-hpb/blockchain/state"
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/blockchain/types"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/crypto"
+	"github.com/hpb-project/go-hpb/common/hexutil"
+	"github.com/hpb-project/go-hpb/common/math"
+	"github.com/hpb-project/go-hpb/hvm"
+	"github.com/hpb-project/go-hpb/hvm/evm"
+)
+
+// StateTest checks transaction processing without block context.
+// See https://github.com/ethereum/EIPs/issues/176 for the test format specification.
+type StateTest struct {
+	json stJSON
+}
+
+// StateSubtest selects a specific configuration of a General State Test.
+type StateSubtest struct {
+	Fork  string
+	Index int
+}
+
+func (t *StateTest) UnmarshalJSON(in []byte) error {
+	return json.Unmarshal(in, &t.json)
+}
+
+type stJSON struct {
+	Env  stEnv                    `json:"env"`
+	Pre  bc.GenesisAlloc          `json:"pre"`
+	Tx   stTransaction            `json:"transaction"`
+	Out  hexutil.Bytes            `json:"out"`
+	Post map[string][]stPostState `json:"post"`
+}
+
+type stPostState struct {
+	Root    common.UnprefixedHash `json:"hash"`
+	Logs    common.UnprefixedHash `json:"logs"`
+	Indexes struct {
+		Data  int `json:"data"`
+		Gas   int `json:"gas"`
+		Value int `json:"value"`
+	}
+}
+
+type stTransaction struct {
+	GasPrice   *math.HexOrDecimal256 `json:"gasPrice"`
+	Nonce      math.HexOrDecimal64   `json:"nonce"`
+	To         string                `json:"to"`
+	Data       []string              `json:"data"`
+	GasLimit   []math.HexOrDecimal64 `json:"gasLimit"`
+	Value      []string              `json:"value"`
+	PrivateKey hexutil.Bytes         `json:"secretKey"`
+}
+
+// Subtests returns all valid subtests of the test, skipping the forks the HVM
+// does not implement.
+func (t *StateTest) Subtests() []StateSubtest {
+	forks := make([]string, 0, len(t.json.Post))
+	for fork := range t.json.Post {
+		if _, ok := Forks[fork]; ok {
+			forks = append(forks, fork)
+		}
+	}
+	sort.Strings(forks)
+
+	var sub []StateSubtest
+	for _, fork := range forks {
+		for i := range t.json.Post[fork] {
+			sub = append(sub, StateSubtest{fork, i})
+		}
+	}
+	return sub
+}
+
+// Run executes a specific subtest and verifies the post-state root and logs.
+// The committed state after the transaction is returned even if the checks
+// failed.
+func (t *StateTest) Run(subtest StateSubtest, vmconfig evm.Config) (*state.StateDB, error) {
+	chainConfig, ok := Forks[subtest.Fork]
+	if !ok {
+		return nil, fmt.Errorf("unsupported fork %q", subtest.Fork)
+	}
+	post := t.json.Post[subtest.Fork][subtest.Index]
+	msg, err := t.json.Tx.toMessage(post)
+	if err != nil {
+		return nil, err
+	}
+	db, _ := hpbdb.NewMemDatabase()
+	statedb := makePreState(db, t.json.Pre)
+	header := t.header()
+
+	context := evm.Context{
+		CanTransfer: hvm.CanTransfer,
+		Transfer:    hvm.Transfer,
+		GetHash:     vmTestBlockHash,
+		Origin:      msg.From(),
+		Coinbase:    header.Coinbase,
+		BlockNumber: header.Number,
+		Time:        header.Time,
+		GasLimit:    header.GasLimit,
+		Difficulty:  header.Difficulty,
+		GasPrice:    msg.GasPrice(),
+	}
+	vmenv := evm.NewEVM(context, statedb, chainConfig, vmconfig)
+
+	// A transaction the block could not include leaves the state untouched
+	gp := new(hvm.GasPool).AddGas(header.GasLimit)
+	snapshot := statedb.Snapshot()
+	if _, _, _, err := bc.ApplyMessageOnEVM(vmenv, header, statedb, msg, gp); err != nil {
+		statedb.RevertToSnapshot(snapshot)
+	}
+	if logs := rlpHash(statedb.Logs()); logs != common.Hash(post.Logs) {
+		return statedb, fmt.Errorf("post state logs hash mismatch: got %x, want %x", logs, post.Logs)
+	}
+	root, err := statedb.CommitTo(db, true)
+	if err != nil {
+		return statedb, err
+	}
+	if root != common.Hash(post.Root) {
+		return statedb, fmt.Errorf("post state root mismatch: got %x, want %x", root, post.Root)
+	}
+	return statedb, nil
+}
+
+// header creates the header of the block the test transaction is included in.
+func (t *StateTest) header() *types.Header {
+	header := &types.Header{
+		Coinbase:   common.Address(t.json.Env.Coinbase),
+		Number:     new(big.Int).SetUint64(uint64(t.json.Env.Number)),
+		Time:       new(big.Int).SetUint64(uint64(t.json.Env.Timestamp)),
+		GasLimit:   new(big.Int).SetUint64(uint64(t.json.Env.GasLimit)),
+		Difficulty: new(big.Int),
+	}
+	if t.json.Env.Difficulty != nil {
+		header.Difficulty = (*big.Int)(t.json.Env.Difficulty)
+	}
+	return header
+}
+
+// toMessage builds the message of the transaction variant selected by ps.
+func (tx *stTransaction) toMessage(ps stPostState) (hvm.Message, error) {
+	// Derive sender from private key if present
+	var from common.Address
+	if len(tx.PrivateKey) > 0 {
+		key, err := crypto.ToECDSA(tx.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key: %v", err)
+		}
+		from = crypto.PubkeyToAddress(key.PublicKey)
+	}
+	// Parse recipient if present
+	var to *common.Address
+	if tx.To != "" {
+		addr, err := hex.DecodeString(strings.TrimPrefix(tx.To, "0x"))
+		if err != nil || len(addr) != common.AddressLength {
+			return nil, fmt.Errorf("invalid to address %q", tx.To)
+		}
+		to = new(common.Address)
+		*to = common.BytesToAddress(addr)
+	}
+	// Get values specific to this post state
+	if ps.Indexes.Data >= len(tx.Data) {
+		return nil, fmt.Errorf("tx data index %d out of bounds", ps.Indexes.Data)
+	}
+	if ps.Indexes.Value >= len(tx.Value) {
+		return nil, fmt.Errorf("tx value index %d out of bounds", ps.Indexes.Value)
+	}
+	if ps.Indexes.Gas >= len(tx.GasLimit) {
+		return nil, fmt.Errorf("tx gas limit index %d out of bounds", ps.Indexes.Gas)
+	}
+	dataHex := tx.Data[ps.Indexes.Data]
+	valueHex := tx.Value[ps.Indexes.Value]
+	gasLimit := tx.GasLimit[ps.Indexes.Gas]
+
+	// Value, Data hex encoding is messy: https://github.com/ethereum/tests/issues/203
+	value := new(big.Int)
+	if valueHex != "0x" {
+		v, ok := math.ParseBig256(valueHex)
+		if !ok {
+			return nil, fmt.Errorf("invalid tx value %q", valueHex)
+		}
+		value = v
+	}
+	data, err := hex.DecodeString(strings.TrimPrefix(dataHex, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid tx data %q", dataHex)
+	}
+	gasPrice := new(big.Int)
+	if tx.GasPrice != nil {
+		gasPrice = (*big.Int)(tx.GasPrice)
+	}
+	msg := types.NewMessage(from, to, uint64(tx.Nonce), value, new(big.Int).SetUint64(uint64(gasLimit)), gasPrice, data, true)
+	return msg, nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package tests
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/hpb-project/go-hpb/config"
+	"github.com/hpb-project/go-hpb/hvm/evm"
+)
+
+var vmTestDir = filepath.Join("testdata", "VMTests")
+
+// TestVM runs the tests of every fork directory under the rules of that fork.
+func TestVM(t *testing.T) {
+	for fork, chainConfig := range Forks {
+		files, err := filepath.Glob(filepath.Join(vmTestDir, fork, "*.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) == 0 {
+			t.Fatalf("no %s tests in %s", fork, vmTestDir)
+		}
+		for _, file := range files {
+			runVMTestFile(t, fork, file, chainConfig)
+		}
+	}
+}
+
+func runVMTestFile(t *testing.T, fork, file string, chainConfig *config.ChainConfig) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests map[string]VMTest
+	if err := json.Unmarshal(data, &tests); err != nil {
+		t.Fatalf("%s: %v", file, err)
+	}
+	names := make([]string, 0, len(tests))
+	for name := range tests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		test := tests[name]
+		t.Run(fork+"/"+filepath.Base(file)+"/"+name, func(t *testing.T) {
+			if err := test.Run(chainConfig, evm.Config{}); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
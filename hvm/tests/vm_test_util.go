@@ -0,0 +1,185 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+// Package tests runs the upstream Ethereum VM test vectors against the HVM.
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	bc "github.com/hpb-project/go-hpb/blockchain"
+	"github.com/hpb-project/go-hpb/blockchain/state"
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/crypto"
+	"github.com/hpb-project/go-hpb/common/hexutil"
+	"github.com/hpb-project/go-hpb/common/math"
+	"github.com/hpb-project/go-hpb/common/rlp"
+	"github.com/hpb-project/go-hpb/config"
+	"github.com/hpb-project/go-hpb/hvm"
+	"github.com/hpb-project/go-hpb/hvm/evm"
+)
+
+// VMTest checks EVM execution without block or transaction context.
+// See https://github.com/ethereum/tests/wiki/VM-Tests for the test format specification.
+type VMTest struct {
+	json vmJSON
+}
+
+func (t *VMTest) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &t.json)
+}
+
+type vmJSON struct {
+	Env          stEnv                `json:"env"`
+	Exec         vmExec               `json:"exec"`
+	Logs         common.Hash          `json:"logs"`
+	GasRemaining *math.HexOrDecimal64 `json:"gas"`
+	Out          hexutil.Bytes        `json:"out"`
+	Pre          bc.GenesisAlloc      `json:"pre"`
+	Post         bc.GenesisAlloc      `json:"post"`
+}
+
+type stEnv struct {
+	Coinbase   common.UnprefixedAddress `json:"currentCoinbase"`
+	Difficulty *math.HexOrDecimal256    `json:"currentDifficulty"`
+	GasLimit   math.HexOrDecimal64      `json:"currentGasLimit"`
+	Number     math.HexOrDecimal64      `json:"currentNumber"`
+	Timestamp  math.HexOrDecimal64      `json:"currentTimestamp"`
+}
+
+type vmExec struct {
+	Address  common.UnprefixedAddress `json:"address"`
+	Value    *math.HexOrDecimal256    `json:"value"`
+	GasLimit math.HexOrDecimal64      `json:"gas"`
+	Caller   common.UnprefixedAddress `json:"caller"`
+	Origin   common.UnprefixedAddress `json:"origin"`
+	Code     hexutil.Bytes            `json:"code"`
+	Data     hexutil.Bytes            `json:"data"`
+	GasPrice *math.HexOrDecimal256    `json:"gasPrice"`
+}
+
+// Forks maps the fork names the tests are grouped by to chain configurations
+// with that fork and the ones before it active from genesis.
+var Forks = map[string]*config.ChainConfig{
+	"Constantinople": {
+		ChainId:             big.NewInt(1),
+		ConstantinopleBlock: big.NewInt(0),
+	},
+	"Istanbul": {
+		ChainId:             big.NewInt(1),
+		ConstantinopleBlock: big.NewInt(0),
+		IstanbulBlock:       big.NewInt(0),
+	},
+}
+
+// Run executes the test under the rules of chainConfig and checks the output,
+// the remaining gas, the logs and the post state against the expectations.
+func (t *VMTest) Run(chainConfig *config.ChainConfig, vmconfig evm.Config) error {
+	db, _ := hpbdb.NewMemDatabase()
+	statedb := makePreState(db, t.json.Pre)
+	ret, gasRemaining, err := t.exec(statedb, chainConfig, vmconfig)
+
+	if t.json.GasRemaining == nil {
+		if err == nil {
+			return fmt.Errorf("gas unspecified (indicating an error), but VM returned no error")
+		}
+		if gasRemaining > 0 {
+			return fmt.Errorf("gas unspecified (indicating an error), but VM returned gas remaining > 0")
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(ret, t.json.Out) {
+		return fmt.Errorf("return data mismatch: got %x, want %x", ret, t.json.Out)
+	}
+	if gasRemaining != uint64(*t.json.GasRemaining) {
+		return fmt.Errorf("remaining gas %v, want %v", gasRemaining, *t.json.GasRemaining)
+	}
+	for addr, account := range t.json.Post {
+		for k, wantV := range account.Storage {
+			if haveV := statedb.GetState(addr, k); haveV != wantV {
+				return fmt.Errorf("wrong storage value at %x:\n  got  %x\n  want %x", k, haveV, wantV)
+			}
+		}
+	}
+	if logs := rlpHash(statedb.Logs()); logs != t.json.Logs {
+		return fmt.Errorf("post state logs hash mismatch: got %x, want %x", logs, t.json.Logs)
+	}
+	return nil
+}
+
+func (t *VMTest) exec(statedb *state.StateDB, chainConfig *config.ChainConfig, vmconfig evm.Config) ([]byte, uint64, error) {
+	e := t.newEVM(statedb, chainConfig, vmconfig)
+	return e.Call(evm.AccountRef(t.json.Exec.Caller), common.Address(t.json.Exec.Address), t.json.Exec.Data,
+		uint64(t.json.Exec.GasLimit), (*big.Int)(t.json.Exec.Value))
+}
+
+func (t *VMTest) newEVM(statedb *state.StateDB, chainConfig *config.ChainConfig, vmconfig evm.Config) *evm.EVM {
+	// The initial call always succeeds and no value is moved, the tests only
+	// cover the execution of the code
+	initialCall := true
+	canTransfer := func(db evm.StateDB, address common.Address, amount *big.Int) bool {
+		if initialCall {
+			initialCall = false
+			return true
+		}
+		return hvm.CanTransfer(db, address, amount)
+	}
+	transfer := func(db evm.StateDB, sender, recipient common.Address, amount *big.Int) {}
+	context := evm.Context{
+		CanTransfer: canTransfer,
+		Transfer:    transfer,
+		GetHash:     vmTestBlockHash,
+		Origin:      common.Address(t.json.Exec.Origin),
+		Coinbase:    common.Address(t.json.Env.Coinbase),
+		BlockNumber: new(big.Int).SetUint64(uint64(t.json.Env.Number)),
+		Time:        new(big.Int).SetUint64(uint64(t.json.Env.Timestamp)),
+		GasLimit:    new(big.Int).SetUint64(uint64(t.json.Env.GasLimit)),
+		Difficulty:  (*big.Int)(t.json.Env.Difficulty),
+		GasPrice:    (*big.Int)(t.json.Exec.GasPrice),
+	}
+	vmconfig.NoRecursion = true
+	return evm.NewEVM(context, statedb, chainConfig, vmconfig)
+}
+
+// makePreState creates a state in db holding the accounts of the test.
+func makePreState(db hpbdb.Database, accounts bc.GenesisAlloc) *state.StateDB {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	for addr, a := range accounts {
+		statedb.SetCode(addr, a.Code)
+		statedb.SetNonce(addr, a.Nonce)
+		statedb.SetBalance(addr, a.Balance)
+		for k, v := range a.Storage {
+			statedb.SetState(addr, k, v)
+		}
+	}
+	return statedb
+}
+
+func vmTestBlockHash(n uint64) common.Hash {
+	return common.BytesToHash(crypto.Keccak256([]byte(big.NewInt(int64(n)).String())))
+}
+
+func rlpHash(x interface{}) common.Hash {
+	data, _ := rlp.EncodeToBytes(x)
+	return crypto.Keccak256Hash(data)
+}
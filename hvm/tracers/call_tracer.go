@@ -0,0 +1,143 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/hpb-project/go-hpb/account/abi"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/hexutil"
+	"github.com/hpb-project/go-hpb/hvm/evm"
+)
+
+// callFrame is a single call of the traced execution and the calls it made.
+type callFrame struct {
+	Type         string         `json:"type"`
+	From         common.Address `json:"from"`
+	To           common.Address `json:"to"`
+	Value        *hexutil.Big   `json:"value,omitempty"`
+	Gas          hexutil.Uint64 `json:"gas"`
+	GasUsed      hexutil.Uint64 `json:"gasUsed"`
+	Input        hexutil.Bytes  `json:"input"`
+	Output       hexutil.Bytes  `json:"output,omitempty"`
+	Error        string         `json:"error,omitempty"`
+	RevertReason string         `json:"revertReason,omitempty"`
+	Calls        []callFrame    `json:"calls,omitempty"`
+}
+
+// finish fills in the results of the call.
+func (f *callFrame) finish(output []byte, gasUsed uint64, err error) {
+	f.GasUsed = hexutil.Uint64(gasUsed)
+	if err == nil {
+		f.Output = common.CopyBytes(output)
+		return
+	}
+	f.Error = err.Error()
+	if err == evm.ErrExecutionReverted && len(output) > 0 {
+		f.Output = common.CopyBytes(output)
+		if reason, err := abi.UnpackRevert(output); err == nil {
+			f.RevertReason = reason
+		}
+	}
+}
+
+// callTracer collects the tree of calls made by a transaction.
+type callTracer struct {
+	ctx       *Context
+	callstack []callFrame
+	intrinsic uint64
+}
+
+func newCallTracer(ctx *Context) Tracer {
+	return &callTracer{ctx: ctx}
+}
+
+// CaptureStart opens the frame of the outermost call.
+func (t *callTracer) CaptureStart(env *evm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	typ := evm.CALL
+	if create {
+		typ = evm.CREATE
+	}
+	// The outermost frame accounts for the whole message, so the gas the
+	// message paid up front is added back to it
+	if t.ctx.GasLimit > gas {
+		t.intrinsic = t.ctx.GasLimit - gas
+	}
+	t.callstack = []callFrame{newCallFrame(typ, from, to, input, gas+t.intrinsic, value)}
+	return nil
+}
+
+// CaptureState implements the Tracer interface, the calls are reported by the
+// enter and exit hooks.
+func (t *callTracer) CaptureState(env *evm.EVM, pc uint64, op evm.OpCode, gas, cost uint64, memory *evm.Memory, stack *evm.Stack, contract *evm.Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnter opens the frame of a nested call.
+func (t *callTracer) CaptureEnter(typ evm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error {
+	t.callstack = append(t.callstack, newCallFrame(typ, from, to, input, gas, value))
+	return nil
+}
+
+// CaptureExit closes the frame of a nested call and attaches it to its caller.
+func (t *callTracer) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	size := len(t.callstack)
+	if size <= 1 {
+		return nil
+	}
+	call := t.callstack[size-1]
+	call.finish(output, gasUsed, err)
+
+	t.callstack = t.callstack[:size-1]
+	t.callstack[size-2].Calls = append(t.callstack[size-2].Calls, call)
+	return nil
+}
+
+// CaptureEnd closes the frame of the outermost call.
+func (t *callTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	if len(t.callstack) == 0 {
+		return nil
+	}
+	t.callstack[0].finish(output, gasUsed+t.intrinsic, err)
+	return nil
+}
+
+// GetResult returns the outermost call frame with the nested calls in it.
+func (t *callTracer) GetResult() (json.RawMessage, error) {
+	if len(t.callstack) != 1 {
+		return nil, errors.New("incorrect number of top-level calls")
+	}
+	return json.Marshal(t.callstack[0])
+}
+
+func newCallFrame(typ evm.OpCode, from, to common.Address, input []byte, gas uint64, value *big.Int) callFrame {
+	frame := callFrame{
+		Type:  typ.String(),
+		From:  from,
+		To:    to,
+		Gas:   hexutil.Uint64(gas),
+		Input: common.CopyBytes(input),
+	}
+	if value != nil {
+		frame.Value = (*hexutil.Big)(new(big.Int).Set(value))
+	}
+	return frame
+}
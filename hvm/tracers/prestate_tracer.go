@@ -0,0 +1,161 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"math/big"
+	"time"
+
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/crypto"
+	"github.com/hpb-project/go-hpb/common/hexutil"
+	"github.com/hpb-project/go-hpb/hvm/evm"
+)
+
+// account is the state of an account before the traced execution.
+type account struct {
+	Balance *hexutil.Big                `json:"balance"`
+	Nonce   uint64                      `json:"nonce"`
+	Code    hexutil.Bytes               `json:"code,omitempty"`
+	Storage map[common.Hash]common.Hash `json:"storage,omitempty"`
+}
+
+// prestateTracer collects the accounts and storage slots touched by a
+// transaction, in the state they had before it was executed.
+type prestateTracer struct {
+	ctx      *Context
+	env      *evm.EVM
+	prestate map[common.Address]*account
+	from     common.Address
+	to       common.Address
+	value    *big.Int
+	create   bool
+}
+
+func newPrestateTracer(ctx *Context) Tracer {
+	return &prestateTracer{
+		ctx:      ctx,
+		prestate: make(map[common.Address]*account),
+	}
+}
+
+// CaptureStart records the sender and the recipient of the message.
+func (t *prestateTracer) CaptureStart(env *evm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	t.env = env
+	t.from, t.to, t.create = from, to, create
+	t.value = new(big.Int)
+	if value != nil {
+		t.value.Set(value)
+	}
+	t.lookupAccount(from)
+	t.lookupAccount(to)
+	t.lookupAccount(env.Coinbase)
+	return nil
+}
+
+// CaptureState records the accounts and storage slots the next operation is
+// about to access.
+func (t *prestateTracer) CaptureState(env *evm.EVM, pc uint64, op evm.OpCode, gas, cost uint64, memory *evm.Memory, stack *evm.Stack, contract *evm.Contract, depth int, err error) error {
+	if err != nil {
+		return nil
+	}
+	size := len(stack.Data())
+	switch {
+	case size >= 1 && (op == evm.SLOAD || op == evm.SSTORE):
+		t.lookupStorage(contract.Address(), common.BigToHash(stack.Back(0)))
+	case size >= 1 && (op == evm.EXTCODECOPY || op == evm.EXTCODEHASH || op == evm.EXTCODESIZE || op == evm.BALANCE || op == evm.SELFDESTRUCT):
+		t.lookupAccount(common.BigToAddress(stack.Back(0)))
+	case size >= 5 && (op == evm.CALL || op == evm.CALLCODE || op == evm.DELEGATECALL || op == evm.STATICCALL):
+		t.lookupAccount(common.BigToAddress(stack.Back(1)))
+	case op == evm.CREATE:
+		nonce := env.StateDB.GetNonce(contract.Address())
+		t.lookupAccount(crypto.CreateAddress(contract.Address(), nonce))
+	case size >= 4 && op == evm.CREATE2:
+		offset, length := stack.Back(1), stack.Back(2)
+		code := memory.Get(offset.Int64(), length.Int64())
+		salt := common.BigToHash(stack.Back(3))
+		t.lookupAccount(crypto.CreateAddress2(contract.Address(), salt, crypto.Keccak256(code)))
+	}
+	return nil
+}
+
+// CaptureEnter implements the Tracer interface, the accounts of nested calls
+// are recorded by the operations making them.
+func (t *prestateTracer) CaptureEnter(typ evm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+// CaptureExit implements the Tracer interface.
+func (t *prestateTracer) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	return nil
+}
+
+// CaptureEnd implements the Tracer interface.
+func (t *prestateTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	return nil
+}
+
+// GetResult returns the recorded accounts. The sender and the recipient were
+// recorded after the message had paid for its gas, moved its value and bumped
+// the sender nonce, so those changes are undone first.
+func (t *prestateTracer) GetResult() (json.RawMessage, error) {
+	value := t.value
+	if t.from == t.to {
+		value = new(big.Int)
+	}
+	if from := t.prestate[t.from]; from != nil {
+		balance := new(big.Int).Add(from.Balance.ToInt(), value)
+		if t.ctx.GasPrice != nil {
+			balance.Add(balance, new(big.Int).Mul(new(big.Int).SetUint64(t.ctx.GasLimit), t.ctx.GasPrice))
+		}
+		from.Balance = (*hexutil.Big)(balance)
+		if from.Nonce > 0 {
+			from.Nonce--
+		}
+	}
+	if t.create {
+		// The contract did not exist before the message created it
+		delete(t.prestate, t.to)
+	} else if to := t.prestate[t.to]; to != nil {
+		to.Balance = (*hexutil.Big)(new(big.Int).Sub(to.Balance.ToInt(), value))
+	}
+	return json.Marshal(t.prestate)
+}
+
+// lookupAccount records the state of the account if it was not seen yet.
+func (t *prestateTracer) lookupAccount(addr common.Address) {
+	if _, ok := t.prestate[addr]; ok {
+		return
+	}
+	t.prestate[addr] = &account{
+		Balance: (*hexutil.Big)(new(big.Int).Set(t.env.StateDB.GetBalance(addr))),
+		Nonce:   t.env.StateDB.GetNonce(addr),
+		Code:    common.CopyBytes(t.env.StateDB.GetCode(addr)),
+		Storage: make(map[common.Hash]common.Hash),
+	}
+}
+
+// lookupStorage records the value the storage slot had at the start of the
+// transaction if it was not seen yet.
+func (t *prestateTracer) lookupStorage(addr common.Address, key common.Hash) {
+	t.lookupAccount(addr)
+	if _, ok := t.prestate[addr].Storage[key]; ok {
+		return
+	}
+	t.prestate[addr].Storage[key] = t.env.StateDB.GetCommittedState(addr, key)
+}
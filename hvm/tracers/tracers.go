@@ -0,0 +1,60 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+// Package tracers implements the built-in tracers that can be selected by name
+// when tracing a transaction, as a fast alternative to the JavaScript tracers.
+package tracers
+
+import (
+	"encoding/json"
+	"math/big"
+
+	"github.com/hpb-project/go-hpb/hvm/evm"
+)
+
+// Context contains the details of the traced message that are not passed to
+// the tracer by the EVM.
+type Context struct {
+	GasLimit uint64   // Gas limit of the message, including the intrinsic gas
+	GasPrice *big.Int // Gas price the sender paid for the message
+}
+
+// Tracer is a built-in tracer which returns its result as JSON.
+type Tracer interface {
+	evm.Tracer
+
+	// GetResult returns the collected trace once the execution has finished.
+	GetResult() (json.RawMessage, error)
+}
+
+// lookup contains the constructors of the built-in tracers by name.
+var lookup = map[string]func(ctx *Context) Tracer{
+	"callTracer":     newCallTracer,
+	"prestateTracer": newPrestateTracer,
+}
+
+// New returns the built-in tracer registered under the given name, or false if
+// there is no such tracer.
+func New(name string, ctx *Context) (Tracer, bool) {
+	constructor, ok := lookup[name]
+	if !ok {
+		return nil, false
+	}
+	if ctx == nil {
+		ctx = new(Context)
+	}
+	return constructor(ctx), true
+}
@@ -0,0 +1,205 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	bc "github.com/hpb-project/go-hpb/blockchain"
+	"github.com/hpb-project/go-hpb/blockchain/state"
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/blockchain/types"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/config"
+	"github.com/hpb-project/go-hpb/hvm"
+	"github.com/hpb-project/go-hpb/hvm/evm"
+)
+
+var (
+	sender   = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	coinbase = common.HexToAddress("0x2000000000000000000000000000000000000002")
+	caller   = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	reverter = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	counter  = common.HexToAddress("0x00000000000000000000000000000000000000cc")
+
+	// callerCode calls the reverter with all of its gas and stops.
+	callerCode = []byte{
+		byte(evm.PUSH1), 0, byte(evm.PUSH1), 0, byte(evm.PUSH1), 0, byte(evm.PUSH1), 0, byte(evm.PUSH1), 0,
+		byte(evm.PUSH1), 0xbb, byte(evm.GAS), byte(evm.CALL), byte(evm.POP), byte(evm.STOP),
+	}
+	// reverterCode reverts with Error("nope").
+	reverterCode = []byte{
+		byte(evm.PUSH4), 0x08, 0xc3, 0x79, 0xa0, byte(evm.PUSH1), 0xe0, byte(evm.SHL), byte(evm.PUSH1), 0x00, byte(evm.MSTORE),
+		byte(evm.PUSH1), 0x20, byte(evm.PUSH1), 0x04, byte(evm.MSTORE),
+		byte(evm.PUSH1), 0x04, byte(evm.PUSH1), 0x24, byte(evm.MSTORE),
+		byte(evm.PUSH4), 'n', 'o', 'p', 'e', byte(evm.PUSH1), 0xe0, byte(evm.SHL), byte(evm.PUSH1), 0x44, byte(evm.MSTORE),
+		byte(evm.PUSH1), 0x64, byte(evm.PUSH1), 0x00, byte(evm.REVERT),
+	}
+	// counterCode increments storage slot 0.
+	counterCode = []byte{
+		byte(evm.PUSH1), 0, byte(evm.SLOAD), byte(evm.PUSH1), 1, byte(evm.ADD), byte(evm.PUSH1), 0, byte(evm.SSTORE), byte(evm.STOP),
+	}
+
+	testChainConfig = &config.ChainConfig{
+		ChainId:             big.NewInt(1),
+		ConstantinopleBlock: big.NewInt(0),
+	}
+)
+
+func newTestState() *state.StateDB {
+	db, _ := hpbdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	statedb.SetBalance(sender, big.NewInt(1000000))
+	statedb.SetCode(caller, callerCode)
+	statedb.SetCode(reverter, reverterCode)
+	statedb.SetCode(counter, counterCode)
+	statedb.SetState(counter, common.Hash{}, common.BigToHash(big.NewInt(5)))
+	statedb.Finalise(true)
+	return statedb
+}
+
+func newTestEVM(statedb *state.StateDB, tracer evm.Tracer) *evm.EVM {
+	ctx := evm.Context{
+		CanTransfer: hvm.CanTransfer,
+		Transfer:    hvm.Transfer,
+		Coinbase:    coinbase,
+		BlockNumber: big.NewInt(1),
+		Time:        big.NewInt(0),
+		Difficulty:  big.NewInt(0),
+		GasLimit:    big.NewInt(1000000),
+		GasPrice:    big.NewInt(1),
+	}
+	return evm.NewEVM(ctx, statedb, testChainConfig, evm.Config{Debug: true, Tracer: tracer})
+}
+
+func TestUnknownTracer(t *testing.T) {
+	if _, ok := New("fooTracer", nil); ok {
+		t.Fatal("unknown tracer constructed")
+	}
+}
+
+// Tests that the call tracer reports nested calls together with the reason
+// they reverted with.
+func TestCallTracer(t *testing.T) {
+	tracer, _ := New("callTracer", &Context{GasLimit: 121000, GasPrice: big.NewInt(1)})
+	vmenv := newTestEVM(newTestState(), tracer)
+	if _, _, err := vmenv.Call(evm.AccountRef(sender), caller, nil, 100000, new(big.Int)); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	res, err := tracer.GetResult()
+	if err != nil {
+		t.Fatalf("failed to retrieve trace result: %v", err)
+	}
+	var frame callFrame
+	if err := json.Unmarshal(res, &frame); err != nil {
+		t.Fatalf("failed to unmarshal trace result: %v", err)
+	}
+	if frame.Type != "CALL" || frame.From != sender || frame.To != caller {
+		t.Errorf("top frame mismatch: have %s %x -> %x", frame.Type, frame.From, frame.To)
+	}
+	if frame.Gas != 121000 || frame.Error != "" {
+		t.Errorf("top frame result mismatch: have gas %d, error %q", frame.Gas, frame.Error)
+	}
+	if len(frame.Calls) != 1 {
+		t.Fatalf("nested call count mismatch: have %d, want 1", len(frame.Calls))
+	}
+	call := frame.Calls[0]
+	if call.Type != "CALL" || call.From != caller || call.To != reverter {
+		t.Errorf("nested frame mismatch: have %s %x -> %x", call.Type, call.From, call.To)
+	}
+	if call.Error != evm.ErrExecutionReverted.Error() {
+		t.Errorf("nested error mismatch: have %q, want %q", call.Error, evm.ErrExecutionReverted)
+	}
+	if call.RevertReason != "nope" {
+		t.Errorf("revert reason mismatch: have %q, want %q", call.RevertReason, "nope")
+	}
+	if call.GasUsed == 0 || call.GasUsed >= frame.GasUsed {
+		t.Errorf("nested gas used %d out of range, top frame used %d", call.GasUsed, frame.GasUsed)
+	}
+}
+
+// Tests that the prestate tracer reports storage as it was before the
+// transaction, even after it was modified.
+func TestPrestateTracerStorage(t *testing.T) {
+	tracer, _ := New("prestateTracer", &Context{GasLimit: 100000, GasPrice: big.NewInt(1)})
+	statedb := newTestState()
+
+	// Pay for the gas and bump the nonce like the state transition would
+	statedb.SubBalance(sender, big.NewInt(100000))
+	statedb.SetNonce(sender, 1)
+
+	vmenv := newTestEVM(statedb, tracer)
+	if _, _, err := vmenv.Call(evm.AccountRef(sender), counter, nil, 100000, big.NewInt(10)); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if have := statedb.GetState(counter, common.Hash{}); have != common.BigToHash(big.NewInt(6)) {
+		t.Fatalf("counter not incremented: have %x", have)
+	}
+	prestate := traceResult(t, tracer)
+	if have := prestate[counter].Storage[common.Hash{}]; have != common.BigToHash(big.NewInt(5)) {
+		t.Errorf("prestate storage mismatch: have %x, want 5", have)
+	}
+	if have := prestate[counter].Balance.ToInt(); have.Sign() != 0 {
+		t.Errorf("prestate recipient balance mismatch: have %v, want 0", have)
+	}
+	if have := prestate[sender].Balance.ToInt(); have.Cmp(big.NewInt(1000000)) != 0 {
+		t.Errorf("prestate sender balance mismatch: have %v, want 1000000", have)
+	}
+	if have := prestate[sender].Nonce; have != 0 {
+		t.Errorf("prestate sender nonce mismatch: have %d, want 0", have)
+	}
+}
+
+// Tests that transfers which don't run on the EVM are traced as well.
+func TestPrestateTracerTransfer(t *testing.T) {
+	var (
+		recipient = common.HexToAddress("0x3000000000000000000000000000000000000003")
+		statedb   = newTestState()
+		msg       = types.NewMessage(sender, &recipient, 0, big.NewInt(500), big.NewInt(21000), big.NewInt(1), nil, true)
+	)
+	tracer, _ := New("prestateTracer", &Context{GasLimit: 21000, GasPrice: big.NewInt(1)})
+	vmenv := newTestEVM(statedb, tracer)
+
+	gp := new(hvm.GasPool).AddGas(big.NewInt(21000))
+	if _, _, _, err := bc.ApplyMessageOnEVM(vmenv, &types.Header{Number: big.NewInt(1)}, statedb, msg, gp); err != nil {
+		t.Fatalf("transfer failed: %v", err)
+	}
+	prestate := traceResult(t, tracer)
+	if have := prestate[sender].Balance.ToInt(); have.Cmp(big.NewInt(1000000)) != 0 {
+		t.Errorf("prestate sender balance mismatch: have %v, want 1000000", have)
+	}
+	if have := prestate[recipient].Balance.ToInt(); have.Sign() != 0 {
+		t.Errorf("prestate recipient balance mismatch: have %v, want 0", have)
+	}
+	if have := statedb.GetBalance(recipient); have.Cmp(big.NewInt(500)) != 0 {
+		t.Errorf("recipient balance mismatch: have %v, want 500", have)
+	}
+}
+
+func traceResult(t *testing.T, tracer Tracer) map[common.Address]*account {
+	res, err := tracer.GetResult()
+	if err != nil {
+		t.Fatalf("failed to retrieve trace result: %v", err)
+	}
+	prestate := make(map[common.Address]*account)
+	if err := json.Unmarshal(res, &prestate); err != nil {
+		t.Fatalf("failed to unmarshal trace result: %v", err)
+	}
+	return prestate
+}
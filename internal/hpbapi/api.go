@@ -17,6 +17,7 @@
 package hpbapi
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -25,6 +26,7 @@ import (
 	"time"
 
 	"github.com/hpb-project/go-hpb/account"
+	"github.com/hpb-project/go-hpb/account/abi"
 	"github.com/hpb-project/go-hpb/account/keystore"
 	"github.com/hpb-project/go-hpb/common"
 	"github.com/hpb-project/go-hpb/common/constant"
@@ -37,9 +39,12 @@ import (
 	"github.com/hpb-project/go-hpb/network/rpc"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/hpb-project/go-hpb/blockchain/state"
 	"github.com/hpb-project/go-hpb/blockchain/types"
+	"github.com/hpb-project/go-hpb/hvm"
 	"github.com/hpb-project/go-hpb/hvm/evm"
 	"github.com/hpb-project/go-hpb/blockchain"
+	"github.com/hpb-project/go-hpb/txpool"
 )
 
 const (
@@ -147,18 +152,11 @@ func (s *PublicTxPoolAPI) Inspect() map[string]map[string]map[string]string {
 	}
 	pending, queue := s.b.TxPoolContent()
 
-	// Define a formatter to flatten a transaction into a string
-	var format = func(tx *types.Transaction) string {
-		if to := tx.To(); to != nil {
-			return fmt.Sprintf("%s: %v wei + %v × %v gas", tx.To().Hex(), tx.Value(), tx.Gas(), tx.GasPrice())
-		}
-		return fmt.Sprintf("contract creation: %v wei + %v × %v gas", tx.Value(), tx.Gas(), tx.GasPrice())
-	}
 	// Flatten the pending transactions
 	for account, txs := range pending {
 		dump := make(map[string]string)
 		for _, tx := range txs {
-			dump[fmt.Sprintf("%d", tx.Nonce())] = format(tx)
+			dump[fmt.Sprintf("%d", tx.Nonce())] = formatPoolTx(tx)
 		}
 		content["pending"][account.Hex()] = dump
 	}
@@ -166,13 +164,151 @@ func (s *PublicTxPoolAPI) Inspect() map[string]map[string]map[string]string {
 	for account, txs := range queue {
 		dump := make(map[string]string)
 		for _, tx := range txs {
-			dump[fmt.Sprintf("%d", tx.Nonce())] = format(tx)
+			dump[fmt.Sprintf("%d", tx.Nonce())] = formatPoolTx(tx)
 		}
 		content["queued"][account.Hex()] = dump
 	}
 	return content
 }
 
+// maxTxPoolListLimit is the maximum number of accounts returned by a single
+// txpool_list call.
+const maxTxPoolListLimit = 1000
+
+// RPCTxPoolAccount is the pool content of a single account.
+type RPCTxPoolAccount struct {
+	Pending map[string]*RPCTransaction `json:"pending"`
+	Queued  map[string]*RPCTransaction `json:"queued"`
+	Status  *RPCTxPoolAccountStatus    `json:"status"`
+}
+
+// RPCTxPoolAccountStatus summarises the pool content of a single account.
+type RPCTxPoolAccountStatus struct {
+	Pending   hexutil.Uint        `json:"pending"`
+	Queued    hexutil.Uint        `json:"queued"`
+	Nonce     hexutil.Uint64      `json:"nonce"`
+	NextNonce hexutil.Uint64      `json:"nextNonce"`
+	Gaps      []RPCTxPoolNonceGap `json:"gaps"`
+}
+
+// RPCTxPoolNonceGap is a range of nonces an account still has to submit.
+type RPCTxPoolNonceGap struct {
+	From hexutil.Uint64 `json:"from"`
+	To   hexutil.Uint64 `json:"to"`
+}
+
+// RPCTxPoolPage is a page of pool content returned by txpool_list.
+type RPCTxPoolPage struct {
+	Accounts map[string]*RPCTxPoolAccount `json:"accounts"`
+	Next     *common.Address              `json:"next"` // First account of the next page, nil if none left
+}
+
+func newRPCTxPoolAccountStatus(status *txpool.AccountStatus) *RPCTxPoolAccountStatus {
+	gaps := make([]RPCTxPoolNonceGap, len(status.Gaps))
+	for i, gap := range status.Gaps {
+		gaps[i] = RPCTxPoolNonceGap{From: hexutil.Uint64(gap.From), To: hexutil.Uint64(gap.To)}
+	}
+	return &RPCTxPoolAccountStatus{
+		Pending:   hexutil.Uint(status.Pending),
+		Queued:    hexutil.Uint(status.Queued),
+		Nonce:     hexutil.Uint64(status.Nonce),
+		NextNonce: hexutil.Uint64(status.NextNonce),
+		Gaps:      gaps,
+	}
+}
+
+// account retrieves the pool content of a single account, restricted to the
+// pending or queued transactions if filter says so.
+func (s *PublicTxPoolAPI) account(addr common.Address, filter string) *RPCTxPoolAccount {
+	pending, queue := s.b.TxPoolContentFrom(addr)
+
+	result := &RPCTxPoolAccount{
+		Pending: make(map[string]*RPCTransaction),
+		Queued:  make(map[string]*RPCTransaction),
+		Status:  newRPCTxPoolAccountStatus(s.b.TxPoolAccountStatus(addr)),
+	}
+	if filter != "queued" {
+		for _, tx := range pending {
+			result.Pending[fmt.Sprintf("%d", tx.Nonce())] = newRPCPendingTransaction(tx)
+		}
+	}
+	if filter != "pending" {
+		for _, tx := range queue {
+			result.Queued[fmt.Sprintf("%d", tx.Nonce())] = newRPCPendingTransaction(tx)
+		}
+	}
+	return result
+}
+
+// ContentFrom returns the transactions of a single account contained within the
+// transaction pool, along with the nonce gaps keeping its queued ones back.
+func (s *PublicTxPoolAPI) ContentFrom(addr common.Address) *RPCTxPoolAccount {
+	return s.account(addr, "all")
+}
+
+// List returns the pool content of up to limit accounts in address order,
+// starting at cursor. Accounts are never split across pages; the returned next
+// cursor resumes the listing. The filter restricts the transactions to
+// "pending" or "queued" ones, the default is "all".
+func (s *PublicTxPoolAPI) List(cursor *common.Address, limit *hexutil.Uint, filter *string) (*RPCTxPoolPage, error) {
+	max := maxTxPoolListLimit
+	if limit != nil {
+		if *limit == 0 || int(*limit) > maxTxPoolListLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d", maxTxPoolListLimit)
+		}
+		max = int(*limit)
+	}
+	kind := "all"
+	if filter != nil {
+		kind = *filter
+	}
+	if kind != "all" && kind != "pending" && kind != "queued" {
+		return nil, fmt.Errorf("invalid filter %q, want pending, queued or all", kind)
+	}
+	page := &RPCTxPoolPage{Accounts: make(map[string]*RPCTxPoolAccount)}
+	for _, addr := range s.b.TxPoolAddresses() {
+		if cursor != nil && bytes.Compare(addr[:], cursor[:]) < 0 {
+			continue
+		}
+		if len(page.Accounts) == max {
+			next := addr
+			page.Next = &next
+			break
+		}
+		account := s.account(addr, kind)
+		if len(account.Pending)+len(account.Queued) == 0 {
+			continue
+		}
+		page.Accounts[addr.Hex()] = account
+	}
+	return page, nil
+}
+
+// InspectFrom retrieves the transactions of a single account contained within
+// the transaction pool and flattens them into an easily inspectable list.
+func (s *PublicTxPoolAPI) InspectFrom(addr common.Address) map[string]map[string]string {
+	content := map[string]map[string]string{
+		"pending": make(map[string]string),
+		"queued":  make(map[string]string),
+	}
+	pending, queue := s.b.TxPoolContentFrom(addr)
+	for _, tx := range pending {
+		content["pending"][fmt.Sprintf("%d", tx.Nonce())] = formatPoolTx(tx)
+	}
+	for _, tx := range queue {
+		content["queued"][fmt.Sprintf("%d", tx.Nonce())] = formatPoolTx(tx)
+	}
+	return content
+}
+
+// formatPoolTx flattens a pool transaction into a string.
+func formatPoolTx(tx *types.Transaction) string {
+	if to := tx.To(); to != nil {
+		return fmt.Sprintf("%s: %v wei + %v × %v gas", tx.To().Hex(), tx.Value(), tx.Gas(), tx.GasPrice())
+	}
+	return fmt.Sprintf("contract creation: %v wei + %v × %v gas", tx.Value(), tx.Gas(), tx.GasPrice())
+}
+
 // PublicAccountAPI provides an API to access accounts managed by this node.
 // It offers only methods that can retrieve accounts.
 type PublicAccountAPI struct {
@@ -550,6 +686,73 @@ func (s *PublicBlockChainAPI) GetStorageAt(ctx context.Context, address common.A
 	return res[:], state.Error()
 }
 
+// AccountResult is the merkle proof of an account and of some of its storage
+// slots, as returned by GetProof.
+type AccountResult struct {
+	Address      common.Address  `json:"address"`
+	AccountProof []string        `json:"accountProof"`
+	Balance      *hexutil.Big    `json:"balance"`
+	CodeHash     common.Hash     `json:"codeHash"`
+	Nonce        hexutil.Uint64  `json:"nonce"`
+	StorageHash  common.Hash     `json:"storageHash"`
+	StorageProof []StorageResult `json:"storageProof"`
+}
+
+// StorageResult is the merkle proof of a storage slot.
+type StorageResult struct {
+	Key   string       `json:"key"`
+	Value *hexutil.Big `json:"value"`
+	Proof []string     `json:"proof"`
+}
+
+// GetProof returns the account and storage values of the specified account
+// along with their merkle proofs against the state root of the given block.
+func (s *PublicBlockChainAPI) GetProof(ctx context.Context, address common.Address, storageKeys []string, blockNr rpc.BlockNumber) (*AccountResult, error) {
+	state, _, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	accountProof, err := state.GetProof(address)
+	if err != nil {
+		return nil, err
+	}
+	storageProof := make([]StorageResult, len(storageKeys))
+	for i, key := range storageKeys {
+		slot := common.HexToHash(key)
+		proof, err := state.GetStorageProof(address, slot)
+		if err != nil {
+			return nil, err
+		}
+		storageProof[i] = StorageResult{
+			Key:   key,
+			Value: (*hexutil.Big)(state.GetState(address, slot).Big()),
+			Proof: encodeProof(proof),
+		}
+	}
+	codeHash := state.GetCodeHash(address)
+	if codeHash == (common.Hash{}) {
+		codeHash = crypto.Keccak256Hash(nil)
+	}
+	return &AccountResult{
+		Address:      address,
+		AccountProof: encodeProof(accountProof),
+		Balance:      (*hexutil.Big)(state.GetBalance(address)),
+		CodeHash:     codeHash,
+		Nonce:        hexutil.Uint64(state.GetNonce(address)),
+		StorageHash:  state.GetStorageRoot(address),
+		StorageProof: storageProof,
+	}, state.Error()
+}
+
+// encodeProof hex encodes the nodes of a merkle proof.
+func encodeProof(proof []rlp.RawValue) []string {
+	enc := make([]string, len(proof))
+	for i, node := range proof {
+		enc[i] = hexutil.Encode(node)
+	}
+	return enc
+}
+
 // CallArgs represents the arguments for a call.
 type CallArgs struct {
 	From     common.Address  `json:"from"`
@@ -560,7 +763,75 @@ type CallArgs struct {
 	Data     hexutil.Bytes   `json:"data"`
 }
 
-func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber, vmCfg evm.Config) ([]byte, *big.Int, bool, error) {
+// OverrideAccount holds the fields of an account to replace before a call is
+// executed. State replaces the whole storage of the account, StateDiff only
+// the given slots, so at most one of them may be set.
+type OverrideAccount struct {
+	Nonce     *hexutil.Uint64              `json:"nonce"`
+	Code      *hexutil.Bytes               `json:"code"`
+	Balance   *hexutil.Big                 `json:"balance"`
+	State     *map[common.Hash]common.Hash `json:"state"`
+	StateDiff *map[common.Hash]common.Hash `json:"stateDiff"`
+}
+
+// StateOverride is the set of accounts to replace before a call is executed.
+type StateOverride map[common.Address]OverrideAccount
+
+// Apply replaces the overridden accounts in the given state.
+func (diff *StateOverride) Apply(statedb *state.StateDB) error {
+	if diff == nil {
+		return nil
+	}
+	for addr, account := range *diff {
+		if account.State != nil && account.StateDiff != nil {
+			return fmt.Errorf("account %s has both 'state' and 'stateDiff'", addr.Hex())
+		}
+		if account.Nonce != nil {
+			statedb.SetNonce(addr, uint64(*account.Nonce))
+		}
+		if account.Code != nil {
+			statedb.SetCode(addr, *account.Code)
+		}
+		if account.Balance != nil {
+			statedb.SetBalance(addr, account.Balance.ToInt())
+		}
+		if account.State != nil {
+			statedb.SetStorage(addr, *account.State)
+		}
+		if account.StateDiff != nil {
+			for key, value := range *account.StateDiff {
+				statedb.SetState(addr, key, value)
+			}
+		}
+	}
+	return nil
+}
+
+// BlockOverrides holds the fields of the block context to replace before a
+// call is executed.
+type BlockOverrides struct {
+	Number   *hexutil.Big    `json:"number"`
+	Time     *hexutil.Big    `json:"time"`
+	Coinbase *common.Address `json:"coinbase"`
+}
+
+// Apply replaces the overridden fields in the given EVM context.
+func (diff *BlockOverrides) Apply(context *evm.Context) {
+	if diff == nil {
+		return
+	}
+	if diff.Number != nil {
+		context.BlockNumber = new(big.Int).Set(diff.Number.ToInt())
+	}
+	if diff.Time != nil {
+		context.Time = new(big.Int).Set(diff.Time.ToInt())
+	}
+	if diff.Coinbase != nil {
+		context.Coinbase = *diff.Coinbase
+	}
+}
+
+func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber, overrides *StateOverride, blockOverrides *BlockOverrides, vmCfg evm.Config) ([]byte, *big.Int, bool, error) {
 	defer func(start time.Time) { log.Debug("Executing EVM call finished", "runtime", time.Since(start)) }(time.Now())
 
 	state, header, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
@@ -601,44 +872,81 @@ func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr
 	defer func() { cancel() }()
 
 	// Get a new instance of the EVM.
-	evm, _, err := s.b.GetEVM(ctx, msg, state, header, vmCfg) //TODO
-	//evm, vmError, err := s.b.GetEVM(ctx, msg, state, header, vmCfg) //TODO
+	vmenv, vmError, err := s.b.GetEVM(ctx, msg, state, header, vmCfg)
 	if err != nil {
 		return nil, common.Big0, false, err
 	}
+	// Apply the overrides last, so they win over the defaults of the backend
+	if err := overrides.Apply(state); err != nil {
+		return nil, common.Big0, false, err
+	}
+	if blockOverrides != nil {
+		context := vmenv.Context
+		blockOverrides.Apply(&context)
+		vmenv = evm.NewEVM(context, state, s.b.ChainConfig(), vmCfg)
+	}
 	// Wait for the context to be done and cancel the evm. Even if the
 	// EVM has finished, cancelling may be done (repeatedly)
 	go func() {
 		<-ctx.Done()
-		evm.Cancel()
+		vmenv.Cancel()
 	}()
 
-
 	// Setup the gas pool (also for unmetered requests)
 	// and apply the message.
-	//gp := new(node.GasPool).AddGas(math.MaxBig256) //TODO
-
-	//blockchain := bc.InstanceBlockChain() //TODO
-	//header := bc. //TODO
-	//TODO
-	/*res, gas, failed, err := bc.ApplyMessage(blockchain, evm, msg, gp)
+	gp := new(hvm.GasPool).AddGas(math.MaxBig256)
+	res, gasUsed, failed, err := bc.ApplyMessageOnEVM(vmenv, header, state, msg, gp)
 	if err := vmError(); err != nil {
 		return nil, common.Big0, false, err
-	}*/
-	//TODO
-	//return res, gas, failed, err
-	return nil,gas,false,err
+	}
+	return res, gasUsed, failed, err
+}
+
+// revertError is an API error carrying the data a call reverted with.
+type revertError struct {
+	error
+	reason string // hex encoded revert data
+}
+
+// newRevertError creates the error for a call which reverted with the given
+// data, decoding the reason if it is an Error(string).
+func newRevertError(ret []byte) *revertError {
+	err := evm.ErrExecutionReverted
+	if reason, errUnpack := abi.UnpackRevert(ret); errUnpack == nil {
+		err = fmt.Errorf("%v: %v", evm.ErrExecutionReverted, reason)
+	}
+	return &revertError{
+		error:  err,
+		reason: hexutil.Encode(ret),
+	}
+}
+
+// ErrorCode returns the JSON-RPC error code of a revert.
+func (e *revertError) ErrorCode() int {
+	return 3
+}
+
+// ErrorData returns the hex encoded revert data.
+func (e *revertError) ErrorData() interface{} {
+	return e.reason
 }
 
 // Call executes the given transaction on the state for the given block number.
 // It doesn't make and changes in the state/blockchain and is useful to execute and retrieve values.
-func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber) (hexutil.Bytes, error) {
-	result, _, _, err := s.doCall(ctx, args, blockNr, evm.Config{DisableGasMetering: true})
+// The optional overrides replace accounts of the state and fields of the block
+// the call is executed in. A failed call returns an error with the data it
+// reverted with, which is empty if it reverted without any or failed otherwise.
+func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber, overrides *StateOverride, blockOverrides *BlockOverrides) (hexutil.Bytes, error) {
+	result, _, failed, err := s.doCall(ctx, args, blockNr, overrides, blockOverrides, evm.Config{DisableGasMetering: true})
+	if err == nil && failed {
+		return nil, newRevertError(result)
+	}
 	return (hexutil.Bytes)(result), err
 }
 
 // EstimateGas returns an estimate of the amount of gas needed to execute the given transaction.
-func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs) (*hexutil.Big, error) {
+// The optional overrides are applied to every execution of the search.
+func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs, overrides *StateOverride, blockOverrides *BlockOverrides) (*hexutil.Big, error) {
 	// Binary search the gas requirement, as it may be higher than the amount used
 	var (
 		lo uint64 = params.TxGas - 1
@@ -659,7 +967,7 @@ func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs) (*
 		mid := (hi + lo) / 2
 		(*big.Int)(&args.Gas).SetUint64(mid)
 
-		_, _, failed, err := s.doCall(ctx, args, rpc.PendingBlockNumber, evm.Config{})
+		_, _, failed, err := s.doCall(ctx, args, rpc.PendingBlockNumber, overrides, blockOverrides, evm.Config{})
 
 		// If the transaction became invalid or execution failed, raise the gas limit
 		if err != nil || failed {
@@ -669,6 +977,15 @@ func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs) (*
 		// Otherwise assume the transaction succeeded, lower the gas limit
 		hi = mid
 	}
+	// Report why the transaction fails if it does with all the gas it may use
+	(*big.Int)(&args.Gas).SetUint64(hi)
+	ret, _, failed, err := s.doCall(ctx, args, rpc.PendingBlockNumber, overrides, blockOverrides, evm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	if failed {
+		return nil, newRevertError(ret)
+	}
 	return (*hexutil.Big)(new(big.Int).SetUint64(hi)), nil
 }
 
@@ -676,10 +993,11 @@ func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs) (*
 // while replaying a transaction in debug mode as well as transaction
 // execution status, the amount of gas used and the return value
 type ExecutionResult struct {
-	Gas         *big.Int       `json:"gas"`
-	Failed      bool           `json:"failed"`
-	ReturnValue string         `json:"returnValue"`
-	StructLogs  []StructLogRes `json:"structLogs"`
+	Gas          *big.Int       `json:"gas"`
+	Failed       bool           `json:"failed"`
+	ReturnValue  string         `json:"returnValue"`
+	RevertReason string         `json:"revertReason,omitempty"`
+	StructLogs   []StructLogRes `json:"structLogs"`
 }
 
 // StructLogRes stores a structured log emitted by the EVM while replaying a
@@ -1318,6 +1636,13 @@ func (api *PrivateDebugAPI) ChaindbProperty(property string) (string, error) {
 	return ldb.LDB().GetProperty(property)
 }
 
+// DbStats iterates over the chain database and returns the number and size of
+// its entries per category of keys. It reads the whole database and may take
+// a long time on a large chain.
+func (api *PrivateDebugAPI) DbStats() (*bc.DatabaseStats, error) {
+	return bc.InspectDatabase(api.b.ChainDb())
+}
+
 func (api *PrivateDebugAPI) ChaindbCompact() error {
 	ldb, ok := api.b.ChainDb().(interface {
 		LDB() *leveldb.DB
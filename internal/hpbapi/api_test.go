@@ -0,0 +1,580 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package hpbapi
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hpb-project/go-hpb/blockchain/state"
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/blockchain/types"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/crypto"
+	"github.com/hpb-project/go-hpb/common/hexutil"
+	"github.com/hpb-project/go-hpb/common/math"
+	"github.com/hpb-project/go-hpb/config"
+	"github.com/hpb-project/go-hpb/hvm"
+	"github.com/hpb-project/go-hpb/hvm/evm"
+	"github.com/hpb-project/go-hpb/network/rpc"
+	"github.com/hpb-project/go-hpb/txpool"
+)
+
+// testPoolBackend serves fixed transaction pool content, any other backend
+// method panics.
+type testPoolBackend struct {
+	Backend
+	pending map[common.Address]types.Transactions
+	queued  map[common.Address]types.Transactions
+	status  map[common.Address]*txpool.AccountStatus
+}
+
+func (b *testPoolBackend) TxPoolAddresses() []common.Address {
+	var addrs []common.Address
+	for addr := range b.status {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].Big().Cmp(addrs[j].Big()) < 0 })
+	return addrs
+}
+
+func (b *testPoolBackend) TxPoolContentFrom(addr common.Address) (types.Transactions, types.Transactions) {
+	return b.pending[addr], b.queued[addr]
+}
+
+func (b *testPoolBackend) TxPoolAccountStatus(addr common.Address) *txpool.AccountStatus {
+	if status, ok := b.status[addr]; ok {
+		return status
+	}
+	return new(txpool.AccountStatus)
+}
+
+func poolTransactions(nonces ...uint64) types.Transactions {
+	txs := make(types.Transactions, len(nonces))
+	for i, nonce := range nonces {
+		txs[i] = types.NewTransaction(nonce, common.Address{}, big.NewInt(1), big.NewInt(21000), big.NewInt(1), nil)
+	}
+	return txs
+}
+
+// newTestPoolBackend creates a pool with an account having pending and queued
+// transactions at address 1, one with pending ones only at address 2 and one
+// with queued ones only at address 3.
+func newTestPoolBackend() *testPoolBackend {
+	return &testPoolBackend{
+		pending: map[common.Address]types.Transactions{
+			common.Address{1}: poolTransactions(0, 1),
+			common.Address{2}: poolTransactions(5),
+		},
+		queued: map[common.Address]types.Transactions{
+			common.Address{1}: poolTransactions(3, 6),
+			common.Address{3}: poolTransactions(2),
+		},
+		status: map[common.Address]*txpool.AccountStatus{
+			common.Address{1}: {Pending: 2, Queued: 2, NextNonce: 2, Gaps: []txpool.NonceGap{{From: 2, To: 2}, {From: 4, To: 5}}},
+			common.Address{2}: {Pending: 1, Nonce: 5, NextNonce: 6},
+			common.Address{3}: {Queued: 1, Gaps: []txpool.NonceGap{{From: 0, To: 1}}},
+		},
+	}
+}
+
+func pageAccounts(page *RPCTxPoolPage) []string {
+	var accounts []string
+	for account := range page.Accounts {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+	return accounts
+}
+
+// Tests that the pool content is paged by account, resuming from the cursor.
+func TestTxPoolList(t *testing.T) {
+	api := NewPublicTxPoolAPI(newTestPoolBackend())
+
+	limit := func(n uint) *hexutil.Uint { return (*hexutil.Uint)(&n) }
+	filter := func(kind string) *string { return &kind }
+
+	tests := []struct {
+		cursor   *common.Address
+		limit    *hexutil.Uint
+		filter   *string
+		accounts []string
+		next     *common.Address
+		fail     bool
+	}{
+		{nil, nil, nil, []string{common.Address{1}.Hex(), common.Address{2}.Hex(), common.Address{3}.Hex()}, nil, false},
+		{nil, limit(2), nil, []string{common.Address{1}.Hex(), common.Address{2}.Hex()}, &common.Address{3}, false},
+		{&common.Address{3}, limit(2), nil, []string{common.Address{3}.Hex()}, nil, false},
+		{&common.Address{2}, limit(1), nil, []string{common.Address{2}.Hex()}, &common.Address{3}, false},
+		{&common.Address{4}, limit(2), nil, nil, nil, false}, // cursor past the last account
+		{nil, nil, filter("pending"), []string{common.Address{1}.Hex(), common.Address{2}.Hex()}, nil, false},
+		{nil, nil, filter("queued"), []string{common.Address{1}.Hex(), common.Address{3}.Hex()}, nil, false},
+		{nil, limit(0), nil, nil, nil, true},
+		{nil, limit(maxTxPoolListLimit + 1), nil, nil, nil, true},
+		{nil, nil, filter("unknown"), nil, nil, true},
+	}
+	for i, tt := range tests {
+		page, err := api.List(tt.cursor, tt.limit, tt.filter)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("test %d: expected failure", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: list failed: %v", i, err)
+			continue
+		}
+		if have := pageAccounts(page); !reflect.DeepEqual(have, tt.accounts) {
+			t.Errorf("test %d: accounts mismatch: have %v, want %v", i, have, tt.accounts)
+		}
+		if !reflect.DeepEqual(page.Next, tt.next) {
+			t.Errorf("test %d: next cursor mismatch: have %v, want %v", i, page.Next, tt.next)
+		}
+	}
+}
+
+// Tests that the content of an account is split into pending and queued
+// transactions and reports the nonce gaps of the account.
+func TestTxPoolContentFrom(t *testing.T) {
+	api := NewPublicTxPoolAPI(newTestPoolBackend())
+
+	account := api.ContentFrom(common.Address{1})
+	if len(account.Pending) != 2 || account.Pending["0"] == nil || account.Pending["1"] == nil {
+		t.Errorf("pending transactions mismatch: have %v", account.Pending)
+	}
+	if len(account.Queued) != 2 || account.Queued["3"] == nil || account.Queued["6"] == nil {
+		t.Errorf("queued transactions mismatch: have %v", account.Queued)
+	}
+	want := &RPCTxPoolAccountStatus{Pending: 2, Queued: 2, NextNonce: 2, Gaps: []RPCTxPoolNonceGap{{From: 2, To: 2}, {From: 4, To: 5}}}
+	if !reflect.DeepEqual(account.Status, want) {
+		t.Errorf("status mismatch: have %+v, want %+v", account.Status, want)
+	}
+	// Unknown accounts have empty content and no gaps
+	account = api.ContentFrom(common.Address{9})
+	if len(account.Pending) != 0 || len(account.Queued) != 0 || len(account.Status.Gaps) != 0 {
+		t.Errorf("unknown account content: have %+v", account)
+	}
+}
+
+// Tests that the inspected content of an account is keyed by nonce.
+func TestTxPoolInspectFrom(t *testing.T) {
+	api := NewPublicTxPoolAPI(newTestPoolBackend())
+
+	content := api.InspectFrom(common.Address{1})
+	for _, nonce := range []string{"0", "1"} {
+		if _, ok := content["pending"][nonce]; !ok {
+			t.Errorf("pending transaction %s missing", nonce)
+		}
+	}
+	for _, nonce := range []string{"3", "6"} {
+		if _, ok := content["queued"][nonce]; !ok {
+			t.Errorf("queued transaction %s missing", nonce)
+		}
+	}
+	if len(content["pending"]) != 2 || len(content["queued"]) != 2 {
+		t.Errorf("content size mismatch: have %d pending, %d queued", len(content["pending"]), len(content["queued"]))
+	}
+}
+
+var (
+	callTestSender = common.Address{0xaa}
+	callTestTarget = common.Address{0xbb} // Account without code, overridden by the tests
+
+	callTestRevertReason = common.Address{0xc1} // Reverts with Error("boom")
+	callTestRevertEmpty  = common.Address{0xc2} // Reverts without data
+	callTestInvalid      = common.Address{0xc3} // Fails on an invalid opcode
+)
+
+// revertData encodes the reason a call reverts with as Solidity does, as a
+// call to Error(string).
+func revertData(reason string) []byte {
+	data := common.Hex2Bytes("08c379a0")
+	data = append(data, common.LeftPadBytes(big.NewInt(32).Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(big.NewInt(int64(len(reason))).Bytes(), 32)...)
+	return append(data, common.RightPadBytes([]byte(reason), (len(reason)+31)/32*32)...)
+}
+
+// revertCode returns contract code reverting with the given data.
+func revertCode(data []byte) []byte {
+	code := []byte{
+		byte(evm.PUSH1), byte(len(data)), byte(evm.PUSH1), 12, byte(evm.PUSH1), 0, byte(evm.CODECOPY),
+		byte(evm.PUSH1), byte(len(data)), byte(evm.PUSH1), 0, byte(evm.REVERT),
+	}
+	return append(code, data...)
+}
+
+// testCallBackend executes calls on a fixed state at block 10 of a chain
+// forking to Istanbul at block 100, any other backend method panics. Every
+// call runs on a fresh copy of the state.
+type testCallBackend struct {
+	Backend
+	db     hpbdb.Database
+	root   common.Hash
+	header *types.Header
+	config *config.ChainConfig
+	evms   int // Number of EVMs created for calls
+}
+
+func newTestCallBackend(t *testing.T, code map[common.Address][]byte) *testCallBackend {
+	db, _ := hpbdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	// Calls from accounts without code are executed natively, so the sender
+	// needs some to run the code of the callee
+	statedb.SetCode(callTestSender, []byte{byte(evm.STOP)})
+	statedb.SetCode(callTestRevertReason, revertCode(revertData("boom")))
+	statedb.SetCode(callTestRevertEmpty, revertCode(nil))
+	statedb.SetCode(callTestInvalid, []byte{0xfe})
+	for addr, code := range code {
+		statedb.SetCode(addr, code)
+	}
+	root, err := statedb.CommitTo(db, false)
+	if err != nil {
+		t.Fatalf("failed to commit test state: %v", err)
+	}
+	chainConfig := *config.MainnetChainConfig
+	chainConfig.IstanbulBlock = big.NewInt(100)
+
+	return &testCallBackend{
+		db:   db,
+		root: root,
+		header: &types.Header{
+			Number:     big.NewInt(10),
+			Time:       big.NewInt(1000),
+			Difficulty: big.NewInt(1),
+			GasLimit:   big.NewInt(1000000),
+			GasUsed:    new(big.Int),
+		},
+		config: &chainConfig,
+	}
+}
+
+func (b *testCallBackend) StateAndHeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*state.StateDB, *types.Header, error) {
+	statedb, err := state.New(b.root, state.NewDatabase(b.db))
+	return statedb, b.header, err
+}
+
+func (b *testCallBackend) BlockByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.Block, error) {
+	return types.NewBlockWithHeader(b.header), nil
+}
+
+func (b *testCallBackend) GetEVM(ctx context.Context, msg types.Message, statedb *state.StateDB, header *types.Header, vmCfg evm.Config) (*evm.EVM, func() error, error) {
+	b.evms++
+	statedb.SetBalance(msg.From(), math.MaxBig256)
+
+	context := evm.Context{
+		CanTransfer: hvm.CanTransfer,
+		Transfer:    hvm.Transfer,
+		GetHash:     func(uint64) common.Hash { return common.Hash{} },
+		Origin:      msg.From(),
+		GasPrice:    new(big.Int).Set(msg.GasPrice()),
+		Coinbase:    header.Coinbase,
+		GasLimit:    new(big.Int).Set(header.GasLimit),
+		BlockNumber: new(big.Int).Set(header.Number),
+		Time:        new(big.Int).Set(header.Time),
+		Difficulty:  new(big.Int).Set(header.Difficulty),
+	}
+	return evm.NewEVM(context, statedb, b.config, vmCfg), func() error { return nil }, nil
+}
+
+func (b *testCallBackend) ChainConfig() *config.ChainConfig {
+	return b.config
+}
+
+// checkRevertError checks that err is the JSON-RPC error of a reverted call
+// with the given message and data.
+func checkRevertError(t *testing.T, name string, err error, message string, data []byte) {
+	if err == nil {
+		t.Errorf("%s: call succeeded, want revert", name)
+		return
+	}
+	if err.Error() != message {
+		t.Errorf("%s: message mismatch: have %q, want %q", name, err.Error(), message)
+	}
+	if coded, ok := err.(rpc.Error); !ok || coded.ErrorCode() != 3 {
+		t.Errorf("%s: error %v has no revert code", name, err)
+	}
+	if withData, ok := err.(rpc.DataError); !ok || withData.ErrorData() != hexutil.Encode(data) {
+		t.Errorf("%s: error %v lacks the revert data %x", name, err, data)
+	}
+}
+
+// Tests that failing calls and gas estimations return a revert error carrying
+// the data the call reverted with, decoding the reason of an Error(string).
+func TestCallRevert(t *testing.T) {
+	api := NewPublicBlockChainAPI(newTestCallBackend(t, nil))
+
+	tests := []struct {
+		name    string
+		to      common.Address
+		message string
+		data    []byte
+	}{
+		{"reason", callTestRevertReason, evm.ErrExecutionReverted.Error() + ": boom", revertData("boom")},
+		{"no data", callTestRevertEmpty, evm.ErrExecutionReverted.Error(), nil},
+		{"invalid opcode", callTestInvalid, evm.ErrExecutionReverted.Error(), nil},
+	}
+	for _, tt := range tests {
+		to := tt.to
+		args := CallArgs{From: callTestSender, To: &to}
+
+		res, err := api.Call(context.Background(), args, rpc.LatestBlockNumber, nil, nil)
+		if res != nil {
+			t.Errorf("%s: call returned %x with the error", tt.name, res)
+		}
+		checkRevertError(t, tt.name+" call", err, tt.message, tt.data)
+
+		_, err = api.EstimateGas(context.Background(), args, nil, nil)
+		checkRevertError(t, tt.name+" estimate", err, tt.message, tt.data)
+	}
+}
+
+// Tests that errors raised before the call is executed are returned as they
+// are instead of as a revert.
+func TestCallNonRevertFailure(t *testing.T) {
+	api := NewPublicBlockChainAPI(newTestCallBackend(t, nil))
+
+	args := CallArgs{From: callTestSender, To: &callTestTarget}
+	overrides := &StateOverride{callTestTarget: {
+		State:     &map[common.Hash]common.Hash{},
+		StateDiff: &map[common.Hash]common.Hash{},
+	}}
+	for name, call := range map[string]func() error{
+		"call": func() error {
+			_, err := api.Call(context.Background(), args, rpc.LatestBlockNumber, overrides, nil)
+			return err
+		},
+		"estimate": func() error {
+			_, err := api.EstimateGas(context.Background(), args, overrides, nil)
+			return err
+		},
+	} {
+		err := call()
+		if err == nil || !strings.Contains(err.Error(), "has both 'state' and 'stateDiff'") {
+			t.Errorf("%s: error mismatch: have %v, want conflicting overrides", name, err)
+		}
+		if _, ok := err.(*revertError); ok {
+			t.Errorf("%s: error %v returned as a revert", name, err)
+		}
+	}
+}
+
+// Tests that state overrides replace the fields of accounts they set, that
+// 'state' replaces the whole storage while 'stateDiff' only the given slots,
+// and that both may not be set for the same account.
+func TestStateOverrideApply(t *testing.T) {
+	var (
+		replaced = common.Address{0x01}
+		patched  = common.Address{0x02}
+		slot1    = common.Hash{0x01}
+		slot2    = common.Hash{0x02}
+	)
+	db, _ := hpbdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	for _, addr := range []common.Address{replaced, patched} {
+		statedb.SetState(addr, slot1, common.Hash{0xaa})
+		statedb.SetState(addr, slot2, common.Hash{0xaa})
+	}
+	var (
+		nonce   = hexutil.Uint64(5)
+		code    = hexutil.Bytes{byte(evm.STOP)}
+		balance = (*hexutil.Big)(big.NewInt(1000))
+	)
+	overrides := &StateOverride{
+		replaced: {
+			Nonce:   &nonce,
+			Code:    &code,
+			Balance: balance,
+			State:   &map[common.Hash]common.Hash{slot1: {0xbb}},
+		},
+		patched: {
+			StateDiff: &map[common.Hash]common.Hash{slot1: {0xbb}},
+		},
+	}
+	if err := overrides.Apply(statedb); err != nil {
+		t.Fatalf("failed to apply overrides: %v", err)
+	}
+	if have := statedb.GetNonce(replaced); have != 5 {
+		t.Errorf("nonce mismatch: have %d, want 5", have)
+	}
+	if have := statedb.GetCode(replaced); !reflect.DeepEqual(have, []byte(code)) {
+		t.Errorf("code mismatch: have %x, want %x", have, code)
+	}
+	if have := statedb.GetBalance(replaced); have.Cmp(balance.ToInt()) != 0 {
+		t.Errorf("balance mismatch: have %v, want %v", have, balance)
+	}
+	if have := statedb.GetState(replaced, slot1); have != (common.Hash{0xbb}) {
+		t.Errorf("replaced slot mismatch: have %x, want %x", have, common.Hash{0xbb})
+	}
+	if have := statedb.GetState(replaced, slot2); have != (common.Hash{}) {
+		t.Errorf("replaced storage kept slot: have %x, want empty", have)
+	}
+	if have := statedb.GetState(patched, slot1); have != (common.Hash{0xbb}) {
+		t.Errorf("patched slot mismatch: have %x, want %x", have, common.Hash{0xbb})
+	}
+	if have := statedb.GetState(patched, slot2); have != (common.Hash{0xaa}) {
+		t.Errorf("patched storage lost slot: have %x, want %x", have, common.Hash{0xaa})
+	}
+
+	conflict := &StateOverride{replaced: {
+		State:     &map[common.Hash]common.Hash{},
+		StateDiff: &map[common.Hash]common.Hash{},
+	}}
+	if err := conflict.Apply(statedb); err == nil || !strings.Contains(err.Error(), "has both 'state' and 'stateDiff'") {
+		t.Errorf("error mismatch: have %v, want conflicting overrides", err)
+	}
+}
+
+// returnWordsCode returns contract code running the given code for every
+// word it returns, each of which leaves the word on the stack.
+func returnWordsCode(words ...[]byte) []byte {
+	var code []byte
+	for i, word := range words {
+		code = append(code, word...)
+		code = append(code, byte(evm.PUSH1), byte(32*i), byte(evm.MSTORE))
+	}
+	return append(code, byte(evm.PUSH1), byte(32*len(words)), byte(evm.PUSH1), 0, byte(evm.RETURN))
+}
+
+// Tests that the balance, nonce, code and storage overrides are seen by the
+// call.
+func TestCallStateOverride(t *testing.T) {
+	api := NewPublicBlockChainAPI(newTestCallBackend(t, nil))
+
+	code := hexutil.Bytes(returnWordsCode(
+		[]byte{byte(evm.ADDRESS), byte(evm.BALANCE)},
+		[]byte{byte(evm.PUSH1), 1, byte(evm.SLOAD)},
+		[]byte{byte(evm.PUSH1), 0, byte(evm.PUSH1), 0, byte(evm.PUSH1), 0, byte(evm.CREATE)},
+	))
+	var (
+		nonce   = hexutil.Uint64(7)
+		balance = (*hexutil.Big)(big.NewInt(1234))
+	)
+	overrides := &StateOverride{
+		callTestTarget: {
+			Nonce:     &nonce,
+			Code:      &code,
+			Balance:   balance,
+			StateDiff: &map[common.Hash]common.Hash{common.BigToHash(big.NewInt(1)): {0xbb}},
+		},
+	}
+	args := CallArgs{From: callTestSender, To: &callTestTarget}
+
+	res, err := api.Call(context.Background(), args, rpc.LatestBlockNumber, overrides, nil)
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	want := append(common.LeftPadBytes(balance.ToInt().Bytes(), 32), common.Hash{0xbb}.Bytes()...)
+	want = append(want, common.LeftPadBytes(crypto.CreateAddress(callTestTarget, 7).Bytes(), 32)...)
+	if !reflect.DeepEqual([]byte(res), want) {
+		t.Errorf("result mismatch:\nhave %x\nwant %x", res, want)
+	}
+	// Without the overrides the target has no code to run
+	if res, err := api.Call(context.Background(), args, rpc.LatestBlockNumber, nil, nil); err != nil || len(res) != 0 {
+		t.Errorf("call without overrides mismatch: have %x, %v, want empty result", res, err)
+	}
+}
+
+// Tests that the block overrides are seen by the call, and that overriding
+// the block number switches the rules of the EVM to those of that block.
+func TestCallBlockOverride(t *testing.T) {
+	var (
+		chainID  = common.Address{0xd1} // Returns the chain id, valid from Istanbul
+		blockEnv = common.Address{0xd2} // Returns the number, time and coinbase
+	)
+	api := NewPublicBlockChainAPI(newTestCallBackend(t, map[common.Address][]byte{
+		chainID: returnWordsCode([]byte{byte(evm.CHAINID)}),
+		blockEnv: returnWordsCode(
+			[]byte{byte(evm.NUMBER)},
+			[]byte{byte(evm.TIMESTAMP)},
+			[]byte{byte(evm.COINBASE)},
+		),
+	}))
+	args := CallArgs{From: callTestSender, To: &chainID}
+
+	// Block 10 of the backend is before Istanbul
+	_, err := api.Call(context.Background(), args, rpc.LatestBlockNumber, nil, nil)
+	checkRevertError(t, "before fork", err, evm.ErrExecutionReverted.Error(), nil)
+
+	overrides := &BlockOverrides{Number: (*hexutil.Big)(big.NewInt(100))}
+	res, err := api.Call(context.Background(), args, rpc.LatestBlockNumber, nil, overrides)
+	if err != nil {
+		t.Fatalf("call at the fork failed: %v", err)
+	}
+	if want := common.LeftPadBytes(config.MainnetChainConfig.ChainId.Bytes(), 32); !reflect.DeepEqual([]byte(res), want) {
+		t.Errorf("chain id mismatch: have %x, want %x", res, want)
+	}
+
+	coinbase := common.Address{0xcb}
+	overrides = &BlockOverrides{
+		Number:   (*hexutil.Big)(big.NewInt(20)),
+		Time:     (*hexutil.Big)(big.NewInt(2000)),
+		Coinbase: &coinbase,
+	}
+	args.To = &blockEnv
+	res, err = api.Call(context.Background(), args, rpc.LatestBlockNumber, nil, overrides)
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	want := append(common.BigToHash(big.NewInt(20)).Bytes(), common.BigToHash(big.NewInt(2000)).Bytes()...)
+	want = append(want, common.LeftPadBytes(coinbase.Bytes(), 32)...)
+	if !reflect.DeepEqual([]byte(res), want) {
+		t.Errorf("block context mismatch:\nhave %x\nwant %x", res, want)
+	}
+}
+
+// Tests that gas estimation applies the overrides to every execution of its
+// binary search, not only to the final one.
+func TestEstimateGasOverride(t *testing.T) {
+	backend := newTestCallBackend(t, nil)
+	api := NewPublicBlockChainAPI(backend)
+
+	// The target only succeeds when its balance is overridden, fails otherwise
+	code := hexutil.Bytes{
+		byte(evm.ADDRESS), byte(evm.BALANCE), byte(evm.PUSH1), 6, byte(evm.JUMPI), 0xfe,
+		byte(evm.JUMPDEST), byte(evm.STOP),
+	}
+	balance := (*hexutil.Big)(big.NewInt(1))
+	overrides := &StateOverride{callTestTarget: {Code: &code, Balance: balance}}
+	args := CallArgs{From: callTestSender, To: &callTestTarget}
+
+	_, used, failed, err := api.doCall(context.Background(), args, rpc.LatestBlockNumber, overrides, nil, evm.Config{})
+	if err != nil || failed {
+		t.Fatalf("call failed: %v", err)
+	}
+	backend.evms = 0
+
+	estimate, err := api.EstimateGas(context.Background(), args, overrides, nil)
+	if err != nil {
+		t.Fatalf("estimation failed: %v", err)
+	}
+	if estimate.ToInt().Cmp(used) != 0 {
+		t.Errorf("estimate mismatch: have %v, want %v", estimate, used)
+	}
+	if backend.evms < 3 {
+		t.Errorf("estimation ran %d calls, want a search", backend.evms)
+	}
+	// Without the balance the target fails with any amount of gas
+	overrides = &StateOverride{callTestTarget: {Code: &code}}
+	_, err = api.EstimateGas(context.Background(), args, overrides, nil)
+	checkRevertError(t, "no balance", err, evm.ErrExecutionReverted.Error(), nil)
+}
@@ -23,6 +23,7 @@ import (
 
 	"github.com/hpb-project/go-hpb/account"
 	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/txpool"
 	"github.com/hpb-project/go-hpb/blockchain/storage"
 	"github.com/hpb-project/go-hpb/blockchain/state"
 	"github.com/hpb-project/go-hpb/blockchain/types"
@@ -64,6 +65,9 @@ type Backend interface {
 	GetPoolNonce(ctx context.Context, addr common.Address) (uint64, error)
 	Stats() (pending int, queued int)
 	TxPoolContent() (map[common.Address]types.Transactions, map[common.Address]types.Transactions)
+	TxPoolAddresses() []common.Address
+	TxPoolContentFrom(addr common.Address) (types.Transactions, types.Transactions)
+	TxPoolAccountStatus(addr common.Address) *txpool.AccountStatus
 	//SubscribeTxPreEvent(chan<- bc.TxPreEvent) sub.Subscription
 
 	ChainConfig() *config.ChainConfig
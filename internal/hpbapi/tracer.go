@@ -316,6 +316,23 @@ func wrapError(context string, err error) error {
 	return fmt.Errorf("%v    in server-side tracer function '%v'", message, context)
 }
 
+// CaptureStart implements the Tracer interface, the JavaScript tracers only
+// see the execution steps.
+func (jst *JavascriptTracer) CaptureStart(env *evm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+// CaptureEnter implements the Tracer interface, nested frames show up in the
+// depth of the traced steps.
+func (jst *JavascriptTracer) CaptureEnter(typ evm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+// CaptureExit implements the Tracer interface.
+func (jst *JavascriptTracer) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	return nil
+}
+
 // CaptureState implements the Tracer interface to trace a single step of VM execution
 func (jst *JavascriptTracer) CaptureState(env *evm.EVM, pc uint64, op evm.OpCode, gas, cost uint64, memory *evm.Memory, stack *evm.Stack, contract *evm.Contract, depth int, err error) error {
 	if jst.err == nil {
@@ -23,9 +23,9 @@ import (
 	"testing"
 	"time"
 
-	"github.com/hpb-project/ghpb/common"
-	"github.com/hpb-project/ghpb/core/vm"
-	"github.com/hpb-project/ghpb/common/constant"
+	"github.com/hpb-project/go-hpb/common"
+	params "github.com/hpb-project/go-hpb/config"
+	vm "github.com/hpb-project/go-hpb/hvm/evm"
 )
 
 type account struct{}
@@ -249,6 +249,16 @@ web3._extend({
 			name: 'chaindbCompact',
 			call: 'debug_chaindbCompact',
 		}),
+		new web3._extend.Method({
+			name: 'dbStats',
+			call: 'debug_dbStats',
+		}),
+		new web3._extend.Method({
+			name: 'verifySnapshot',
+			call: 'debug_verifySnapshot',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
 		new web3._extend.Method({
 			name: 'metrics',
 			call: 'debug_metrics',
@@ -351,12 +361,24 @@ web3._extend({
 			params: 2,
 			inputFormatter: [null, null]
 		}),
+		new web3._extend.Method({
+			name: 'traceCall',
+			call: 'debug_traceCall',
+			params: 3,
+			inputFormatter: [null, web3._extend.formatters.inputBlockNumberFormatter, null]
+		}),
 		new web3._extend.Method({
 			name: 'preimage',
 			call: 'debug_preimage',
 			params: 1,
 			inputFormatter: [null]
 		}),
+		new web3._extend.Method({
+			name: 'vmProfile',
+			call: 'debug_vmProfile',
+			params: 1,
+			inputFormatter: [null]
+		}),
 		new web3._extend.Method({
 			name: 'getBadBlocks',
 			call: 'debug_getBadBlocks',
@@ -405,6 +427,17 @@ web3._extend({
 			call: 'hpb_getRawTransactionByHash',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'sendBundle',
+			call: 'hpb_sendBundle',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'getProof',
+			call: 'hpb_getProof',
+			params: 3,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, null, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
 		new web3._extend.Method({
 			name: 'getRawTransactionFromBlock',
 			call: function(args) {
@@ -456,6 +489,18 @@ web3._extend({
 			call: 'miner_setExtra',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'setGasTarget',
+			call: 'miner_setGasTarget',
+			params: 1,
+			inputFormatter: [web3._extend.utils.fromDecimal]
+		}),
+		new web3._extend.Method({
+			name: 'getMinedBlocks',
+			call: 'miner_getMinedBlocks',
+			params: 2,
+			inputFormatter: [web3._extend.utils.fromDecimal, web3._extend.utils.fromDecimal]
+		}),
 		new web3._extend.Method({
 			name: 'setGasPrice',
 			call: 'miner_setGasPrice',
@@ -580,7 +625,25 @@ web3._extend({
 const TxPool_JS = `
 web3._extend({
 	property: 'txpool',
-	methods: [],
+	methods:
+	[
+		new web3._extend.Method({
+			name: 'contentFrom',
+			call: 'txpool_contentFrom',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'inspectFrom',
+			call: 'txpool_inspectFrom',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'list',
+			call: 'txpool_list',
+			params: 3,
+			inputFormatter: [null, null, null]
+		}),
+	],
 	properties:
 	[
 		new web3._extend.Property({
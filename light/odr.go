@@ -0,0 +1,199 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+// Package light implements on-demand retrieval capable state and chain objects
+// for the Hpb light client.
+package light
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/hpb-project/go-hpb/blockchain"
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/blockchain/types"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/crypto"
+	"github.com/hpb-project/go-hpb/common/rlp"
+	"github.com/hpb-project/go-hpb/common/trie"
+)
+
+// NoOdr is the default context passed to an ODR capable function when the ODR
+// service is not required.
+var NoOdr = context.Background()
+
+var (
+	// ErrNoPeers is returned if no peers capable of serving a queued request are available.
+	ErrNoPeers = errors.New("no suitable peers available")
+
+	// ErrNoTrustedCht is returned if the CHT of a block number is not known locally.
+	ErrNoTrustedCht = errors.New("no trusted canonical hash trie")
+
+	// ErrNoHeader is returned if a header of a block could not be retrieved.
+	ErrNoHeader = errors.New("header not found")
+)
+
+// OdrBackend is an interface to a backend service that handles ODR retrievals.
+type OdrBackend interface {
+	// Database returns the local database the retrieved data is stored into.
+	Database() hpbdb.Database
+
+	// Retrieve fetches the data of the request from the network, verifies it
+	// and stores it into the local database.
+	Retrieve(ctx context.Context, req OdrRequest) error
+}
+
+// OdrRequest is an interface for retrieval requests. The network layer fills
+// the request through Validate, which only accepts data proven against the
+// locally known headers.
+type OdrRequest interface {
+	StoreResult(db hpbdb.Database)
+}
+
+// TrieRequest is the ODR request type for the entry of a key in the account
+// trie or a storage trie of a state.
+type TrieRequest struct {
+	BlockHash common.Hash    // Hash of the block the state belongs to
+	Root      common.Hash    // Root hash of the trie the key is looked up in
+	AccKey    []byte         // Hashed address of the account owning the storage trie, nil for the account trie
+	Key       []byte         // Hashed key to retrieve the proof of
+	Proof     []rlp.RawValue // Merkle proof of the key, filled in by Validate
+}
+
+// Validate checks the merkle proof of the key against the trie root.
+func (req *TrieRequest) Validate(proof []rlp.RawValue) error {
+	if _, err := trie.VerifyProof(req.Root, req.Key, proof); err != nil {
+		return fmt.Errorf("merkle proof verification failed: %v", err)
+	}
+	req.Proof = proof
+	return nil
+}
+
+// StoreResult stores the nodes of the proof into the database.
+func (req *TrieRequest) StoreResult(db hpbdb.Database) {
+	for _, node := range req.Proof {
+		db.Put(crypto.Keccak256(node), node)
+	}
+}
+
+// CodeRequest is the ODR request type for contract code.
+type CodeRequest struct {
+	Hash common.Hash // Hash of the code to retrieve
+	Data []byte      // Code, filled in by Validate
+}
+
+// Validate checks the code against its hash.
+func (req *CodeRequest) Validate(code []byte) error {
+	if hash := crypto.Keccak256Hash(code); hash != req.Hash {
+		return fmt.Errorf("code hash mismatch: have %x, want %x", hash, req.Hash)
+	}
+	req.Data = code
+	return nil
+}
+
+// StoreResult stores the code into the database.
+func (req *CodeRequest) StoreResult(db hpbdb.Database) {
+	db.Put(req.Hash[:], req.Data)
+}
+
+// BlockRequest is the ODR request type for the body of a block.
+type BlockRequest struct {
+	Header *types.Header // Header of the block to retrieve the body of
+	Body   *types.Body   // Body of the block, filled in by Validate
+}
+
+// Validate checks the transactions and uncles against the header.
+func (req *BlockRequest) Validate(body *types.Body) error {
+	if hash := types.DeriveSha(types.Transactions(body.Transactions)); hash != req.Header.TxHash {
+		return fmt.Errorf("transaction root mismatch: have %x, want %x", hash, req.Header.TxHash)
+	}
+	if hash := types.CalcUncleHash(body.Uncles); hash != req.Header.UncleHash {
+		return fmt.Errorf("uncle root mismatch: have %x, want %x", hash, req.Header.UncleHash)
+	}
+	req.Body = body
+	return nil
+}
+
+// StoreResult stores the body into the database.
+func (req *BlockRequest) StoreResult(db hpbdb.Database) {
+	bc.WriteBody(db, req.Header.Hash(), req.Header.Number.Uint64(), req.Body)
+}
+
+// ReceiptsRequest is the ODR request type for the receipts of a block.
+type ReceiptsRequest struct {
+	Header   *types.Header  // Header of the block to retrieve the receipts of
+	Receipts types.Receipts // Receipts of the block, filled in by Validate
+}
+
+// Validate checks the receipts against the header.
+func (req *ReceiptsRequest) Validate(receipts types.Receipts) error {
+	if hash := types.DeriveSha(receipts); hash != req.Header.ReceiptHash {
+		return fmt.Errorf("receipt root mismatch: have %x, want %x", hash, req.Header.ReceiptHash)
+	}
+	req.Receipts = receipts
+	return nil
+}
+
+// StoreResult stores the receipts into the database.
+func (req *ReceiptsRequest) StoreResult(db hpbdb.Database) {
+	bc.WriteBlockReceipts(db, req.Header.Hash(), req.Header.Number.Uint64(), req.Receipts)
+}
+
+// ChtRequest is the ODR request type for a canonical header proven by the
+// canonical hash trie of its section.
+type ChtRequest struct {
+	ChtNum   uint64         // Section of the canonical hash trie
+	BlockNum uint64         // Number of the block to retrieve the header of
+	ChtRoot  common.Hash    // Trusted root of the canonical hash trie
+	Header   *types.Header  // Header of the block, filled in by Validate
+	Td       *big.Int       // Total difficulty of the block, filled in by Validate
+	Proof    []rlp.RawValue // Merkle proof of the block number, filled in by Validate
+}
+
+// Validate checks the header against the entry of its number in the canonical
+// hash trie.
+func (req *ChtRequest) Validate(header *types.Header, proof []rlp.RawValue) error {
+	if header == nil || header.Number.Uint64() != req.BlockNum {
+		return errors.New("header number mismatch")
+	}
+	value, err := trie.VerifyProof(req.ChtRoot, encodeNumber(req.BlockNum), proof)
+	if err != nil {
+		return fmt.Errorf("merkle proof verification failed: %v", err)
+	}
+	if value == nil {
+		return errors.New("block number missing from canonical hash trie")
+	}
+	var node ChtNode
+	if err := rlp.DecodeBytes(value, &node); err != nil {
+		return err
+	}
+	if node.Hash != header.Hash() {
+		return fmt.Errorf("header hash mismatch: have %x, want %x", header.Hash(), node.Hash)
+	}
+	req.Header, req.Td, req.Proof = header, node.Td, proof
+	return nil
+}
+
+// StoreResult stores the header as canonical into the database.
+func (req *ChtRequest) StoreResult(db hpbdb.Database) {
+	hash, number := req.Header.Hash(), req.Header.Number.Uint64()
+
+	bc.WriteHeader(db, req.Header)
+	bc.WriteTd(db, hash, number, req.Td)
+	bc.WriteCanonicalHash(db, hash, number)
+}
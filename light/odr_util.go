@@ -0,0 +1,85 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+
+	"github.com/hpb-project/go-hpb/blockchain"
+	"github.com/hpb-project/go-hpb/blockchain/types"
+	"github.com/hpb-project/go-hpb/common"
+)
+
+// GetHeaderByNumber retrieves the canonical header of a block number, proving
+// it by the canonical hash trie of its section if it is not known locally.
+func GetHeaderByNumber(ctx context.Context, odr OdrBackend, number uint64) (*types.Header, error) {
+	db := odr.Database()
+	if hash := bc.GetCanonicalHash(db, number); hash != (common.Hash{}) {
+		if header := bc.GetHeader(db, hash, number); header != nil {
+			return header, nil
+		}
+	}
+	section := number / ChtFrequency
+	root := GetChtRoot(db, section)
+	if root == (common.Hash{}) {
+		return nil, ErrNoTrustedCht
+	}
+	req := &ChtRequest{ChtNum: section, BlockNum: number, ChtRoot: root}
+	if err := odr.Retrieve(ctx, req); err != nil {
+		return nil, err
+	}
+	return req.Header, nil
+}
+
+// GetBody retrieves the body of the block of the given header.
+func GetBody(ctx context.Context, odr OdrBackend, header *types.Header) (*types.Body, error) {
+	if header.TxHash == types.EmptyRootHash && header.UncleHash == types.EmptyUncleHash {
+		return &types.Body{}, nil
+	}
+	if body := bc.GetBody(odr.Database(), header.Hash(), header.Number.Uint64()); body != nil {
+		return body, nil
+	}
+	req := &BlockRequest{Header: header}
+	if err := odr.Retrieve(ctx, req); err != nil {
+		return nil, err
+	}
+	return req.Body, nil
+}
+
+// GetBlock retrieves the block of the given header.
+func GetBlock(ctx context.Context, odr OdrBackend, header *types.Header) (*types.Block, error) {
+	body, err := GetBody(ctx, odr, header)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewBlockWithHeader(header).WithBody(body.Transactions, body.Uncles), nil
+}
+
+// GetBlockReceipts retrieves the receipts of the block of the given header.
+func GetBlockReceipts(ctx context.Context, odr OdrBackend, header *types.Header) (types.Receipts, error) {
+	if header.ReceiptHash == types.EmptyRootHash {
+		return types.Receipts{}, nil
+	}
+	if receipts := bc.GetBlockReceipts(odr.Database(), header.Hash(), header.Number.Uint64()); receipts != nil {
+		return receipts, nil
+	}
+	req := &ReceiptsRequest{Header: header}
+	if err := odr.Retrieve(ctx, req); err != nil {
+		return nil, err
+	}
+	return req.Receipts, nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"encoding/binary"
+	"math/big"
+	"time"
+
+	"github.com/hpb-project/go-hpb/blockchain"
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/blockchain/types"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/log"
+	"github.com/hpb-project/go-hpb/common/rlp"
+	"github.com/hpb-project/go-hpb/common/trie"
+)
+
+const (
+	// ChtFrequency is the number of blocks a canonical hash trie section covers.
+	ChtFrequency = 4096
+
+	// ChtConfirmations is the number of confirmations before a section is
+	// considered final and its canonical hash trie is built.
+	ChtConfirmations = 256
+
+	// chtThrottling is the time to wait between processing two consecutive
+	// sections.
+	chtThrottling = 100 * time.Millisecond
+)
+
+var (
+	chtTablePrefix = "cht-"             // chtTablePrefix + hash -> canonical hash trie node
+	chtIndexPrefix = "chtIndex-"        // chtIndexPrefix + key -> chain indexer metadata
+	chtRootPrefix  = []byte("chtRoot-") // chtRootPrefix + section (uint64 big endian) -> trie root hash
+)
+
+// ChtNode is the value stored for a block number in the canonical hash trie.
+type ChtNode struct {
+	Hash common.Hash
+	Td   *big.Int
+}
+
+// encodeNumber encodes a block number as a canonical hash trie key.
+func encodeNumber(number uint64) []byte {
+	enc := make([]byte, 8)
+	binary.BigEndian.PutUint64(enc, number)
+	return enc
+}
+
+// GetChtRoot retrieves the root of the canonical hash trie of a section, or the
+// zero hash if it was not built yet.
+func GetChtRoot(db hpbdb.Database, section uint64) common.Hash {
+	data, _ := db.Get(append(chtRootPrefix, encodeNumber(section)...))
+	return common.BytesToHash(data)
+}
+
+// StoreChtRoot stores the root of the canonical hash trie of a section.
+func StoreChtRoot(db hpbdb.Putter, section uint64, root common.Hash) error {
+	return db.Put(append(chtRootPrefix, encodeNumber(section)...), root.Bytes())
+}
+
+// ChtTable returns the view of the database holding the canonical hash trie
+// nodes, kept apart from the state trie nodes.
+func ChtTable(db hpbdb.Database) hpbdb.Database {
+	return hpbdb.NewTable(db, chtTablePrefix)
+}
+
+// ChtIndexerBackend implements bc.ChainIndexerBackend, building a trie mapping
+// the block numbers of a section to their canonical hash and total difficulty.
+// Every section's trie continues the one of the previous section.
+type ChtIndexerBackend struct {
+	db    hpbdb.Database
+	table hpbdb.Database
+
+	section uint64
+	trie    *trie.Trie
+}
+
+// NewChtIndexer returns a chain indexer that generates the canonical hash tries
+// of the chain, so headers can be proven to light clients.
+func NewChtIndexer(db hpbdb.Database) *bc.ChainIndexer {
+	backend := &ChtIndexerBackend{
+		db:    db,
+		table: ChtTable(db),
+	}
+	index := hpbdb.NewTable(db, chtIndexPrefix)
+
+	return bc.NewChainIndexer(db, index, backend, ChtFrequency, ChtConfirmations, chtThrottling, "cht")
+}
+
+// Reset implements bc.ChainIndexerBackend, opening the trie of the previous
+// section to continue it.
+func (c *ChtIndexerBackend) Reset(section uint64) {
+	var root common.Hash
+	if section > 0 {
+		root = GetChtRoot(c.db, section-1)
+	}
+	var err error
+	if c.trie, err = trie.New(root, c.table); err != nil {
+		log.Error("Failed to open canonical hash trie, rebuilding", "section", section, "err", err)
+		c.trie, _ = trie.New(common.Hash{}, c.table)
+	}
+	c.section = section
+}
+
+// Process implements bc.ChainIndexerBackend, adding the canonical hash and
+// total difficulty of a header into the trie.
+func (c *ChtIndexerBackend) Process(header *types.Header) {
+	hash, number := header.Hash(), header.Number.Uint64()
+
+	data, _ := rlp.EncodeToBytes(ChtNode{Hash: hash, Td: bc.GetTd(c.db, hash, number)})
+	c.trie.Update(encodeNumber(number), data)
+}
+
+// Commit implements bc.ChainIndexerBackend, writing the trie of the section
+// out into the database.
+func (c *ChtIndexerBackend) Commit() error {
+	batch := c.table.NewBatch()
+	root, err := c.trie.CommitTo(batch)
+	if err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	log.Info("Stored canonical hash trie", "section", c.section, "root", root)
+	return StoreChtRoot(c.db, c.section, root)
+}
+
+// ProveCht returns the merkle proof of a block number in the canonical hash
+// trie of a section, nil if the trie is not available.
+func ProveCht(db hpbdb.Database, section, number uint64) []rlp.RawValue {
+	root := GetChtRoot(db, section)
+	if root == (common.Hash{}) {
+		return nil
+	}
+	tr, err := trie.New(root, ChtTable(db))
+	if err != nil {
+		return nil
+	}
+	return tr.Prove(encodeNumber(number))
+}
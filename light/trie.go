@@ -0,0 +1,194 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hpb-project/go-hpb/blockchain/state"
+	"github.com/hpb-project/go-hpb/blockchain/types"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/crypto"
+	"github.com/hpb-project/go-hpb/common/rlp"
+	"github.com/hpb-project/go-hpb/common/trie"
+)
+
+var emptyCodeHash = crypto.Keccak256Hash(nil)
+
+// NewState creates a state of the given header whose tries and code are
+// retrieved from the network on demand.
+func NewState(ctx context.Context, head *types.Header, odr OdrBackend) (*state.StateDB, error) {
+	return state.New(head.Root, NewStateDatabase(ctx, head, odr))
+}
+
+// NewStateDatabase creates a state.Database retrieving the missing parts of the
+// state of the given header through the ODR backend.
+func NewStateDatabase(ctx context.Context, head *types.Header, odr OdrBackend) state.Database {
+	return &odrDatabase{ctx: ctx, blockHash: head.Hash(), backend: odr}
+}
+
+type odrDatabase struct {
+	ctx       context.Context
+	blockHash common.Hash
+	backend   OdrBackend
+}
+
+func (db *odrDatabase) OpenTrie(root common.Hash) (state.Trie, error) {
+	return &odrTrie{db: db, root: root}, nil
+}
+
+func (db *odrDatabase) OpenStorageTrie(addrHash, root common.Hash) (state.Trie, error) {
+	return &odrTrie{db: db, root: root, accKey: addrHash[:]}, nil
+}
+
+func (db *odrDatabase) CopyTrie(t state.Trie) state.Trie {
+	switch t := t.(type) {
+	case *odrTrie:
+		cpy := &odrTrie{db: t.db, root: t.root, accKey: t.accKey, err: t.err}
+		if t.trie != nil {
+			tr := *t.trie
+			cpy.trie = &tr
+		}
+		return cpy
+	default:
+		// Tries of other databases can't be retrieved from the network, every
+		// access of the copy fails instead
+		return &odrTrie{db: db, root: t.Hash(), err: fmt.Errorf("unknown trie type %T", t)}
+	}
+}
+
+func (db *odrDatabase) ContractCode(addrHash, codeHash common.Hash) ([]byte, error) {
+	if codeHash == emptyCodeHash {
+		return nil, nil
+	}
+	if code, err := db.backend.Database().Get(codeHash[:]); err == nil {
+		return code, nil
+	}
+	req := &CodeRequest{Hash: codeHash}
+	if err := db.backend.Retrieve(db.ctx, req); err != nil {
+		return nil, err
+	}
+	return req.Data, nil
+}
+
+func (db *odrDatabase) ContractCodeSize(addrHash, codeHash common.Hash) (int, error) {
+	code, err := db.ContractCode(addrHash, codeHash)
+	return len(code), err
+}
+
+func (db *odrDatabase) NodeCache() *trie.NodeCache {
+	return nil
+}
+
+// odrTrie is a secure trie whose missing nodes are retrieved along with the
+// merkle proof of the key being accessed.
+type odrTrie struct {
+	db     *odrDatabase
+	root   common.Hash
+	accKey []byte
+	trie   *trie.Trie
+	err    error // set if the trie can't be resolved at all
+}
+
+func (t *odrTrie) TryGet(key []byte) ([]byte, error) {
+	key = crypto.Keccak256(key)
+	var res []byte
+	err := t.do(key, func() (err error) {
+		res, err = t.trie.TryGet(key)
+		return err
+	})
+	return res, err
+}
+
+func (t *odrTrie) TryUpdate(key, value []byte) error {
+	key = crypto.Keccak256(key)
+	return t.do(key, func() error {
+		return t.trie.TryUpdate(key, value)
+	})
+}
+
+func (t *odrTrie) TryDelete(key []byte) error {
+	key = crypto.Keccak256(key)
+	return t.do(key, func() error {
+		return t.trie.TryDelete(key)
+	})
+}
+
+func (t *odrTrie) CommitTo(trie.DatabaseWriter) (common.Hash, error) {
+	return common.Hash{}, errors.New("not implemented in light client state")
+}
+
+func (t *odrTrie) CommitToCallback(trie.DatabaseWriter, trie.LeafCallback) (common.Hash, error) {
+	return common.Hash{}, errors.New("not implemented in light client state")
+}
+
+func (t *odrTrie) Hash() common.Hash {
+	if t.trie == nil {
+		return t.root
+	}
+	return t.trie.Hash()
+}
+
+func (t *odrTrie) NodeIterator(startKey []byte) trie.NodeIterator {
+	if t.trie == nil {
+		tr, _ := trie.New(common.Hash{}, nil)
+		return tr.NodeIterator(startKey)
+	}
+	return t.trie.NodeIterator(startKey)
+}
+
+func (t *odrTrie) GetKey(sha []byte) []byte {
+	return nil
+}
+
+func (t *odrTrie) Prove(key []byte) []rlp.RawValue {
+	key = crypto.Keccak256(key)
+	var proof []rlp.RawValue
+	if err := t.do(key, func() error {
+		proof = t.trie.Prove(key)
+		return nil
+	}); err != nil {
+		return nil
+	}
+	return proof
+}
+
+// do runs fn on the trie, retrieving the proof of the key and retrying as
+// long as fn fails because of a missing node.
+func (t *odrTrie) do(key []byte, fn func() error) error {
+	if t.err != nil {
+		return t.err
+	}
+	for {
+		var err error
+		if t.trie == nil {
+			t.trie, err = trie.New(t.root, t.db.backend.Database())
+		}
+		if err == nil {
+			err = fn()
+		}
+		if _, ok := err.(*trie.MissingNodeError); !ok {
+			return err
+		}
+		req := &TrieRequest{BlockHash: t.db.blockHash, Root: t.root, AccKey: t.accKey, Key: key}
+		if err := t.db.backend.Retrieve(t.db.ctx, req); err != nil {
+			return err
+		}
+	}
+}
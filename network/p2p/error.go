@@ -138,6 +138,7 @@ var (
 // protocal
 var (
 	errProtNoStatusCB             = errors.New("protocol this is no status callback")
+	errProtNoForkIDCB             = errors.New("protocol this is no fork id callback")
 )
 
 // Peer
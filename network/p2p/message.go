@@ -65,6 +65,24 @@ const (
 	ReceiptsMsg        uint64 = 0x201c
 
 	NewHashBlockMsg    uint64 = 0x2020
+
+	GetAccountRangeMsg  uint64 = 0x2021
+	AccountRangeMsg     uint64 = 0x2022
+	GetStorageRangesMsg uint64 = 0x2023
+	StorageRangesMsg    uint64 = 0x2024
+	GetByteCodesMsg     uint64 = 0x2025
+	ByteCodesMsg        uint64 = 0x2026
+
+	GetProofsMsg        uint64 = 0x2027
+	ProofsMsg           uint64 = 0x2028
+	GetCodeMsg          uint64 = 0x2029
+	CodeMsg             uint64 = 0x202a
+	GetHeaderProofsMsg  uint64 = 0x202b
+	HeaderProofsMsg     uint64 = 0x202c
+	GetLightBodiesMsg   uint64 = 0x202d
+	LightBodiesMsg      uint64 = 0x202e
+	GetLightReceiptsMsg uint64 = 0x202f
+	LightReceiptsMsg    uint64 = 0x2030
 )
 
 
@@ -91,6 +91,14 @@ var (
 	reqReceiptInTrafficMeter  = metrics.NewMeter("hpb/req/receipts/in/traffic")
 	reqReceiptOutPacketsMeter = metrics.NewMeter("hpb/req/receipts/out/packets")
 	reqReceiptOutTrafficMeter = metrics.NewMeter("hpb/req/receipts/out/traffic")
+	reqSnapInPacketsMeter     = metrics.NewMeter("hpb/req/snap/in/packets")
+	reqSnapInTrafficMeter     = metrics.NewMeter("hpb/req/snap/in/traffic")
+	reqSnapOutPacketsMeter    = metrics.NewMeter("hpb/req/snap/out/packets")
+	reqSnapOutTrafficMeter    = metrics.NewMeter("hpb/req/snap/out/traffic")
+	reqLightInPacketsMeter    = metrics.NewMeter("hpb/req/light/in/packets")
+	reqLightInTrafficMeter    = metrics.NewMeter("hpb/req/light/in/traffic")
+	reqLightOutPacketsMeter   = metrics.NewMeter("hpb/req/light/out/packets")
+	reqLightOutTrafficMeter   = metrics.NewMeter("hpb/req/light/out/traffic")
 	miscInPacketsMeter        = metrics.NewMeter("hpb/misc/in/packets")
 	miscInTrafficMeter        = metrics.NewMeter("hpb/misc/in/traffic")
 	miscOutPacketsMeter       = metrics.NewMeter("hpb/misc/out/packets")
@@ -129,6 +137,10 @@ func (rw *meteredMsgReadWriter) ReadMsg() (Msg, error) {
 
 	case msg.Code == NodeDataMsg:
 		packets, traffic = reqStateInPacketsMeter, reqStateInTrafficMeter
+	case msg.Code == AccountRangeMsg, msg.Code == StorageRangesMsg, msg.Code == ByteCodesMsg:
+		packets, traffic = reqSnapInPacketsMeter, reqSnapInTrafficMeter
+	case msg.Code == ProofsMsg, msg.Code == CodeMsg, msg.Code == HeaderProofsMsg, msg.Code == LightBodiesMsg, msg.Code == LightReceiptsMsg:
+		packets, traffic = reqLightInPacketsMeter, reqLightInTrafficMeter
 	case msg.Code == ReceiptsMsg:
 		packets, traffic = reqReceiptInPacketsMeter, reqReceiptInTrafficMeter
 
@@ -156,6 +168,10 @@ func (rw *meteredMsgReadWriter) WriteMsg(msg Msg) error {
 
 	case msg.Code == NodeDataMsg:
 		packets, traffic = reqStateOutPacketsMeter, reqStateOutTrafficMeter
+	case msg.Code == AccountRangeMsg, msg.Code == StorageRangesMsg, msg.Code == ByteCodesMsg:
+		packets, traffic = reqSnapOutPacketsMeter, reqSnapOutTrafficMeter
+	case msg.Code == ProofsMsg, msg.Code == CodeMsg, msg.Code == HeaderProofsMsg, msg.Code == LightBodiesMsg, msg.Code == LightReceiptsMsg:
+		packets, traffic = reqLightOutPacketsMeter, reqLightOutTrafficMeter
 	case msg.Code == ReceiptsMsg:
 		packets, traffic = reqReceiptOutPacketsMeter, reqReceiptOutTrafficMeter
 
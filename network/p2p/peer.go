@@ -29,6 +29,7 @@ import (
 	"github.com/hpb-project/go-hpb/common/rlp"
 	"github.com/hpb-project/go-hpb/event"
 	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/config"
 	"math/big"
 	"gopkg.in/fatih/set.v0"
 	"errors"
@@ -87,6 +88,16 @@ type statusData struct {
 	TD              *big.Int
 	CurrentBlock    common.Hash
 	GenesisBlock    common.Hash
+	ForkID          config.ForkID
+}
+
+// statusData100 is the status message of hpb/100, which predates the fork ID.
+type statusData100 struct {
+	ProtocolVersion uint32
+	NetworkId       uint64
+	TD              *big.Int
+	CurrentBlock    common.Hash
+	GenesisBlock    common.Hash
 }
 type hardwareTable struct {
 	Version uint32
@@ -407,6 +418,21 @@ func countMatchingProtocols(protocols []Protocol, caps []Cap) int {
 	return n
 }
 
+// matchProtocol returns the highest version of the local protocols that the
+// remote side also supports.
+func matchProtocol(protocols []Protocol, caps []Cap) Protocol {
+	match := protocols[0]
+	found := false
+	for _, cap := range caps {
+		for _, proto := range protocols {
+			if proto.Name == cap.Name && proto.Version == cap.Version && (!found || proto.Version > match.Version) {
+				match, found = proto, true
+			}
+		}
+	}
+	return match
+}
+
 func (p *PeerBase) startProtocols(writeStart <-chan struct{}, writeErr chan<- error) {
 
 	p.wg.Add(1)
@@ -573,24 +599,35 @@ func SendData(p *Peer, msgCode uint64, data interface{}) error {
 }
 
 // Handshake executes the eth protocol handshake, negotiating version number,
-// network IDs, difficulties, head and genesis blocks.
-func (p *Peer) Handshake(network uint64,td *big.Int, head common.Hash, genesis common.Hash) error {
+// network IDs, difficulties, head and genesis blocks and fork IDs.
+func (p *Peer) Handshake(network uint64,td *big.Int, head common.Hash, genesis common.Hash, forkID config.ForkID, forkFilter ForkFilterCB) error {
 	// Send out own handshake in a new thread
 	errc := make(chan error, 2)
 	var status statusData // safe to read after two values have been received from errc
 
 	go func() {
 		p.log.Debug("Do hpb handshake send.","networkid",network,"genesis",genesis,"block",head,"td",td,"head",head)
+		if p.version < ProtoVersion101 {
+			errc <- SendData(p,StatusMsg, &statusData100{
+				ProtocolVersion: uint32(p.version),
+				NetworkId:       network,
+				TD:              td,
+				CurrentBlock:    head,
+				GenesisBlock:    genesis,
+			})
+			return
+		}
 		errc <- SendData(p,StatusMsg, &statusData{
 			ProtocolVersion: uint32(p.version),
 			NetworkId:       network,
 			TD:              td,
 			CurrentBlock:    head,
 			GenesisBlock:    genesis,
+			ForkID:          forkID,
 		})
 	}()
 	go func() {
-		errc <- p.readStatus(network, &status, genesis)
+		errc <- p.readStatus(network, &status, genesis, forkFilter)
 		p.log.Debug("Do hpb handshake recv.","networkid",status.NetworkId,"genesis",status.GenesisBlock,"block",status.CurrentBlock,"td",p.td,"head", p.head)
 	}()
 
@@ -610,7 +647,7 @@ func (p *Peer) Handshake(network uint64,td *big.Int, head common.Hash, genesis c
 	return nil
 }
 
-func (p *Peer) readStatus(network uint64, status *statusData, genesis common.Hash) (err error) {
+func (p *Peer) readStatus(network uint64, status *statusData, genesis common.Hash, forkFilter ForkFilterCB) (err error) {
 	msg, err := p.rw.ReadMsg()
 	if err != nil {
 		return err
@@ -619,8 +656,21 @@ func (p *Peer) readStatus(network uint64, status *statusData, genesis common.Has
 		return ErrResp(ErrNoStatusMsg, "first msg has code %x (!= %x)", msg.Code, StatusMsg)
 	}
 
-	// Decode the handshake and make sure everything matches
-	if err := msg.Decode(&status); err != nil {
+	// Decode the handshake and make sure everything matches, hpb/100 peers
+	// don't send a fork ID
+	if p.version < ProtoVersion101 {
+		var old statusData100
+		if err := msg.Decode(&old); err != nil {
+			return ErrResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		*status = statusData{
+			ProtocolVersion: old.ProtocolVersion,
+			NetworkId:       old.NetworkId,
+			TD:              old.TD,
+			CurrentBlock:    old.CurrentBlock,
+			GenesisBlock:    old.GenesisBlock,
+		}
+	} else if err := msg.Decode(&status); err != nil {
 		return ErrResp(ErrDecode, "msg %v: %v", msg, err)
 	}
 	if status.GenesisBlock != genesis {
@@ -632,6 +682,11 @@ func (p *Peer) readStatus(network uint64, status *statusData, genesis common.Has
 	if uint(status.ProtocolVersion) != p.version {
 		return ErrResp(ErrProtocolVersionMismatch, "%d (!= %d)", status.ProtocolVersion, p.version)
 	}
+	if p.version >= ProtoVersion101 {
+		if err := forkFilter(status.ForkID); err != nil {
+			return ErrResp(ErrForkIDRejected, "%v", err)
+		}
+	}
 
 	return nil
 }
@@ -474,6 +474,12 @@ func (prm *PeerManager) RegChanStatus(cb ChanStatusCB) {
 	return
 }
 
+func (prm *PeerManager) RegForkID(id ForkIDCB, filter ForkFilterCB) {
+	prm.hpbpro.regForkID(id, filter)
+	log.Debug("ForkID has been register")
+	return
+}
+
 
 func (prm *PeerManager) RegOnAddPeer(cb OnAddPeerCB) {
 	prm.hpbpro.regOnAddPeer(cb)
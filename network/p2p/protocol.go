@@ -21,6 +21,7 @@ import (
 	"math/big"
 	"github.com/hpb-project/go-hpb/common"
 	"github.com/hpb-project/go-hpb/common/log"
+	"github.com/hpb-project/go-hpb/config"
 	"github.com/hpb-project/go-hpb/network/p2p/discover"
 	"time"
 	"runtime/debug"
@@ -53,17 +54,23 @@ type HpbProto struct {
 
 	msgProcess  map[uint64]MsgProcessCB
 	chanStatus  ChanStatusCB
+	forkID      ForkIDCB
+	forkFilter  ForkFilterCB
 	onAddPeer   OnAddPeerCB
 	onDropPeer  OnDropPeerCB
 }
 
 // HPB 支持的协议消息
 const ProtoName        = "hpb"
-var ProtocolVersions   = []uint{ProtoVersion100}
+var ProtocolVersions   = []uint{ProtoVersion102, ProtoVersion101, ProtoVersion100}
 const ProtoVersion100  uint   =  100
+const ProtoVersion101  uint   =  101 // Fork ID in the status message
+const ProtoVersion102  uint   =  102 // State snapshot ranges and light client requests
 
 type MsgProcessCB func(p *Peer, msg Msg) error
 type ChanStatusCB func()(td *big.Int, currentBlock common.Hash, genesisBlock common.Hash)
+type ForkIDCB     func() config.ForkID
+type ForkFilterCB func(id config.ForkID) error
 
 type OnAddPeerCB  func(p *Peer) error
 type OnDropPeerCB func(p *Peer) error
@@ -78,6 +85,7 @@ const (
 	ErrGenesisBlockMismatch
 	ErrNoStatusMsg
 	ErrNoExchangeMsg
+	ErrForkIDRejected
 )
 
 func NewProtos() *HpbProto {
@@ -87,6 +95,7 @@ func NewProtos() *HpbProto {
 	}
 
 	for _, version := range ProtocolVersions {
+		version := version // closure
 		hpb.protos = append(hpb.protos, Protocol{
 			Name:    ProtoName,
 			Version: version,
@@ -150,8 +159,12 @@ func (hp *HpbProto) handle(p *Peer) error {
 		p.log.Error("this no chan status callback")
 		return errProtNoStatusCB
 	}
+	if hp.forkID == nil || hp.forkFilter == nil {
+		p.log.Error("this no fork id callback")
+		return errProtNoForkIDCB
+	}
 	td, head, genesis := hp.chanStatus()
-	if err := p.Handshake(hp.networkId, td, head, genesis); err != nil {
+	if err := p.Handshake(hp.networkId, td, head, genesis, hp.forkID(), hp.forkFilter); err != nil {
 		p.log.Error("Handshake failed in handle peer.", "err", err)
 		return err
 	}
@@ -197,6 +210,11 @@ func (hp *HpbProto) regChanStatus(cb ChanStatusCB) {
 	hp.chanStatus = cb
 }
 
+func (hp *HpbProto) regForkID(id ForkIDCB, filter ForkFilterCB) {
+	hp.forkID = id
+	hp.forkFilter = filter
+}
+
 func (hp *HpbProto) regOnAddPeer(cb OnAddPeerCB) {
 	hp.onAddPeer = cb
 }
@@ -254,6 +272,21 @@ func (hp *HpbProto) handleMsg(p *Peer) error {
 		}
 		return nil
 
+	case GetAccountRangeMsg,GetStorageRangesMsg,GetByteCodesMsg,AccountRangeMsg,StorageRangesMsg,ByteCodesMsg:
+		if cb := hp.msgProcess[msg.Code]; cb != nil{
+			err := cb(p,msg)
+			p.log.Trace("Process syn snapshot msg","msg",msg,"err",err)
+		}
+		return nil
+
+	case GetProofsMsg,GetCodeMsg,GetHeaderProofsMsg,GetLightBodiesMsg,GetLightReceiptsMsg,
+		ProofsMsg,CodeMsg,HeaderProofsMsg,LightBodiesMsg,LightReceiptsMsg:
+		if cb := hp.msgProcess[msg.Code]; cb != nil{
+			err := cb(p,msg)
+			p.log.Trace("Process light msg","msg",msg,"err",err)
+		}
+		return nil
+
 	case NewBlockHashesMsg,NewBlockMsg,NewHashBlockMsg,TxMsg:
 		if cb := hp.msgProcess[msg.Code]; cb != nil{
 			err := cb(p,msg)
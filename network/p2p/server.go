@@ -514,7 +514,7 @@ running:
 			err := srv.protoHandshakeChecks(peers, c)
 			if err == nil {
 				// The handshakes are done and it passed all checks.
-				p := newPeerBase(c, srv.Protocols[0], srv.ntab)
+				p := newPeerBase(c, matchProtocol(srv.Protocols, c.their.Caps), srv.ntab)
 				// If message events are enabled, pass the peerFeed
 				// to the peer
 				if srv.EnableMsgEvents {
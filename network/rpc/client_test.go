@@ -49,6 +49,24 @@ func TestClientRequest(t *testing.T) {
 	}
 }
 
+func TestClientErrorData(t *testing.T) {
+	server := newTestServer("service", new(Service))
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	err := client.Call(nil, "service_returnError")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if code := err.(Error).ErrorCode(); code != 3 {
+		t.Errorf("wrong error code: have %d, want 3", code)
+	}
+	if data := err.(DataError).ErrorData(); data != "0xdead" {
+		t.Errorf("wrong error data: have %v, want 0xdead", data)
+	}
+}
+
 func TestClientBatchRequest(t *testing.T) {
 	server := newTestServer("service", new(Service))
 	defer server.Stop()
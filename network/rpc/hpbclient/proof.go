@@ -0,0 +1,187 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package hpbclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/hpb-project/go-hpb/blockchain/state"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/crypto"
+	"github.com/hpb-project/go-hpb/common/hexutil"
+	"github.com/hpb-project/go-hpb/common/rlp"
+	"github.com/hpb-project/go-hpb/common/trie"
+)
+
+var (
+	// emptyRoot is the known root hash of an empty trie.
+	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+	// emptyCode is the known hash of the empty EVM bytecode.
+	emptyCode = crypto.Keccak256Hash(nil)
+)
+
+// AccountResult is the merkle proof of an account and of some of its storage
+// slots against the state root of a block.
+type AccountResult struct {
+	Address      common.Address  `json:"address"`
+	AccountProof []string        `json:"accountProof"`
+	Balance      *big.Int        `json:"balance"`
+	CodeHash     common.Hash     `json:"codeHash"`
+	Nonce        uint64          `json:"nonce"`
+	StorageHash  common.Hash     `json:"storageHash"`
+	StorageProof []StorageResult `json:"storageProof"`
+}
+
+// StorageResult is the merkle proof of a storage slot against the storage root
+// of its account.
+type StorageResult struct {
+	Key   common.Hash `json:"key"`
+	Value *big.Int    `json:"value"`
+	Proof []string    `json:"proof"`
+}
+
+// GetProof returns the account and storage values of the specified account
+// along with their merkle proofs. If blockNumber is nil, the latest known block
+// is used. The result can be checked against the state root of the block with
+// VerifyProof.
+func (ec *Client) GetProof(ctx context.Context, account common.Address, keys []common.Hash, blockNumber *big.Int) (*AccountResult, error) {
+	type storageResult struct {
+		Key   string       `json:"key"`
+		Value *hexutil.Big `json:"value"`
+		Proof []string     `json:"proof"`
+	}
+	type accountResult struct {
+		Address      common.Address  `json:"address"`
+		AccountProof []string        `json:"accountProof"`
+		Balance      *hexutil.Big    `json:"balance"`
+		CodeHash     common.Hash     `json:"codeHash"`
+		Nonce        hexutil.Uint64  `json:"nonce"`
+		StorageHash  common.Hash     `json:"storageHash"`
+		StorageProof []storageResult `json:"storageProof"`
+	}
+	storageKeys := make([]string, len(keys))
+	for i, key := range keys {
+		storageKeys[i] = key.Hex()
+	}
+	var res accountResult
+	if err := ec.c.CallContext(ctx, &res, "hpb_getProof", account, storageKeys, toBlockNumArg(blockNumber)); err != nil {
+		return nil, err
+	}
+	result := &AccountResult{
+		Address:      res.Address,
+		AccountProof: res.AccountProof,
+		Balance:      (*big.Int)(res.Balance),
+		CodeHash:     res.CodeHash,
+		Nonce:        uint64(res.Nonce),
+		StorageHash:  res.StorageHash,
+		StorageProof: make([]StorageResult, len(res.StorageProof)),
+	}
+	for i, proof := range res.StorageProof {
+		result.StorageProof[i] = StorageResult{
+			Key:   common.HexToHash(proof.Key),
+			Value: (*big.Int)(proof.Value),
+			Proof: proof.Proof,
+		}
+	}
+	return result, nil
+}
+
+// VerifyProof checks that the account and storage values of a proof are the
+// ones committed to by the given state root.
+func VerifyProof(root common.Hash, result *AccountResult) error {
+	if result.Balance == nil {
+		return fmt.Errorf("account %x: missing balance", result.Address)
+	}
+	proof, err := decodeProof(result.AccountProof)
+	if err != nil {
+		return fmt.Errorf("account %x: %v", result.Address, err)
+	}
+	blob, err := trie.VerifyProof(root, crypto.Keccak256(result.Address[:]), proof)
+	if err != nil {
+		return fmt.Errorf("account %x: %v", result.Address, err)
+	}
+	// A proven absent account must be reported empty
+	account := state.Account{Balance: new(big.Int), Root: emptyRoot, CodeHash: emptyCode[:]}
+	if blob != nil {
+		if err := rlp.DecodeBytes(blob, &account); err != nil {
+			return fmt.Errorf("account %x: invalid account: %v", result.Address, err)
+		}
+	}
+	switch {
+	case account.Nonce != result.Nonce:
+		return fmt.Errorf("account %x: nonce mismatch: proven %d, reported %d", result.Address, account.Nonce, result.Nonce)
+	case account.Balance.Cmp(result.Balance) != 0:
+		return fmt.Errorf("account %x: balance mismatch: proven %v, reported %v", result.Address, account.Balance, result.Balance)
+	case account.Root != result.StorageHash:
+		return fmt.Errorf("account %x: storage root mismatch: proven %x, reported %x", result.Address, account.Root, result.StorageHash)
+	case !bytes.Equal(account.CodeHash, result.CodeHash[:]):
+		return fmt.Errorf("account %x: code hash mismatch: proven %x, reported %x", result.Address, account.CodeHash, result.CodeHash)
+	}
+	for _, slot := range result.StorageProof {
+		if err := verifyStorageProof(account.Root, slot); err != nil {
+			return fmt.Errorf("account %x: storage %x: %v", result.Address, slot.Key, err)
+		}
+	}
+	return nil
+}
+
+// verifyStorageProof checks that the value of a storage slot is the one
+// committed to by the storage root.
+func verifyStorageProof(root common.Hash, slot StorageResult) error {
+	if slot.Value == nil {
+		return fmt.Errorf("missing value")
+	}
+	proof, err := decodeProof(slot.Proof)
+	if err != nil {
+		return err
+	}
+	// The empty trie has no nodes, so nothing to prove against
+	var blob []byte
+	if root != emptyRoot || len(proof) > 0 {
+		if blob, err = trie.VerifyProof(root, crypto.Keccak256(slot.Key[:]), proof); err != nil {
+			return err
+		}
+	}
+	value := new(big.Int)
+	if blob != nil {
+		_, content, _, err := rlp.Split(blob)
+		if err != nil {
+			return fmt.Errorf("invalid value: %v", err)
+		}
+		value.SetBytes(content)
+	}
+	if value.Cmp(slot.Value) != 0 {
+		return fmt.Errorf("value mismatch: proven %v, reported %v", value, slot.Value)
+	}
+	return nil
+}
+
+func decodeProof(proof []string) ([]rlp.RawValue, error) {
+	nodes := make([]rlp.RawValue, len(proof))
+	for i, node := range proof {
+		blob, err := hexutil.Decode(node)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proof node %d: %v", i, err)
+		}
+		nodes[i] = blob
+	}
+	return nodes, nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package hpbclient
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/hpb-project/go-hpb/blockchain/state"
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/hexutil"
+	"github.com/hpb-project/go-hpb/common/rlp"
+)
+
+// proveAccount builds the proof the RPC server would return.
+func proveAccount(t *testing.T, statedb *state.StateDB, addr common.Address, keys ...common.Hash) *AccountResult {
+	proof, err := statedb.GetProof(addr)
+	if err != nil {
+		t.Fatalf("failed to prove account: %v", err)
+	}
+	codeHash := statedb.GetCodeHash(addr)
+	if codeHash == (common.Hash{}) {
+		codeHash = emptyCode
+	}
+	result := &AccountResult{
+		Address:      addr,
+		AccountProof: encodeTestProof(proof),
+		Balance:      statedb.GetBalance(addr),
+		CodeHash:     codeHash,
+		Nonce:        statedb.GetNonce(addr),
+		StorageHash:  statedb.GetStorageRoot(addr),
+	}
+	for _, key := range keys {
+		proof, err := statedb.GetStorageProof(addr, key)
+		if err != nil {
+			t.Fatalf("failed to prove storage: %v", err)
+		}
+		result.StorageProof = append(result.StorageProof, StorageResult{
+			Key:   key,
+			Value: statedb.GetState(addr, key).Big(),
+			Proof: encodeTestProof(proof),
+		})
+	}
+	return result
+}
+
+func encodeTestProof(proof []rlp.RawValue) []string {
+	enc := make([]string, len(proof))
+	for i, node := range proof {
+		enc[i] = hexutil.Encode(node)
+	}
+	return enc
+}
+
+func TestVerifyProof(t *testing.T) {
+	db, _ := hpbdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	contract, plain, missing := common.Address{1}, common.Address{2}, common.Address{3}
+	statedb.SetBalance(contract, big.NewInt(100))
+	statedb.SetNonce(contract, 5)
+	statedb.SetCode(contract, []byte{0x60, 0x00})
+	statedb.SetState(contract, common.Hash{1}, common.Hash{31: 0x42})
+	statedb.SetBalance(plain, big.NewInt(7))
+
+	root, err := statedb.CommitTo(db, true)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	statedb, _ = state.New(root, state.NewDatabase(db))
+
+	// Existing and empty slots of a contract, an account without storage and
+	// a non-existent account must all verify
+	for _, result := range []*AccountResult{
+		proveAccount(t, statedb, contract, common.Hash{1}, common.Hash{2}),
+		proveAccount(t, statedb, plain, common.Hash{1}),
+		proveAccount(t, statedb, missing, common.Hash{1}),
+	} {
+		if err := VerifyProof(root, result); err != nil {
+			t.Errorf("valid proof rejected: %v", err)
+		}
+	}
+	// Tampered values must be rejected
+	tamper := []func(r *AccountResult){
+		func(r *AccountResult) { r.Balance = big.NewInt(101) },
+		func(r *AccountResult) { r.Nonce++ },
+		func(r *AccountResult) { r.CodeHash = common.Hash{} },
+		func(r *AccountResult) { r.StorageProof[0].Value = big.NewInt(1) },
+		func(r *AccountResult) { r.StorageProof[1].Value = big.NewInt(1) },
+		func(r *AccountResult) { r.AccountProof = r.AccountProof[:len(r.AccountProof)-1] },
+		func(r *AccountResult) { r.StorageProof[0].Proof = nil },
+	}
+	for i, fn := range tamper {
+		result := proveAccount(t, statedb, contract, common.Hash{1}, common.Hash{2})
+		fn(result)
+		if err := VerifyProof(root, result); err == nil {
+			t.Errorf("tampering %d: invalid proof accepted", i)
+		}
+	}
+	if err := VerifyProof(common.Hash{1}, proveAccount(t, statedb, contract)); err == nil {
+		t.Errorf("proof accepted against the wrong root")
+	}
+}
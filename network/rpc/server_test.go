@@ -59,6 +59,17 @@ func (s *Service) Rets() (string, error) {
 	return "", nil
 }
 
+// dataError is an error with a custom code and data.
+type dataError struct{}
+
+func (dataError) Error() string          { return "data error" }
+func (dataError) ErrorCode() int         { return 3 }
+func (dataError) ErrorData() interface{} { return "0xdead" }
+
+func (s *Service) ReturnError() error {
+	return dataError{}
+}
+
 func (s *Service) InvalidRets1() (error, string) {
 	return nil, ""
 }
@@ -92,8 +103,8 @@ func TestServerRegisterName(t *testing.T) {
 		t.Fatalf("Expected service calc to be registered")
 	}
 
-	if len(svc.callbacks) != 5 {
-		t.Errorf("Expected 5 callbacks for service 'calc', got %d", len(svc.callbacks))
+	if len(svc.callbacks) != 6 {
+		t.Errorf("Expected 6 callbacks for service 'calc', got %d", len(svc.callbacks))
 	}
 
 	if len(svc.subscriptions) != 1 {
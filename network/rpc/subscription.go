@@ -37,7 +37,8 @@ type ID string
 type Subscription struct {
 	ID        ID
 	namespace string
-	err       chan error // closed on unsubscribe
+	err       chan error    // closed on unsubscribe
+	pending   []interface{} // notifications sent before activation
 }
 
 // Err returns a channel that is closed when the client send an unsubscribe request.
@@ -86,18 +87,29 @@ func (n *Notifier) CreateSubscription() *Subscription {
 }
 
 // Notify sends a notification to the client with the given data as payload.
+// Notifications of a subscription not activated yet are held back until it is.
 // If an error occurs the RPC connection is closed and the error is returned.
 func (n *Notifier) Notify(id ID, data interface{}) error {
-	n.subMu.RLock()
-	defer n.subMu.RUnlock()
-
-	sub, active := n.active[id]
-	if active {
-		notification := n.codec.CreateNotification(string(id), sub.namespace, data)
-		if err := n.codec.Write(notification); err != nil {
-			n.codec.Close()
-			return err
-		}
+	n.subMu.Lock()
+	defer n.subMu.Unlock()
+
+	if sub, inactive := n.inactive[id]; inactive {
+		sub.pending = append(sub.pending, data)
+		return nil
+	}
+	if sub, active := n.active[id]; active {
+		return n.send(sub, data)
+	}
+	return nil
+}
+
+// send writes a notification of the subscription to the client, closing the
+// connection if that fails.
+func (n *Notifier) send(sub *Subscription, data interface{}) error {
+	notification := n.codec.CreateNotification(string(sub.ID), sub.namespace, data)
+	if err := n.codec.Write(notification); err != nil {
+		n.codec.Close()
+		return err
 	}
 	return nil
 }
@@ -117,11 +129,16 @@ func (n *Notifier) unsubscribe(id ID) error {
 		delete(n.active, id)
 		return nil
 	}
+	if s, found := n.inactive[id]; found {
+		close(s.err)
+		delete(n.inactive, id)
+		return nil
+	}
 	return ErrSubscriptionNotFound
 }
 
 // activate enables a subscription. Until a subscription is enabled all
-// notifications are dropped. This method is called by the RPC server after
+// notifications are held back. This method is called by the RPC server after
 // the subscription ID was sent to client. This prevents notifications being
 // send to the client before the subscription ID is send to the client.
 func (n *Notifier) activate(id ID, namespace string) {
@@ -131,5 +148,12 @@ func (n *Notifier) activate(id ID, namespace string) {
 		sub.namespace = namespace
 		n.active[id] = sub
 		delete(n.inactive, id)
+
+		for _, data := range sub.pending {
+			if n.send(sub, data) != nil {
+				break
+			}
+		}
+		sub.pending = nil
 	}
 }
@@ -20,14 +20,18 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"math/big"
 	"os"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/hpb-project/go-hpb/account/abi"
 	"github.com/hpb-project/go-hpb/common"
 	"github.com/hpb-project/go-hpb/common/hexutil"
 	"github.com/hpb-project/go-hpb/internal/hpbapi"
@@ -38,14 +42,21 @@ import (
 	"github.com/hpb-project/go-hpb/blockchain/types"
 	"github.com/hpb-project/go-hpb/blockchain/state"
 	"github.com/hpb-project/go-hpb/blockchain"
+	"github.com/hpb-project/go-hpb/hvm"
 	"github.com/hpb-project/go-hpb/hvm/evm"
+	"github.com/hpb-project/go-hpb/hvm/tracers"
 	"github.com/hpb-project/go-hpb/network/p2p"
 	"github.com/hpb-project/go-hpb/common/crypto"
 	"github.com/hpb-project/go-hpb/config"
+	"github.com/hpb-project/go-hpb/worker"
 )
 
 const defaultTraceTimeout = 5 * time.Second
 
+// defaultTraceReexec is the number of blocks the tracers re-execute at most to
+// regenerate a state that is not available any more.
+const defaultTraceReexec = 128
+
 // PublicHpbAPI provides an API to access Hpb full node-related
 // information.
 type PublicHpbAPI struct {
@@ -72,6 +83,42 @@ func (api *PublicHpbAPI) Mining() bool {
 	return api.e.miner.Mining()
 }
 
+// SendBundleArgs represents the arguments to submit a bundle of signed
+// transactions for atomic inclusion in a block.
+type SendBundleArgs struct {
+	Txs      []hexutil.Bytes `json:"txs"`
+	MinBlock hexutil.Uint64  `json:"minBlock"`
+	MaxBlock hexutil.Uint64  `json:"maxBlock"`
+}
+
+// SendBundle queues RLP encoded signed transactions to be included together,
+// in order and at the top of a block between MinBlock and MaxBlock, or not at
+// all. It returns the hash identifying the bundle.
+func (api *PublicHpbAPI) SendBundle(args SendBundleArgs) (common.Hash, error) {
+	signer := types.MakeSigner(&api.e.Hpbconfig.BlockChain)
+
+	txs := make(types.Transactions, len(args.Txs))
+	for i, encodedTx := range args.Txs {
+		tx := new(types.Transaction)
+		if err := rlp.DecodeBytes(encodedTx, tx); err != nil {
+			return common.Hash{}, fmt.Errorf("bundle tx %d: %v", i, err)
+		}
+		if _, err := types.Sender(signer, tx); err != nil {
+			return common.Hash{}, fmt.Errorf("bundle tx %d: %v", i, err)
+		}
+		txs[i] = tx
+	}
+	bundle, err := worker.NewBundle(txs, uint64(args.MinBlock), uint64(args.MaxBlock))
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if err := api.e.miner.AddBundle(bundle); err != nil {
+		return common.Hash{}, err
+	}
+	log.Info("Submitted transaction bundle", "hash", bundle.Hash(), "txs", len(txs), "min", bundle.MinBlock, "max", bundle.MaxBlock)
+	return bundle.Hash(), nil
+}
+
 // PrivateMinerAPI provides private RPC methods tso control the miner.
 // These methods can be abused by external users and must be considered insecure for use by untrusted users.
 type PrivateMinerAPI struct {
@@ -145,12 +192,84 @@ func (api *PrivateMinerAPI) SetGasPrice(gasPrice hexutil.Big) bool {
 	return true
 }
 
+// SetGasTarget sets the gas limit the miner moves new blocks toward.
+func (api *PrivateMinerAPI) SetGasTarget(target hexutil.Big) (bool, error) {
+	if err := api.e.Miner().SetGasTarget((*big.Int)(&target)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // SetHpberbase sets the hpberbase of the miner
 func (api *PrivateMinerAPI) SetHpberbase(hpberbase common.Address) bool {
 	api.e.SetHpberbase(hpberbase)
 	return true
 }
 
+// maxMinedBlocksRange is the widest block range GetMinedBlocks serves at once.
+const maxMinedBlocksRange = 10000
+
+// GetMinedBlocks returns the blocks sealed by this node between from and to,
+// inclusive, with their canonical status, reward and propagation time.
+func (api *PrivateMinerAPI) GetMinedBlocks(from, to hexutil.Uint64) ([]map[string]interface{}, error) {
+	if to < from {
+		return nil, fmt.Errorf("invalid range: from %d is above to %d", from, to)
+	}
+	if to-from >= maxMinedBlocksRange {
+		return nil, fmt.Errorf("range too large: %d blocks, limit %d", to-from+1, maxMinedBlocksRange)
+	}
+	blocks := api.e.Miner().MinedBlocks(uint64(from), uint64(to))
+
+	fields := make([]map[string]interface{}, len(blocks))
+	for i, block := range blocks {
+		fields[i] = rpcMarshalMinedBlock(block)
+	}
+	return fields, nil
+}
+
+// OrphanedBlocks creates a subscription that fires each time a block sealed by
+// this node turns out to be a side fork.
+func (api *PrivateMinerAPI) OrphanedBlocks(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		orphans := make(chan worker.OrphanedBlockEvent)
+		orphansSub := api.e.Miner().SubscribeOrphanedBlockEvent(orphans)
+
+		for {
+			select {
+			case ev := <-orphans:
+				notifier.Notify(rpcSub.ID, rpcMarshalMinedBlock(ev.Block))
+			case <-rpcSub.Err():
+				orphansSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				orphansSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// rpcMarshalMinedBlock converts a mined block record into its RPC form.
+func rpcMarshalMinedBlock(block *worker.MinedBlock) map[string]interface{} {
+	return map[string]interface{}{
+		"number":      hexutil.Uint64(block.Number),
+		"hash":        block.Hash,
+		"inTurn":      block.InTurn,
+		"status":      block.StatusString(),
+		"reward":      (*hexutil.Big)(block.Reward),
+		"sealedAt":    hexutil.Uint64(block.SealedAt),
+		"propagation": hexutil.Uint64(block.Propagation),
+	}
+}
+
 // PrivateAdminAPI is the collection of Hpb full node-related APIs
 // exposed over the private admin endpoint.
 type PrivateAdminAPI struct {
@@ -302,7 +421,8 @@ type BlockTraceResult struct {
 	Error      string                `json:"error"`
 }
 
-// TraceArgs holds extra parameters to trace functions
+// TraceArgs holds extra parameters to trace functions. Tracer is either the
+// name of a built-in tracer or the code of a JavaScript tracer.
 type TraceArgs struct {
 	*evm.LogConfig
 	Tracer  *string
@@ -339,17 +459,7 @@ func (api *PrivateDebugAPI) TraceBlockFromFile(file string, config *evm.LogConfi
 // TraceBlockByNumber processes the block by canonical block number.
 func (api *PrivateDebugAPI) TraceBlockByNumber(blockNr rpc.BlockNumber, config *evm.LogConfig) BlockTraceResult {
 	// Fetch the block that we aim to reprocess
-	var block *types.Block
-	switch blockNr {
-	case rpc.PendingBlockNumber:
-		// Pending block is only known by the miner
-		block = api.hpb.miner.PendingBlock()
-	case rpc.LatestBlockNumber:
-		block = api.hpb.Hpbbc.CurrentBlock()
-	default:
-		block = api.hpb.Hpbbc.GetBlockByNumber(uint64(blockNr))
-	}
-
+	block := api.blockByNumber(blockNr)
 	if block == nil {
 		return BlockTraceResult{Error: fmt.Sprintf("block #%d not found", blockNr)}
 	}
@@ -423,120 +533,413 @@ func (t *timeoutError) Error() string {
 	return "Execution time exceeded"
 }
 
-/*// TraceTransaction returns the structured logs created during the execution of EVM
-// and returns them as a JSON object.
+// TraceTransaction returns the structured logs created during the execution of EVM
+// and returns them as a JSON object. A built-in tracer such as callTracer or
+// prestateTracer can be selected by name instead, any other tracer is taken to
+// be JavaScript code.
 func (api *PrivateDebugAPI) TraceTransaction(ctx context.Context, txHash common.Hash, config *TraceArgs) (interface{}, error) {
-	var tracer evm.Tracer
+	// Retrieve the tx from the chain and the containing block
+	tx, blockHash, _, txIndex := bc.GetTransaction(api.hpb.ChainDb(), txHash)
+	if tx == nil {
+		return nil, fmt.Errorf("transaction %x not found", txHash)
+	}
+	msg, header, statedb, err := api.computeTxEnv(blockHash, int(txIndex))
+	if err != nil {
+		return nil, err
+	}
+	return api.traceTx(ctx, msg, header, statedb, config)
+}
+
+// TraceCall lets you trace a given call on top of the state of the given
+// block, in the same way TraceTransaction traces a mined transaction. Unless
+// specified, the call has the gas limit of the block and a gas price of zero.
+func (api *PrivateDebugAPI) TraceCall(ctx context.Context, args hpbapi.CallArgs, blockNr rpc.BlockNumber, config *TraceArgs) (interface{}, error) {
+	statedb, header, err := api.hpb.ApiBackend.StateAndHeaderByNumber(ctx, blockNr)
+	if statedb == nil || err != nil {
+		if err == nil {
+			err = fmt.Errorf("block #%d not found", blockNr)
+		}
+		return nil, err
+	}
+	gas := args.Gas.ToInt()
+	if gas.Sign() == 0 {
+		gas = header.GasLimit
+	}
+	msg := types.NewMessage(args.From, args.To, 0, args.Value.ToInt(), gas, args.GasPrice.ToInt(), args.Data, false)
+
+	return api.traceTx(ctx, msg, header, statedb, config)
+}
+
+// traceTx runs the message on the given state with the tracer selected by the
+// config and returns the result of the tracer.
+func (api *PrivateDebugAPI) traceTx(ctx context.Context, msg hvm.Message, header *types.Header, statedb *state.StateDB, config *TraceArgs) (interface{}, error) {
+	var (
+		tracer evm.Tracer
+		err    error
+	)
 	if config != nil && config.Tracer != nil {
-		timeout := defaultTraceTimeout
-		if config.Timeout != nil {
-			var err error
-			if timeout, err = time.ParseDuration(*config.Timeout); err != nil {
+		if native, ok := tracers.New(*config.Tracer, &tracers.Context{GasLimit: msg.Gas().Uint64(), GasPrice: msg.GasPrice()}); ok {
+			tracer = native
+		} else {
+			timeout := defaultTraceTimeout
+			if config.Timeout != nil {
+				if timeout, err = time.ParseDuration(*config.Timeout); err != nil {
+					return nil, err
+				}
+			}
+			jst, err := hpbapi.NewJavascriptTracer(*config.Tracer)
+			if err != nil {
 				return nil, err
 			}
+			tracer = jst
+
+			// Handle timeouts and RPC cancellations
+			deadlineCtx, cancel := context.WithTimeout(ctx, timeout)
+			go func() {
+				<-deadlineCtx.Done()
+				jst.Stop(&timeoutError{})
+			}()
+			defer cancel()
 		}
-
-		var err error
-		if tracer, err = hpbapi.NewJavascriptTracer(*config.Tracer); err != nil {
-			return nil, err
-		}
-
-		// Handle timeouts and RPC cancellations
-		deadlineCtx, cancel := context.WithTimeout(ctx, timeout)
-		go func() {
-			<-deadlineCtx.Done()
-			tracer.(*hpbapi.JavascriptTracer).Stop(&timeoutError{})
-		}()
-		defer cancel()
 	} else if config == nil {
 		tracer = evm.NewStructLogger(nil)
 	} else {
 		tracer = evm.NewStructLogger(config.LogConfig)
 	}
 
-	// Retrieve the tx from the chain and the containing block
-	tx, blockHash, _, txIndex := bc.GetTransaction(api.hpb.ChainDb(), txHash)
-	if tx == nil {
-		return nil, fmt.Errorf("transaction %x not found", txHash)
-	}
-	msg, context, statedb, err := api.computeTxEnv(blockHash, int(txIndex))
-	if err != nil {
-		return nil, err
-	}
-
 	// Run the transaction with tracing enabled.
+	context := hvm.NewEVMContext(msg, header, api.hpb.BlockChain(), nil)
 	vmenv := evm.NewEVM(context, statedb, api.config, evm.Config{Debug: true, Tracer: tracer})
 
-	block := bc.InstanceBlockChain()
-	ret, gas, failed, err := bc.ApplyMessage(block, nil, nil, nil, msg , nil)
+	gp := new(hvm.GasPool).AddGas(msg.Gas())
+	ret, gas, failed, err := bc.ApplyMessageOnEVM(vmenv, header, statedb, msg, gp)
 	if err != nil {
 		return nil, fmt.Errorf("tracing failed: %v", err)
 	}
 	switch tracer := tracer.(type) {
 	case *evm.StructLogger:
-		return &hpbapi.ExecutionResult{
+		result := &hpbapi.ExecutionResult{
 			Gas:         gas,
 			Failed:      failed,
 			ReturnValue: fmt.Sprintf("%x", ret),
 			StructLogs:  hpbapi.FormatLogs(tracer.StructLogs()),
-		}, nil
+		}
+		if failed {
+			if reason, err := abi.UnpackRevert(ret); err == nil {
+				result.RevertReason = reason
+			}
+		}
+		return result, nil
+	case tracers.Tracer:
+		return tracer.GetResult()
 	case *hpbapi.JavascriptTracer:
 		return tracer.GetResult()
 	default:
 		panic(fmt.Sprintf("bad tracer type %T", tracer))
 	}
-}*/
-/*
-// computeTxEnv returns the execution environment of a certain transaction.
-func (api *PrivateDebugAPI) computeTxEnv(blockHash common.Hash, txIndex int) (bc.Message, evm.Context, *state.StateDB, error) {
+}
+
+// txTraceResult is the trace of a single transaction streamed by TraceChain.
+type txTraceResult struct {
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	BlockHash   common.Hash    `json:"blockHash"`
+	TxHash      common.Hash    `json:"txHash"`
+	TxIndex     hexutil.Uint   `json:"txIndex"`
+	Result      interface{}    `json:"result,omitempty"`
+	Error       string         `json:"error,omitempty"`
+}
+
+// blockTraceTask is a block to trace together with the state it starts from.
+type blockTraceTask struct {
+	block   *types.Block
+	statedb *state.StateDB
+	results []*txTraceResult
+}
+
+// TraceChain creates a subscription streaming the traces of all transactions
+// in the blocks between start and end, inclusive. A single producer replays
+// the range serially from the state of the parent of start, as returned by
+// stateAtBlock, and only the tracing of the blocks runs in parallel. The
+// results are delivered in chain order.
+func (api *PrivateDebugAPI) TraceChain(ctx context.Context, start, end rpc.BlockNumber, config *TraceArgs) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	from, to := api.blockByNumber(start), api.blockByNumber(end)
+	if from == nil {
+		return nil, fmt.Errorf("block #%d not found", start)
+	}
+	if to == nil {
+		return nil, fmt.Errorf("block #%d not found", end)
+	}
+	if from.NumberU64() == 0 {
+		return nil, errors.New("genesis is not traceable")
+	}
+	if to.NumberU64() < from.NumberU64() {
+		return nil, fmt.Errorf("invalid range: end %d is below start %d", to.NumberU64(), from.NumberU64())
+	}
+	parent := api.hpb.BlockChain().GetBlock(from.ParentHash(), from.NumberU64()-1)
+	if parent == nil {
+		return nil, fmt.Errorf("block parent %x not found", from.ParentHash())
+	}
+	statedb, err := api.stateAtBlock(parent)
+	if err != nil {
+		return nil, err
+	}
+	rpcSub := notifier.CreateSubscription()
+	go api.traceChain(from.NumberU64(), to.NumberU64(), statedb, config, notifier, rpcSub)
+
+	return rpcSub, nil
+}
+
+// traceChain replays the blocks of the range one after the other on statedb,
+// handing each block with a copy of the state before it to a set of tracing
+// workers, and delivers their results in order until the range is done or the
+// subscription is closed.
+func (api *PrivateDebugAPI) traceChain(start, end uint64, statedb *state.StateDB, config *TraceArgs, notifier *rpc.Notifier, rpcSub *rpc.Subscription) {
+	var (
+		chain   = api.hpb.BlockChain()
+		threads = runtime.NumCPU()
+		tasks   = make(chan *blockTraceTask, threads)
+		results = make(chan *blockTraceTask, threads)
+		quit    = make(chan struct{})
+		pend    sync.WaitGroup
+	)
+	defer close(quit)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for i := 0; i < threads; i++ {
+		pend.Add(1)
+		go func() {
+			defer pend.Done()
+			for task := range tasks {
+				api.traceBlockTxs(ctx, task, config)
+				select {
+				case results <- task:
+				case <-quit:
+					return
+				}
+			}
+		}()
+	}
+	// Advance the state block by block and hand out the blocks to trace
+	go func() {
+		defer func() {
+			close(tasks)
+			pend.Wait()
+			close(results)
+		}()
+		for number := start; number <= end; number++ {
+			block := chain.GetBlockByNumber(number)
+			if block == nil {
+				log.Warn("Chain tracing aborted, block missing", "number", number)
+				return
+			}
+			select {
+			case tasks <- &blockTraceTask{block: block, statedb: statedb.Copy()}:
+			case <-quit:
+				return
+			}
+			if number == end {
+				break
+			}
+			if _, _, _, err := chain.Processor().Process(block, statedb); err != nil {
+				log.Warn("Chain tracing aborted, block failed", "number", number, "err", err)
+				return
+			}
+		}
+	}()
+	// Deliver the traces in chain order, the workers may finish out of order
+	var (
+		next = start
+		done = make(map[uint64]*blockTraceTask)
+	)
+	for {
+		select {
+		case task, ok := <-results:
+			if !ok {
+				return
+			}
+			done[task.block.NumberU64()] = task
+			for done[next] != nil {
+				for _, result := range done[next].results {
+					notifier.Notify(rpcSub.ID, result)
+				}
+				delete(done, next)
+				next++
+			}
+		case <-rpcSub.Err():
+			return
+		case <-notifier.Closed():
+			return
+		}
+	}
+}
+
+// traceBlockTxs traces the transactions of the block of the task one after
+// the other on top of the state of the task.
+func (api *PrivateDebugAPI) traceBlockTxs(ctx context.Context, task *blockTraceTask, config *TraceArgs) {
+	var (
+		block  = task.block
+		header = block.Header()
+		signer = types.MakeSigner(api.config)
+	)
+	for i, tx := range block.Transactions() {
+		result := &txTraceResult{
+			BlockNumber: hexutil.Uint64(block.NumberU64()),
+			BlockHash:   block.Hash(),
+			TxHash:      tx.Hash(),
+			TxIndex:     hexutil.Uint(i),
+		}
+		task.results = append(task.results, result)
+
+		msg, err := tx.AsMessage(signer)
+		if err != nil {
+			result.Error = err.Error()
+			continue
+		}
+		task.statedb.Prepare(tx.Hash(), block.Hash(), i)
+		if result.Result, err = api.traceTx(ctx, msg, header, task.statedb, config); err != nil {
+			result.Error = err.Error()
+		}
+		task.statedb.Finalise(true)
+	}
+}
+
+// blockByNumber returns the canonical block with the given number, or nil if
+// it is not known.
+func (api *PrivateDebugAPI) blockByNumber(blockNr rpc.BlockNumber) *types.Block {
+	switch blockNr {
+	case rpc.PendingBlockNumber:
+		// Pending block is only known by the miner
+		return api.hpb.miner.PendingBlock()
+	case rpc.LatestBlockNumber:
+		return api.hpb.Hpbbc.CurrentBlock()
+	default:
+		return api.hpb.Hpbbc.GetBlockByNumber(uint64(blockNr))
+	}
+}
+
+// stateAtBlock returns the state after the given block. If it is not available
+// any more, the state is regenerated by re-executing the blocks from the most
+// recent ancestor whose state is, up to defaultTraceReexec blocks back.
+func (api *PrivateDebugAPI) stateAtBlock(block *types.Block) (*state.StateDB, error) {
+	chain := api.hpb.BlockChain()
+
+	var (
+		origin  = block
+		replay  []*types.Block
+		statedb *state.StateDB
+		err     error
+	)
+	for statedb, err = chain.StateAt(origin.Root()); err != nil; statedb, err = chain.StateAt(origin.Root()) {
+		if len(replay) >= defaultTraceReexec || origin.NumberU64() == 0 {
+			return nil, fmt.Errorf("state of block #%d not available within %d blocks", block.NumberU64(), defaultTraceReexec)
+		}
+		replay = append(replay, origin)
+		if origin = chain.GetBlock(origin.ParentHash(), origin.NumberU64()-1); origin == nil {
+			return nil, fmt.Errorf("block parent %x not found", replay[len(replay)-1].ParentHash())
+		}
+	}
+	for i := len(replay) - 1; i >= 0; i-- {
+		if _, _, _, err := chain.Processor().Process(replay[i], statedb); err != nil {
+			return nil, fmt.Errorf("re-executing block #%d failed: %v", replay[i].NumberU64(), err)
+		}
+	}
+	return statedb, nil
+}
+
+// computeTxEnv returns the message, the header and the state a certain
+// transaction of a block is executed with.
+func (api *PrivateDebugAPI) computeTxEnv(blockHash common.Hash, txIndex int) (hvm.Message, *types.Header, *state.StateDB, error) {
 	// Create the parent state.
 	block := api.hpb.BlockChain().GetBlockByHash(blockHash)
 	if block == nil {
-		return nil, evm.Context{}, nil, fmt.Errorf("block %x not found", blockHash)
+		return nil, nil, nil, fmt.Errorf("block %x not found", blockHash)
 	}
 	parent := api.hpb.BlockChain().GetBlock(block.ParentHash(), block.NumberU64()-1)
 	if parent == nil {
-		return nil, evm.Context{}, nil, fmt.Errorf("block parent %x not found", block.ParentHash())
+		return nil, nil, nil, fmt.Errorf("block parent %x not found", block.ParentHash())
 	}
-	statedb, err := api.hpb.BlockChain().StateAt(parent.Root())
+	statedb, err := api.stateAtBlock(parent)
 	if err != nil {
-		return nil, evm.Context{}, nil, err
+		return nil, nil, nil, err
 	}
 	txs := block.Transactions()
 
 	// Recompute transactions up to the target index.
-	signer := types.MakeSigner(api.config, block.Number())
+	var (
+		header = block.Header()
+		signer = types.MakeSigner(api.config)
+		gp     = new(hvm.GasPool).AddGas(block.GasLimit())
+	)
 	for idx, tx := range txs {
 		// Assemble the transaction call message
-		msg, _ := tx.AsMessage(signer)
-		context := hvm.NewEVMContext(msg, block.Header(), api.hpb.BlockChain(), nil)
+		msg, err := tx.AsMessage(signer)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		statedb.Prepare(tx.Hash(), blockHash, idx)
 		if idx == txIndex {
-			return msg, context, statedb, nil
+			return msg, header, statedb, nil
 		}
-
-		vmenv := evm.NewEVM(context, statedb, api.config, evm.Config{})
-		gp := new(bc.GasPool).AddGas(tx.Gas())
-		_, _, _, err := bc.ApplyMessage(vmenv, msg, gp)
-		if err != nil {
-			return nil, evm.Context{}, nil, fmt.Errorf("tx %x failed: %v", tx.Hash(), err)
+		if _, _, _, err := bc.ApplyMessage(header, statedb, nil, msg, gp); err != nil {
+			return nil, nil, nil, fmt.Errorf("tx %x failed: %v", tx.Hash(), err)
 		}
-		statedb.DeleteSuicides()
+		statedb.Finalise(true)
 	}
-	return nil, evm.Context{}, nil, fmt.Errorf("tx index %d out of range for block %x", txIndex, blockHash)
+	return nil, nil, nil, fmt.Errorf("tx index %d out of range for block %x", txIndex, blockHash)
 }
-*/
+
 // Preimage is a debug API function that returns the preimage for a sha3 hash, if known.
 func (api *PrivateDebugAPI) Preimage(ctx context.Context, hash common.Hash) (hexutil.Bytes, error) {
 	db := bc.PreimageTable(api.hpb.ChainDb())
 	return db.Get(hash.Bytes())
 }
 
+// VmProfile returns the execution time and gas the VM recorded per opcode and
+// per contract while processing blocks, keeping only the contracts taking the
+// most time. Profiling is enabled with --vmprofile, if reset is set the
+// recorded statistics are dropped after they were read.
+func (api *PrivateDebugAPI) VmProfile(reset *bool) (*evm.Profile, error) {
+	if !api.hpb.BlockChain().VMConfig().Profile {
+		return nil, errors.New("vm profiling is disabled")
+	}
+	profile := evm.DefaultProfiler.Profile()
+	if reset != nil && *reset {
+		evm.DefaultProfiler.Reset()
+	}
+	return profile, nil
+}
+
 // GetBadBLocks returns a list of the last 'bad blocks' that the client has seen on the network
 // and returns them as a JSON list of block-hashes
 func (api *PrivateDebugAPI) GetBadBlocks(ctx context.Context) ([]bc.BadBlockArgs, error) {
 	return api.hpb.BlockChain().BadBlocks()
 }
 
+// VerifySnapshot rebuilds the state tries of a block from its flat state
+// snapshot and checks them against the state root of the block.
+func (api *PrivateDebugAPI) VerifySnapshot(blockNr rpc.BlockNumber) error {
+	snaps := api.hpb.BlockChain().Snapshots()
+	if snaps == nil {
+		return fmt.Errorf("state snapshot disabled")
+	}
+	var block *types.Block
+	if blockNr == rpc.LatestBlockNumber || blockNr == rpc.PendingBlockNumber {
+		block = api.hpb.Hpbbc.CurrentBlock()
+	} else {
+		block = api.hpb.Hpbbc.GetBlockByNumber(uint64(blockNr))
+	}
+	if block == nil {
+		return fmt.Errorf("block #%d not found", blockNr)
+	}
+	return snaps.Verify(block.Root())
+}
+
 // StorageRangeResult is the result of a debug_storageRangeAt API call.
 type StorageRangeResult struct {
 	Storage storageMap   `json:"storage"`
@@ -34,6 +34,7 @@ import (
 	"github.com/hpb-project/go-hpb/blockchain/bloombits"
 	"github.com/hpb-project/go-hpb/event/sub"
 	"github.com/hpb-project/go-hpb/synctrl"
+	"github.com/hpb-project/go-hpb/txpool"
 )
 
 // HpbApiBackend implements ethapi.Backend for full nodes
@@ -168,6 +169,18 @@ func (b *HpbApiBackend) TxPoolContent() (map[common.Address]types.Transactions,
 	return b.hpb.TxPool().Content()
 }
 
+func (b *HpbApiBackend) TxPoolAddresses() []common.Address {
+	return b.hpb.TxPool().Addresses()
+}
+
+func (b *HpbApiBackend) TxPoolContentFrom(addr common.Address) (types.Transactions, types.Transactions) {
+	return b.hpb.TxPool().ContentFrom(addr)
+}
+
+func (b *HpbApiBackend) TxPoolAccountStatus(addr common.Address) *txpool.AccountStatus {
+	return b.hpb.TxPool().AccountStatus(addr)
+}
+
 func (b *HpbApiBackend) SubscribeTxPreEvent(ch chan<- bc.TxPreEvent) sub.Subscription {
 	return b.hpb.TxPool().SubscribeTxPreEvent(ch)
 }
@@ -0,0 +1,221 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package node
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/hpb-project/go-hpb/account"
+	"github.com/hpb-project/go-hpb/blockchain"
+	"github.com/hpb-project/go-hpb/blockchain/bloombits"
+	"github.com/hpb-project/go-hpb/blockchain/state"
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/blockchain/types"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/math"
+	"github.com/hpb-project/go-hpb/config"
+	"github.com/hpb-project/go-hpb/event/sub"
+	"github.com/hpb-project/go-hpb/hvm"
+	"github.com/hpb-project/go-hpb/hvm/evm"
+	"github.com/hpb-project/go-hpb/light"
+	"github.com/hpb-project/go-hpb/network/rpc"
+	"github.com/hpb-project/go-hpb/node/gasprice"
+	"github.com/hpb-project/go-hpb/synctrl"
+	"github.com/hpb-project/go-hpb/txpool"
+)
+
+// LightApiBackend implements hpbapi.Backend for light clients. Only headers
+// are kept locally, blocks, receipts and state are retrieved from full nodes
+// on demand and verified against the headers.
+type LightApiBackend struct {
+	hpb *Node
+	gpo *gasprice.Oracle
+}
+
+func (b *LightApiBackend) odr() light.OdrBackend {
+	return b.hpb.Hpbsyncctr.LightRetriever()
+}
+
+func (b *LightApiBackend) ChainConfig() *config.ChainConfig {
+	return &b.hpb.Hpbconfig.BlockChain
+}
+
+func (b *LightApiBackend) CurrentBlock() *types.Block {
+	return types.NewBlockWithHeader(b.hpb.Hpbbc.CurrentHeader())
+}
+
+func (b *LightApiBackend) SetHead(number uint64) {
+	b.hpb.Hpbsyncctr.Syncer().Cancel()
+	b.hpb.Hpbbc.SetHead(number)
+}
+
+func (b *LightApiBackend) HeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.Header, error) {
+	// Light clients don't build blocks, the pending block is the latest one
+	if blockNr == rpc.LatestBlockNumber || blockNr == rpc.PendingBlockNumber {
+		return b.hpb.Hpbbc.CurrentHeader(), nil
+	}
+	return light.GetHeaderByNumber(ctx, b.odr(), uint64(blockNr))
+}
+
+func (b *LightApiBackend) BlockByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.Block, error) {
+	header, err := b.HeaderByNumber(ctx, blockNr)
+	if header == nil || err != nil {
+		return nil, err
+	}
+	return light.GetBlock(ctx, b.odr(), header)
+}
+
+func (b *LightApiBackend) StateAndHeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*state.StateDB, *types.Header, error) {
+	header, err := b.HeaderByNumber(ctx, blockNr)
+	if header == nil || err != nil {
+		return nil, nil, err
+	}
+	stateDb, err := light.NewState(ctx, header, b.odr())
+	return stateDb, header, err
+}
+
+func (b *LightApiBackend) GetBlock(ctx context.Context, blockHash common.Hash) (*types.Block, error) {
+	header := b.hpb.Hpbbc.GetHeaderByHash(blockHash)
+	if header == nil {
+		return nil, nil
+	}
+	return light.GetBlock(ctx, b.odr(), header)
+}
+
+func (b *LightApiBackend) GetReceipts(ctx context.Context, blockHash common.Hash) (types.Receipts, error) {
+	header := b.hpb.Hpbbc.GetHeaderByHash(blockHash)
+	if header == nil {
+		return nil, nil
+	}
+	return light.GetBlockReceipts(ctx, b.odr(), header)
+}
+
+func (b *LightApiBackend) GetTd(blockHash common.Hash) *big.Int {
+	return b.hpb.Hpbbc.GetTdByHash(blockHash)
+}
+
+func (b *LightApiBackend) GetEVM(ctx context.Context, msg types.Message, state *state.StateDB, header *types.Header, vmConfig evm.Config) (*evm.EVM, func() error, error) {
+	state.SetBalance(msg.From(), math.MaxBig256)
+	vmError := func() error { return state.Error() }
+
+	context := hvm.NewEVMContext(msg, header, b.hpb.BlockChain(), nil)
+	return evm.NewEVM(context, state, &b.hpb.Hpbconfig.BlockChain, vmConfig), vmError, nil
+}
+
+func (b *LightApiBackend) SubscribeRemovedLogsEvent(ch chan<- bc.RemovedLogsEvent) sub.Subscription {
+	return b.hpb.BlockChain().SubscribeRemovedLogsEvent(ch)
+}
+
+func (b *LightApiBackend) SubscribeChainEvent(ch chan<- bc.ChainEvent) sub.Subscription {
+	return b.hpb.SubscribeLightHeadEvent(ch)
+}
+
+func (b *LightApiBackend) SubscribeChainHeadEvent(ch chan<- bc.ChainHeadEvent) sub.Subscription {
+	return b.hpb.BlockChain().SubscribeChainHeadEvent(ch)
+}
+
+func (b *LightApiBackend) SubscribeChainSideEvent(ch chan<- bc.ChainSideEvent) sub.Subscription {
+	return b.hpb.BlockChain().SubscribeChainSideEvent(ch)
+}
+
+func (b *LightApiBackend) SubscribeLogsEvent(ch chan<- []*types.Log) sub.Subscription {
+	return b.hpb.BlockChain().SubscribeLogsEvent(ch)
+}
+
+// SendTx relays the transaction straight to the peers, light clients don't
+// keep a transaction pool.
+func (b *LightApiBackend) SendTx(ctx context.Context, signedTx *types.Transaction) error {
+	b.hpb.Hpbsyncctr.RelayTx(signedTx)
+	return nil
+}
+
+func (b *LightApiBackend) GetPoolTransactions() (types.Transactions, error) {
+	return nil, nil
+}
+
+func (b *LightApiBackend) GetPoolTransaction(hash common.Hash) *types.Transaction {
+	return nil
+}
+
+func (b *LightApiBackend) GetPoolNonce(ctx context.Context, addr common.Address) (uint64, error) {
+	stateDb, err := light.NewState(ctx, b.hpb.Hpbbc.CurrentHeader(), b.odr())
+	if err != nil {
+		return 0, err
+	}
+	nonce := stateDb.GetNonce(addr)
+	return nonce, stateDb.Error()
+}
+
+func (b *LightApiBackend) Stats() (pending int, queued int) {
+	return 0, 0
+}
+
+func (b *LightApiBackend) TxPoolContent() (map[common.Address]types.Transactions, map[common.Address]types.Transactions) {
+	return make(map[common.Address]types.Transactions), make(map[common.Address]types.Transactions)
+}
+
+func (b *LightApiBackend) TxPoolAddresses() []common.Address {
+	return nil
+}
+
+func (b *LightApiBackend) TxPoolContentFrom(addr common.Address) (types.Transactions, types.Transactions) {
+	return nil, nil
+}
+
+func (b *LightApiBackend) TxPoolAccountStatus(addr common.Address) *txpool.AccountStatus {
+	return new(txpool.AccountStatus)
+}
+
+func (b *LightApiBackend) SubscribeTxPreEvent(ch chan<- bc.TxPreEvent) sub.Subscription {
+	return b.hpb.TxPool().SubscribeTxPreEvent(ch)
+}
+
+func (b *LightApiBackend) Downloader() *synctrl.Syncer {
+	return b.hpb.Hpbsyncctr.Syncer()
+}
+
+func (b *LightApiBackend) ProtocolVersion() int {
+	return b.hpb.EthVersion()
+}
+
+func (b *LightApiBackend) SuggestPrice(ctx context.Context) (*big.Int, error) {
+	return b.gpo.SuggestPrice(ctx)
+}
+
+func (b *LightApiBackend) ChainDb() hpbdb.Database {
+	return b.hpb.ChainDb()
+}
+
+func (b *LightApiBackend) EventMux() *sub.TypeMux {
+	return b.hpb.NewBlockMux()
+}
+
+func (b *LightApiBackend) AccountManager() *accounts.Manager {
+	return b.hpb.AccountManager()
+}
+
+func (b *LightApiBackend) BloomStatus() (uint64, uint64) {
+	sections, _, _ := b.hpb.bloomIndexer.Sections()
+	return config.BloomBitsBlocks, sections
+}
+
+func (b *LightApiBackend) ServiceFilter(ctx context.Context, session *bloombits.MatcherSession) {
+	for i := 0; i < bloomFilterThreads; i++ {
+		go session.Multiplex(bloomRetrievalBatch, bloomRetrievalWait, b.hpb.bloomRequests)
+	}
+}
@@ -0,0 +1,320 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hpb-project/go-hpb/blockchain"
+	"github.com/hpb-project/go-hpb/blockchain/state"
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/blockchain/types"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/crypto"
+	"github.com/hpb-project/go-hpb/common/hexutil"
+	"github.com/hpb-project/go-hpb/config"
+	"github.com/hpb-project/go-hpb/consensus"
+	"github.com/hpb-project/go-hpb/internal/hpbapi"
+	"github.com/hpb-project/go-hpb/network/rpc"
+	"github.com/hpb-project/go-hpb/node/db"
+)
+
+const (
+	traceTestBlocks = 16 // Number of blocks of the test chain
+	traceTestTxs    = 3  // Number of transfers in every block of the test chain
+)
+
+var (
+	traceTestKey, _   = crypto.GenerateKey()
+	traceTestSender   = crypto.PubkeyToAddress(traceTestKey.PublicKey)
+	traceTestReceiver = common.HexToAddress("0x0100000000000000000000000000000000000001")
+	traceTestCoinbase = common.HexToAddress("0x0200000000000000000000000000000000000002")
+	traceTestFunds    = new(big.Int).Mul(big.NewInt(1000), big.NewInt(1e18))
+
+	traceTestOnce  sync.Once
+	traceTestNode  *Node
+	traceTestChain []*types.Block
+)
+
+// traceTestEngine is a consensus engine accepting every block, crediting the
+// fees to the coinbase of the header.
+type traceTestEngine struct{}
+
+func (traceTestEngine) Author(header *types.Header) (common.Address, error) {
+	return header.Coinbase, nil
+}
+func (traceTestEngine) VerifyHeader(chain consensus.ChainReader, header *types.Header, seal bool) error {
+	return nil
+}
+func (traceTestEngine) VerifyHeaders(chain consensus.ChainReader, headers []*types.Header, seals []bool) (chan<- struct{}, <-chan error) {
+	abort, results := make(chan struct{}), make(chan error, len(headers))
+	for range headers {
+		results <- nil
+	}
+	return abort, results
+}
+func (traceTestEngine) SetNetTopology(chain consensus.ChainReader, headers []*types.Header) {}
+func (traceTestEngine) VerifyUncles(chain consensus.ChainReader, block *types.Block) error {
+	return nil
+}
+func (traceTestEngine) VerifySeal(chain consensus.ChainReader, header *types.Header) error {
+	return nil
+}
+func (traceTestEngine) PrepareBlockHeader(chain consensus.ChainReader, header *types.Header, state *state.StateDB) error {
+	return nil
+}
+func (traceTestEngine) Finalize(chain consensus.ChainReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) (*types.Block, error) {
+	return types.NewBlock(header, txs, uncles, receipts), nil
+}
+func (traceTestEngine) GenBlockWithSig(chain consensus.ChainReader, block *types.Block, stop <-chan struct{}) (*types.Block, error) {
+	return block, nil
+}
+func (traceTestEngine) APIs(chain consensus.ChainReader) []rpc.API { return nil }
+
+// newTraceTestNode returns a node over a chain of blocks full of transfers
+// from the test sender. The block chain is a process wide singleton, so the
+// chain is only created once.
+func newTraceTestNode(t *testing.T) (*Node, []*types.Block) {
+	traceTestOnce.Do(func() {
+		hpbconfig := config.GetHpbConfigInstance()
+		hpbconfig.Node.NoSnapshot = true
+
+		chaindb, _ := hpbdb.NewMemDatabase()
+		genesis := (&bc.Genesis{
+			Config:     &hpbconfig.BlockChain,
+			GasLimit:   config.GenesisGasLimit.Uint64(),
+			Difficulty: big.NewInt(1),
+			Alloc:      bc.GenesisAlloc{traceTestSender: {Balance: traceTestFunds}},
+		}).MustCommit(chaindb)
+
+		signer := types.MakeSigner(&hpbconfig.BlockChain)
+		blocks, receipts := bc.GenerateChain(&hpbconfig.BlockChain, genesis, chaindb, traceTestBlocks, func(i int, block *bc.BlockGen) {
+			block.SetCoinbase(traceTestCoinbase)
+			for j := 0; j < traceTestTxs; j++ {
+				tx := types.NewTransaction(uint64(i*traceTestTxs+j), traceTestReceiver, big.NewInt(int64(j+1)), big.NewInt(21000), big.NewInt(1), nil)
+				if tx, err := types.SignTx(tx, signer, traceTestKey); err != nil {
+					panic(err)
+				} else {
+					block.AddTx(tx)
+				}
+			}
+		})
+		td := new(big.Int).Set(genesis.Difficulty())
+		for i, block := range blocks {
+			td.Add(td, block.Difficulty())
+			if err := bc.WriteBlock(chaindb, block); err != nil {
+				panic(err)
+			}
+			if err := bc.WriteCanonicalHash(chaindb, block.Hash(), block.NumberU64()); err != nil {
+				panic(err)
+			}
+			if err := bc.WriteTd(chaindb, block.Hash(), block.NumberU64(), td); err != nil {
+				panic(err)
+			}
+			if err := bc.WriteBlockReceipts(chaindb, block.Hash(), block.NumberU64(), receipts[i]); err != nil {
+				panic(err)
+			}
+		}
+		head := blocks[len(blocks)-1].Hash()
+		bc.WriteHeadBlockHash(chaindb, head)
+		bc.WriteHeadHeaderHash(chaindb, head)
+		bc.WriteHeadFastBlockHash(chaindb, head)
+
+		db.DBINSTANCE.Store(chaindb)
+		chain, err := bc.InstanceBlockChain().InitWithEngine(traceTestEngine{})
+		if err != nil {
+			panic(err)
+		}
+		traceTestNode = &Node{Hpbbc: chain, HpbDb: chaindb, Hpbengine: traceTestEngine{}}
+		traceTestNode.ApiBackend = &HpbApiBackend{traceTestNode, nil}
+		traceTestChain = blocks
+	})
+	if traceTestNode.Hpbbc.CurrentBlock().NumberU64() != traceTestBlocks {
+		t.Fatalf("test chain head mismatch: have #%d, want #%d", traceTestNode.Hpbbc.CurrentBlock().NumberU64(), traceTestBlocks)
+	}
+	return traceTestNode, traceTestChain
+}
+
+// newTraceTestClient serves the debug API of the node in process.
+func newTraceTestClient(t *testing.T, node *Node) (*rpc.Client, func()) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("debug", NewPrivateDebugAPI(node.Hpbbc.Config(), node)); err != nil {
+		t.Fatalf("failed to register debug API: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	return client, func() {
+		client.Close()
+		server.Stop()
+	}
+}
+
+// traceTestAccount is the prestate of an account as reported by the tracer.
+type traceTestAccount struct {
+	Balance *hexutil.Big `json:"balance"`
+	Nonce   uint64       `json:"nonce"`
+}
+
+// traceTestPrestate decodes the prestate tracer result of the test sender.
+func traceTestPrestate(t *testing.T, result interface{}) *traceTestAccount {
+	blob, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("failed to encode trace result: %v", err)
+	}
+	prestate := make(map[common.Address]*traceTestAccount)
+	if err := json.Unmarshal(blob, &prestate); err != nil {
+		t.Fatalf("failed to decode trace result %s: %v", blob, err)
+	}
+	account := prestate[traceTestSender]
+	if account == nil {
+		t.Fatalf("sender missing from trace result %s", blob)
+	}
+	return account
+}
+
+// Tests that a call traced on top of an old block sees the state of that
+// block, not the one of the head.
+func TestTraceCallHistorical(t *testing.T) {
+	node, _ := newTraceTestNode(t)
+	api := NewPrivateDebugAPI(node.Hpbbc.Config(), node)
+
+	tracer := "prestateTracer"
+	for _, number := range []uint64{1, traceTestBlocks / 2, traceTestBlocks} {
+		args := hpbapi.CallArgs{From: traceTestSender, To: &traceTestReceiver, Value: hexutil.Big(*big.NewInt(1))}
+		result, err := api.TraceCall(context.Background(), args, rpc.BlockNumber(number), &TraceArgs{Tracer: &tracer})
+		if err != nil {
+			t.Fatalf("block #%d: tracing failed: %v", number, err)
+		}
+		statedb, err := node.Hpbbc.StateAt(node.Hpbbc.GetBlockByNumber(number).Root())
+		if err != nil {
+			t.Fatalf("block #%d: state missing: %v", number, err)
+		}
+		account := traceTestPrestate(t, result)
+		if want := number * traceTestTxs; account.Nonce != want {
+			t.Errorf("block #%d: nonce mismatch: have %d, want %d", number, account.Nonce, want)
+		}
+		if want := statedb.GetBalance(traceTestSender); account.Balance.ToInt().Cmp(want) != 0 {
+			t.Errorf("block #%d: balance mismatch: have %v, want %v", number, account.Balance.ToInt(), want)
+		}
+	}
+	// Blocks beyond the head can't be traced
+	args := hpbapi.CallArgs{From: traceTestSender, To: &traceTestReceiver}
+	if _, err := api.TraceCall(context.Background(), args, rpc.BlockNumber(traceTestBlocks+1), &TraceArgs{Tracer: &tracer}); err == nil {
+		t.Errorf("call on unknown block traced")
+	}
+}
+
+// Tests that the traces of a block range are delivered transaction by
+// transaction in chain order, each traced on the state right before it.
+func TestTraceChainOrder(t *testing.T) {
+	node, blocks := newTraceTestNode(t)
+	client, stop := newTraceTestClient(t, node)
+	defer stop()
+
+	var (
+		from, to = 3, traceTestBlocks - 2
+		results  = make(chan *txTraceResult, traceTestBlocks*traceTestTxs)
+	)
+	sub, err := client.Subscribe(context.Background(), "debug", results, "traceChain", hexutil.Uint64(from), hexutil.Uint64(to), map[string]string{"tracer": "prestateTracer"})
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	for number := from; number <= to; number++ {
+		block := blocks[number-1]
+		for i, tx := range block.Transactions() {
+			select {
+			case result := <-results:
+				if uint64(result.BlockNumber) != block.NumberU64() || int(result.TxIndex) != i {
+					t.Fatalf("trace out of order: have #%d tx %d, want #%d tx %d", result.BlockNumber, result.TxIndex, block.NumberU64(), i)
+				}
+				if result.BlockHash != block.Hash() || result.TxHash != tx.Hash() {
+					t.Fatalf("#%d tx %d: hash mismatch: have block %x tx %x, want block %x tx %x", number, i, result.BlockHash, result.TxHash, block.Hash(), tx.Hash())
+				}
+				if result.Error != "" {
+					t.Fatalf("#%d tx %d: tracing failed: %s", number, i, result.Error)
+				}
+				if account := traceTestPrestate(t, result.Result); account.Nonce != tx.Nonce() {
+					t.Errorf("#%d tx %d: traced on wrong state: nonce %d, want %d", number, i, account.Nonce, tx.Nonce())
+				}
+			case err := <-sub.Err():
+				t.Fatalf("subscription failed: %v", err)
+			case <-time.After(10 * time.Second):
+				t.Fatalf("#%d tx %d: trace timeout", number, i)
+			}
+		}
+	}
+	select {
+	case result := <-results:
+		t.Errorf("trace beyond the range: #%d tx %d", result.BlockNumber, result.TxIndex)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// Tests that unsubscribing in the middle of a range stops the replay and all
+// the tracing workers, even if their tracers never finish on their own.
+func TestTraceChainCancel(t *testing.T) {
+	node, _ := newTraceTestNode(t)
+	client, stop := newTraceTestClient(t, node)
+	defer stop()
+
+	// Get the connection going with a range that is rejected right away
+	if _, err := client.Subscribe(context.Background(), "debug", make(chan *txTraceResult), "traceChain", hexutil.Uint64(0), hexutil.Uint64(1), nil); err == nil {
+		t.Fatalf("genesis traced")
+	}
+	base := runtime.NumGoroutine()
+
+	// Trace with a tracer spinning forever, nothing is ever delivered
+	var (
+		results = make(chan *txTraceResult, traceTestBlocks*traceTestTxs)
+		config  = map[string]string{
+			"tracer":  "{step: function() {}, result: function() { while (true) {} }}",
+			"timeout": "1h",
+		}
+	)
+	sub, err := client.Subscribe(context.Background(), "debug", results, "traceChain", hexutil.Uint64(1), hexutil.Uint64(traceTestBlocks), config)
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	// Wait for all the workers to be stuck tracing, then cancel
+	for deadline := time.Now().Add(5 * time.Second); runtime.NumGoroutine() <= base+runtime.NumCPU(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("tracing workers not started: %d goroutines, %d before", runtime.NumGoroutine(), base)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	sub.Unsubscribe()
+
+	for deadline := time.Now().Add(5 * time.Second); runtime.NumGoroutine() > base; {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			t.Fatalf("goroutines leaked: %d left, %d before\n%s", runtime.NumGoroutine(), base, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case result := <-results:
+		t.Errorf("trace delivered from a spinning tracer: #%d tx %d", result.BlockNumber, result.TxIndex)
+	default:
+	}
+}
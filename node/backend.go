@@ -48,7 +48,14 @@ type LesServer interface {
 // APIs returns the collection of RPC services the hpb package offers.
 // NOTE, some of these services probably need to be moved to somewhere else.
 func (s *Node) APIs() []rpc.API {
-	apis := hpbapi.GetAPIs(s.ApiBackend)
+	var (
+		backend       hpbapi.Backend  = s.ApiBackend
+		filterBackend filters.Backend = s.ApiBackend
+	)
+	if s.LightBackend != nil {
+		backend, filterBackend = s.LightBackend, s.LightBackend
+	}
+	apis := hpbapi.GetAPIs(backend)
 
 	// Append all the local APIs and return
 	apis = append(apis, []rpc.API{
@@ -65,7 +72,7 @@ func (s *Node) APIs() []rpc.API {
 		},{ //TODO lsl
 			Namespace: "hpb",
 			Version:   "1.0",
-			Service:   filters.NewPublicFilterAPI(s.ApiBackend, false),
+			Service:   filters.NewPublicFilterAPI(filterBackend, s.LightBackend != nil),
 			Public:    true,
 		}, {
 			Namespace: "admin",
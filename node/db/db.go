@@ -17,7 +17,10 @@
 package db
 
 import (
+	"path/filepath"
 	"sync/atomic"
+
+	"github.com/hpb-project/go-hpb/common"
 	"github.com/hpb-project/go-hpb/blockchain/storage"
 	"github.com/hpb-project/go-hpb/config"
 	"github.com/hpb-project/go-hpb/common/log"
@@ -34,7 +37,7 @@ var DBINSTANCE = atomic.Value{}
 func  CreateDB(config *config.Nodeconfig, name string) (hpbdb.Database, error) {
 
 	if DBINSTANCE.Load() != nil {
-		return DBINSTANCE.Load().(*hpbdb.LDBDatabase),nil
+		return DBINSTANCE.Load().(hpbdb.Database), nil
 	}
 	db, err := OpenDatabase(name, config.DatabaseCache, config.DatabaseHandles)
 	if err != nil {
@@ -53,26 +56,39 @@ func  CreateDB(config *config.Nodeconfig, name string) (hpbdb.Database, error) {
 func OpenDatabase(name string, cache int, handles int) (hpbdb.Database, error) {
 
 	if DBINSTANCE.Load() != nil {
-		return DBINSTANCE.Load().(*hpbdb.LDBDatabase),nil
+		return DBINSTANCE.Load().(hpbdb.Database), nil
 	}
 
 	var cfg = config.GetHpbConfigInstance()
 	if cfg.Node.DataDir == ""{
 		return hpbdb.NewMemDatabase()
 	}
-	db, err := hpbdb.NewLDBDatabase(cfg.Node.ResolvePath(name), cache, handles)
+	db, err := hpbdb.Open(cfg.Node.DatabaseEngine, cfg.Node.ResolvePath(name), cache, handles)
 	if err != nil {
 		return nil, err
 	}
+	// Attach the ancient block store if enabled or already holding blocks
+	ancient := cfg.Node.AncientDir
+	if ancient == "" {
+		ancient = filepath.Join(cfg.Node.ResolvePath(name), "ancient")
+	}
+	if cfg.Node.AncientDepth > 0 || common.FileExist(ancient) {
+		freezer, err := hpbdb.NewFreezer(ancient)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		db.SetFreezer(freezer)
+	}
 	DBINSTANCE.Store(db)
 
 	return db, nil
 }
 
-func GetHpbDbInstance() (*hpbdb.LDBDatabase) {
+func GetHpbDbInstance() hpbdb.Database {
 	if DBINSTANCE.Load() != nil {
-		return DBINSTANCE.Load().(*hpbdb.LDBDatabase)
+		return DBINSTANCE.Load().(hpbdb.Database)
 	}
-	log.Warn("LDBDatabase is nil, please init tx pool first.")
+	log.Warn("Database is nil, please init tx pool first.")
 	return nil
 }
\ No newline at end of file
@@ -55,6 +55,7 @@ import (
 	"github.com/hpb-project/go-hpb/worker"
 	"github.com/hpb-project/go-hpb/node/db"
 	"github.com/hpb-project/go-hpb/node/gasprice"
+	"github.com/hpb-project/go-hpb/light"
 	"github.com/hpb-project/go-hpb/boe"
 )
 
@@ -86,6 +87,9 @@ type Node struct {
 	//accountManager  *accounts.Manager
 	bloomRequests   chan chan *bloombits.Retrieval // Channel receiving bloom data retrieval requests
 	bloomIndexer    *bc.ChainIndexer             // Bloom indexer operating during block imports
+	chtIndexer      *bc.ChainIndexer             // Canonical hash trie indexer operating during block imports
+
+	lightHeadFeed sub.Feed // Chain events of the header chain of a light client
 
 	// Channel for shutting down the service
 	shutdownChan  chan bool    // Channel for shutting down the hpb
@@ -105,6 +109,7 @@ type Node struct {
 
 	lock sync.RWMutex
 	ApiBackend *HpbApiBackend
+	LightBackend *LightApiBackend // Non-nil if the node runs as a light client
 
 	RpcAPIs       []rpc.API   // List of APIs currently provided by the node
 
@@ -223,6 +228,7 @@ func New(conf  *config.HpbConfig) (*Node, error){
 	hpbnode.Hpbbc = bc.InstanceBlockChain()
 
 	peermanager.RegChanStatus(hpbnode.Hpbbc.Status)
+	peermanager.RegForkID(hpbnode.Hpbbc.ForkID, hpbnode.Hpbbc.ForkFilter)
 
 
 	txpool.NewTxPool(conf.TxPool, &conf.BlockChain, hpbnode.Hpbbc)
@@ -238,6 +244,12 @@ func New(conf  *config.HpbConfig) (*Node, error){
 
 	hpbnode.ApiBackend.gpo = gasprice.NewOracle(hpbnode.ApiBackend, gpoParams)
 	hpbnode.bloomIndexer = NewBloomIndexer(hpbdatabase, params.BloomBitsBlocks)
+	hpbnode.chtIndexer = light.NewChtIndexer(hpbdatabase)
+
+	if conf.Node.SyncMode == config.LightSync {
+		hpbnode.LightBackend = &LightApiBackend{hpbnode, nil}
+		hpbnode.LightBackend.gpo = gasprice.NewOracle(hpbnode.LightBackend, gpoParams)
+	}
 	return hpbnode, nil
 }
 func (hpbnode *Node) WorkerInit(conf  *config.HpbConfig) error{
@@ -258,11 +270,29 @@ func (hpbnode *Node) WorkerInit(conf  *config.HpbConfig) error{
 			log.Error("add engine to blockchain error")
 			return err
 		}
+		if conf.Node.AncientDepth > 0 {
+			if err := hpbnode.Hpbbc.StartFreezer(conf.Node.AncientDepth); err != nil {
+				return err
+			}
+		}
 		hpbnode.Hpbsyncctr = synctrl.InstanceSynCtrl()
 		hpbnode.newBlockMux = hpbnode.Hpbsyncctr.NewBlockMux()
 
 		hpbnode.miner = worker.New(&conf.BlockChain, hpbnode.NewBlockMux(), hpbnode.Hpbengine,hpbnode.hpberbase)
-		hpbnode.bloomIndexer.Start(hpbnode.Hpbbc.CurrentHeader(), hpbnode.Hpbbc.SubscribeChainEvent)
+		if conf.Node.GasTarget != nil {
+			if err := hpbnode.miner.SetGasTarget(conf.Node.GasTarget); err != nil {
+				return err
+			}
+		}
+		if hpbnode.LightBackend != nil {
+			// Light clients only import headers, which post no chain events
+			hpbnode.bloomIndexer.Start(hpbnode.Hpbbc.CurrentHeader(), hpbnode.SubscribeLightHeadEvent)
+			hpbnode.chtIndexer.Start(hpbnode.Hpbbc.CurrentHeader(), hpbnode.SubscribeLightHeadEvent)
+			go hpbnode.lightHeadLoop()
+		} else {
+			hpbnode.bloomIndexer.Start(hpbnode.Hpbbc.CurrentHeader(), hpbnode.Hpbbc.SubscribeChainEvent)
+			hpbnode.chtIndexer.Start(hpbnode.Hpbbc.CurrentHeader(), hpbnode.Hpbbc.SubscribeChainEvent)
+		}
 
 	}else{
 		return errors.New(`The genesis block is not inited`)
@@ -270,6 +300,32 @@ func (hpbnode *Node) WorkerInit(conf  *config.HpbConfig) error{
 	return nil
 }
 
+// SubscribeLightHeadEvent registers a subscription of the chain events of the
+// header chain of a light client.
+func (hpbnode *Node) SubscribeLightHeadEvent(ch chan<- bc.ChainEvent) sub.Subscription {
+	return hpbnode.lightHeadFeed.Subscribe(ch)
+}
+
+// lightHeadLoop announces the new head of the header chain whenever a sync
+// cycle of a light client finishes, driving the chain indexers.
+func (hpbnode *Node) lightHeadLoop() {
+	events := hpbnode.newBlockMux.Subscribe(synctrl.DoneEvent{})
+	defer events.Unsubscribe()
+
+	for {
+		select {
+		case ev := <-events.Chan():
+			if ev == nil {
+				return
+			}
+			head := hpbnode.Hpbbc.CurrentHeader()
+			hpbnode.lightHeadFeed.Send(bc.ChainEvent{Block: types.NewBlockWithHeader(head), Hash: head.Hash()})
+		case <-hpbnode.stop:
+			return
+		}
+	}
+}
+
 func (hpbnode *Node) Start(conf  *config.HpbConfig) (error){
 
 
@@ -374,6 +430,7 @@ func (n *Node) Stop() error {
 	n.Hpbtxpool.Stop()
 	n.miner.Stop()
 	n.Hpbpeermanager.Stop()
+	n.Hpbbc.Stop()
 
 	// Release instance directory lock.
 	if n.instanceDirLock != nil {
@@ -67,6 +67,7 @@ type SynCtrl struct {
 
 	syner  *Syncer
 	puller *Puller
+	odr    *LightRetriever
 
 	SubProtocols []p2p.Protocol
 
@@ -125,6 +126,7 @@ func newSynCtrl(cfg *config.ChainConfig, mode config.SyncMode, txpoolins *txpool
 	}
 	// Construct the different synchronisation mechanisms
 	synctrl.syner = NewSyncer(mode, db.GetHpbDbInstance(), synctrl.newBlockMux, nil, synctrl.removePeer)
+	synctrl.odr = NewLightRetriever(db.GetHpbDbInstance())
 
 	validator := func(header *types.Header) error {
 		return engine.VerifyHeader(bc.InstanceBlockChain(), header, true)
@@ -151,6 +153,22 @@ func newSynCtrl(cfg *config.ChainConfig, mode config.SyncMode, txpoolins *txpool
 	p2p.PeerMgrInst().RegMsgProcess(p2p.NodeDataMsg, HandleNodeDataMsg)
 	p2p.PeerMgrInst().RegMsgProcess(p2p.GetReceiptsMsg, HandleGetReceiptsMsg)
 	p2p.PeerMgrInst().RegMsgProcess(p2p.ReceiptsMsg, HandleReceiptsMsg)
+	p2p.PeerMgrInst().RegMsgProcess(p2p.GetAccountRangeMsg, HandleGetAccountRangeMsg)
+	p2p.PeerMgrInst().RegMsgProcess(p2p.AccountRangeMsg, HandleAccountRangeMsg)
+	p2p.PeerMgrInst().RegMsgProcess(p2p.GetStorageRangesMsg, HandleGetStorageRangesMsg)
+	p2p.PeerMgrInst().RegMsgProcess(p2p.StorageRangesMsg, HandleStorageRangesMsg)
+	p2p.PeerMgrInst().RegMsgProcess(p2p.GetByteCodesMsg, HandleGetByteCodesMsg)
+	p2p.PeerMgrInst().RegMsgProcess(p2p.ByteCodesMsg, HandleByteCodesMsg)
+	p2p.PeerMgrInst().RegMsgProcess(p2p.GetProofsMsg, HandleGetProofsMsg)
+	p2p.PeerMgrInst().RegMsgProcess(p2p.ProofsMsg, HandleProofsMsg)
+	p2p.PeerMgrInst().RegMsgProcess(p2p.GetCodeMsg, HandleGetCodeMsg)
+	p2p.PeerMgrInst().RegMsgProcess(p2p.CodeMsg, HandleCodeMsg)
+	p2p.PeerMgrInst().RegMsgProcess(p2p.GetHeaderProofsMsg, HandleGetHeaderProofsMsg)
+	p2p.PeerMgrInst().RegMsgProcess(p2p.HeaderProofsMsg, HandleHeaderProofsMsg)
+	p2p.PeerMgrInst().RegMsgProcess(p2p.GetLightBodiesMsg, HandleGetLightBodiesMsg)
+	p2p.PeerMgrInst().RegMsgProcess(p2p.LightBodiesMsg, HandleLightBodiesMsg)
+	p2p.PeerMgrInst().RegMsgProcess(p2p.GetLightReceiptsMsg, HandleGetLightReceiptsMsg)
+	p2p.PeerMgrInst().RegMsgProcess(p2p.LightReceiptsMsg, HandleLightReceiptsMsg)
 	p2p.PeerMgrInst().RegMsgProcess(p2p.NewBlockHashesMsg, HandleNewBlockHashesMsg)
 	p2p.PeerMgrInst().RegMsgProcess(p2p.NewBlockMsg, HandleNewBlockMsg)
 	p2p.PeerMgrInst().RegMsgProcess(p2p.NewHashBlockMsg, HandleNewHashBlockMsg)
@@ -167,6 +185,11 @@ func (this *SynCtrl) NewBlockMux() *sub.TypeMux{
 	return this.newBlockMux
 }
 
+// LightRetriever returns the on-demand retriever serving the light client.
+func (this *SynCtrl) LightRetriever() *LightRetriever {
+	return this.odr
+}
+
 func (this *SynCtrl) Start() {
 	// broadcast transactions
 	this.txCh = make(chan bc.TxPreEvent, txChanSize)
@@ -594,9 +617,10 @@ func HandleGetNodeDataMsg(p *p2p.Peer, msg p2p.Msg) error {
 	}
 	// Gather state data until the fetch or network limits is reached
 	var (
-		hash  common.Hash
-		bytes int
-		data  [][]byte
+		hash   common.Hash
+		bytes  int
+		data   [][]byte
+		triedb = bc.InstanceBlockChain().TrieDB()
 	)
 	for bytes < softResponseLimit && len(data) < MaxStateFetch {
 		// Retrieve the hash of the next state entry
@@ -605,8 +629,9 @@ func HandleGetNodeDataMsg(p *p2p.Peer, msg p2p.Msg) error {
 		} else if err != nil {
 			return p2p.ErrResp(p2p.ErrDecode, "msg %v: %v", msg, err)
 		}
-		// Retrieve the requested state entry, stopping if enough was found
-		if entry, err := db.GetHpbDbInstance().Get(hash.Bytes()); err == nil {
+		// Retrieve the requested state entry, stopping if enough was found. Nodes
+		// of recent states may only be held by the trie node cache.
+		if entry, err := triedb.Get(hash.Bytes()); err == nil {
 			data = append(data, entry)
 			bytes += len(entry)
 		}
@@ -628,6 +653,174 @@ func HandleNodeDataMsg(p *p2p.Peer, msg p2p.Msg) error {
 	return nil
 }
 
+// HandleGetAccountRangeMsg deal received GetAccountRangeMsg
+func HandleGetAccountRangeMsg(p *p2p.Peer, msg p2p.Msg) error {
+	var req getAccountRangeData
+	if err := msg.Decode(&req); err != nil {
+		return p2p.ErrResp(p2p.ErrDecode, "msg %v: %v", msg, err)
+	}
+	return sendAccountRange(p, serviceAccountRange(bc.InstanceBlockChain().TrieDB(), &req))
+}
+
+// HandleAccountRangeMsg deal received AccountRangeMsg
+func HandleAccountRangeMsg(p *p2p.Peer, msg p2p.Msg) error {
+	var res accountRangeData
+	if err := msg.Decode(&res); err != nil {
+		return p2p.ErrResp(p2p.ErrDecode, "msg %v: %v", msg, err)
+	}
+	if err := InstanceSynCtrl().syner.DeliverAccountRange(p.GetID(), &res); err != nil {
+		log.Debug("Failed to deliver account range", "err", err)
+	}
+	return nil
+}
+
+// HandleGetStorageRangesMsg deal received GetStorageRangesMsg
+func HandleGetStorageRangesMsg(p *p2p.Peer, msg p2p.Msg) error {
+	var req getStorageRangesData
+	if err := msg.Decode(&req); err != nil {
+		return p2p.ErrResp(p2p.ErrDecode, "msg %v: %v", msg, err)
+	}
+	return sendStorageRanges(p, serviceStorageRanges(bc.InstanceBlockChain().TrieDB(), &req))
+}
+
+// HandleStorageRangesMsg deal received StorageRangesMsg
+func HandleStorageRangesMsg(p *p2p.Peer, msg p2p.Msg) error {
+	var res storageRangesData
+	if err := msg.Decode(&res); err != nil {
+		return p2p.ErrResp(p2p.ErrDecode, "msg %v: %v", msg, err)
+	}
+	if err := InstanceSynCtrl().syner.DeliverStorageRanges(p.GetID(), &res); err != nil {
+		log.Debug("Failed to deliver storage ranges", "err", err)
+	}
+	return nil
+}
+
+// HandleGetByteCodesMsg deal received GetByteCodesMsg
+func HandleGetByteCodesMsg(p *p2p.Peer, msg p2p.Msg) error {
+	var req getByteCodesData
+	if err := msg.Decode(&req); err != nil {
+		return p2p.ErrResp(p2p.ErrDecode, "msg %v: %v", msg, err)
+	}
+	return sendByteCodes(p, serviceByteCodes(bc.InstanceBlockChain().TrieDB(), &req))
+}
+
+// HandleByteCodesMsg deal received ByteCodesMsg
+func HandleByteCodesMsg(p *p2p.Peer, msg p2p.Msg) error {
+	var res byteCodesData
+	if err := msg.Decode(&res); err != nil {
+		return p2p.ErrResp(p2p.ErrDecode, "msg %v: %v", msg, err)
+	}
+	if err := InstanceSynCtrl().syner.DeliverByteCodes(p.GetID(), &res); err != nil {
+		log.Debug("Failed to deliver byte codes", "err", err)
+	}
+	return nil
+}
+
+// HandleGetProofsMsg deal received GetProofsMsg
+func HandleGetProofsMsg(p *p2p.Peer, msg p2p.Msg) error {
+	var req getProofsData
+	if err := msg.Decode(&req); err != nil {
+		return p2p.ErrResp(p2p.ErrDecode, "msg %v: %v", msg, err)
+	}
+	return sendProofs(p, serviceProofs(db.GetHpbDbInstance(), bc.InstanceBlockChain().TrieDB(), &req))
+}
+
+// HandleProofsMsg deal received ProofsMsg
+func HandleProofsMsg(p *p2p.Peer, msg p2p.Msg) error {
+	var res proofsData
+	if err := msg.Decode(&res); err != nil {
+		return p2p.ErrResp(p2p.ErrDecode, "msg %v: %v", msg, err)
+	}
+	if err := InstanceSynCtrl().odr.deliver(p.GetID(), res.ID, &res); err != nil {
+		log.Debug("Failed to deliver proofs", "err", err)
+	}
+	return nil
+}
+
+// HandleGetCodeMsg deal received GetCodeMsg
+func HandleGetCodeMsg(p *p2p.Peer, msg p2p.Msg) error {
+	var req getByteCodesData
+	if err := msg.Decode(&req); err != nil {
+		return p2p.ErrResp(p2p.ErrDecode, "msg %v: %v", msg, err)
+	}
+	return sendCode(p, serviceByteCodes(bc.InstanceBlockChain().TrieDB(), &req))
+}
+
+// HandleCodeMsg deal received CodeMsg
+func HandleCodeMsg(p *p2p.Peer, msg p2p.Msg) error {
+	var res byteCodesData
+	if err := msg.Decode(&res); err != nil {
+		return p2p.ErrResp(p2p.ErrDecode, "msg %v: %v", msg, err)
+	}
+	if err := InstanceSynCtrl().odr.deliver(p.GetID(), res.ID, &res); err != nil {
+		log.Debug("Failed to deliver code", "err", err)
+	}
+	return nil
+}
+
+// HandleGetHeaderProofsMsg deal received GetHeaderProofsMsg
+func HandleGetHeaderProofsMsg(p *p2p.Peer, msg p2p.Msg) error {
+	var req getHeaderProofsData
+	if err := msg.Decode(&req); err != nil {
+		return p2p.ErrResp(p2p.ErrDecode, "msg %v: %v", msg, err)
+	}
+	return sendHeaderProofs(p, serviceHeaderProofs(db.GetHpbDbInstance(), &req))
+}
+
+// HandleHeaderProofsMsg deal received HeaderProofsMsg
+func HandleHeaderProofsMsg(p *p2p.Peer, msg p2p.Msg) error {
+	var res headerProofsData
+	if err := msg.Decode(&res); err != nil {
+		return p2p.ErrResp(p2p.ErrDecode, "msg %v: %v", msg, err)
+	}
+	if err := InstanceSynCtrl().odr.deliver(p.GetID(), res.ID, &res); err != nil {
+		log.Debug("Failed to deliver header proofs", "err", err)
+	}
+	return nil
+}
+
+// HandleGetLightBodiesMsg deal received GetLightBodiesMsg
+func HandleGetLightBodiesMsg(p *p2p.Peer, msg p2p.Msg) error {
+	var req getLightBlocksData
+	if err := msg.Decode(&req); err != nil {
+		return p2p.ErrResp(p2p.ErrDecode, "msg %v: %v", msg, err)
+	}
+	return sendLightBodies(p, serviceLightBodies(db.GetHpbDbInstance(), &req))
+}
+
+// HandleLightBodiesMsg deal received LightBodiesMsg
+func HandleLightBodiesMsg(p *p2p.Peer, msg p2p.Msg) error {
+	var res lightBodiesData
+	if err := msg.Decode(&res); err != nil {
+		return p2p.ErrResp(p2p.ErrDecode, "msg %v: %v", msg, err)
+	}
+	if err := InstanceSynCtrl().odr.deliver(p.GetID(), res.ID, &res); err != nil {
+		log.Debug("Failed to deliver light bodies", "err", err)
+	}
+	return nil
+}
+
+// HandleGetLightReceiptsMsg deal received GetLightReceiptsMsg
+func HandleGetLightReceiptsMsg(p *p2p.Peer, msg p2p.Msg) error {
+	var req getLightBlocksData
+	if err := msg.Decode(&req); err != nil {
+		return p2p.ErrResp(p2p.ErrDecode, "msg %v: %v", msg, err)
+	}
+	return sendLightReceipts(p, serviceLightReceipts(db.GetHpbDbInstance(), &req))
+}
+
+// HandleLightReceiptsMsg deal received LightReceiptsMsg
+func HandleLightReceiptsMsg(p *p2p.Peer, msg p2p.Msg) error {
+	var res lightReceiptsData
+	if err := msg.Decode(&res); err != nil {
+		return p2p.ErrResp(p2p.ErrDecode, "msg %v: %v", msg, err)
+	}
+	if err := InstanceSynCtrl().odr.deliver(p.GetID(), res.ID, &res); err != nil {
+		log.Debug("Failed to deliver light receipts", "err", err)
+	}
+	return nil
+}
+
 // HandleGetReceiptsMsg deal received GetReceiptsMsg
 func HandleGetReceiptsMsg(p *p2p.Peer, msg p2p.Msg) error {
 	// Decode the retrieval message
@@ -115,6 +115,120 @@ type blockBody struct {
 // blockBodiesData is the network packet for block content distribution.
 type blockBodiesData []*blockBody
 
+// getAccountRangeData represents a query for a consecutive range of accounts
+// of a state trie.
+type getAccountRangeData struct {
+	ID     uint64      // Request ID to match up the response with
+	Root   common.Hash // Root hash of the account trie to serve
+	Origin common.Hash // Hash of the first account to retrieve
+	Limit  common.Hash // Hash of the last account to retrieve
+	Bytes  uint64      // Soft limit at which to stop returning data
+}
+
+// accountRangeData is the network packet for a range of accounts, along with
+// the merkle proofs of its edges.
+type accountRangeData struct {
+	ID       uint64         // Request ID of the query being answered
+	Accounts []*accountData // Consecutive accounts from the trie
+	Proof    []rlp.RawValue // Merkle proofs of the first and last account
+}
+
+// accountData is a single account of an account range.
+type accountData struct {
+	Hash common.Hash  // Hash of the account address
+	Body rlp.RawValue // RLP encoded account
+}
+
+// getStorageRangesData represents a query for the storage slots of a batch
+// of accounts. Only the first account is served from Origin on, the rest of
+// them from their first slot.
+type getStorageRangesData struct {
+	ID       uint64        // Request ID to match up the response with
+	Root     common.Hash   // Root hash of the account trie to serve
+	Accounts []common.Hash // Account hashes of the storage tries to serve
+	Origin   common.Hash   // Hash of the first storage slot to retrieve
+	Limit    common.Hash   // Hash of the last storage slot to retrieve
+	Bytes    uint64        // Soft limit at which to stop returning data
+}
+
+// storageRangesData is the network packet for the storage slots of a batch of
+// accounts. Only the last storage range may be partial, in which case the
+// merkle proofs of its edges are attached.
+type storageRangesData struct {
+	ID    uint64         // Request ID of the query being answered
+	Slots [][]*slotData  // Consecutive storage slots of the requested accounts
+	Proof []rlp.RawValue // Merkle proofs of the edges of the last range
+}
+
+// slotData is a single storage slot of a storage range.
+type slotData struct {
+	Hash common.Hash // Hash of the storage slot key
+	Body []byte      // RLP encoded storage value
+}
+
+// getByteCodesData represents a query for contract codes.
+type getByteCodesData struct {
+	ID     uint64        // Request ID to match up the response with
+	Hashes []common.Hash // Code hashes to retrieve
+	Bytes  uint64        // Soft limit at which to stop returning data
+}
+
+// byteCodesData is the network packet for contract codes.
+type byteCodesData struct {
+	ID    uint64   // Request ID of the query being answered
+	Codes [][]byte // Requested contract codes, unknown ones left out
+}
+
+// getProofsData represents a query for the merkle proof of a key in the
+// account trie or a storage trie of the state of a block.
+type getProofsData struct {
+	ID     uint64      // Request ID to match up the response with
+	BHash  common.Hash // Hash of the block the state belongs to
+	AccKey []byte      // Hashed address of the account owning the storage trie, empty for the account trie
+	Key    []byte      // Hashed key to prove
+}
+
+// proofsData is the network packet for a merkle proof.
+type proofsData struct {
+	ID    uint64         // Request ID of the query being answered
+	Nodes []rlp.RawValue // Trie nodes on the path to the key
+}
+
+// getHeaderProofsData represents a query for a canonical header along with its
+// merkle proof in the canonical hash trie of its section.
+type getHeaderProofsData struct {
+	ID       uint64 // Request ID to match up the response with
+	ChtNum   uint64 // Section of the canonical hash trie
+	BlockNum uint64 // Number of the block to retrieve the header of
+}
+
+// headerProofsData is the network packet for a proven canonical header.
+type headerProofsData struct {
+	ID      uint64          // Request ID of the query being answered
+	Headers []*types.Header // Requested header, empty if unknown
+	Proof   []rlp.RawValue  // Merkle proof of the block number
+}
+
+// getLightBlocksData represents a query for the bodies or receipts of blocks.
+type getLightBlocksData struct {
+	ID     uint64        // Request ID to match up the response with
+	Hashes []common.Hash // Hashes of the blocks to retrieve the data of
+}
+
+// lightBodiesData is the network packet for block bodies answering a light
+// client query.
+type lightBodiesData struct {
+	ID     uint64       // Request ID of the query being answered
+	Bodies []*blockBody // Requested block bodies, up to the first unknown one
+}
+
+// lightReceiptsData is the network packet for block receipts answering a light
+// client query.
+type lightReceiptsData struct {
+	ID       uint64             // Request ID of the query being answered
+	Receipts [][]*types.Receipt // Requested block receipts, up to the first unknown one
+}
+
 func sendNewBlock(peer *p2p.Peer, block *types.Block, td *big.Int) error {
 	peer.KnownBlockAdd(block.Hash())
 	return p2p.SendData(peer,p2p.NewBlockMsg, []interface{}{block, td})
@@ -160,6 +274,46 @@ func sendNodeData(peer *p2p.Peer, data [][]byte) error {
 	return p2p.SendData(peer,p2p.NodeDataMsg, data)
 }
 
+// sendAccountRange sends a range of accounts along with its edge proofs.
+func sendAccountRange(peer *p2p.Peer, data *accountRangeData) error {
+	return p2p.SendData(peer,p2p.AccountRangeMsg, data)
+}
+
+// sendStorageRanges sends the storage ranges of a batch of accounts.
+func sendStorageRanges(peer *p2p.Peer, data *storageRangesData) error {
+	return p2p.SendData(peer,p2p.StorageRangesMsg, data)
+}
+
+// sendByteCodes sends a batch of contract codes.
+func sendByteCodes(peer *p2p.Peer, data *byteCodesData) error {
+	return p2p.SendData(peer,p2p.ByteCodesMsg, data)
+}
+
+// sendProofs sends a merkle proof of a state key.
+func sendProofs(peer *p2p.Peer, data *proofsData) error {
+	return p2p.SendData(peer,p2p.ProofsMsg, data)
+}
+
+// sendCode sends a batch of contract codes to a light client.
+func sendCode(peer *p2p.Peer, data *byteCodesData) error {
+	return p2p.SendData(peer,p2p.CodeMsg, data)
+}
+
+// sendHeaderProofs sends a canonical header along with its merkle proof.
+func sendHeaderProofs(peer *p2p.Peer, data *headerProofsData) error {
+	return p2p.SendData(peer,p2p.HeaderProofsMsg, data)
+}
+
+// sendLightBodies sends a batch of block bodies to a light client.
+func sendLightBodies(peer *p2p.Peer, data *lightBodiesData) error {
+	return p2p.SendData(peer,p2p.LightBodiesMsg, data)
+}
+
+// sendLightReceipts sends a batch of block receipts to a light client.
+func sendLightReceipts(peer *p2p.Peer, data *lightReceiptsData) error {
+	return p2p.SendData(peer,p2p.LightReceiptsMsg, data)
+}
+
 // sendReceiptsRLP sends a batch of transaction receipts, corresponding to the
 // ones requested from an already RLP encoded format.
 func sendReceiptsRLP(peer *p2p.Peer, receipts []rlp.RawValue) error {
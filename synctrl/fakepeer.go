@@ -157,3 +157,27 @@ func (p *FakePeer) RequestNodeData(hashes []common.Hash) error {
 	p.syncer.DeliverNodeData(p.id, data)
 	return nil
 }
+
+// RequestAccountRange implements syncer.Peer, returning a range of accounts
+// of the specified state trie.
+func (p *FakePeer) RequestAccountRange(id uint64, root, origin, limit common.Hash, bytes uint64) error {
+	res := serviceAccountRange(p.db, &getAccountRangeData{ID: id, Root: root, Origin: origin, Limit: limit, Bytes: bytes})
+	p.syncer.DeliverAccountRange(p.id, res)
+	return nil
+}
+
+// RequestStorageRanges implements syncer.Peer, returning the storage ranges of
+// the specified accounts.
+func (p *FakePeer) RequestStorageRanges(id uint64, root common.Hash, accounts []common.Hash, origin, limit common.Hash, bytes uint64) error {
+	res := serviceStorageRanges(p.db, &getStorageRangesData{ID: id, Root: root, Accounts: accounts, Origin: origin, Limit: limit, Bytes: bytes})
+	p.syncer.DeliverStorageRanges(p.id, res)
+	return nil
+}
+
+// RequestByteCodes implements syncer.Peer, returning a batch of contract codes
+// corresponding to the specified code hashes.
+func (p *FakePeer) RequestByteCodes(id uint64, hashes []common.Hash, bytes uint64) error {
+	res := serviceByteCodes(p.db, &getByteCodesData{ID: id, Hashes: hashes, Bytes: bytes})
+	p.syncer.DeliverByteCodes(p.id, res)
+	return nil
+}
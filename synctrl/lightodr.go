@@ -0,0 +1,230 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package synctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/blockchain/types"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/log"
+	"github.com/hpb-project/go-hpb/light"
+	"github.com/hpb-project/go-hpb/network/p2p"
+)
+
+// lightRequestTimeout is the time a peer is given to answer a light request
+// before it is asked of the next peer.
+var lightRequestTimeout = 5 * time.Second
+
+var errLightTimeout = errors.New("light request timed out")
+
+// LightRetriever implements light.OdrBackend, retrieving the requests of the
+// light client from the connected peers one at a time and verifying the
+// answers before they are stored locally.
+type LightRetriever struct {
+	db    hpbdb.Database
+	peers func() []lightPeer // Connected peers, replaceable for testing
+
+	pending map[uint64]*lightPending // Requests waiting for an answer
+	nextID  uint64
+	lock    sync.Mutex
+}
+
+// lightPending is a request in flight to a peer.
+type lightPending struct {
+	peer    string
+	deliver chan interface{}
+}
+
+// lightPeer is a remote node light requests are sent to.
+type lightPeer interface {
+	GetID() string
+	GetVersion() uint
+	SendData(msgCode uint64, data interface{}) error
+}
+
+// lightNetPeer sends the light requests to a peer connected over the network.
+type lightNetPeer struct {
+	*p2p.Peer
+}
+
+func (p lightNetPeer) SendData(msgCode uint64, data interface{}) error {
+	return p2p.SendData(p.Peer, msgCode, data)
+}
+
+// lightNetPeers returns all peers connected over the network.
+func lightNetPeers() []lightPeer {
+	var peers []lightPeer
+	for _, p := range p2p.PeerMgrInst().PeersAll() {
+		peers = append(peers, lightNetPeer{p})
+	}
+	return peers
+}
+
+// NewLightRetriever creates a retriever storing the retrieved data into db.
+func NewLightRetriever(db hpbdb.Database) *LightRetriever {
+	return &LightRetriever{
+		db:      db,
+		peers:   lightNetPeers,
+		pending: make(map[uint64]*lightPending),
+		nextID:  uint64(time.Now().UnixNano()),
+	}
+}
+
+// Database implements light.OdrBackend, returning the local database.
+func (r *LightRetriever) Database() hpbdb.Database {
+	return r.db
+}
+
+// Retrieve implements light.OdrBackend, asking the peers for the request in
+// random order until one of them answers it with valid data. Peers predating
+// hpb/102 don't serve light requests and are never asked.
+func (r *LightRetriever) Retrieve(ctx context.Context, req light.OdrRequest) error {
+	var peers []lightPeer
+	for _, p := range r.peers() {
+		if p.GetVersion() >= p2p.ProtoVersion102 {
+			peers = append(peers, p)
+		}
+	}
+	if len(peers) == 0 {
+		return light.ErrNoPeers
+	}
+	for _, i := range rand.Perm(len(peers)) {
+		p := peers[i]
+
+		id, pending := r.register(p.GetID())
+		err := r.request(p, id, req)
+		if err == nil {
+			select {
+			case res := <-pending.deliver:
+				err = r.validate(req, res)
+			case <-time.After(lightRequestTimeout):
+				err = errLightTimeout
+			case <-ctx.Done():
+				r.unregister(id)
+				return ctx.Err()
+			}
+		}
+		r.unregister(id)
+
+		if err == nil {
+			req.StoreResult(r.db)
+			return nil
+		}
+		log.Debug("Light request failed", "peer", p.GetID(), "type", fmt.Sprintf("%T", req), "err", err)
+	}
+	return light.ErrNoPeers
+}
+
+// register allocates the ID of a request to the peer.
+func (r *LightRetriever) register(peer string) (uint64, *lightPending) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.nextID++
+	pending := &lightPending{peer: peer, deliver: make(chan interface{}, 1)}
+	r.pending[r.nextID] = pending
+	return r.nextID, pending
+}
+
+// unregister drops a request that is no longer waited for.
+func (r *LightRetriever) unregister(id uint64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.pending, id)
+}
+
+// deliver hands an answer received from a peer over to the request waiting
+// for it.
+func (r *LightRetriever) deliver(peer string, id uint64, res interface{}) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	pending := r.pending[id]
+	if pending == nil || pending.peer != peer {
+		return errNoSyncActive
+	}
+	select {
+	case pending.deliver <- res:
+	default:
+	}
+	return nil
+}
+
+// request sends the network query of a light request to the peer.
+func (r *LightRetriever) request(p lightPeer, id uint64, req light.OdrRequest) error {
+	switch req := req.(type) {
+	case *light.TrieRequest:
+		return p.SendData(p2p.GetProofsMsg, &getProofsData{ID: id, BHash: req.BlockHash, AccKey: req.AccKey, Key: req.Key})
+	case *light.CodeRequest:
+		return p.SendData(p2p.GetCodeMsg, &getByteCodesData{ID: id, Hashes: []common.Hash{req.Hash}, Bytes: softResponseLimit})
+	case *light.ChtRequest:
+		return p.SendData(p2p.GetHeaderProofsMsg, &getHeaderProofsData{ID: id, ChtNum: req.ChtNum, BlockNum: req.BlockNum})
+	case *light.BlockRequest:
+		return p.SendData(p2p.GetLightBodiesMsg, &getLightBlocksData{ID: id, Hashes: []common.Hash{req.Header.Hash()}})
+	case *light.ReceiptsRequest:
+		return p.SendData(p2p.GetLightReceiptsMsg, &getLightBlocksData{ID: id, Hashes: []common.Hash{req.Header.Hash()}})
+	}
+	return fmt.Errorf("unknown light request %T", req)
+}
+
+// validate checks the answer of a peer against the request, filling the
+// request in if it holds.
+func (r *LightRetriever) validate(req light.OdrRequest, res interface{}) error {
+	switch req := req.(type) {
+	case *light.TrieRequest:
+		if res, ok := res.(*proofsData); ok {
+			return req.Validate(res.Nodes)
+		}
+	case *light.CodeRequest:
+		if res, ok := res.(*byteCodesData); ok {
+			if len(res.Codes) != 1 {
+				return errors.New("code unavailable")
+			}
+			return req.Validate(res.Codes[0])
+		}
+	case *light.ChtRequest:
+		if res, ok := res.(*headerProofsData); ok {
+			if len(res.Headers) != 1 {
+				return errors.New("header proof unavailable")
+			}
+			return req.Validate(res.Headers[0], res.Proof)
+		}
+	case *light.BlockRequest:
+		if res, ok := res.(*lightBodiesData); ok {
+			if len(res.Bodies) != 1 {
+				return errors.New("block body unavailable")
+			}
+			return req.Validate(&types.Body{Transactions: res.Bodies[0].Transactions, Uncles: res.Bodies[0].Uncles})
+		}
+	case *light.ReceiptsRequest:
+		if res, ok := res.(*lightReceiptsData); ok {
+			if len(res.Receipts) != 1 {
+				return errors.New("block receipts unavailable")
+			}
+			return req.Validate(res.Receipts[0])
+		}
+	}
+	return fmt.Errorf("mismatching answer %T to %T", res, req)
+}
@@ -0,0 +1,417 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package synctrl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hpb-project/go-hpb/blockchain"
+	"github.com/hpb-project/go-hpb/blockchain/state"
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/blockchain/types"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/crypto"
+	"github.com/hpb-project/go-hpb/common/rlp"
+	"github.com/hpb-project/go-hpb/event/sub"
+	"github.com/hpb-project/go-hpb/light"
+	"github.com/hpb-project/go-hpb/network/p2p"
+)
+
+var (
+	lightTestAccount  = common.HexToAddress("0x0100000000000000000000000000000000000001")
+	lightTestContract = common.HexToAddress("0x0200000000000000000000000000000000000002")
+	lightTestCode     = []byte{0x60, 0x01, 0x60, 0x00, 0x55}
+	lightTestSlot     = common.HexToHash("0x01")
+)
+
+// lightTestBlock is the number of the block holding the transactions and
+// receipts the light client retrieves.
+const lightTestBlock = 100
+
+// lightTestServer is a server chain for the light client tests: a canonical
+// chain of empty headers long enough for its first canonical hash trie section
+// to be built, all of them on a state holding a plain account and a contract.
+type lightTestServer struct {
+	db       *hpbdb.MemDatabase
+	headers  []*types.Header
+	txs      types.Transactions
+	receipts types.Receipts
+}
+
+func newLightTestServer(t *testing.T) *lightTestServer {
+	db, _ := hpbdb.NewMemDatabase()
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	statedb.AddBalance(lightTestAccount, big.NewInt(1000000))
+	statedb.SetNonce(lightTestAccount, 3)
+	statedb.SetCode(lightTestContract, lightTestCode)
+	statedb.SetState(lightTestContract, lightTestSlot, common.HexToHash("0x2a"))
+	root, err := statedb.CommitTo(db, false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	server := &lightTestServer{db: db}
+	for i := 0; i < 3; i++ {
+		server.txs = append(server.txs, types.NewTransaction(uint64(i), lightTestContract, big.NewInt(1), big.NewInt(21000), big.NewInt(1), nil))
+		server.receipts = append(server.receipts, types.NewReceipt(root[:], false, big.NewInt(int64(21000*(i+1)))))
+	}
+	var (
+		parent common.Hash
+		td     = new(big.Int)
+	)
+	for i := 0; i < light.ChtFrequency+light.ChtConfirmations; i++ {
+		header := &types.Header{
+			ParentHash:  parent,
+			UncleHash:   types.EmptyUncleHash,
+			VoteIndex:   new(big.Int),
+			Root:        root,
+			TxHash:      types.EmptyRootHash,
+			ReceiptHash: types.EmptyRootHash,
+			Difficulty:  big.NewInt(1),
+			Number:      big.NewInt(int64(i)),
+			GasLimit:    big.NewInt(8000000),
+			GasUsed:     new(big.Int),
+			Time:        big.NewInt(int64(i)),
+		}
+		if i == lightTestBlock {
+			header.TxHash = types.DeriveSha(server.txs)
+			header.ReceiptHash = types.DeriveSha(server.receipts)
+			header.GasUsed = big.NewInt(int64(21000 * len(server.txs)))
+		}
+		hash := header.Hash()
+		td.Add(td, header.Difficulty)
+
+		bc.WriteHeader(db, header)
+		bc.WriteTd(db, hash, header.Number.Uint64(), td)
+		bc.WriteCanonicalHash(db, hash, header.Number.Uint64())
+		if i == lightTestBlock {
+			bc.WriteBody(db, hash, header.Number.Uint64(), &types.Body{Transactions: server.txs})
+			bc.WriteBlockReceipts(db, hash, header.Number.Uint64(), server.receipts)
+		}
+		server.headers = append(server.headers, header)
+		parent = hash
+	}
+	// Build the first canonical hash trie section the way a server does
+	indexer := light.NewChtIndexer(db)
+	indexer.Start(server.headers[len(server.headers)-1], func(ch chan<- bc.ChainEvent) sub.Subscription {
+		return new(sub.Feed).Subscribe(ch)
+	})
+	defer indexer.Close()
+
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if sections, _, _ := indexer.Sections(); sections > 0 {
+			break
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("canonical hash trie not built")
+		}
+	}
+	return server
+}
+
+// lightTestPeer is a fake peer answering the light requests sent to it from
+// the database of a server, through the same encoding and the same serving
+// functions as the network handlers. Its answers may be tampered with.
+type lightTestPeer struct {
+	id       string
+	version  uint
+	db       hpbdb.Database
+	odr      *LightRetriever
+	tamper   func(res interface{}) // Corrupts the answers, if set
+	requests int32                 // Number of requests received
+}
+
+func (p *lightTestPeer) GetID() string    { return p.id }
+func (p *lightTestPeer) GetVersion() uint { return p.version }
+
+func (p *lightTestPeer) SendData(msgCode uint64, data interface{}) error {
+	atomic.AddInt32(&p.requests, 1)
+
+	var res interface{}
+	switch msgCode {
+	case p2p.GetProofsMsg:
+		var req getProofsData
+		lightTestTransfer(data, &req)
+		res = serviceProofs(p.db, p.db, &req)
+	case p2p.GetCodeMsg:
+		var req getByteCodesData
+		lightTestTransfer(data, &req)
+		res = serviceByteCodes(p.db, &req)
+	case p2p.GetHeaderProofsMsg:
+		var req getHeaderProofsData
+		lightTestTransfer(data, &req)
+		res = serviceHeaderProofs(p.db, &req)
+	case p2p.GetLightBodiesMsg:
+		var req getLightBlocksData
+		lightTestTransfer(data, &req)
+		res = serviceLightBodies(p.db, &req)
+	case p2p.GetLightReceiptsMsg:
+		var req getLightBlocksData
+		lightTestTransfer(data, &req)
+		res = serviceLightReceipts(p.db, &req)
+	default:
+		return fmt.Errorf("unexpected message %d", msgCode)
+	}
+	if p.tamper != nil {
+		p.tamper(res)
+	}
+	// Deliver a copy decoded from the wire, as the network handlers do
+	var (
+		id      uint64
+		decoded interface{}
+	)
+	switch res := res.(type) {
+	case *proofsData:
+		id, decoded = res.ID, new(proofsData)
+	case *byteCodesData:
+		id, decoded = res.ID, new(byteCodesData)
+	case *headerProofsData:
+		id, decoded = res.ID, new(headerProofsData)
+	case *lightBodiesData:
+		id, decoded = res.ID, new(lightBodiesData)
+	case *lightReceiptsData:
+		id, decoded = res.ID, new(lightReceiptsData)
+	}
+	lightTestTransfer(res, decoded)
+	go p.odr.deliver(p.id, id, decoded)
+	return nil
+}
+
+// lightTestTransfer passes a message through its network encoding.
+func lightTestTransfer(data interface{}, decoded interface{}) {
+	blob, err := rlp.EncodeToBytes(data)
+	if err != nil {
+		panic(err)
+	}
+	if err := rlp.DecodeBytes(blob, decoded); err != nil {
+		panic(err)
+	}
+}
+
+// newLightTestClient creates a light client trusting the canonical hash trie of
+// the first section of the server, retrieving from the given peers.
+func newLightTestClient(server *lightTestServer, peers ...*lightTestPeer) *LightRetriever {
+	db, _ := hpbdb.NewMemDatabase()
+	light.StoreChtRoot(db, 0, light.GetChtRoot(server.db, 0))
+
+	odr := NewLightRetriever(db)
+	odr.peers = func() []lightPeer {
+		var res []lightPeer
+		for _, p := range peers {
+			res = append(res, p)
+		}
+		return res
+	}
+	for _, p := range peers {
+		p.odr = odr
+	}
+	return odr
+}
+
+// Tests that a light client retrieves a canonical header proven by the
+// canonical hash trie, and reads accounts, storage, code and receipts of its
+// block on demand, all proven against the header. Peers predating hpb/102 must
+// never be asked.
+func TestLightOdrRoundTrip(t *testing.T) {
+	server := newLightTestServer(t)
+	legacy := &lightTestPeer{id: "legacy", version: p2p.ProtoVersion101, db: server.db}
+	peer := &lightTestPeer{id: "server", version: p2p.ProtoVersion102, db: server.db}
+	odr := newLightTestClient(server, legacy, peer)
+	ctx := context.Background()
+
+	header, err := light.GetHeaderByNumber(ctx, odr, lightTestBlock)
+	if err != nil {
+		t.Fatalf("failed to retrieve header: %v", err)
+	}
+	if header.Hash() != server.headers[lightTestBlock].Hash() {
+		t.Fatalf("header mismatch: have %x, want %x", header.Hash(), server.headers[lightTestBlock].Hash())
+	}
+	if hash := bc.GetCanonicalHash(odr.Database(), lightTestBlock); hash != header.Hash() {
+		t.Errorf("proven header not stored as canonical: have %x, want %x", hash, header.Hash())
+	}
+	if td := bc.GetTd(odr.Database(), header.Hash(), lightTestBlock); td == nil || td.Uint64() != lightTestBlock+1 {
+		t.Errorf("total difficulty mismatch: have %v, want %d", td, lightTestBlock+1)
+	}
+	// Read the state of the proven header
+	statedb, err := light.NewState(ctx, header, odr)
+	if err != nil {
+		t.Fatalf("failed to open light state: %v", err)
+	}
+	if balance := statedb.GetBalance(lightTestAccount); balance.Cmp(big.NewInt(1000000)) != 0 {
+		t.Errorf("balance mismatch: have %v, want 1000000", balance)
+	}
+	if nonce := statedb.GetNonce(lightTestAccount); nonce != 3 {
+		t.Errorf("nonce mismatch: have %d, want 3", nonce)
+	}
+	if code := statedb.GetCode(lightTestContract); !bytes.Equal(code, lightTestCode) {
+		t.Errorf("code mismatch: have %x, want %x", code, lightTestCode)
+	}
+	if value := statedb.GetState(lightTestContract, lightTestSlot); value != common.HexToHash("0x2a") {
+		t.Errorf("storage mismatch: have %x, want 0x2a", value)
+	}
+	if err := statedb.Error(); err != nil {
+		t.Errorf("light state failed: %v", err)
+	}
+	// Retrieve the body and receipts of the block
+	block, err := light.GetBlock(ctx, odr, header)
+	if err != nil {
+		t.Fatalf("failed to retrieve block: %v", err)
+	}
+	if len(block.Transactions()) != len(server.txs) {
+		t.Errorf("transaction count mismatch: have %d, want %d", len(block.Transactions()), len(server.txs))
+	}
+	receipts, err := light.GetBlockReceipts(ctx, odr, header)
+	if err != nil {
+		t.Fatalf("failed to retrieve receipts: %v", err)
+	}
+	if hash := types.DeriveSha(receipts); hash != header.ReceiptHash {
+		t.Errorf("receipt root mismatch: have %x, want %x", hash, header.ReceiptHash)
+	}
+	// Retrieved data is stored, asking again must not hit the network
+	requests := atomic.LoadInt32(&peer.requests)
+	if _, err := light.GetBlockReceipts(ctx, odr, header); err != nil {
+		t.Fatalf("failed to read stored receipts: %v", err)
+	}
+	if _, err := light.GetHeaderByNumber(ctx, odr, lightTestBlock); err != nil {
+		t.Fatalf("failed to read stored header: %v", err)
+	}
+	if n := atomic.LoadInt32(&peer.requests); n != requests {
+		t.Errorf("stored data retrieved again: %d requests, %d before", n, requests)
+	}
+	if n := atomic.LoadInt32(&legacy.requests); n != 0 {
+		t.Errorf("hpb/101 peer asked %d light requests", n)
+	}
+}
+
+// Tests that answers failing their proofs are rejected and not stored, and
+// that the request moves on to the next peer.
+func TestLightOdrBadProof(t *testing.T) {
+	server := newLightTestServer(t)
+	header := server.headers[lightTestBlock]
+
+	tests := []struct {
+		name   string
+		tamper func(res interface{})
+		req    func() light.OdrRequest
+		stored func(db hpbdb.Database) bool
+	}{
+		{
+			name: "account-proof",
+			tamper: func(res interface{}) {
+				if res, ok := res.(*proofsData); ok && len(res.Nodes) > 0 {
+					res.Nodes = res.Nodes[:len(res.Nodes)-1]
+				}
+			},
+			req: func() light.OdrRequest {
+				return &light.TrieRequest{BlockHash: header.Hash(), Root: header.Root, Key: crypto.Keccak256(lightTestAccount[:])}
+			},
+			stored: func(db hpbdb.Database) bool {
+				ok, _ := db.Has(header.Root[:])
+				return ok
+			},
+		},
+		{
+			name: "cht-header",
+			tamper: func(res interface{}) {
+				if res, ok := res.(*headerProofsData); ok && len(res.Headers) > 0 {
+					res.Headers[0].Extra = []byte("forged")
+				}
+			},
+			req: func() light.OdrRequest {
+				return &light.ChtRequest{ChtNum: 0, BlockNum: lightTestBlock, ChtRoot: light.GetChtRoot(server.db, 0)}
+			},
+			stored: func(db hpbdb.Database) bool {
+				return bc.GetCanonicalHash(db, lightTestBlock) != (common.Hash{})
+			},
+		},
+		{
+			name: "cht-proof",
+			tamper: func(res interface{}) {
+				if res, ok := res.(*headerProofsData); ok && len(res.Proof) > 0 {
+					res.Proof = res.Proof[1:]
+				}
+			},
+			req: func() light.OdrRequest {
+				return &light.ChtRequest{ChtNum: 0, BlockNum: lightTestBlock, ChtRoot: light.GetChtRoot(server.db, 0)}
+			},
+			stored: func(db hpbdb.Database) bool {
+				return bc.GetCanonicalHash(db, lightTestBlock) != (common.Hash{})
+			},
+		},
+		{
+			name: "receipts",
+			tamper: func(res interface{}) {
+				if res, ok := res.(*lightReceiptsData); ok && len(res.Receipts) > 0 && len(res.Receipts[0]) > 0 {
+					res.Receipts[0] = res.Receipts[0][1:]
+				}
+			},
+			req: func() light.OdrRequest {
+				return &light.ReceiptsRequest{Header: header}
+			},
+			stored: func(db hpbdb.Database) bool {
+				return bc.GetBlockReceipts(db, header.Hash(), lightTestBlock) != nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		// A lone peer with a bad answer fails the request
+		bad := &lightTestPeer{id: "bad", version: p2p.ProtoVersion102, db: server.db, tamper: tt.tamper}
+		odr := newLightTestClient(server, bad)
+
+		if err := odr.Retrieve(context.Background(), tt.req()); err != light.ErrNoPeers {
+			t.Errorf("%s: bad answer: have error %v, want %v", tt.name, err, light.ErrNoPeers)
+		}
+		if n := atomic.LoadInt32(&bad.requests); n != 1 {
+			t.Errorf("%s: bad peer asked %d times, want once", tt.name, n)
+		}
+		if tt.stored(odr.Database()) {
+			t.Errorf("%s: rejected answer stored", tt.name)
+		}
+		// Along with an honest peer the request succeeds
+		bad = &lightTestPeer{id: "bad", version: p2p.ProtoVersion102, db: server.db, tamper: tt.tamper}
+		good := &lightTestPeer{id: "good", version: p2p.ProtoVersion102, db: server.db}
+		odr = newLightTestClient(server, bad, good)
+
+		if err := odr.Retrieve(context.Background(), tt.req()); err != nil {
+			t.Errorf("%s: retrieval with an honest peer failed: %v", tt.name, err)
+		}
+		if !tt.stored(odr.Database()) {
+			t.Errorf("%s: valid answer not stored", tt.name)
+		}
+	}
+}
+
+// Tests that a light client without peers of hpb/102 or later fails right away
+// instead of waiting for answers that never come.
+func TestLightOdrLegacyPeers(t *testing.T) {
+	server := newLightTestServer(t)
+	legacy := &lightTestPeer{id: "legacy", version: p2p.ProtoVersion100, db: server.db}
+	odr := newLightTestClient(server, legacy)
+
+	if _, err := light.GetHeaderByNumber(context.Background(), odr, lightTestBlock); err != light.ErrNoPeers {
+		t.Errorf("retrieval error mismatch: have %v, want %v", err, light.ErrNoPeers)
+	}
+	if n := atomic.LoadInt32(&legacy.requests); n != 0 {
+		t.Errorf("hpb/100 peer asked %d light requests", n)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package synctrl
+
+import (
+	"github.com/hpb-project/go-hpb/blockchain"
+	"github.com/hpb-project/go-hpb/blockchain/state"
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/blockchain/types"
+	"github.com/hpb-project/go-hpb/common/rlp"
+	"github.com/hpb-project/go-hpb/common/trie"
+	"github.com/hpb-project/go-hpb/light"
+)
+
+// MaxLightBlockFetch is the amount of block bodies or receipts to allow
+// fetching per light client request.
+var MaxLightBlockFetch = 64
+
+// serviceProofs proves a key of the account trie or a storage trie of the
+// state of a block. If the state is not available, the response is empty. The
+// tries are read through triedb, the header from the chain database.
+func serviceProofs(db hpbdb.Database, triedb trie.Database, req *getProofsData) *proofsData {
+	res := &proofsData{ID: req.ID}
+
+	header := bc.GetHeader(db, req.BHash, bc.GetBlockNumber(db, req.BHash))
+	if header == nil {
+		return res
+	}
+	tr, err := trie.New(header.Root, triedb)
+	if err != nil {
+		return res
+	}
+	if len(req.AccKey) > 0 {
+		blob, err := tr.TryGet(req.AccKey)
+		if err != nil || blob == nil {
+			return res
+		}
+		var account state.Account
+		if err := rlp.DecodeBytes(blob, &account); err != nil {
+			return res
+		}
+		if tr, err = trie.New(account.Root, triedb); err != nil {
+			return res
+		}
+	}
+	res.Nodes = tr.Prove(req.Key)
+	return res
+}
+
+// serviceHeaderProofs gathers a canonical header along with its proof in the
+// canonical hash trie of its section. If either is not available, the response
+// is empty.
+func serviceHeaderProofs(db hpbdb.Database, req *getHeaderProofsData) *headerProofsData {
+	res := &headerProofsData{ID: req.ID}
+
+	if req.BlockNum/light.ChtFrequency != req.ChtNum {
+		return res
+	}
+	header := bc.GetHeader(db, bc.GetCanonicalHash(db, req.BlockNum), req.BlockNum)
+	if header == nil {
+		return res
+	}
+	if proof := light.ProveCht(db, req.ChtNum, req.BlockNum); proof != nil {
+		res.Headers, res.Proof = []*types.Header{header}, proof
+	}
+	return res
+}
+
+// serviceLightBodies gathers the requested block bodies up to the first unknown
+// one or until the fetch or network limits are reached.
+func serviceLightBodies(db hpbdb.Database, req *getLightBlocksData) *lightBodiesData {
+	res := &lightBodiesData{ID: req.ID}
+
+	bytes := 0
+	for i, hash := range req.Hashes {
+		if i >= MaxLightBlockFetch || bytes >= softResponseLimit {
+			break
+		}
+		data := bc.GetBodyRLP(db, hash, bc.GetBlockNumber(db, hash))
+		if len(data) == 0 {
+			break
+		}
+		body := new(blockBody)
+		if err := rlp.DecodeBytes(data, body); err != nil {
+			break
+		}
+		res.Bodies = append(res.Bodies, body)
+		bytes += len(data)
+	}
+	return res
+}
+
+// serviceLightReceipts gathers the requested block receipts up to the first
+// unknown one or until the fetch or network limits are reached.
+func serviceLightReceipts(db hpbdb.Database, req *getLightBlocksData) *lightReceiptsData {
+	res := &lightReceiptsData{ID: req.ID}
+
+	bytes := 0
+	for i, hash := range req.Hashes {
+		if i >= MaxLightBlockFetch || bytes >= softResponseLimit {
+			break
+		}
+		number := bc.GetBlockNumber(db, hash)
+		receipts := bc.GetBlockReceipts(db, hash, number)
+		if receipts == nil {
+			if header := bc.GetHeader(db, hash, number); header == nil || header.ReceiptHash != types.EmptyRootHash {
+				break
+			}
+		}
+		encoded, err := rlp.EncodeToBytes(receipts)
+		if err != nil {
+			break
+		}
+		res.Receipts = append(res.Receipts, receipts)
+		bytes += len(encoded)
+	}
+	return res
+}
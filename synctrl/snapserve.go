@@ -0,0 +1,178 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package synctrl
+
+import (
+	"bytes"
+
+	"github.com/hpb-project/go-hpb/blockchain/state"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/crypto"
+	"github.com/hpb-project/go-hpb/common/rlp"
+	"github.com/hpb-project/go-hpb/common/trie"
+)
+
+// MaxCodeFetch is the amount of contract codes to allow fetching per request.
+var MaxCodeFetch = 1024
+
+// responseBytes caps the response size requested by a remote peer.
+func responseBytes(requested uint64) uint64 {
+	if requested > softResponseLimit {
+		return softResponseLimit
+	}
+	return requested
+}
+
+// serviceAccountRange gathers the accounts of a state trie from the origin of
+// the request on, until its limit hash or size is reached. If the state is not
+// available, the response is empty. Tries are read through triedb, so states
+// only held by the trie node cache are served as well.
+func serviceAccountRange(triedb trie.Database, req *getAccountRangeData) *accountRangeData {
+	res := &accountRangeData{ID: req.ID}
+
+	tr, err := trie.New(req.Root, triedb)
+	if err != nil {
+		return res
+	}
+	var (
+		limit = responseBytes(req.Bytes)
+		size  uint64
+		last  []byte
+	)
+	it := trie.NewIterator(tr.NodeIterator(req.Origin[:]))
+	for it.Next() {
+		res.Accounts = append(res.Accounts, &accountData{Hash: common.BytesToHash(it.Key), Body: common.CopyBytes(it.Value)})
+		size += uint64(common.HashLength + len(it.Value))
+		last = it.Key
+
+		if bytes.Compare(it.Key, req.Limit[:]) >= 0 || size >= limit {
+			break
+		}
+	}
+	if it.Err != nil {
+		return &accountRangeData{ID: req.ID}
+	}
+	res.Proof = proveRange(tr, req.Origin[:], last)
+	return res
+}
+
+// serviceStorageRanges gathers the storage slots of the accounts of the
+// request until its size limit is reached. Every range is complete except for
+// the last one if it got cut off, or if it was requested from a non-zero
+// origin, in which case the proofs of its edges are attached.
+func serviceStorageRanges(triedb trie.Database, req *getStorageRangesData) *storageRangesData {
+	res := &storageRangesData{ID: req.ID}
+
+	accTrie, err := trie.New(req.Root, triedb)
+	if err != nil {
+		return res
+	}
+	var (
+		limit = responseBytes(req.Bytes)
+		size  uint64
+	)
+	for i, account := range req.Accounts {
+		if size >= limit {
+			break
+		}
+		blob, err := accTrie.TryGet(account[:])
+		if err != nil || blob == nil {
+			break
+		}
+		var acc state.Account
+		if err := rlp.DecodeBytes(blob, &acc); err != nil {
+			break
+		}
+		stTrie, err := trie.New(acc.Root, triedb)
+		if err != nil {
+			break
+		}
+		var (
+			origin common.Hash
+			slots  []*slotData
+			last   []byte
+			abort  bool
+		)
+		if i == 0 {
+			origin = req.Origin
+		}
+		it := trie.NewIterator(stTrie.NodeIterator(origin[:]))
+		for it.Next() {
+			if size >= limit || (i == len(req.Accounts)-1 && last != nil && bytes.Compare(last, req.Limit[:]) >= 0) {
+				abort = true
+				break
+			}
+			slots = append(slots, &slotData{Hash: common.BytesToHash(it.Key), Body: common.CopyBytes(it.Value)})
+			size += uint64(common.HashLength + len(it.Value))
+			last = it.Key
+		}
+		if it.Err != nil || (abort && len(slots) == 0) {
+			break
+		}
+		res.Slots = append(res.Slots, slots)
+
+		// A partial range can only be verified against its edges
+		if origin != (common.Hash{}) || abort {
+			res.Proof = proveRange(stTrie, origin[:], last)
+			break
+		}
+	}
+	return res
+}
+
+// serviceByteCodes gathers the requested contract codes until the size limit
+// is reached, leaving out the unknown ones.
+func serviceByteCodes(triedb trie.Database, req *getByteCodesData) *byteCodesData {
+	res := &byteCodesData{ID: req.ID}
+
+	var (
+		limit = responseBytes(req.Bytes)
+		size  uint64
+	)
+	for i, hash := range req.Hashes {
+		if i >= MaxCodeFetch || size >= limit {
+			break
+		}
+		if code, err := triedb.Get(hash[:]); err == nil && len(code) > 0 {
+			res.Codes = append(res.Codes, code)
+			size += uint64(len(code))
+		}
+	}
+	return res
+}
+
+// proveRange returns the merkle proofs of the edges of a range of the trie.
+// The last key is nil for an empty range.
+func proveRange(tr *trie.Trie, origin, last []byte) []rlp.RawValue {
+	var (
+		proof = tr.Prove(origin)
+		seen  = make(map[common.Hash]struct{}, len(proof))
+	)
+	for _, node := range proof {
+		seen[crypto.Keccak256Hash(node)] = struct{}{}
+	}
+	if last != nil {
+		for _, node := range tr.Prove(last) {
+			hash := crypto.Keccak256Hash(node)
+			if _, ok := seen[hash]; !ok {
+				seen[hash] = struct{}{}
+				proof = append(proof, node)
+			}
+		}
+	}
+	return proof
+}
@@ -0,0 +1,249 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package synctrl
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hpb-project/go-hpb/blockchain/state"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/crypto"
+	"github.com/hpb-project/go-hpb/common/rlp"
+	"github.com/hpb-project/go-hpb/common/trie"
+)
+
+// trieKeys returns the sorted keys of all leaves of a trie.
+func trieKeys(t *testing.T, triedb trie.Database, root common.Hash) []common.Hash {
+	tr, err := trie.New(root, triedb)
+	if err != nil {
+		t.Fatalf("failed to open trie %x: %v", root, err)
+	}
+	var keys []common.Hash
+	it := trie.NewIterator(tr.NodeIterator(nil))
+	for it.Next() {
+		keys = append(keys, common.BytesToHash(it.Key))
+	}
+	return keys
+}
+
+// verifyAccountRange checks a served account range against the state root,
+// returning whether the response claims more accounts to the right.
+func verifyAccountRange(root, origin common.Hash, res *accountRangeData) (bool, error) {
+	keys, values := make([][]byte, len(res.Accounts)), make([][]byte, len(res.Accounts))
+	for i, account := range res.Accounts {
+		keys[i], values[i] = account.Hash[:], account.Body
+	}
+	var last []byte
+	if len(keys) > 0 {
+		last = keys[len(keys)-1]
+	}
+	return trie.VerifyRangeProof(root, origin[:], last, keys, values, res.Proof)
+}
+
+// Tests that account ranges start at the first account from the origin on,
+// stop at the first account reaching the limit or the size cap, and carry the
+// proofs of both their edges.
+func TestServiceAccountRange(t *testing.T) {
+	db, root, _ := makeSnapTestState()
+	keys := trieKeys(t, db, root)
+
+	tests := []struct {
+		name   string
+		origin common.Hash
+		limit  common.Hash
+		bytes  uint64
+		first  int  // Index of the first account served
+		count  int  // Number of accounts served
+		more   bool // Whether accounts are left to the right
+	}{
+		{"whole", common.Hash{}, maxHash, softResponseLimit, 0, len(keys), false},
+		{"origin-on-key", keys[10], maxHash, softResponseLimit, 10, len(keys) - 10, false},
+		{"origin-between-keys", incHash(keys[10]), maxHash, softResponseLimit, 11, len(keys) - 11, false},
+		{"limit-on-key", keys[10], keys[20], softResponseLimit, 10, 11, true},
+		{"limit-between-keys", keys[10], incHash(keys[20]), softResponseLimit, 10, 12, true},
+		{"size-cap", keys[10], maxHash, 1, 10, 1, true},
+		{"last", keys[len(keys)-1], maxHash, softResponseLimit, len(keys) - 1, 1, false},
+	}
+	for _, tt := range tests {
+		res := serviceAccountRange(db, &getAccountRangeData{ID: 1, Root: root, Origin: tt.origin, Limit: tt.limit, Bytes: tt.bytes})
+		if res.ID != 1 {
+			t.Errorf("%s: response id mismatch: have %d, want 1", tt.name, res.ID)
+		}
+		if len(res.Accounts) != tt.count {
+			t.Errorf("%s: account count mismatch: have %d, want %d", tt.name, len(res.Accounts), tt.count)
+			continue
+		}
+		for i, account := range res.Accounts {
+			if account.Hash != keys[tt.first+i] {
+				t.Errorf("%s: account %d mismatch: have %x, want %x", tt.name, i, account.Hash, keys[tt.first+i])
+				break
+			}
+		}
+		more, err := verifyAccountRange(root, tt.origin, res)
+		if err != nil {
+			t.Errorf("%s: range proof rejected: %v", tt.name, err)
+			continue
+		}
+		if more != tt.more {
+			t.Errorf("%s: more accounts mismatch: have %v, want %v", tt.name, more, tt.more)
+		}
+		// Leaving out an account or claiming other edges must break the proof
+		if len(res.Accounts) > 2 {
+			gapped := &accountRangeData{ID: res.ID, Accounts: append(append([]*accountData{}, res.Accounts[:1]...), res.Accounts[2:]...), Proof: res.Proof}
+			if _, err := verifyAccountRange(root, tt.origin, gapped); err == nil {
+				t.Errorf("%s: range with a missing account accepted", tt.name)
+			}
+			cut := &accountRangeData{ID: res.ID, Accounts: res.Accounts[1:], Proof: res.Proof}
+			if _, err := verifyAccountRange(root, tt.origin, cut); err == nil {
+				t.Errorf("%s: range with a missing first account accepted", tt.name)
+			}
+		}
+	}
+}
+
+// Tests that an account range of an unknown state is empty, which marks the
+// peer as not serving the state.
+func TestServiceAccountRangeUnknownRoot(t *testing.T) {
+	db, _, _ := makeSnapTestState()
+
+	res := serviceAccountRange(db, &getAccountRangeData{ID: 1, Root: common.HexToHash("0x01"), Limit: maxHash, Bytes: softResponseLimit})
+	if len(res.Accounts) != 0 || len(res.Proof) != 0 {
+		t.Errorf("unknown root served: %d accounts, %d proof nodes", len(res.Accounts), len(res.Proof))
+	}
+}
+
+// Tests that storage ranges are served whole without proofs, and that only a
+// range starting midway or cut off by the size cap carries edge proofs, ending
+// the response.
+func TestServiceStorageRanges(t *testing.T) {
+	db, root, accounts := makeSnapTestState()
+
+	// Gather the storage roots of the contracts, the big one last
+	var (
+		owners []common.Hash
+		roots  []common.Hash
+	)
+	statedb, _ := state.New(root, state.NewDatabase(db))
+	for _, acc := range accounts {
+		if acc.slots == nil {
+			continue
+		}
+		owners = append(owners, crypto.Keccak256Hash(acc.address[:]))
+		roots = append(roots, statedb.StorageTrie(acc.address).Hash())
+	}
+	large := len(owners) - 1
+
+	// Complete ranges of small storage tries need no proofs
+	res := serviceStorageRanges(db, &getStorageRangesData{ID: 1, Root: root, Accounts: owners[:3], Limit: maxHash, Bytes: softResponseLimit})
+	if len(res.Slots) != 3 || len(res.Proof) != 0 {
+		t.Fatalf("complete ranges: have %d ranges and %d proof nodes, want 3 and none", len(res.Slots), len(res.Proof))
+	}
+	for i, slots := range res.Slots {
+		if len(slots) != snapTestSlots {
+			t.Errorf("range %d: slot count mismatch: have %d, want %d", i, len(slots), snapTestSlots)
+		}
+		if _, err := verifySlots(roots[i], common.Hash{}, slots, nil); err != nil {
+			t.Errorf("range %d: rejected: %v", i, err)
+		}
+	}
+	// A storage trie exceeding the size cap is cut off and proven, ending the
+	// response even if more accounts were asked for
+	res = serviceStorageRanges(db, &getStorageRangesData{ID: 1, Root: root, Accounts: []common.Hash{owners[0], owners[large], owners[1]}, Limit: maxHash, Bytes: 64 * 1024})
+	if len(res.Slots) != 2 || len(res.Proof) == 0 {
+		t.Fatalf("cut off range: have %d ranges and %d proof nodes, want 2 and a proof", len(res.Slots), len(res.Proof))
+	}
+	slots := res.Slots[1]
+	if len(slots) == 0 || len(slots) >= snapTestBigSlots {
+		t.Fatalf("cut off range: slot count %d out of bounds", len(slots))
+	}
+	more, err := verifySlots(roots[large], common.Hash{}, slots, res.Proof)
+	if err != nil {
+		t.Fatalf("cut off range rejected: %v", err)
+	}
+	if !more {
+		t.Errorf("cut off range claims to be complete")
+	}
+	// The rest of the storage trie, requested from where the last range ended
+	origin := incHash(slots[len(slots)-1].Hash)
+	res = serviceStorageRanges(db, &getStorageRangesData{ID: 1, Root: root, Accounts: owners[large:], Origin: origin, Limit: maxHash, Bytes: softResponseLimit})
+	if len(res.Slots) != 1 || len(res.Proof) == 0 {
+		t.Fatalf("resumed range: have %d ranges and %d proof nodes, want 1 and a proof", len(res.Slots), len(res.Proof))
+	}
+	if have := len(slots) + len(res.Slots[0]); have != snapTestBigSlots {
+		t.Errorf("resumed range: slot count mismatch: have %d, want %d", have, snapTestBigSlots)
+	}
+	if bytes.Compare(res.Slots[0][0].Hash[:], origin[:]) < 0 {
+		t.Errorf("resumed range starts before its origin: %x < %x", res.Slots[0][0].Hash, origin)
+	}
+	if more, err := verifySlots(roots[large], origin, res.Slots[0], res.Proof); err != nil || more {
+		t.Errorf("resumed range: have more %v, error %v, want false and none", more, err)
+	}
+	// Unknown states are not served at all
+	res = serviceStorageRanges(db, &getStorageRangesData{ID: 1, Root: common.HexToHash("0x01"), Accounts: owners, Limit: maxHash, Bytes: softResponseLimit})
+	if len(res.Slots) != 0 || len(res.Proof) != 0 {
+		t.Errorf("unknown root served: %d ranges, %d proof nodes", len(res.Slots), len(res.Proof))
+	}
+}
+
+// verifySlots checks a served storage range against its storage root.
+func verifySlots(root, origin common.Hash, slots []*slotData, proof []rlp.RawValue) (bool, error) {
+	keys, values := make([][]byte, len(slots)), make([][]byte, len(slots))
+	for i, slot := range slots {
+		keys[i], values[i] = slot.Hash[:], slot.Body
+	}
+	if proof == nil {
+		return trie.VerifyRangeProof(root, nil, nil, keys, values, nil)
+	}
+	var last []byte
+	if len(keys) > 0 {
+		last = keys[len(keys)-1]
+	}
+	return trie.VerifyRangeProof(root, origin[:], last, keys, values, proof)
+}
+
+// Tests that contract codes are served as far as they are known, up to the
+// count limit.
+func TestServiceByteCodes(t *testing.T) {
+	db, _, accounts := makeSnapTestState()
+
+	var (
+		hashes []common.Hash
+		codes  [][]byte
+	)
+	for _, acc := range accounts {
+		if acc.code != nil && len(codes) < 3 {
+			hashes = append(hashes, crypto.Keccak256Hash(acc.code), common.HexToHash("0x01"))
+			codes = append(codes, acc.code)
+		}
+	}
+	res := serviceByteCodes(db, &getByteCodesData{ID: 1, Hashes: hashes, Bytes: softResponseLimit})
+	if len(res.Codes) != len(codes) {
+		t.Fatalf("code count mismatch: have %d, want %d", len(res.Codes), len(codes))
+	}
+	for i, code := range res.Codes {
+		if !bytes.Equal(code, codes[i]) {
+			t.Errorf("code %d mismatch: have %x, want %x", i, code, codes[i])
+		}
+	}
+	defer func(limit int) { MaxCodeFetch = limit }(MaxCodeFetch)
+	MaxCodeFetch = 2
+
+	if res = serviceByteCodes(db, &getByteCodesData{ID: 1, Hashes: hashes, Bytes: softResponseLimit}); len(res.Codes) != 1 {
+		t.Errorf("code count beyond the fetch limit: have %d, want 1", len(res.Codes))
+	}
+}
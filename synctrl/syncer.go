@@ -178,6 +178,9 @@ type Syncer struct {
 	stateCh        chan dataPack // Channel receiving inbound node state data
 	syncStatsState stateSyncStats
 	syncStatsLock  sync.RWMutex // Lock protecting the sync stats fields
+
+	snap     *snapSync    // Snapshot sync currently running, if any
+	snapLock sync.RWMutex // Lock protecting the running snapshot sync
 	// Status
 	synchroniseMock func(id string, hash common.Hash) error // Replacement for synchronise during testing
 	synchronising   int32
@@ -370,6 +373,37 @@ func (this *Syncer) DeliverNodeData(id string, data [][]byte) (err error) {
 	return this.strategy.deliverNodeData(id, data)
 }
 
+// DeliverAccountRange injects a range of accounts received from a remote node.
+func (this *Syncer) DeliverAccountRange(id string, res *accountRangeData) error {
+	return this.deliverSnap(&snapPack{peerId: id, id: res.ID, data: res})
+}
+
+// DeliverStorageRanges injects a batch of storage ranges received from a remote node.
+func (this *Syncer) DeliverStorageRanges(id string, res *storageRangesData) error {
+	return this.deliverSnap(&snapPack{peerId: id, id: res.ID, data: res})
+}
+
+// DeliverByteCodes injects a batch of contract codes received from a remote node.
+func (this *Syncer) DeliverByteCodes(id string, res *byteCodesData) error {
+	return this.deliverSnap(&snapPack{peerId: id, id: res.ID, data: res})
+}
+
+// deliverSnap hands snapshot data over to the running snapshot sync.
+func (this *Syncer) deliverSnap(pack *snapPack) error {
+	this.snapLock.RLock()
+	snap := this.snap
+	this.snapLock.RUnlock()
+
+	if snap == nil {
+		return errNoSyncActive
+	}
+	select {
+	case snap.deliver <- pack:
+		return nil
+	case <-snap.done:
+		return errNoSyncActive
+	}
+}
 
 // qosTuner is the quality of service tuning loop that occasionally gathers the
 // peer latency statistics and updates the estimated request round trip time.
@@ -1177,7 +1177,11 @@ func (this *fastSync) commitPivotBlock(result *fetchResult) error {
 	if _, err := bc.InstanceBlockChain().InsertReceiptChain([]*types.Block{b}, []types.Receipts{result.Receipts}); err != nil {
 		return err
 	}
-	return bc.InstanceBlockChain().FastSyncCommitHead(b.Hash())
+	if err := bc.InstanceBlockChain().FastSyncCommitHead(b.Hash()); err != nil {
+		return err
+	}
+	bc.DeleteSnapshotSyncStatus(this.syncer.stateDB)
+	return nil
 }
 
 // deliver injects a new batch of data received from a remote node.
@@ -90,6 +90,9 @@ type Peer interface {
 	RequestBodies([]common.Hash) error
 	RequestReceipts([]common.Hash) error
 	RequestNodeData([]common.Hash) error
+	RequestAccountRange(id uint64, root, origin, limit common.Hash, bytes uint64) error
+	RequestStorageRanges(id uint64, root common.Hash, accounts []common.Hash, origin, limit common.Hash, bytes uint64) error
+	RequestByteCodes(id uint64, hashes []common.Hash, bytes uint64) error
 }
 
 // lightPeerWrapper wraps a LightPeer struct, stubbing out the Peer-only methods.
@@ -113,6 +116,15 @@ func (w *lightPeerWrapper) RequestReceipts([]common.Hash) error {
 func (w *lightPeerWrapper) RequestNodeData([]common.Hash) error {
 	panic("RequestNodeData not supported in light client mode sync")
 }
+func (w *lightPeerWrapper) RequestAccountRange(uint64, common.Hash, common.Hash, common.Hash, uint64) error {
+	panic("RequestAccountRange not supported in light client mode sync")
+}
+func (w *lightPeerWrapper) RequestStorageRanges(uint64, common.Hash, []common.Hash, common.Hash, common.Hash, uint64) error {
+	panic("RequestStorageRanges not supported in light client mode sync")
+}
+func (w *lightPeerWrapper) RequestByteCodes(uint64, []common.Hash, uint64) error {
+	panic("RequestByteCodes not supported in light client mode sync")
+}
 
 // newPeerConnection creates a new downloader peer.
 func newPeerConnection(id string, version uint, peer Peer, logger log.Logger) *peerConnection {
@@ -611,3 +623,15 @@ func (ps *PeerSyn) RequestReceipts(hashes []common.Hash) error {
 	log.Debug("Fetching batch of receipts", "id",ps.GetID(),"count", len(hashes))
 	return p2p.SendData(ps.Peer,p2p.GetReceiptsMsg, hashes)
 }
+func (ps *PeerSyn) RequestAccountRange(id uint64, root, origin, limit common.Hash, bytes uint64) error {
+	log.Debug("Fetching range of accounts", "id",ps.GetID(),"root", root, "origin", origin, "limit", limit, "bytes", bytes)
+	return p2p.SendData(ps.Peer,p2p.GetAccountRangeMsg, &getAccountRangeData{ID: id, Root: root, Origin: origin, Limit: limit, Bytes: bytes})
+}
+func (ps *PeerSyn) RequestStorageRanges(id uint64, root common.Hash, accounts []common.Hash, origin, limit common.Hash, bytes uint64) error {
+	log.Debug("Fetching ranges of storage slots", "id",ps.GetID(),"root", root, "accounts", len(accounts), "origin", origin, "limit", limit, "bytes", bytes)
+	return p2p.SendData(ps.Peer,p2p.GetStorageRangesMsg, &getStorageRangesData{ID: id, Root: root, Accounts: accounts, Origin: origin, Limit: limit, Bytes: bytes})
+}
+func (ps *PeerSyn) RequestByteCodes(id uint64, hashes []common.Hash, bytes uint64) error {
+	log.Debug("Fetching batch of byte codes", "id",ps.GetID(),"count", len(hashes), "bytes", bytes)
+	return p2p.SendData(ps.Peer,p2p.GetByteCodesMsg, &getByteCodesData{ID: id, Hashes: hashes, Bytes: bytes})
+}
@@ -0,0 +1,681 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package synctrl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/hpb-project/go-hpb/blockchain"
+	"github.com/hpb-project/go-hpb/blockchain/state"
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/blockchain/types"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/crypto"
+	"github.com/hpb-project/go-hpb/common/log"
+	"github.com/hpb-project/go-hpb/common/rlp"
+	"github.com/hpb-project/go-hpb/common/trie"
+	"github.com/hpb-project/go-hpb/network/p2p"
+)
+
+const (
+	snapAccountChunks = 16         // Number of chunks the account hash space is split into
+	snapStorageBatch  = 64         // Maximum number of storage tries to request at once
+	snapCodeBatch     = 64         // Maximum number of contract codes to request at once
+	snapRequestBytes  = 512 * 1024 // Soft limit of the response size requested from a peer
+	snapTrieCacheGen  = 16         // Number of commits to keep rebuilt trie nodes in memory for
+)
+
+var (
+	emptyCodeHash = crypto.Keccak256Hash(nil)
+	maxHash       = common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+
+	errSnapUnavailable = errors.New("no peers serving the state snapshot")
+)
+
+// snapAccountTask is a chunk of the account hash space left to download.
+type snapAccountTask struct {
+	Next common.Hash // Hash of the next account to download
+	Last common.Hash // Hash of the last account of the chunk
+
+	req *snapRequest // Request in flight for the chunk, if any
+}
+
+// snapStorageTask is a storage trie left to download.
+type snapStorageTask struct {
+	State   common.Hash // State root the owning account was downloaded from
+	Account common.Hash // Hash of the account owning the storage
+	Root    common.Hash // Root hash of the storage trie
+	Next    common.Hash // Hash of the next storage slot to download
+	Partial common.Hash // Root of the storage trie rebuilt so far, if started
+
+	req  *snapRequest // Request in flight for the storage, if any
+	trie *trie.Trie   // Storage trie rebuilt so far, opened on first delivery
+}
+
+// snapStatus is the progress of a snapshot sync, persisted along with the
+// data downloaded so that an interrupted sync can resume.
+type snapStatus struct {
+	Root     common.Hash        // State root being synced
+	Partial  common.Hash        // Root of the account trie rebuilt so far
+	Accounts []*snapAccountTask // Chunks of the account hash space left
+	Storage  []*snapStorageTask // Storage tries left
+	Codes    []common.Hash      // Contract codes left
+
+	AccountsSynced uint64 // Number of accounts downloaded
+	SlotsSynced    uint64 // Number of storage slots downloaded
+	CodesSynced    uint64 // Number of contract codes downloaded
+	BytesSynced    uint64 // Size of the state downloaded
+}
+
+// snapRequest is a snapshot data request in flight to a peer.
+type snapRequest struct {
+	id    uint64
+	peer  *peerConnection
+	timer *time.Timer
+
+	account *snapAccountTask   // Account chunk requested
+	storage []*snapStorageTask // Storage tries requested
+	codes   []common.Hash      // Contract codes requested
+}
+
+// snapPack is a snapshot data response delivered by a peer.
+type snapPack struct {
+	peerId string
+	id     uint64
+	data   interface{}
+}
+
+// snapSync downloads the state of a root hash as consecutive ranges of
+// accounts and storage slots verified by the merkle proofs of their edges, and
+// rebuilds the tries locally. Whatever it could not download is left for the
+// node by node state sync to heal.
+type snapSync struct {
+	syn  *Syncer
+	root common.Hash
+
+	status  *snapStatus
+	accTrie *trie.Trie // Account trie rebuilt so far
+	batch   hpbdb.Batch
+	pending int // Size of the data not yet committed
+
+	storageRoots map[common.Hash]struct{} // Storage tries queued or downloaded
+	codeHashes   map[common.Hash]struct{} // Contract codes queued or downloaded
+
+	requests  map[uint64]*snapRequest // Requests in flight
+	busy      map[string]struct{}     // Peers with a request in flight
+	stateless map[string]struct{}     // Peers not serving the state
+	nextID    uint64
+
+	deliver chan *snapPack
+	timeout chan *snapRequest
+	done    chan struct{}
+
+	start time.Time
+}
+
+// newSnapSync creates a snapshot sync of the given state root. The sync does
+// not start until run is called.
+func newSnapSync(syn *Syncer, root common.Hash) *snapSync {
+	return &snapSync{
+		syn:          syn,
+		root:         root,
+		batch:        syn.stateDB.NewBatch(),
+		storageRoots: make(map[common.Hash]struct{}),
+		codeHashes:   make(map[common.Hash]struct{}),
+		requests:     make(map[uint64]*snapRequest),
+		busy:         make(map[string]struct{}),
+		stateless:    make(map[string]struct{}),
+		nextID:       uint64(time.Now().UnixNano()),
+		deliver:      make(chan *snapPack),
+		timeout:      make(chan *snapRequest),
+		done:         make(chan struct{}),
+		start:        time.Now(),
+	}
+}
+
+// run downloads the state until it's complete, no peer serves it anymore or
+// the sync is canceled. The progress is persisted in every case.
+func (s *snapSync) run(cancel chan struct{}) error {
+	defer close(s.done)
+
+	// Nothing to do if the state is already around
+	if ok, _ := s.syn.stateDB.Has(s.root[:]); ok {
+		return nil
+	}
+	if err := s.load(); err != nil {
+		return err
+	}
+	if s.complete() {
+		return nil
+	}
+	s.syn.snapLock.Lock()
+	s.syn.snap = s
+	s.syn.snapLock.Unlock()
+
+	defer func() {
+		s.syn.snapLock.Lock()
+		s.syn.snap = nil
+		s.syn.snapLock.Unlock()
+	}()
+	err := s.loop(cancel)
+	for _, req := range s.requests {
+		s.revert(req)
+	}
+	if cerr := s.commit(true); cerr != nil {
+		return cerr
+	}
+	if err == nil {
+		if s.status.Partial == s.root {
+			log.Info("State snapshot synced", "accounts", s.status.AccountsSynced, "slots", s.status.SlotsSynced, "codes", s.status.CodesSynced, "size", common.StorageSize(s.status.BytesSynced), "elapsed", common.PrettyDuration(time.Since(s.start)))
+		} else {
+			log.Info("State snapshot synced, healing stale entries", "root", s.root, "rebuilt", s.status.Partial)
+		}
+	}
+	return err
+}
+
+// loop assigns requests to the idle peers and processes their responses
+// until the state is downloaded.
+func (s *snapSync) loop(cancel chan struct{}) error {
+	newPeer := make(chan *peerConnection, 1024)
+	peerSub := s.syn.peers.SubscribeNewPeers(newPeer)
+	defer peerSub.Unsubscribe()
+
+	peerDrop := make(chan *peerConnection, 1024)
+	dropSub := s.syn.peers.SubscribePeerDrops(peerDrop)
+	defer dropSub.Unsubscribe()
+
+	for !s.complete() {
+		if err := s.commit(false); err != nil {
+			return err
+		}
+		s.assignTasks()
+		if len(s.requests) == 0 {
+			return errSnapUnavailable
+		}
+		select {
+		case <-newPeer:
+			// New peer arrived, try to assign it download tasks
+
+		case p := <-peerDrop:
+			for _, req := range s.requests {
+				if req.peer.id == p.id {
+					s.revert(req)
+				}
+			}
+
+		case req := <-s.timeout:
+			// Peers not answering in time are not asked again
+			if s.requests[req.id] != req {
+				continue
+			}
+			req.peer.log.Debug("Snapshot request timed out", "id", req.id)
+			s.stateless[req.peer.id] = struct{}{}
+			s.revert(req)
+
+		case pack := <-s.deliver:
+			if err := s.process(pack); err != nil {
+				return err
+			}
+
+		case <-cancel:
+			return errCancelStateFetch
+		}
+	}
+	return nil
+}
+
+// load restores the progress of a previous sync, or splits up the account
+// hash space if there was none. The progress made on another state root is
+// kept, the differences get healed afterwards.
+func (s *snapSync) load() error {
+	status := new(snapStatus)
+	if blob := bc.GetSnapshotSyncStatus(s.syn.stateDB); len(blob) > 0 {
+		if err := rlp.DecodeBytes(blob, status); err != nil {
+			log.Warn("Failed to decode snapshot sync status, restarting", "err", err)
+			status = new(snapStatus)
+		}
+	}
+	accTrie, err := trie.New(status.Partial, s.syn.stateDB)
+	if err != nil {
+		log.Warn("Rebuilt account trie missing, restarting snapshot sync", "root", status.Partial)
+		status = new(snapStatus)
+		accTrie, _ = trie.New(common.Hash{}, s.syn.stateDB)
+	}
+	switch {
+	case status.Root == (common.Hash{}):
+		log.Info("Starting state snapshot sync", "root", s.root)
+		status.Accounts = splitAccountRange(snapAccountChunks)
+	case status.Root != s.root:
+		log.Info("Continuing state snapshot sync on new root", "root", s.root, "previous", status.Root)
+	default:
+		log.Info("Resuming state snapshot sync", "root", s.root, "accounts", status.AccountsSynced, "slots", status.SlotsSynced, "codes", status.CodesSynced)
+	}
+	status.Root = s.root
+	accTrie.SetCacheLimit(snapTrieCacheGen)
+
+	s.status, s.accTrie = status, accTrie
+	for _, task := range status.Storage {
+		s.storageRoots[task.Root] = struct{}{}
+	}
+	for _, hash := range status.Codes {
+		s.codeHashes[hash] = struct{}{}
+	}
+	return nil
+}
+
+// splitAccountRange splits the account hash space into n consecutive chunks.
+func splitAccountRange(n int) []*snapAccountTask {
+	var (
+		tasks = make([]*snapAccountTask, 0, n)
+		step  = new(big.Int).Div(new(big.Int).Add(maxHash.Big(), common.Big1), big.NewInt(int64(n)))
+		next  common.Hash
+	)
+	for i := 0; i < n; i++ {
+		last := maxHash
+		if i < n-1 {
+			last = common.BigToHash(new(big.Int).Sub(new(big.Int).Add(next.Big(), step), common.Big1))
+		}
+		tasks = append(tasks, &snapAccountTask{Next: next, Last: last})
+		next = incHash(last)
+	}
+	return tasks
+}
+
+// complete reports whether there is nothing left to download.
+func (s *snapSync) complete() bool {
+	return len(s.status.Accounts) == 0 && len(s.status.Storage) == 0 && len(s.status.Codes) == 0 && len(s.requests) == 0
+}
+
+// assignTasks sends a request to every idle peer serving the state, as long
+// as there is anything left to request. Peers predating hpb/102 don't know the
+// snapshot messages and are never asked.
+func (s *snapSync) assignTasks() {
+	for _, p := range s.syn.peers.AllPeers() {
+		if p.version < p2p.ProtoVersion102 {
+			continue
+		}
+		if _, ok := s.busy[p.id]; ok {
+			continue
+		}
+		if _, ok := s.stateless[p.id]; ok {
+			continue
+		}
+		if !s.request(p) {
+			return
+		}
+	}
+}
+
+// request sends the next batch of tasks to the peer, contract codes and
+// storage first to keep the queues short. It returns false if there was
+// nothing to request.
+func (s *snapSync) request(p *peerConnection) bool {
+	s.nextID++
+	req := &snapRequest{id: s.nextID, peer: p}
+
+	var send func()
+	if len(s.status.Codes) > 0 {
+		n := len(s.status.Codes)
+		if n > snapCodeBatch {
+			n = snapCodeBatch
+		}
+		req.codes = append([]common.Hash{}, s.status.Codes[:n]...)
+		s.status.Codes = s.status.Codes[n:]
+
+		send = func() { p.peer.RequestByteCodes(req.id, req.codes, snapRequestBytes) }
+	}
+	if send == nil {
+		for _, task := range s.status.Storage {
+			if task.req != nil {
+				continue
+			}
+			// A storage trie resumed midway must be requested alone, the
+			// rest of them in batches of the same state
+			if len(req.storage) > 0 && (task.Next != (common.Hash{}) || task.State != req.storage[0].State) {
+				continue
+			}
+			task.req = req
+			req.storage = append(req.storage, task)
+			if task.Next != (common.Hash{}) || len(req.storage) == snapStorageBatch {
+				break
+			}
+		}
+		if len(req.storage) > 0 {
+			var (
+				first    = req.storage[0]
+				accounts = make([]common.Hash, len(req.storage))
+			)
+			for i, task := range req.storage {
+				accounts[i] = task.Account
+			}
+			send = func() {
+				p.peer.RequestStorageRanges(req.id, first.State, accounts, first.Next, maxHash, snapRequestBytes)
+			}
+		}
+	}
+	if send == nil {
+		for _, task := range s.status.Accounts {
+			if task.req == nil {
+				task.req, req.account = req, task
+				next, last := task.Next, task.Last
+				send = func() { p.peer.RequestAccountRange(req.id, s.root, next, last, snapRequestBytes) }
+				break
+			}
+		}
+	}
+	if send == nil {
+		return false
+	}
+	req.timer = time.AfterFunc(s.syn.requestTTL(), func() {
+		select {
+		case s.timeout <- req:
+		case <-s.done:
+		}
+	})
+	s.requests[req.id] = req
+	s.busy[p.id] = struct{}{}
+
+	go send()
+	return true
+}
+
+// revert returns the tasks of a request that won't be answered to the queues.
+func (s *snapSync) revert(req *snapRequest) {
+	req.timer.Stop()
+	delete(s.requests, req.id)
+	delete(s.busy, req.peer.id)
+
+	if req.account != nil {
+		req.account.req = nil
+	}
+	for _, task := range req.storage {
+		task.req = nil
+	}
+	s.status.Codes = append(s.status.Codes, req.codes...)
+}
+
+// process matches a response up with its request and integrates its data.
+func (s *snapSync) process(pack *snapPack) error {
+	req := s.requests[pack.id]
+	if req == nil || req.peer.id != pack.peerId {
+		log.Debug("Unrequested snapshot data", "peer", pack.peerId, "id", pack.id)
+		return nil
+	}
+	s.revert(req)
+
+	switch res := pack.data.(type) {
+	case *accountRangeData:
+		if req.account != nil {
+			return s.processAccounts(req, res)
+		}
+	case *storageRangesData:
+		if len(req.storage) > 0 {
+			return s.processStorage(req, res)
+		}
+	case *byteCodesData:
+		if len(req.codes) > 0 {
+			s.processCodes(req, res)
+			return nil
+		}
+	}
+	s.invalid(req, errors.New("mismatching response"))
+	return nil
+}
+
+// invalid drops a peer that delivered data not matching the state.
+func (s *snapSync) invalid(req *snapRequest, err error) {
+	log.Warn("Invalid state snapshot data, dropping peer", "peer", req.peer.id, "err", err)
+	s.stateless[req.peer.id] = struct{}{}
+	s.syn.dropPeer(req.peer.id)
+}
+
+// processAccounts verifies a range of accounts against the state root, adds
+// them to the account trie and queues their storage and code for download.
+func (s *snapSync) processAccounts(req *snapRequest, res *accountRangeData) error {
+	task := req.account
+	if len(res.Accounts) == 0 && len(res.Proof) == 0 {
+		req.peer.log.Debug("Peer does not serve the state snapshot", "root", s.root)
+		s.stateless[req.peer.id] = struct{}{}
+		return nil
+	}
+	keys, values := make([][]byte, len(res.Accounts)), make([][]byte, len(res.Accounts))
+	for i, account := range res.Accounts {
+		keys[i], values[i] = account.Hash[:], account.Body
+	}
+	var last []byte
+	if len(keys) > 0 {
+		last = keys[len(keys)-1]
+	}
+	more, err := trie.VerifyRangeProof(s.root, task.Next[:], last, keys, values, res.Proof)
+	if err != nil {
+		s.invalid(req, err)
+		return nil
+	}
+	for i, key := range keys {
+		if err := s.accTrie.TryUpdate(key, values[i]); err != nil {
+			return err
+		}
+		var account state.Account
+		if err := rlp.DecodeBytes(values[i], &account); err != nil {
+			return fmt.Errorf("invalid account %x: %v", key, err)
+		}
+		if _, ok := s.storageRoots[account.Root]; !ok && account.Root != types.EmptyRootHash && !s.known(account.Root) {
+			s.storageRoots[account.Root] = struct{}{}
+			s.status.Storage = append(s.status.Storage, &snapStorageTask{State: s.root, Account: common.BytesToHash(key), Root: account.Root})
+		}
+		if hash := common.BytesToHash(account.CodeHash); hash != emptyCodeHash {
+			if _, ok := s.codeHashes[hash]; !ok && !s.known(hash) {
+				s.codeHashes[hash] = struct{}{}
+				s.status.Codes = append(s.status.Codes, hash)
+			}
+		}
+		s.pending += len(key) + len(values[i])
+		s.status.AccountsSynced++
+		s.status.BytesSynced += uint64(len(key) + len(values[i]))
+	}
+	// The chunk is done once the trie runs out or the next chunk is reached
+	if !more || bytes.Compare(last, task.Last[:]) >= 0 {
+		for i, t := range s.status.Accounts {
+			if t == task {
+				s.status.Accounts = append(s.status.Accounts[:i], s.status.Accounts[i+1:]...)
+				break
+			}
+		}
+	} else {
+		task.Next = incHash(common.BytesToHash(last))
+	}
+	return nil
+}
+
+// processStorage verifies the storage ranges of a batch of accounts against
+// their storage roots and adds them to the storage tries.
+func (s *snapSync) processStorage(req *snapRequest, res *storageRangesData) error {
+	if len(res.Slots) == 0 && len(res.Proof) == 0 {
+		req.peer.log.Debug("Peer does not serve the state snapshot", "root", req.storage[0].State)
+		s.stateless[req.peer.id] = struct{}{}
+		return nil
+	}
+	if len(res.Slots) > len(req.storage) {
+		s.invalid(req, fmt.Errorf("too many storage ranges: %d > %d", len(res.Slots), len(req.storage)))
+		return nil
+	}
+	for i, slots := range res.Slots {
+		task := req.storage[i]
+
+		keys, values := make([][]byte, len(slots)), make([][]byte, len(slots))
+		for j, slot := range slots {
+			keys[j], values[j] = slot.Hash[:], slot.Body
+		}
+		// Only the last range may be partial, proven by its edges
+		var (
+			more bool
+			err  error
+		)
+		if i == len(res.Slots)-1 && len(res.Proof) > 0 {
+			var last []byte
+			if len(keys) > 0 {
+				last = keys[len(keys)-1]
+			}
+			more, err = trie.VerifyRangeProof(task.Root, task.Next[:], last, keys, values, res.Proof)
+		} else {
+			_, err = trie.VerifyRangeProof(task.Root, nil, nil, keys, values, nil)
+		}
+		if err != nil {
+			s.invalid(req, err)
+			return nil
+		}
+		if task.trie == nil {
+			if task.trie, err = trie.New(task.Partial, s.syn.stateDB); err != nil {
+				return err
+			}
+			task.trie.SetCacheLimit(snapTrieCacheGen)
+		}
+		for j, key := range keys {
+			if err := task.trie.TryUpdate(key, values[j]); err != nil {
+				return err
+			}
+			s.pending += len(key) + len(values[j])
+			s.status.BytesSynced += uint64(len(key) + len(values[j]))
+		}
+		s.status.SlotsSynced += uint64(len(keys))
+
+		if more {
+			task.Next = incHash(common.BytesToHash(keys[len(keys)-1]))
+			continue
+		}
+		if _, err := task.trie.CommitTo(s.batch); err != nil {
+			return err
+		}
+		for j, t := range s.status.Storage {
+			if t == task {
+				s.status.Storage = append(s.status.Storage[:j], s.status.Storage[j+1:]...)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// processCodes stores the delivered contract codes that were requested and
+// queues the missing ones again.
+func (s *snapSync) processCodes(req *snapRequest, res *byteCodesData) {
+	// The codes were queued again on revert, take the delivered ones out
+	s.status.Codes = s.status.Codes[:len(s.status.Codes)-len(req.codes)]
+
+	if len(res.Codes) == 0 {
+		req.peer.log.Debug("Peer does not serve the requested codes", "count", len(req.codes))
+		s.stateless[req.peer.id] = struct{}{}
+		s.status.Codes = append(s.status.Codes, req.codes...)
+		return
+	}
+	missing := make(map[common.Hash]struct{}, len(req.codes))
+	for _, hash := range req.codes {
+		missing[hash] = struct{}{}
+	}
+	for _, code := range res.Codes {
+		hash := crypto.Keccak256Hash(code)
+		if _, ok := missing[hash]; !ok {
+			continue
+		}
+		delete(missing, hash)
+		s.batch.Put(hash[:], code)
+
+		s.pending += len(code)
+		s.status.CodesSynced++
+		s.status.BytesSynced += uint64(len(code))
+	}
+	for _, hash := range req.codes {
+		if _, ok := missing[hash]; ok {
+			s.status.Codes = append(s.status.Codes, hash)
+		}
+	}
+}
+
+// commit writes the rebuilt tries and the progress of the sync to the
+// database once enough data accumulated, or right away if forced.
+func (s *snapSync) commit(force bool) error {
+	if !force && s.pending+s.batch.ValueSize() < hpbdb.IdealBatchSize {
+		return nil
+	}
+	root, err := s.accTrie.CommitTo(s.batch)
+	if err != nil {
+		return err
+	}
+	s.status.Partial = root
+
+	for _, task := range s.status.Storage {
+		if task.trie != nil {
+			if task.Partial, err = task.trie.CommitTo(s.batch); err != nil {
+				return err
+			}
+		}
+	}
+	blob, err := rlp.EncodeToBytes(s.status)
+	if err != nil {
+		return err
+	}
+	bc.WriteSnapshotSyncStatus(s.batch, blob)
+	if err := s.batch.Write(); err != nil {
+		return fmt.Errorf("DB write error: %v", err)
+	}
+	s.batch.Reset()
+	s.pending = 0
+
+	s.syn.syncStatsLock.Lock()
+	s.syn.syncStatsState.processed = s.status.AccountsSynced + s.status.SlotsSynced + s.status.CodesSynced
+	s.syn.syncStatsState.pending = uint64(len(s.status.Storage) + len(s.status.Codes))
+	s.syn.syncStatsLock.Unlock()
+
+	log.Info("Imported state snapshot entries", "accounts", s.status.AccountsSynced, "slots", s.status.SlotsSynced, "codes", s.status.CodesSynced, "size", common.StorageSize(s.status.BytesSynced), "chunks", len(s.status.Accounts), "storage", len(s.status.Storage), "elapsed", common.PrettyDuration(time.Since(s.start)))
+	return nil
+}
+
+// known reports whether a trie node or code is already in the database.
+func (s *snapSync) known(hash common.Hash) bool {
+	ok, _ := s.syn.stateDB.Has(hash[:])
+	return ok
+}
+
+// heal schedules the storage tries and codes the sync did not get to on the
+// node by node state sync. The rest of the state is reached from its root.
+func (s *snapSync) heal(sched *trie.TrieSync) {
+	if s.status == nil {
+		return
+	}
+	for _, task := range s.status.Storage {
+		sched.AddSubTrie(task.Root, 64, common.Hash{}, nil)
+	}
+	for _, hash := range s.status.Codes {
+		sched.AddRawEntry(hash, 64, common.Hash{})
+	}
+}
+
+// incHash returns the hash following h.
+func incHash(h common.Hash) common.Hash {
+	for i := len(h) - 1; i >= 0; i-- {
+		h[i]++
+		if h[i] != 0 {
+			break
+		}
+	}
+	return h
+}
@@ -0,0 +1,277 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package synctrl
+
+import (
+	"bytes"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hpb-project/go-hpb/blockchain"
+	"github.com/hpb-project/go-hpb/blockchain/state"
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/log"
+	"github.com/hpb-project/go-hpb/common/rlp"
+	"github.com/hpb-project/go-hpb/network/p2p"
+)
+
+const (
+	snapTestAccounts  = 2000  // Number of plain accounts in the test state
+	snapTestContracts = 24    // Number of contracts with storage in the test state
+	snapTestSlots     = 100   // Number of storage slots of a contract
+	snapTestBigSlots  = 20000 // Number of storage slots of the contract too big for a single response
+)
+
+// snapTestAccount is the data of an account of the snapshot test state.
+type snapTestAccount struct {
+	address common.Address
+	balance *big.Int
+	code    []byte
+	slots   map[common.Hash]common.Hash
+}
+
+// makeSnapTestState creates a state with plain accounts, contracts sharing and
+// not sharing their code, and a contract whose storage exceeds the response
+// size of a single request.
+func makeSnapTestState() (*hpbdb.MemDatabase, common.Hash, []*snapTestAccount) {
+	db, _ := hpbdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	var accounts []*snapTestAccount
+	for i := 0; i < snapTestAccounts+snapTestContracts+1; i++ {
+		acc := &snapTestAccount{
+			address: common.BigToAddress(big.NewInt(int64(i + 1))),
+			balance: big.NewInt(int64(i+1) * 1000),
+		}
+		statedb.AddBalance(acc.address, acc.balance)
+
+		if i >= snapTestAccounts {
+			acc.code = []byte{0x60, byte(i % 4), 0x60, 0x00, 0x55}
+			statedb.SetCode(acc.address, acc.code)
+
+			slots := snapTestSlots
+			if i == snapTestAccounts+snapTestContracts {
+				slots = snapTestBigSlots
+			}
+			acc.slots = make(map[common.Hash]common.Hash, slots)
+			for j := 0; j < slots; j++ {
+				key, value := common.BigToHash(big.NewInt(int64(j))), common.BigToHash(big.NewInt(int64(i*j+1)))
+				statedb.SetState(acc.address, key, value)
+				acc.slots[key] = value
+			}
+		}
+		accounts = append(accounts, acc)
+	}
+	root, _ := statedb.CommitTo(db, false)
+	return db, root, accounts
+}
+
+// checkSnapTestState verifies that the database holds the complete test state.
+func checkSnapTestState(t *testing.T, db hpbdb.Database, root common.Hash, accounts []*snapTestAccount) {
+	statedb, err := state.New(root, state.NewDatabase(db))
+	if err != nil {
+		t.Fatalf("failed to open synced state %x: %v", root, err)
+	}
+	it := state.NewNodeIterator(statedb)
+	for it.Next() {
+	}
+	if it.Error != nil {
+		t.Fatalf("synced state incomplete: %v", it.Error)
+	}
+	for i, acc := range accounts {
+		if balance := statedb.GetBalance(acc.address); balance.Cmp(acc.balance) != 0 {
+			t.Errorf("account %d: balance mismatch: have %v, want %v", i, balance, acc.balance)
+		}
+		if code := statedb.GetCode(acc.address); !bytes.Equal(code, acc.code) {
+			t.Errorf("account %d: code mismatch: have %x, want %x", i, code, acc.code)
+		}
+		for key, value := range acc.slots {
+			if have := statedb.GetState(acc.address, key); have != value {
+				t.Fatalf("account %d: slot %x mismatch: have %x, want %x", i, key, have, value)
+			}
+		}
+	}
+}
+
+// snapTestBudget is the number of responses a set of test peers gives before
+// going silent, closing its exhausted channel when it runs out.
+type snapTestBudget struct {
+	left      int
+	exhausted chan struct{}
+	lock      sync.Mutex
+}
+
+func newSnapTestBudget(responses int) *snapTestBudget {
+	return &snapTestBudget{left: responses, exhausted: make(chan struct{})}
+}
+
+// take reports whether another response may be given.
+func (b *snapTestBudget) take() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.left == 0 {
+		return false
+	}
+	if b.left--; b.left == 0 {
+		close(b.exhausted)
+	}
+	return true
+}
+
+// snapTestPeer is a fake peer serving the snapshot of a source database,
+// keeping track of the accounts it served and optionally stopping to answer
+// once its budget is used up.
+type snapTestPeer struct {
+	*FakePeer
+	budget   *snapTestBudget // Responses left to give, unlimited if nil
+	accounts int32           // Number of accounts served
+	requests int32           // Number of snapshot requests received
+}
+
+func newSnapTestPeer(id string, db hpbdb.Database, syn *Syncer, budget *snapTestBudget) *snapTestPeer {
+	return &snapTestPeer{FakePeer: NewFakePeer(id, db, nil, syn), budget: budget}
+}
+
+// answer counts a request and reports whether it should be answered.
+func (p *snapTestPeer) answer() bool {
+	atomic.AddInt32(&p.requests, 1)
+	return p.budget == nil || p.budget.take()
+}
+
+func (p *snapTestPeer) RequestAccountRange(id uint64, root, origin, limit common.Hash, bytes uint64) error {
+	if !p.answer() {
+		return nil
+	}
+	res := serviceAccountRange(p.db, &getAccountRangeData{ID: id, Root: root, Origin: origin, Limit: limit, Bytes: bytes})
+	atomic.AddInt32(&p.accounts, int32(len(res.Accounts)))
+	p.syncer.DeliverAccountRange(p.id, res)
+	return nil
+}
+
+func (p *snapTestPeer) RequestStorageRanges(id uint64, root common.Hash, accounts []common.Hash, origin, limit common.Hash, bytes uint64) error {
+	if !p.answer() {
+		return nil
+	}
+	return p.FakePeer.RequestStorageRanges(id, root, accounts, origin, limit, bytes)
+}
+
+func (p *snapTestPeer) RequestByteCodes(id uint64, hashes []common.Hash, bytes uint64) error {
+	if !p.answer() {
+		return nil
+	}
+	return p.FakePeer.RequestByteCodes(id, hashes, bytes)
+}
+
+// newSnapTestSyncer creates a syncer over the given database without a chain,
+// as the snapshot sync needs none, failing the test if a peer gets dropped.
+func newSnapTestSyncer(t *testing.T, db hpbdb.Database) *Syncer {
+	return &Syncer{
+		stateDB:       db,
+		peers:         newPeerSet(),
+		dropPeer:      func(id string) { t.Errorf("peer %s dropped", id) },
+		rttEstimate:   uint64(rttMaxEstimate),
+		rttConfidence: uint64(1000000),
+		quitCh:        make(chan struct{}),
+	}
+}
+
+// registerSnapTestPeer adds a peer of the given protocol version to the syncer.
+func registerSnapTestPeer(t *testing.T, syn *Syncer, peer *snapTestPeer, version uint) {
+	if err := syn.peers.Register(newPeerConnection(peer.id, version, peer, log.New("peer", peer.id))); err != nil {
+		t.Fatalf("failed to register peer %s: %v", peer.id, err)
+	}
+}
+
+// Tests that a snapshot sync from two peers which is interrupted midway
+// persists its progress, and that a new sync of the same root resumes from it
+// instead of downloading the state again. Peers predating hpb/102 must never be
+// asked for snapshot data.
+func TestSnapSyncInterruptResume(t *testing.T) {
+	src, root, accounts := makeSnapTestState()
+	dst, _ := hpbdb.NewMemDatabase()
+
+	// Sync until the peers stop answering, then cancel
+	syn := newSnapTestSyncer(t, dst)
+	budget := newSnapTestBudget(8)
+	legacy := newSnapTestPeer("legacy", src, syn, nil)
+	registerSnapTestPeer(t, syn, legacy, p2p.ProtoVersion101)
+	for _, id := range []string{"first", "second"} {
+		registerSnapTestPeer(t, syn, newSnapTestPeer(id, src, syn, budget), p2p.ProtoVersion102)
+	}
+	if err := newSnapSync(syn, root).run(budget.exhausted); err != errCancelStateFetch {
+		t.Fatalf("interrupted sync: have error %v, want %v", err, errCancelStateFetch)
+	}
+	status := new(snapStatus)
+	if err := rlp.DecodeBytes(bc.GetSnapshotSyncStatus(dst), status); err != nil {
+		t.Fatalf("failed to decode persisted status: %v", err)
+	}
+	if status.Root != root {
+		t.Errorf("persisted root mismatch: have %x, want %x", status.Root, root)
+	}
+	if status.AccountsSynced == 0 || status.Partial == root {
+		t.Fatalf("interrupted sync made no partial progress: %d accounts, partial root %x", status.AccountsSynced, status.Partial)
+	}
+	if len(status.Accounts) == 0 {
+		t.Fatalf("interrupted sync downloaded all accounts")
+	}
+	// Resume the sync with fresh peers and make sure the state completes
+	syn = newSnapTestSyncer(t, dst)
+	third, fourth := newSnapTestPeer("third", src, syn, nil), newSnapTestPeer("fourth", src, syn, nil)
+	registerSnapTestPeer(t, syn, legacy, p2p.ProtoVersion101)
+	registerSnapTestPeer(t, syn, third, p2p.ProtoVersion102)
+	registerSnapTestPeer(t, syn, fourth, p2p.ProtoVersion102)
+
+	snap := newSnapSync(syn, root)
+	if err := snap.run(make(chan struct{})); err != nil {
+		t.Fatalf("resumed sync failed: %v", err)
+	}
+	if snap.status.Partial != root {
+		t.Fatalf("rebuilt root mismatch: have %x, want %x", snap.status.Partial, root)
+	}
+	if snap.status.AccountsSynced <= status.AccountsSynced {
+		t.Errorf("resumed sync lost its progress: %d accounts, %d before", snap.status.AccountsSynced, status.AccountsSynced)
+	}
+	if served := atomic.LoadInt32(&third.accounts) + atomic.LoadInt32(&fourth.accounts); int(served) >= len(accounts) {
+		t.Errorf("resumed sync downloaded all %d accounts again", served)
+	}
+	if n := atomic.LoadInt32(&legacy.requests); n != 0 {
+		t.Errorf("hpb/101 peer asked for snapshot data %d times", n)
+	}
+	checkSnapTestState(t, dst, root, accounts)
+}
+
+// Tests that a snapshot sync without any peer of hpb/102 or later gives up
+// right away instead of waiting for responses that never come.
+func TestSnapSyncLegacyPeers(t *testing.T) {
+	src, root, _ := makeSnapTestState()
+	dst, _ := hpbdb.NewMemDatabase()
+
+	syn := newSnapTestSyncer(t, dst)
+	legacy := newSnapTestPeer("legacy", src, syn, nil)
+	registerSnapTestPeer(t, syn, legacy, p2p.ProtoVersion100)
+
+	if err := newSnapSync(syn, root).run(make(chan struct{})); err != errSnapUnavailable {
+		t.Fatalf("sync error mismatch: have %v, want %v", err, errSnapUnavailable)
+	}
+	if n := atomic.LoadInt32(&legacy.requests); n != 0 {
+		t.Errorf("hpb/100 peer asked for snapshot data %d times", n)
+	}
+}
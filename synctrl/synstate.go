@@ -60,7 +60,8 @@ type stateSyncStats struct {
 // stateSync schedules requests for downloading a particular state trie defined
 // by a given state root.
 type stateSync struct {
-	syn    *Syncer // syncer instance to access and manage current peerset
+	syn    *Syncer     // syncer instance to access and manage current peerset
+	root   common.Hash // State root being synced
 
 	sched  *trie.TrieSync             // State trie sync scheduler defining the tasks
 	keccak hash.Hash                  // Keccak256 hasher to verify deliveries with
@@ -87,7 +88,7 @@ type stateTask struct {
 func newStateSync(syn *Syncer, root common.Hash) *stateSync {
 	return &stateSync{
 		syn:     syn,
-		sched:   state.NewStateSync(root, syn.stateDB),
+		root:    root,
 		keccak:  sha3.NewKeccak256(),
 		tasks:   make(map[common.Hash]*stateTask),
 		deliver: make(chan *stateReq),
@@ -96,12 +97,25 @@ func newStateSync(syn *Syncer, root common.Hash) *stateSync {
 	}
 }
 
-// run starts the task assignment and response processing loop, blocking until
-// it finishes, and finally notifying any goroutines waiting for the loop to
-// finish.
+// run downloads the state as snapshot ranges first, then starts the task
+// assignment and response processing loop to heal whatever is still missing
+// node by node, blocking until it finishes, and finally notifying any
+// goroutines waiting for the loop to finish.
 func (s *stateSync) run() {
+	defer close(s.done)
+
+	snap := newSnapSync(s.syn, s.root)
+	switch err := snap.run(s.cancel); err {
+	case nil:
+	case errSnapUnavailable:
+		log.Warn("State snapshot sync incomplete, healing by trie nodes", "err", err)
+	default:
+		s.err = err
+		return
+	}
+	s.sched = state.NewStateSync(s.root, s.syn.stateDB)
+	snap.heal(s.sched)
 	s.err = s.loop()
-	close(s.done)
 }
 
 // Wait blocks until the sync is done or canceled.
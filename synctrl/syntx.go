@@ -126,6 +126,12 @@ func (this *SynCtrl) txRoutingLoop() {
 	}
 }
 
+// RelayTx propagates a transaction submitted locally by a node running without a
+// transaction pool, such as a light client.
+func (this *SynCtrl) RelayTx(tx *types.Transaction) {
+	this.routingTx(tx.Hash(), tx)
+}
+
 // routingTx will propagate a transaction to peers by type which are not known to
 // already have the given transaction.
 func (this *SynCtrl) routingTx(hash common.Hash, tx *types.Transaction) {
@@ -17,6 +17,8 @@
 package txpool
 
 import (
+	"bytes"
+
 	"github.com/hpb-project/go-hpb/common"
 	"github.com/hpb-project/go-hpb/common/log"
 	"github.com/hpb-project/go-hpb/config"
@@ -99,7 +101,14 @@ func NewTxPool(config config.TxPoolConfiguration, chainConfig *config.ChainConfi
 		return INSTANCE.Load().(*TxPool)
 	}
 	//2.Create the transaction pool with its initial settings
-	pool := &TxPool{
+	pool := newTxPool(config, chainConfig, blockChain)
+	INSTANCE.Store(pool)
+	return pool
+}
+
+// newTxPool creates a transaction pool without making it the pool instance.
+func newTxPool(config config.TxPoolConfiguration, chainConfig *config.ChainConfig, blockChain blockChain) *TxPool {
+	return &TxPool{
 		config:      config,
 		pending:     make(map[common.Address]*txList),
 		queue:       make(map[common.Address]*txList),
@@ -113,8 +122,6 @@ func NewTxPool(config config.TxPoolConfiguration, chainConfig *config.ChainConfi
 		tmpbeats:    make(map[common.Hash]time.Time),
 		tmpqueue:     make(map[common.Hash]*types.Transaction),
 	}
-	INSTANCE.Store(pool)
-	return pool
 }
 func (pool *TxPool) Start(){
 	pool.reset(nil, pool.chain.CurrentBlock().Header())
@@ -881,6 +888,92 @@ func (pool *TxPool) Content() (map[common.Address]types.Transactions, map[common
 	return pending, queued
 }
 
+// NonceGap is a range of nonces missing from the transactions of an account.
+type NonceGap struct {
+	From uint64 // First missing nonce
+	To   uint64 // Last missing nonce
+}
+
+// AccountStatus summarises the transactions an account has in the pool.
+type AccountStatus struct {
+	Pending   int        // Number of executable transactions
+	Queued    int        // Number of non-executable transactions
+	Nonce     uint64     // Account nonce in the current state
+	NextNonce uint64     // Lowest nonce the account has to submit next to make progress
+	Gaps      []NonceGap // Nonces missing before all queued transactions can execute
+}
+
+// Addresses returns the accounts having pending or queued transactions in the
+// pool, sorted by address.
+func (pool *TxPool) Addresses() []common.Address {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	addrs := make([]common.Address, 0, len(pool.pending)+len(pool.queue))
+	for addr := range pool.pending {
+		addrs = append(addrs, addr)
+	}
+	for addr := range pool.queue {
+		if _, ok := pool.pending[addr]; !ok {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Slice(addrs, func(i, j int) bool { return bytes.Compare(addrs[i][:], addrs[j][:]) < 0 })
+	return addrs
+}
+
+// ContentFrom retrieves the pending and queued transactions of a single account,
+// sorted by nonce.
+func (pool *TxPool) ContentFrom(addr common.Address) (types.Transactions, types.Transactions) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	var pending, queued types.Transactions
+	if list, ok := pool.pending[addr]; ok {
+		pending = list.Flatten()
+	}
+	if list, ok := pool.queue[addr]; ok {
+		queued = list.Flatten()
+	}
+	return pending, queued
+}
+
+// AccountStatus summarises the transactions of an account in the pool, including
+// the nonce gaps keeping its queued transactions from being executed and the
+// lowest nonce the account still needs to submit.
+func (pool *TxPool) AccountStatus(addr common.Address) *AccountStatus {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	status := &AccountStatus{Nonce: pool.currentState.GetNonce(addr)}
+
+	next := status.Nonce
+	if list, ok := pool.pending[addr]; ok {
+		txs := list.Flatten()
+		status.Pending = len(txs)
+		if len(txs) > 0 {
+			next = txs[len(txs)-1].Nonce() + 1
+		}
+	}
+	if list, ok := pool.queue[addr]; ok {
+		txs := list.Flatten()
+		status.Queued = len(txs)
+		for _, tx := range txs {
+			if nonce := tx.Nonce(); nonce > next {
+				status.Gaps = append(status.Gaps, NonceGap{From: next, To: nonce - 1})
+			}
+			if nonce := tx.Nonce(); nonce >= next {
+				next = nonce + 1
+			}
+		}
+	}
+	status.NextNonce = next
+	if len(status.Gaps) > 0 {
+		status.NextNonce = status.Gaps[0].From
+	}
+	return status
+}
+
 func (pool *TxPool) SubscribeTxPreEvent(ch chan<-bc.TxPreEvent) sub.Subscription {
 	return pool.scope.Track(pool.txFeed.Subscribe(ch))
 }
@@ -17,16 +17,20 @@
 package txpool
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"fmt"
 	"github.com/hpb-project/go-hpb/common"
 	"github.com/hpb-project/go-hpb/common/crypto"
 	"github.com/hpb-project/go-hpb/event"
+	"github.com/hpb-project/go-hpb/event/sub"
+	"github.com/hpb-project/go-hpb/blockchain"
 	"github.com/hpb-project/go-hpb/blockchain/storage"
 	"github.com/hpb-project/go-hpb/blockchain/state"
 	"github.com/hpb-project/go-hpb/blockchain/types"
 	"math/big"
 	"math/rand"
+	"reflect"
 	"testing"
 	"time"
 	"github.com/hpb-project/go-hpb/config"
@@ -60,6 +64,10 @@ func (bc *testBlockChain) StateAt(common.Hash) (*state.StateDB, error) {
 	return bc.statedb, nil
 }
 
+func (*testBlockChain) SubscribeChainHeadEvent(ch chan<- bc.ChainHeadEvent) sub.Subscription {
+	return new(sub.Feed).Subscribe(ch)
+}
+
 func transaction(nonce uint64, gaslimit *big.Int, key *ecdsa.PrivateKey) *types.Transaction {
 	return pricedTransaction(nonce, gaslimit, big.NewInt(1), key)
 }
@@ -80,6 +88,18 @@ func setupTxPool() (*TxPool, *ecdsa.PrivateKey) {
 	return pool, key
 }
 
+// setupLocalTxPool creates a pool of its own over an empty state, instead of
+// the shared pool instance. The pool is not started.
+func setupLocalTxPool() *TxPool {
+	db, _ := hpbdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	blockchain := &testBlockChain{statedb, big.NewInt(1000000)}
+
+	pool := newTxPool(testTxPoolConfig, config.MainnetChainConfig, blockchain)
+	pool.reset(nil, blockchain.CurrentBlock().Header())
+	return pool
+}
+
 // validateTxPoolInternals checks various consistency invariants within the pool.
 func validateTxPoolInternals(pool *TxPool) error {
 	pool.mu.RLock()
@@ -1030,6 +1050,101 @@ func TestTransactionReplacement(t *testing.T) {
 	}
 }
 
+// Tests that the accounts of the pool are listed once and in address order,
+// including the ones having only queued transactions.
+func TestTransactionAddresses(t *testing.T) {
+	pool := setupLocalTxPool()
+
+	want := make(map[common.Address]bool)
+	for i := 0; i < 5; i++ {
+		key, _ := crypto.GenerateKey()
+		addr := crypto.PubkeyToAddress(key.PublicKey)
+		pool.currentState.AddBalance(addr, big.NewInt(1000000))
+
+		// Odd accounts skip their first nonce, leaving them queued only
+		for nonce := uint64(i % 2); nonce < 2; nonce++ {
+			if err := pool.AddTx(transaction(nonce, big.NewInt(100000), key)); err != nil {
+				t.Fatalf("account %d: failed to add transaction %d: %v", i, nonce, err)
+			}
+		}
+		want[addr] = true
+	}
+	addrs := pool.Addresses()
+	if len(addrs) != len(want) {
+		t.Fatalf("address count mismatch: have %d, want %d", len(addrs), len(want))
+	}
+	for i, addr := range addrs {
+		if !want[addr] {
+			t.Errorf("address %d: unexpected account %x", i, addr)
+		}
+		if i > 0 && bytes.Compare(addrs[i-1][:], addr[:]) >= 0 {
+			t.Errorf("address %d: accounts not in strictly ascending order", i)
+		}
+	}
+}
+
+// Tests that the content of an account is split into its pending and queued
+// transactions, and that the nonce gaps holding back the queued ones are found.
+func TestTransactionAccountContent(t *testing.T) {
+	pool := setupLocalTxPool()
+	key, _ := crypto.GenerateKey()
+
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	pool.currentState.AddBalance(addr, big.NewInt(1000000))
+	for _, nonce := range []uint64{0, 1, 3, 4, 7} {
+		if err := pool.AddTx(transaction(nonce, big.NewInt(100000), key)); err != nil {
+			t.Fatalf("failed to add transaction %d: %v", nonce, err)
+		}
+	}
+	nonces := func(txs types.Transactions) []uint64 {
+		var res []uint64
+		for _, tx := range txs {
+			res = append(res, tx.Nonce())
+		}
+		return res
+	}
+	pending, queued := pool.ContentFrom(addr)
+	if have, want := nonces(pending), []uint64{0, 1}; !reflect.DeepEqual(have, want) {
+		t.Errorf("pending nonces mismatch: have %v, want %v", have, want)
+	}
+	if have, want := nonces(queued), []uint64{3, 4, 7}; !reflect.DeepEqual(have, want) {
+		t.Errorf("queued nonces mismatch: have %v, want %v", have, want)
+	}
+	want := &AccountStatus{Pending: 2, Queued: 3, NextNonce: 2, Gaps: []NonceGap{{From: 2, To: 2}, {From: 5, To: 6}}}
+	if status := pool.AccountStatus(addr); !reflect.DeepEqual(status, want) {
+		t.Errorf("account status mismatch: have %+v, want %+v", status, want)
+	}
+	// An account with only queued transactions is missing its state nonce first
+	other, _ := crypto.GenerateKey()
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(other.PublicKey), big.NewInt(1000000))
+	if err := pool.AddTx(transaction(2, big.NewInt(100000), other)); err != nil {
+		t.Fatalf("failed to add queued transaction: %v", err)
+	}
+	want = &AccountStatus{Queued: 1, NextNonce: 0, Gaps: []NonceGap{{From: 0, To: 1}}}
+	if status := pool.AccountStatus(crypto.PubkeyToAddress(other.PublicKey)); !reflect.DeepEqual(status, want) {
+		t.Errorf("queued account status mismatch: have %+v, want %+v", status, want)
+	}
+	// An account without gaps continues after its last transaction
+	third, _ := crypto.GenerateKey()
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(third.PublicKey), big.NewInt(1000000))
+	for _, nonce := range []uint64{0, 1, 2} {
+		if err := pool.AddTx(transaction(nonce, big.NewInt(100000), third)); err != nil {
+			t.Fatalf("failed to add transaction %d: %v", nonce, err)
+		}
+	}
+	want = &AccountStatus{Pending: 3, NextNonce: 3}
+	if status := pool.AccountStatus(crypto.PubkeyToAddress(third.PublicKey)); !reflect.DeepEqual(status, want) {
+		t.Errorf("gapless account status mismatch: have %+v, want %+v", status, want)
+	}
+	// An unknown account has no content
+	if pending, queued := pool.ContentFrom(common.Address{1}); len(pending) != 0 || len(queued) != 0 {
+		t.Errorf("unknown account content: have %d pending, %d queued", len(pending), len(queued))
+	}
+	if status := pool.AccountStatus(common.Address{1}); !reflect.DeepEqual(status, &AccountStatus{}) {
+		t.Errorf("unknown account status mismatch: have %+v", status)
+	}
+}
+
 // Benchmarks the speed of validating the contents of the pending queue of the
 // transaction pool.
 func BenchmarkPendingDemotion100(b *testing.B)   { benchmarkPendingDemotion(b, 100) }
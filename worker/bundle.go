@@ -0,0 +1,234 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/hpb-project/go-hpb/blockchain"
+	"github.com/hpb-project/go-hpb/blockchain/types"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/crypto"
+	"github.com/hpb-project/go-hpb/common/log"
+)
+
+const (
+	// maxBundles is the maximum number of bundles waiting for inclusion.
+	maxBundles = 256
+	// maxBundleTxs is the maximum number of transactions in a single bundle.
+	maxBundleTxs = 64
+)
+
+var (
+	errEmptyBundle      = errors.New("bundle has no transactions")
+	errBundleTooLarge   = errors.New("bundle has too many transactions")
+	errBundleRange      = errors.New("bundle block range is invalid")
+	errBundleQueueFull  = errors.New("bundle queue is full")
+	errBundleKnown      = errors.New("bundle already known")
+	errBundleTxReverted = errors.New("bundle transaction reverted")
+)
+
+// Bundle is a list of transactions that must be included in a block together,
+// in the given order, or not at all.
+type Bundle struct {
+	Txs      types.Transactions
+	MinBlock uint64 // First block the bundle may be included in (0 = any)
+	MaxBlock uint64 // Last block the bundle may be included in
+
+	hash    common.Hash
+	arrival uint64 // position of the bundle in the arrival order of the queue
+}
+
+// NewBundle creates a bundle for the block range [minBlock, maxBlock].
+func NewBundle(txs types.Transactions, minBlock, maxBlock uint64) (*Bundle, error) {
+	switch {
+	case len(txs) == 0:
+		return nil, errEmptyBundle
+	case len(txs) > maxBundleTxs:
+		return nil, errBundleTooLarge
+	case maxBlock < minBlock:
+		return nil, errBundleRange
+	}
+	hashes := make([][]byte, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.Hash().Bytes()
+	}
+	return &Bundle{
+		Txs:      txs,
+		MinBlock: minBlock,
+		MaxBlock: maxBlock,
+		hash:     crypto.Keccak256Hash(hashes...),
+	}, nil
+}
+
+// Hash returns the identifier of the bundle, the hash of its transaction hashes.
+func (b *Bundle) Hash() common.Hash { return b.hash }
+
+// bundleQueue holds the bundles submitted to the worker until they are
+// included or expire.
+type bundleQueue struct {
+	bundles map[common.Hash]*Bundle
+	arrived uint64 // number of bundles queued so far
+	lock    sync.Mutex
+}
+
+func newBundleQueue() *bundleQueue {
+	return &bundleQueue{bundles: make(map[common.Hash]*Bundle)}
+}
+
+// add queues a bundle for inclusion, rejecting ones already expired at head.
+func (q *bundleQueue) add(bundle *Bundle, head uint64) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if bundle.MaxBlock <= head {
+		return errBundleRange
+	}
+	if _, ok := q.bundles[bundle.hash]; ok {
+		return errBundleKnown
+	}
+	if len(q.bundles) >= maxBundles {
+		return errBundleQueueFull
+	}
+	q.arrived++
+	bundle.arrival = q.arrived
+	q.bundles[bundle.hash] = bundle
+	return nil
+}
+
+// remove drops a bundle from the queue.
+func (q *bundleQueue) remove(hash common.Hash) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	delete(q.bundles, hash)
+}
+
+// prune drops the bundles included in the new head block, along with the ones
+// that can no longer be included after it.
+func (q *bundleQueue) prune(head *types.Block) {
+	included := make(map[common.Hash]struct{}, len(head.Transactions()))
+	for _, tx := range head.Transactions() {
+		included[tx.Hash()] = struct{}{}
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for hash, bundle := range q.bundles {
+		if bundle.MaxBlock <= head.NumberU64() {
+			delete(q.bundles, hash)
+			continue
+		}
+		for _, tx := range bundle.Txs {
+			if _, ok := included[tx.Hash()]; ok {
+				delete(q.bundles, hash)
+				break
+			}
+		}
+	}
+}
+
+// ready drops the bundles that can no longer be included from number onwards
+// and returns the ones targeting the block number, ordered by their first
+// block, then by arrival and hash.
+func (q *bundleQueue) ready(number uint64) []*Bundle {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	var bundles []*Bundle
+	for hash, bundle := range q.bundles {
+		if bundle.MaxBlock < number {
+			delete(q.bundles, hash)
+			continue
+		}
+		if bundle.MinBlock <= number {
+			bundles = append(bundles, bundle)
+		}
+	}
+	sort.Slice(bundles, func(i, j int) bool {
+		a, b := bundles[i], bundles[j]
+		if a.MinBlock != b.MinBlock {
+			return a.MinBlock < b.MinBlock
+		}
+		if a.arrival != b.arrival {
+			return a.arrival < b.arrival
+		}
+		return bytes.Compare(a.hash[:], b.hash[:]) < 0
+	})
+	return bundles
+}
+
+// commitBundles applies each bundle atomically on top of the work. A bundle
+// whose transactions do not all execute successfully is rolled back entirely.
+// Bundles that can never succeed because of stale nonces are dropped from the
+// queue.
+func (env *Work) commitBundles(queue *bundleQueue, bundles []*Bundle, coinbase common.Address) {
+	for _, bundle := range bundles {
+		err := env.commitBundle(bundle, coinbase)
+		switch err {
+		case nil:
+			log.Debug("Committed transaction bundle", "hash", bundle.Hash(), "txs", len(bundle.Txs))
+		case bc.ErrNonceTooLow:
+			log.Debug("Dropping stale transaction bundle", "hash", bundle.Hash())
+			queue.remove(bundle.Hash())
+		default:
+			log.Debug("Transaction bundle skipped", "hash", bundle.Hash(), "err", err)
+		}
+	}
+}
+
+// commitBundle applies all transactions of a bundle to the work, reverting the
+// state and the block under construction if any of them fails. The state is
+// restored from a copy since its journal is cleared after every transaction.
+func (env *Work) commitBundle(bundle *Bundle, coinbase common.Address) error {
+	var (
+		snap     = env.state.Copy()
+		gas      = env.gasPool.Gas()
+		gasUsed  = new(big.Int).Set(env.header.GasUsed)
+		tcount   = env.tcount
+		txs      = len(env.txs)
+		receipts = len(env.receipts)
+	)
+	revert := func() {
+		env.state = snap
+		(*big.Int)(env.gasPool).Set(gas)
+		env.header.GasUsed.Set(gasUsed)
+		env.tcount = tcount
+		env.txs = env.txs[:txs]
+		env.receipts = env.receipts[:receipts]
+	}
+	for _, tx := range bundle.Txs {
+		env.state.Prepare(tx.Hash(), common.Hash{}, env.tcount)
+
+		receipt, _, err := bc.ApplyTransaction(env.config, &coinbase, env.gasPool, env.state, env.header, tx, env.header.GasUsed)
+		if err == nil && receipt.Status == types.ReceiptStatusFailed {
+			err = errBundleTxReverted
+		}
+		if err != nil {
+			revert()
+			return err
+		}
+		env.txs = append(env.txs, tx)
+		env.receipts = append(env.receipts, receipt)
+		env.tcount++
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/hpb-project/go-hpb/blockchain"
+	"github.com/hpb-project/go-hpb/blockchain/state"
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/blockchain/types"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/crypto"
+	"github.com/hpb-project/go-hpb/config"
+	"github.com/hpb-project/go-hpb/hvm"
+)
+
+func testBundle(t *testing.T, nonce, min, max uint64) *Bundle {
+	tx := types.NewTransaction(nonce, common.Address{}, big.NewInt(1), big.NewInt(21000), big.NewInt(1), nil)
+	bundle, err := NewBundle(types.Transactions{tx}, min, max)
+	if err != nil {
+		t.Fatalf("failed to create bundle: %v", err)
+	}
+	return bundle
+}
+
+func TestNewBundleValidation(t *testing.T) {
+	tx := types.NewTransaction(0, common.Address{}, big.NewInt(1), big.NewInt(21000), big.NewInt(1), nil)
+
+	if _, err := NewBundle(nil, 1, 2); err != errEmptyBundle {
+		t.Errorf("empty bundle: have %v, want %v", err, errEmptyBundle)
+	}
+	if _, err := NewBundle(types.Transactions{tx}, 5, 4); err != errBundleRange {
+		t.Errorf("inverted range: have %v, want %v", err, errBundleRange)
+	}
+	txs := make(types.Transactions, maxBundleTxs+1)
+	for i := range txs {
+		txs[i] = tx
+	}
+	if _, err := NewBundle(txs, 1, 2); err != errBundleTooLarge {
+		t.Errorf("oversized bundle: have %v, want %v", err, errBundleTooLarge)
+	}
+}
+
+func TestBundleQueueReady(t *testing.T) {
+	queue := newBundleQueue()
+
+	early := testBundle(t, 0, 0, 10)
+	late := testBundle(t, 1, 12, 20)
+	if err := queue.add(early, 5); err != nil {
+		t.Fatalf("failed to add bundle: %v", err)
+	}
+	if err := queue.add(late, 5); err != nil {
+		t.Fatalf("failed to add bundle: %v", err)
+	}
+	if err := queue.add(early, 5); err != errBundleKnown {
+		t.Errorf("duplicate bundle: have %v, want %v", err, errBundleKnown)
+	}
+	if err := queue.add(testBundle(t, 2, 0, 5), 5); err != errBundleRange {
+		t.Errorf("expired bundle: have %v, want %v", err, errBundleRange)
+	}
+	if ready := queue.ready(6); len(ready) != 1 || ready[0] != early {
+		t.Errorf("block 6: have %v ready bundles, want only the early one", len(ready))
+	}
+	if ready := queue.ready(12); len(ready) != 1 || ready[0] != late {
+		t.Errorf("block 12: have %v ready bundles, want only the late one", len(ready))
+	}
+	if len(queue.bundles) != 1 {
+		t.Errorf("expired bundles not dropped: have %d queued, want 1", len(queue.bundles))
+	}
+}
+
+func TestBundleQueueReadyOrder(t *testing.T) {
+	queue := newBundleQueue()
+
+	second := testBundle(t, 0, 3, 10)
+	third := testBundle(t, 1, 3, 10)
+	first := testBundle(t, 2, 1, 10)
+	for _, bundle := range []*Bundle{second, third, first} {
+		if err := queue.add(bundle, 0); err != nil {
+			t.Fatalf("failed to add bundle: %v", err)
+		}
+	}
+	// The order must not depend on the map iteration of the queue
+	for i := 0; i < 10; i++ {
+		ready := queue.ready(5)
+		if len(ready) != 3 || ready[0] != first || ready[1] != second || ready[2] != third {
+			t.Fatalf("attempt %d: ready bundles not ordered by first block and arrival", i)
+		}
+	}
+}
+
+func TestBundleQueuePrune(t *testing.T) {
+	queue := newBundleQueue()
+
+	included := testBundle(t, 0, 0, 10)
+	expiring := testBundle(t, 1, 0, 5)
+	pending := testBundle(t, 2, 0, 10)
+	for _, bundle := range []*Bundle{included, expiring, pending} {
+		if err := queue.add(bundle, 0); err != nil {
+			t.Fatalf("failed to add bundle: %v", err)
+		}
+	}
+	head := types.NewBlock(&types.Header{Number: big.NewInt(5)}, included.Txs, nil, nil)
+	queue.prune(head)
+
+	if len(queue.bundles) != 1 || queue.bundles[pending.Hash()] == nil {
+		t.Errorf("have %d queued bundles, want only the pending one", len(queue.bundles))
+	}
+}
+
+var (
+	testWorkKey, _   = crypto.GenerateKey()
+	testWorkSender   = crypto.PubkeyToAddress(testWorkKey.PublicKey)
+	testWorkCoinbase = common.Address{0xcb}
+	testWorkFunds    = big.NewInt(1000000000)
+)
+
+// newTestWork creates the work for block 1 on top of a state funding the test
+// sender, with room for the given amount of gas.
+func newTestWork(t *testing.T, gasLimit int64) *Work {
+	db, _ := hpbdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	statedb.AddBalance(testWorkSender, testWorkFunds)
+	root, err := statedb.CommitTo(db, false)
+	if err != nil {
+		t.Fatalf("failed to commit test state: %v", err)
+	}
+	statedb, _ = state.New(root, state.NewDatabase(db))
+
+	header := &types.Header{
+		Number:   big.NewInt(1),
+		GasLimit: big.NewInt(gasLimit),
+		GasUsed:  new(big.Int),
+		Coinbase: testWorkCoinbase,
+	}
+	return &Work{
+		config:  config.MainnetChainConfig,
+		signer:  types.MakeSigner(config.MainnetChainConfig),
+		state:   statedb,
+		header:  header,
+		gasPool: new(hvm.GasPool).AddGas(header.GasLimit),
+	}
+}
+
+// testTransfer creates a transfer of the given value signed by the key.
+func testTransfer(t *testing.T, key *ecdsa.PrivateKey, nonce uint64, value int64) *types.Transaction {
+	tx := types.NewTransaction(nonce, common.Address{0x01}, big.NewInt(value), big.NewInt(21000), big.NewInt(1), nil)
+	tx, err := types.SignTx(tx, types.MakeSigner(config.MainnetChainConfig), key)
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	return tx
+}
+
+// testWorkSnapshot is the part of the work a bundle may change.
+type testWorkSnapshot struct {
+	root     common.Hash
+	gas      *big.Int
+	gasUsed  *big.Int
+	tcount   int
+	txs      int
+	receipts int
+}
+
+func snapshotWork(env *Work) testWorkSnapshot {
+	return testWorkSnapshot{
+		root:     env.state.IntermediateRoot(true),
+		gas:      env.gasPool.Gas(),
+		gasUsed:  new(big.Int).Set(env.header.GasUsed),
+		tcount:   env.tcount,
+		txs:      len(env.txs),
+		receipts: len(env.receipts),
+	}
+}
+
+// Tests that a bundle whose second transaction fails leaves the work exactly
+// as it was before: state, gas pool, gas used and included transactions.
+func TestCommitBundleRevert(t *testing.T) {
+	tests := []struct {
+		name   string
+		second func(t *testing.T) *types.Transaction
+		err    error
+	}{
+		{"nonce gap", func(t *testing.T) *types.Transaction { return testTransfer(t, testWorkKey, 3, 1) }, bc.ErrNonceTooHigh},
+		{"no funds", func(t *testing.T) *types.Transaction { return testTransfer(t, testWorkKey, 2, testWorkFunds.Int64()) }, bc.ErrInsufficientBalance},
+		{"no gas", func(t *testing.T) *types.Transaction {
+			tx := types.NewTransaction(2, common.Address{0x01}, big.NewInt(1), big.NewInt(50000), big.NewInt(1), nil)
+			tx, _ = types.SignTx(tx, types.MakeSigner(config.MainnetChainConfig), testWorkKey)
+			return tx
+		}, hvm.ErrGasLimitReached},
+	}
+	for _, tt := range tests {
+		// Include a transaction ahead of the bundle, with less gas left than the "no gas" one needs
+		env := newTestWork(t, 40000)
+		if err := env.commitBundle(&Bundle{Txs: types.Transactions{testTransfer(t, testWorkKey, 0, 1)}}, testWorkCoinbase); err != nil {
+			t.Fatalf("%s: failed to commit leading transaction: %v", tt.name, err)
+		}
+		before := snapshotWork(env)
+
+		bundle := &Bundle{Txs: types.Transactions{testTransfer(t, testWorkKey, 1, 1), tt.second(t)}}
+		if err := env.commitBundle(bundle, testWorkCoinbase); err != tt.err {
+			t.Errorf("%s: error mismatch: have %v, want %v", tt.name, err, tt.err)
+		}
+		after := snapshotWork(env)
+		if after.root != before.root {
+			t.Errorf("%s: state not reverted: root %x, want %x", tt.name, after.root, before.root)
+		}
+		if after.gas.Cmp(before.gas) != 0 || after.gasUsed.Cmp(before.gasUsed) != 0 {
+			t.Errorf("%s: gas not restored: pool %v used %v, want %v and %v", tt.name, after.gas, after.gasUsed, before.gas, before.gasUsed)
+		}
+		if after.tcount != before.tcount || after.txs != before.txs || after.receipts != before.receipts {
+			t.Errorf("%s: transactions not dropped: %d/%d/%d, want %d/%d/%d", tt.name, after.tcount, after.txs, after.receipts, before.tcount, before.txs, before.receipts)
+		}
+		if nonce := env.state.GetNonce(testWorkSender); nonce != 1 {
+			t.Errorf("%s: sender nonce mismatch: have %d, want 1", tt.name, nonce)
+		}
+		// The work must still take the transactions the bundle reverted
+		if err := env.commitBundle(&Bundle{Txs: types.Transactions{testTransfer(t, testWorkKey, 1, 1)}}, testWorkCoinbase); err != nil {
+			t.Errorf("%s: work unusable after revert: %v", tt.name, err)
+		}
+	}
+}
+
+// Tests that committing the ready bundles includes the ones that succeed,
+// keeps the ones that failed for a later block and drops the ones that can
+// never succeed because their nonces are already used.
+func TestCommitBundlesDropStale(t *testing.T) {
+	env := newTestWork(t, 1000000)
+	queue := newBundleQueue()
+
+	var (
+		good    = &Bundle{Txs: types.Transactions{testTransfer(t, testWorkKey, 0, 1), testTransfer(t, testWorkKey, 1, 1)}, hash: common.Hash{1}}
+		stale   = &Bundle{Txs: types.Transactions{testTransfer(t, testWorkKey, 1, 2)}, hash: common.Hash{2}}
+		future  = &Bundle{Txs: types.Transactions{testTransfer(t, testWorkKey, 2, 3), testTransfer(t, testWorkKey, 4, 3)}, hash: common.Hash{3}}
+		bundles = []*Bundle{good, stale, future}
+	)
+	for _, bundle := range bundles {
+		queue.bundles[bundle.Hash()] = bundle
+	}
+	env.commitBundles(queue, bundles, testWorkCoinbase)
+
+	if len(env.txs) != 2 || env.txs[0] != good.Txs[0] || env.txs[1] != good.Txs[1] {
+		t.Errorf("included transactions mismatch: have %d", len(env.txs))
+	}
+	if queue.bundles[stale.Hash()] != nil {
+		t.Errorf("bundle with a used nonce kept")
+	}
+	if queue.bundles[future.Hash()] == nil {
+		t.Errorf("failed bundle dropped")
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"encoding/binary"
+	"math/big"
+
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/common/log"
+	"github.com/hpb-project/go-hpb/common/rlp"
+)
+
+// minedBlockPrefix + num (uint64 big endian) -> RLP list of blocks sealed locally at that height
+var minedBlockPrefix = []byte("miner-mined-")
+
+// Canonical statuses of a locally sealed block.
+const (
+	MinedBlockPending   uint8 = iota // Not yet deep enough to be checked
+	MinedBlockCanonical              // Reached the canonical chain
+	MinedBlockOrphaned               // Became a side fork
+	MinedBlockUnknown                // Header could not be retrieved when checked
+)
+
+// MinedBlock is the history record of a block sealed by the local miner.
+type MinedBlock struct {
+	Number      uint64
+	Hash        common.Hash
+	InTurn      bool     // Whether the block was sealed in turn
+	Status      uint8    // Canonical status, one of the MinedBlock* constants
+	Reward      *big.Int // Block reward and fees credited to the coinbase
+	SealedAt    uint64   // Unix time in milliseconds the block was sealed at
+	Propagation uint64   // Milliseconds until a child block was imported, 0 if none yet
+}
+
+// StatusString returns the readable form of the canonical status.
+func (b *MinedBlock) StatusString() string {
+	switch b.Status {
+	case MinedBlockPending:
+		return "pending"
+	case MinedBlockCanonical:
+		return "canonical"
+	case MinedBlockOrphaned:
+		return "orphaned"
+	default:
+		return "unknown"
+	}
+}
+
+// OrphanedBlockEvent is posted when a locally sealed block became a side fork.
+type OrphanedBlockEvent struct{ Block *MinedBlock }
+
+func minedBlockKey(number uint64) []byte {
+	enc := make([]byte, 8)
+	binary.BigEndian.PutUint64(enc, number)
+	return append(append([]byte{}, minedBlockPrefix...), enc...)
+}
+
+// readMinedBlocks retrieves the blocks sealed locally at the given height.
+func readMinedBlocks(db hpbdb.Database, number uint64) []*MinedBlock {
+	data, _ := db.Get(minedBlockKey(number))
+	if len(data) == 0 {
+		return nil
+	}
+	var blocks []*MinedBlock
+	if err := rlp.DecodeBytes(data, &blocks); err != nil {
+		log.Error("Invalid mined block RLP", "number", number, "err", err)
+		return nil
+	}
+	return blocks
+}
+
+// writeMinedBlock stores a locally sealed block, replacing any previous record
+// of the same block.
+func writeMinedBlock(db hpbdb.Database, block *MinedBlock) error {
+	blocks := readMinedBlocks(db, block.Number)
+
+	replaced := false
+	for i, b := range blocks {
+		if b.Hash == block.Hash {
+			blocks[i], replaced = block, true
+		}
+	}
+	if !replaced {
+		blocks = append(blocks, block)
+	}
+	data, err := rlp.EncodeToBytes(blocks)
+	if err != nil {
+		return err
+	}
+	return db.Put(minedBlockKey(block.Number), data)
+}
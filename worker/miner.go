@@ -19,6 +19,7 @@ package worker
 
 import (
 	"fmt"
+	"math/big"
 	"sync/atomic"
 
 	"github.com/hpb-project/go-hpb/common"
@@ -139,6 +140,16 @@ func (self *Miner) SetExtra(extra []byte) error {
 	return nil
 }
 
+// SetGasTarget sets the gas limit the miner moves new blocks toward. Each block
+// may only step parentGasLimit / GasLimitBoundDivisor closer to the target.
+func (self *Miner) SetGasTarget(target *big.Int) error {
+	if target.Cmp(config.MinGasLimit) < 0 {
+		return fmt.Errorf("Gas target below minimum gas limit. %v < %v", target, config.MinGasLimit)
+	}
+	self.worker.setGasTarget(target)
+	return nil
+}
+
 // Pending returns the currently pending block and associated state.
 func (self *Miner) Pending() (*types.Block, *state.StateDB) {
 	return self.worker.pending()
@@ -153,6 +164,24 @@ func (self *Miner) PendingBlock() *types.Block {
 	return self.worker.pendingBlock()
 }
 
+// AddBundle queues a bundle of transactions to be included atomically, at the
+// top of a block within its block range.
+func (self *Miner) AddBundle(bundle *Bundle) error {
+	return self.worker.addBundle(bundle)
+}
+
+// MinedBlocks returns the history of blocks sealed locally between the given
+// heights, inclusive.
+func (self *Miner) MinedBlocks(from, to uint64) []*MinedBlock {
+	return self.worker.unconfirmed.MinedBlocks(from, to)
+}
+
+// SubscribeOrphanedBlockEvent registers a subscription of OrphanedBlockEvent,
+// fired when a locally sealed block becomes a side fork.
+func (self *Miner) SubscribeOrphanedBlockEvent(ch chan<- OrphanedBlockEvent) sub.Subscription {
+	return self.worker.unconfirmed.SubscribeOrphanedBlockEvent(ch)
+}
+
 func (self *Miner) SetHpberbase(addr common.Address) {
 	self.coinbase = addr
 	self.worker.setHpberbase(addr)
@@ -19,10 +19,13 @@ package worker
 import (
 	"container/ring"
 	"sync"
+	"time"
 
+	"github.com/hpb-project/go-hpb/blockchain/storage"
 	"github.com/hpb-project/go-hpb/blockchain/types"
 	"github.com/hpb-project/go-hpb/common"
 	"github.com/hpb-project/go-hpb/common/log"
+	"github.com/hpb-project/go-hpb/event/sub"
 )
 
 // headerRetriever is used by the unconfirmed block set to verify whether a previously
@@ -35,8 +38,9 @@ type headerRetriever interface {
 // unconfirmedBlock is a small collection of metadata about a locally mined block
 // that is placed into a unconfirmed set for canonical chain inclusion tracking.
 type unconfirmedBlock struct {
-	index uint64
-	hash  common.Hash
+	index  uint64
+	hash   common.Hash
+	record *MinedBlock
 }
 
 // unconfirmedBlocks implements a data structure to maintain locally mined blocks
@@ -45,29 +49,55 @@ type unconfirmedBlock struct {
 // has a high enough guarantee to not be reorged out of the canonical chain.
 type unconfirmedBlocks struct {
 	chain  headerRetriever // Blockchain to verify canonical status through
+	db     hpbdb.Database  // Database to persist the mined block history into (optional)
 	depth  uint            // Depth after which to discard previous blocks
 	blocks *ring.Ring      // Block infos to allow canonical chain cross checks
 	lock   sync.RWMutex    // Protects the fields from concurrent access
+
+	orphanFeed sub.Feed
+	scope      sub.SubscriptionScope
 }
 
 // newUnconfirmedBlocks returns new data structure to track currently unconfirmed blocks.
-func newUnconfirmedBlocks(chain headerRetriever, depth uint) *unconfirmedBlocks {
+func newUnconfirmedBlocks(chain headerRetriever, db hpbdb.Database, depth uint) *unconfirmedBlocks {
 	return &unconfirmedBlocks{
 		chain: chain,
+		db:    db,
 		depth: depth,
 	}
 }
 
+// SubscribeOrphanedBlockEvent registers a subscription of OrphanedBlockEvent.
+func (set *unconfirmedBlocks) SubscribeOrphanedBlockEvent(ch chan<- OrphanedBlockEvent) sub.Subscription {
+	return set.scope.Track(set.orphanFeed.Subscribe(ch))
+}
+
+// persist writes the record of a mined block into the history, if enabled.
+func (set *unconfirmedBlocks) persist(record *MinedBlock) {
+	if set.db == nil {
+		return
+	}
+	if err := writeMinedBlock(set.db, record); err != nil {
+		log.Warn("Failed to store mined block", "number", record.Number, "hash", record.Hash, "err", err)
+	}
+}
+
 // Insert adds a new block to the set of unconfirmed ones.
-func (set *unconfirmedBlocks) Insert(index uint64, hash common.Hash) {
+func (set *unconfirmedBlocks) Insert(record *MinedBlock) {
+	index, hash := record.Number, record.Hash
+
 	// If a new block was mined locally, shift out any old enough blocks
 	set.Shift(index)
 
 	// Create the new item as its own ring
+	record.Status = MinedBlockPending
+	set.persist(record)
+
 	item := ring.New(1)
 	item.Value = &unconfirmedBlock{
-		index: index,
-		hash:  hash,
+		index:  index,
+		hash:   hash,
+		record: record,
 	}
 	// Set as the initial ring or append to the end
 	set.lock.Lock()
@@ -86,6 +116,12 @@ func (set *unconfirmedBlocks) Insert(index uint64, hash common.Hash) {
 // allowance, checking them against the canonical chain for inclusion or staleness
 // report.
 func (set *unconfirmedBlocks) Shift(height uint64) {
+	var orphaned []*MinedBlock
+	defer func() {
+		for _, record := range orphaned {
+			set.orphanFeed.Send(OrphanedBlockEvent{Block: record})
+		}
+	}()
 	set.lock.Lock()
 	defer set.lock.Unlock()
 
@@ -100,11 +136,17 @@ func (set *unconfirmedBlocks) Shift(height uint64) {
 		switch {
 		case header == nil:
 			log.Warn("Failed to retrieve header of mined block", "number", next.index, "hash", next.hash)
+			next.record.Status = MinedBlockUnknown
 		case header.Hash() == next.hash:
 			log.Info("🔗 block reached canonical chain", "number", next.index, "hash", next.hash)
+			next.record.Status = MinedBlockCanonical
 		default:
 			log.Info("⑂ block  became a side fork", "number", next.index, "hash", next.hash)
+			next.record.Status = MinedBlockOrphaned
+			orphaned = append(orphaned, next.record)
 		}
+		set.persist(next.record)
+
 		// Drop the block out of the ring
 		if set.blocks.Value == set.blocks.Next().Value {
 			set.blocks = nil
@@ -115,3 +157,50 @@ func (set *unconfirmedBlocks) Shift(height uint64) {
 		}
 	}
 }
+
+// Propagated records the time it took for a locally mined block to be built
+// upon, if the given header is the first known child of one.
+func (set *unconfirmedBlocks) Propagated(header *types.Header) {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+
+	if set.blocks == nil {
+		return
+	}
+	set.blocks.Do(func(value interface{}) {
+		block := value.(*unconfirmedBlock)
+		if block.hash != header.ParentHash || block.record.Propagation != 0 {
+			return
+		}
+		if now := uint64(time.Now().UnixNano() / int64(time.Millisecond)); now > block.record.SealedAt {
+			block.record.Propagation = now - block.record.SealedAt
+		} else {
+			block.record.Propagation = 1
+		}
+		set.persist(block.record)
+	})
+}
+
+// MinedBlocks returns the history of locally mined blocks between the given
+// heights, inclusive. Without a database only the unconfirmed blocks are known.
+func (set *unconfirmedBlocks) MinedBlocks(from, to uint64) []*MinedBlock {
+	var blocks []*MinedBlock
+	if set.db != nil {
+		for number := from; number <= to && number >= from; number++ {
+			blocks = append(blocks, readMinedBlocks(set.db, number)...)
+		}
+		return blocks
+	}
+	set.lock.RLock()
+	defer set.lock.RUnlock()
+
+	if set.blocks != nil {
+		set.blocks.Do(func(value interface{}) {
+			if block := value.(*unconfirmedBlock); block.index >= from && block.index <= to {
+				record := *block.record
+				blocks = append(blocks, &record)
+			}
+		})
+	}
+	return blocks
+}
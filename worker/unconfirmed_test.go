@@ -0,0 +1,107 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/hpb-project/go-hpb/blockchain/storage"
+	"github.com/hpb-project/go-hpb/blockchain/types"
+	"github.com/hpb-project/go-hpb/common"
+)
+
+// noopHeaderRetriever is an implementation of headerRetriever that always
+// returns nil for any requested headers.
+type noopHeaderRetriever struct{}
+
+func (r *noopHeaderRetriever) GetHeaderByNumber(number uint64) *types.Header {
+	return nil
+}
+
+// canonHeaderRetriever returns canonical headers from a fixed set.
+type canonHeaderRetriever map[uint64]*types.Header
+
+func (r canonHeaderRetriever) GetHeaderByNumber(number uint64) *types.Header {
+	return r[number]
+}
+
+// Tests that inserting blocks into the unconfirmed set accumulates them until
+// the desired depth is reached, after which they begin to be dropped.
+func TestUnconfirmedInsertBounds(t *testing.T) {
+	limit := uint(10)
+
+	pool := newUnconfirmedBlocks(new(noopHeaderRetriever), nil, limit)
+	for depth := uint64(0); depth < 2*uint64(limit); depth++ {
+		// Insert multiple blocks for the same level just to stress it
+		for i := 0; i < int(depth); i++ {
+			pool.Insert(&MinedBlock{Number: depth, Hash: common.Hash{byte(depth), byte(i)}})
+		}
+		// Validate that no blocks below the depth allowance are left in
+		pool.blocks.Do(func(block interface{}) {
+			if block := block.(*unconfirmedBlock); block.index+uint64(limit) <= depth {
+				t.Errorf("depth %d: block %x not dropped", depth, block.hash)
+			}
+		})
+	}
+}
+
+// Tests that the mined block history is persisted with the canonical status
+// and that orphaned blocks are announced.
+func TestMinedBlockHistory(t *testing.T) {
+	db, _ := hpbdb.NewMemDatabase()
+
+	canonical := &types.Header{Number: big.NewInt(1)}
+	chain := canonHeaderRetriever{1: canonical, 2: &types.Header{Number: big.NewInt(2), ParentHash: canonical.Hash()}}
+	pool := newUnconfirmedBlocks(chain, db, 2)
+
+	orphans := make(chan OrphanedBlockEvent, 1)
+	subscription := pool.SubscribeOrphanedBlockEvent(orphans)
+	defer subscription.Unsubscribe()
+
+	pool.Insert(&MinedBlock{Number: 1, Hash: canonical.Hash(), InTurn: true, Reward: big.NewInt(10)})
+	pool.Insert(&MinedBlock{Number: 2, Hash: common.Hash{0x02}, Reward: big.NewInt(5)})
+	pool.Propagated(chain[2])
+
+	if blocks := pool.MinedBlocks(1, 2); len(blocks) != 2 || blocks[0].Status != MinedBlockPending {
+		t.Fatalf("pending history mismatch: have %d blocks", len(blocks))
+	}
+	if blocks := pool.MinedBlocks(1, 1); blocks[0].Propagation == 0 {
+		t.Errorf("propagation time not recorded")
+	}
+	pool.Shift(4)
+
+	blocks := pool.MinedBlocks(0, 10)
+	if len(blocks) != 2 {
+		t.Fatalf("history length mismatch: have %d, want 2", len(blocks))
+	}
+	if blocks[0].Status != MinedBlockCanonical || !blocks[0].InTurn || blocks[0].Reward.Cmp(big.NewInt(10)) != 0 {
+		t.Errorf("canonical block record mismatch: %+v", blocks[0])
+	}
+	if blocks[1].Status != MinedBlockOrphaned {
+		t.Errorf("orphaned block status mismatch: have %s", blocks[1].StatusString())
+	}
+	select {
+	case ev := <-orphans:
+		if ev.Block.Hash != (common.Hash{0x02}) {
+			t.Errorf("orphan event hash mismatch: have %x", ev.Block.Hash)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("no orphan event received")
+	}
+}
@@ -19,6 +19,7 @@ package worker
 import (
 	"fmt"
 	"math/big"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -30,11 +31,13 @@ import (
 	"github.com/hpb-project/go-hpb/consensus"
 	"github.com/hpb-project/go-hpb/common"
 	"github.com/hpb-project/go-hpb/common/log"
+	"github.com/hpb-project/go-hpb/common/metrics"
 	"github.com/hpb-project/go-hpb/hvm"
 	"github.com/hpb-project/go-hpb/txpool"
 	"github.com/hpb-project/go-hpb/blockchain/storage"
 	"github.com/hpb-project/go-hpb/blockchain"
 	"github.com/hpb-project/go-hpb/event/sub"
+	"github.com/hpb-project/go-hpb/node/db"
 )
 
 const (
@@ -48,6 +51,18 @@ const (
 	chainHeadChanSize = 10
 	// chainSideChanSize is the size of channel listening to ChainSideEvent.
 	chainSideChanSize = 10
+
+	// sealMargin is the part of the slot kept free before the header timestamp,
+	// so the block can still be sealed and propagated in time.
+	sealMargin = 500 * time.Millisecond
+	// minBuildBudget is the least time a round may spend committing transactions,
+	// even if the slot of the new header is already due.
+	minBuildBudget = 200 * time.Millisecond
+)
+
+var (
+	roundExecTimer = metrics.NewTimer("hpb/worker/round/exec")
+	roundWaitTimer = metrics.NewTimer("hpb/worker/round/wait")
 )
 
 // Agent can register themself with the worker
@@ -76,7 +91,16 @@ type Work struct {
 	txs      []*types.Transaction
 	receipts []*types.Receipt
 
+	gasPool      *hvm.GasPool    // gas left for the transactions of the block
+	uncleHeaders []*types.Header // uncles chosen for the block
+	deadline     time.Time       // time after which no more transactions are committed
+	execElapsed  time.Duration   // time spent executing transactions
+	reward       *big.Int        // block reward and fees credited to the coinbase
+	task         *Work           // finalized copy last handed to the producers
+	seq          uint64          // sequence number of the task, results of older tasks are stale
+
 	createdAt time.Time
+	pushedAt  time.Time
 }
 
 type Result struct {
@@ -110,8 +134,9 @@ type worker struct {
 	proc    bc.Validator
 	chainDb hpbdb.Database
 
-	coinbase common.Address
-	extra    []byte
+	coinbase  common.Address
+	extra     []byte
+	gasTarget *big.Int // gas limit the mined headers are moved toward, nil for the default target
 
 	currentMu sync.Mutex
 	current   *Work
@@ -119,7 +144,9 @@ type worker struct {
 	uncleMu        sync.Mutex
 	possibleUncles map[common.Hash]*types.Block
 
+	taskSeq     uint64             // sequence number of the latest sealing task, accessed atomically
 	unconfirmed *unconfirmedBlocks // set of locally mined blocks pending canonicalness confirmations
+	bundles     *bundleQueue       // transaction bundles waiting to be included atomically
 
 	// atomic status counters
 	mining int32
@@ -141,7 +168,8 @@ func newWorker(config *config.ChainConfig, engine consensus.Engine, coinbase com
 		possibleUncles: make(map[common.Hash]*types.Block),
 		coinbase:       coinbase,
 		producers:         make(map[Producer]struct{}),
-		unconfirmed:    newUnconfirmedBlocks(bc.InstanceBlockChain(), miningLogAtDepth),
+		unconfirmed:    newUnconfirmedBlocks(bc.InstanceBlockChain(), nil, miningLogAtDepth),
+		bundles:        newBundleQueue(),
 	}
 	// Subscribe TxPreEvent for tx pool
 	//TODO new event system
@@ -156,6 +184,10 @@ func newWorker(config *config.ChainConfig, engine consensus.Engine, coinbase com
 		})*/
 
 
+	if chainDb := db.GetHpbDbInstance(); chainDb != nil {
+		worker.chainDb = chainDb
+		worker.unconfirmed.db = chainDb
+	}
 	worker.pool = txpool.GetTxPool()
 	worker.txCh = make(chan bc.TxPreEvent, txChanSize)
 	worker.txSub = worker.pool.SubscribeTxPreEvent(worker.txCh)
@@ -183,6 +215,17 @@ func (self *worker) setExtra(extra []byte) {
 	self.extra = extra
 }
 
+func (self *worker) setGasTarget(target *big.Int) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.gasTarget = new(big.Int).Set(target)
+}
+
+// addBundle queues a transaction bundle for inclusion in an upcoming block.
+func (self *worker) addBundle(bundle *Bundle) error {
+	return self.bundles.add(bundle, self.chain.CurrentBlock().NumberU64())
+}
+
 func (self *worker) pending() (*types.Block, *state.StateDB) {
 	self.currentMu.Lock()
 	defer self.currentMu.Unlock()
@@ -195,6 +238,9 @@ func (self *worker) pending() (*types.Block, *state.StateDB) {
 			self.current.receipts,
 		), self.current.state.Copy()
 	}
+	if self.current.task != nil {
+		return self.current.task.Block, self.current.task.state.Copy()
+	}
 	return self.current.Block, self.current.state.Copy()
 }
 
@@ -288,7 +334,9 @@ func (self *worker) eventListener() {
 		// A real event arrived, process interesting content
 		select {
 		// Handle ChainHeadEvent
-		case <-self.chainHeadCh:
+		case ev := <-self.chainHeadCh:
+			self.unconfirmed.Propagated(ev.Block.Header())
+			self.bundles.prune(ev.Block)
 			self.startNewMinerRound()
 
 		// Handle ChainSideEvent
@@ -301,17 +349,10 @@ func (self *worker) eventListener() {
 
 		
 		case ev := <-self.txCh:
-			// Apply transaction to the pending state if we're not mining
-			if atomic.LoadInt32(&self.mining) == 0 {
-				self.currentMu.Lock()
-				acc, _ := types.Sender(self.current.signer, ev.Tx)
-				txs := map[common.Address]types.Transactions{acc: {ev.Tx}}
-				txset := types.NewTransactionsByPriceAndNonce(self.current.signer, txs)
-
-				self.current.commitTransactions(self.mux, txset, self.coinbase)
-				self.currentMu.Unlock()
+			// The refreshed task is pushed without holding the work lock
+			if task := self.commitNewTxs(ev.Tx); task != nil {
+				self.push(task)
 			}
-		
 
 		// System stopped
 		//case <-self.txSub.Err():
@@ -336,6 +377,14 @@ func (self *worker) handlerSelfMinedBlock() {
 			block := result.Block
 			work := result.Work
 
+			// A newer task superseded the one sealed, its block is outdated
+			if seq := atomic.LoadUint64(&self.taskSeq); work.seq != seq {
+				log.Debug("Discarding stale sealing result", "number", block.Number(), "seq", work.seq, "latest", seq)
+				continue
+			}
+
+			recordRound(work, block.Number())
+
 			// Update the block hash in all logs since it is now available and not when the
 			// receipt/log of individual transactions were created.
 			for _, r := range work.receipts {
@@ -370,7 +419,13 @@ func (self *worker) handlerSelfMinedBlock() {
 			self.chain.PostChainEvents(events, logs)
 
 			// Insert the block into the set of pending ones to wait for confirmations
-			self.unconfirmed.Insert(block.NumberU64(), block.Hash())
+			self.unconfirmed.Insert(&MinedBlock{
+				Number:   block.NumberU64(),
+				Hash:     block.Hash(),
+				InTurn:   block.Difficulty().Cmp(consensus.DiffInTurn) == 0,
+				Reward:   work.reward,
+				SealedAt: uint64(time.Now().UnixNano() / int64(time.Millisecond)),
+			})
 
 			if mustCommitNewWork {
 				self.startNewMinerRound()
@@ -379,11 +434,16 @@ func (self *worker) handlerSelfMinedBlock() {
 	}
 }
 
-// push sends a new work task to currently live miner agents.
+// push sends a new work task to currently live miner agents. Tasks superseded
+// by a newer one in the meantime are not sent.
 func (self *worker) push(work *Work) {
 	if atomic.LoadInt32(&self.mining) != 1 {
 		return
 	}
+	if work.seq != atomic.LoadUint64(&self.taskSeq) {
+		return
+	}
+	work.pushedAt = time.Now()
 	for producer := range self.producers {
 		atomic.AddInt32(&self.atWork, 1)
 		if ch := producer.Work(); ch != nil {
@@ -406,6 +466,8 @@ func (self *worker) makeCurrent(parent *types.Block, header *types.Header) error
 		family:    set.New(),
 		uncles:    set.New(),
 		header:    header,
+		gasPool:   new(hvm.GasPool).AddGas(header.GasLimit),
+		deadline:  buildDeadline(header, time.Now()),
 		createdAt: time.Now(),
 	}
 
@@ -446,11 +508,15 @@ func (self *worker) startNewMinerRound() {
 		time.Sleep(wait)
 	}
 
+	target := self.gasTarget
+	if target == nil {
+		target = config.TargetGasLimit
+	}
 	num := parent.Number()
 	header := &types.Header{
 		ParentHash: parent.Hash(),
 		Number:     num.Add(num, common.Big1),
-		GasLimit:   bc.CalcGasLimit(parent),
+		GasLimit:   bc.CalcGasLimitTarget(parent, target),
 		GasUsed:    new(big.Int),
 		Extra:      self.extra,
 		Time:       big.NewInt(tstamp),
@@ -477,6 +543,9 @@ func (self *worker) startNewMinerRound() {
 	//if self.config.DAOForkSupport && self.config.DAOForkBlock != nil && self.config.DAOForkBlock.Cmp(header.Number) == 0 {
 	//	misc.ApplyDAOHardFork(work.state)
 	//}
+	// Bundles are placed at the top of the block, ahead of the pool transactions
+	work.commitBundles(self.bundles, self.bundles.ready(header.Number.Uint64()), self.coinbase)
+
 	pending, err := txpool.GetTxPool().Pending()
 	if err != nil {
 		log.Error("Failed to fetch pending transactions", "err", err)
@@ -484,7 +553,7 @@ func (self *worker) startNewMinerRound() {
 	}
 	//log.Error("----read tx from pending is ", "number is", len(pending))
 	txs := types.NewTransactionsByPriceAndNonce(self.current.signer, pending)
-	work.commitTransactions(self.mux, txs, self.coinbase)
+	work.commitTransactions(self.mux, txs, self.coinbase, work.deadline)
 	// compute uncles for the new block.
 	var (
 		uncles    []*types.Header
@@ -507,17 +576,130 @@ func (self *worker) startNewMinerRound() {
 	for _, hash := range badUncles {
 		delete(self.possibleUncles, hash)
 	}
+	work.uncleHeaders = uncles
+
 	// Create the new block to seal with the consensus engine
-	if work.Block, err = self.engine.Finalize(self.chain, header, work.state, work.txs, uncles, work.receipts); err != nil {
+	if err := self.updateSealingWork(work); err != nil {
 		log.Error("Failed to finalize block for sealing", "err", err)
 		return
 	}
 	// We only care about logging if we're actually mining.
 	if atomic.LoadInt32(&self.mining) == 1 {
-		log.Info("Commit new mining work", "number", work.Block.Number(), "txs", work.tcount, "uncles", len(uncles), "elapsed", common.PrettyDuration(time.Since(tstart)))
+		log.Info("Commit new mining work", "number", work.Block.Number(), "txs", work.tcount, "uncles", len(uncles),
+			"exec", common.PrettyDuration(work.execElapsed), "elapsed", common.PrettyDuration(time.Since(tstart)))
 		self.unconfirmed.Shift(work.Block.NumberU64() - 1)
 	}
-	self.push(work)
+	self.push(work.task)
+}
+
+// commitNewTxs applies transactions that arrived after the round started,
+// together with the ones queued behind them. While not mining they extend the
+// pending state. While mining, the block being sealed is rebuilt only if it is
+// still within its build deadline and any of the transactions was included; the
+// refreshed task is returned for the caller to push.
+func (self *worker) commitNewTxs(first *types.Transaction) *Work {
+	var (
+		signer = types.NewBoeSigner(self.config.ChainId)
+		txs    = make(map[common.Address]types.Transactions)
+	)
+	add := func(tx *types.Transaction) {
+		acc, _ := types.Sender(signer, tx)
+		txs[acc] = append(txs[acc], tx)
+	}
+	add(first)
+drain:
+	for {
+		select {
+		case ev := <-self.txCh:
+			add(ev.Tx)
+		default:
+			break drain
+		}
+	}
+	for _, list := range txs {
+		sort.Sort(types.TxByNonce(list))
+	}
+
+	self.currentMu.Lock()
+	defer self.currentMu.Unlock()
+
+	txset := types.NewTransactionsByPriceAndNonce(self.current.signer, txs)
+	if atomic.LoadInt32(&self.mining) == 0 {
+		// Apply transaction to the pending state if we're not mining
+		self.current.commitTransactions(self.mux, txset, self.coinbase, time.Time{})
+		return nil
+	}
+	if self.current.task == nil || !time.Now().Before(self.current.deadline) {
+		return nil
+	}
+	tcount := self.current.tcount
+	self.current.commitTransactions(self.mux, txset, self.coinbase, self.current.deadline)
+	if self.current.tcount == tcount {
+		return nil
+	}
+	if err := self.updateSealingWork(self.current); err != nil {
+		log.Error("Failed to refresh block for sealing", "err", err)
+		return nil
+	}
+	return self.current.task
+}
+
+// updateSealingWork finalizes a copy of the work committed so far, leaving the
+// work itself open for more transactions until its deadline passes. The copy
+// is what gets handed to the producers and written once sealed.
+func (self *worker) updateSealingWork(work *Work) error {
+	header := types.CopyHeader(work.header)
+	statedb := work.state.Copy()
+	balance := statedb.GetBalance(header.Coinbase)
+
+	block, err := self.engine.Finalize(self.chain, header, statedb, work.txs, work.uncleHeaders, work.receipts)
+	if err != nil {
+		return err
+	}
+	// The coinbase earns the block reward on finalization plus the fees paid
+	reward := new(big.Int).Sub(statedb.GetBalance(header.Coinbase), balance)
+	for i, tx := range work.txs {
+		reward.Add(reward, new(big.Int).Mul(work.receipts[i].GasUsed, tx.GasPrice()))
+	}
+	task := &Work{
+		config:      work.config,
+		signer:      work.signer,
+		state:       statedb,
+		tcount:      work.tcount,
+		Block:       block,
+		header:      header,
+		txs:         append([]*types.Transaction(nil), work.txs...),
+		receipts:    append([]*types.Receipt(nil), work.receipts...),
+		deadline:    work.deadline,
+		execElapsed: work.execElapsed,
+		reward:      reward,
+		createdAt:   work.createdAt,
+		seq:         atomic.AddUint64(&self.taskSeq, 1),
+	}
+	work.Block = block
+	work.task = task
+	return nil
+}
+
+// recordRound reports how long the sealed round spent executing transactions
+// and waiting for the producers after its task was pushed.
+func recordRound(work *Work, number *big.Int) {
+	wait := time.Since(work.pushedAt)
+	roundExecTimer.Update(work.execElapsed)
+	roundWaitTimer.Update(wait)
+	log.Info("Sealing round finished", "number", number, "txs", work.tcount,
+		"exec", common.PrettyDuration(work.execElapsed), "wait", common.PrettyDuration(wait))
+}
+
+// buildDeadline derives the time budget for committing transactions from the
+// header timestamp: transactions are applied until shortly before the slot
+// opens, but never for less than minBuildBudget.
+func buildDeadline(header *types.Header, now time.Time) time.Time {
+	deadline := time.Unix(header.Time.Int64(), 0).Add(-sealMargin)
+	if min := now.Add(minBuildBudget); deadline.Before(min) {
+		return min
+	}
+	return deadline
 }
 
 func (self *worker) commitUncle(work *Work, uncle *types.Header) error {
@@ -535,13 +717,31 @@ func (self *worker) commitUncle(work *Work, uncle *types.Header) error {
 	return nil
 }
 
-func (env *Work) commitTransactions(mux *sub.TypeMux, txs *types.TransactionsByPriceAndNonce, coinbase common.Address) {
+// commitTransactions applies transactions to the work until the set is drained,
+// the block gas runs out or the deadline passes. A zero deadline means no
+// time budget.
+func (env *Work) commitTransactions(mux *sub.TypeMux, txs *types.TransactionsByPriceAndNonce, coinbase common.Address, deadline time.Time) {
 	//log.Error("----------------committransactions--------------")
-	gp := new(hvm.GasPool).AddGas(env.header.GasLimit)
+	gp := env.gasPool
+	start := time.Now()
+	defer func() { env.execElapsed += time.Since(start) }()
 
-	var coalescedLogs []*types.Log
+	var (
+		coalescedLogs []*types.Log
+		tcount        = env.tcount
+		minGas        = new(big.Int).SetUint64(config.TxGas)
+	)
 
 	for {
+		// Abort if the time budget or the block gas is used up
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			log.Debug("Time budget for transactions exhausted", "number", env.header.Number, "txs", env.tcount)
+			break
+		}
+		if gp.Gas().Cmp(minGas) < 0 {
+			log.Trace("Not enough gas for further transactions", "gas", gp)
+			break
+		}
 		// Retrieve the next transaction and abort if all done
 		tx := txs.Peek()
 		if tx == nil {
@@ -595,7 +795,7 @@ func (env *Work) commitTransactions(mux *sub.TypeMux, txs *types.TransactionsByP
 		}
 	}
 
-	if len(coalescedLogs) > 0 || env.tcount > 0 {
+	if len(coalescedLogs) > 0 || env.tcount > tcount {
 		// make a copy, the state caches the logs and these logs get "upgraded" from pending to mined
 		// logs by filling in the block hash when the block was mined by the local miner. This can
 		// cause a race condition if a log was "upgraded" before the PendingLogsEvent is processed.
@@ -611,7 +811,7 @@ func (env *Work) commitTransactions(mux *sub.TypeMux, txs *types.TransactionsByP
 			if tcount > 0 {
 				mux.Post(bc.PendingStateEvent{})
 			}
-		}(cpy, env.tcount)
+		}(cpy, env.tcount-tcount)
 	}
 }
 
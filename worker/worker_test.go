@@ -0,0 +1,180 @@
+// Copyright 2018 The go-hpb Authors
+// This file is part of the go-hpb.
+//
+// The go-hpb is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-hpb is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-hpb. If not, see <http://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/hpb-project/go-hpb/blockchain"
+	"github.com/hpb-project/go-hpb/blockchain/types"
+	"github.com/hpb-project/go-hpb/common"
+	"github.com/hpb-project/go-hpb/config"
+	"github.com/hpb-project/go-hpb/event/sub"
+)
+
+// testProducer is a producer recording the work it is handed.
+type testProducer struct {
+	workCh chan *Work
+}
+
+func (p *testProducer) Work() chan<- *Work         { return p.workCh }
+func (p *testProducer) SetReturnCh(chan<- *Result) {}
+func (p *testProducer) Stop()                      {}
+func (p *testProducer) Start()                     {}
+
+// Tests that a task superseded by a newer one is not handed to the producers.
+func TestPushSkipsStaleTask(t *testing.T) {
+	producer := &testProducer{workCh: make(chan *Work, 2)}
+	w := &worker{
+		producers: map[Producer]struct{}{producer: {}},
+		mining:    1,
+		taskSeq:   2,
+	}
+	w.push(&Work{seq: 1})
+	if len(producer.workCh) != 0 {
+		t.Fatalf("stale task pushed")
+	}
+	w.push(&Work{seq: 2})
+	if len(producer.workCh) != 1 {
+		t.Fatalf("latest task not pushed")
+	}
+}
+
+// Tests that the build deadline keeps the seal margin before the header
+// timestamp, but leaves at least the minimum budget when the slot is close.
+func TestBuildDeadline(t *testing.T) {
+	now := time.Unix(1000, 0)
+	tests := []struct {
+		time int64
+		want time.Time
+	}{
+		{1010, time.Unix(1010, 0).Add(-sealMargin)}, // slot far ahead
+		{1001, time.Unix(1001, 0).Add(-sealMargin)}, // margin still above the minimum budget
+		{1000, now.Add(minBuildBudget)},             // slot opening now
+		{990, now.Add(minBuildBudget)},              // slot already open
+		{0, now.Add(minBuildBudget)},                // no timestamp
+	}
+	for i, tt := range tests {
+		header := &types.Header{Time: big.NewInt(tt.time)}
+		if have := buildDeadline(header, now); !have.Equal(tt.want) {
+			t.Errorf("test %d: deadline mismatch: have %v, want %v", i, have, tt.want)
+		}
+	}
+}
+
+// testTxWorker creates a worker extending the given work with new transactions.
+func testTxWorker(env *Work, mining int32) *worker {
+	return &worker{
+		config:   config.MainnetChainConfig,
+		mux:      new(sub.TypeMux),
+		txCh:     make(chan bc.TxPreEvent, 8),
+		coinbase: testWorkCoinbase,
+		current:  env,
+		mining:   mining,
+	}
+}
+
+// testCheapTransfer creates a transfer using exactly the intrinsic gas.
+func testCheapTransfer(t *testing.T, nonce uint64) *types.Transaction {
+	tx := types.NewTransaction(nonce, common.Address{0x01}, big.NewInt(1), new(big.Int).SetUint64(config.TxGas), big.NewInt(1), nil)
+	tx, err := types.SignTx(tx, types.MakeSigner(config.MainnetChainConfig), testWorkKey)
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	return tx
+}
+
+// Tests that new transactions, with the ones queued behind them, extend the
+// pending state while not mining until the block gas runs out.
+func TestCommitNewTxsGasExhausted(t *testing.T) {
+	// Leave room for two transactions only
+	env := newTestWork(t, int64(2*config.TxGas+config.TxGas/2))
+	w := testTxWorker(env, 0)
+
+	w.txCh <- bc.TxPreEvent{Tx: testCheapTransfer(t, 1)}
+	w.txCh <- bc.TxPreEvent{Tx: testCheapTransfer(t, 2)}
+	if task := w.commitNewTxs(testCheapTransfer(t, 0)); task != nil {
+		t.Errorf("task returned while not mining")
+	}
+	if len(w.txCh) != 0 {
+		t.Errorf("queued transactions not drained: %d left", len(w.txCh))
+	}
+	if env.tcount != 2 || len(env.txs) != 2 {
+		t.Fatalf("included transactions mismatch: have %d, want 2", env.tcount)
+	}
+	for i, tx := range env.txs {
+		if tx.Nonce() != uint64(i) {
+			t.Errorf("transaction %d: nonce mismatch: have %d, want %d", i, tx.Nonce(), i)
+		}
+	}
+	if env.execElapsed <= 0 {
+		t.Errorf("execution time not accounted")
+	}
+}
+
+// Tests that new transactions are not added to the block being sealed once
+// its build deadline passed.
+func TestCommitNewTxsDeadline(t *testing.T) {
+	env := newTestWork(t, 1000000)
+	env.task = &Work{seq: 1}
+	env.deadline = time.Now().Add(-time.Millisecond)
+	w := testTxWorker(env, 1)
+
+	if task := w.commitNewTxs(testCheapTransfer(t, 0)); task != nil {
+		t.Errorf("task refreshed after the deadline")
+	}
+	if env.tcount != 0 || len(env.txs) != 0 {
+		t.Errorf("transactions included after the deadline: %d", len(env.txs))
+	}
+	// The transactions applied in the round must not run past the deadline
+	// either, even when committed directly
+	txs := types.NewTransactionsByPriceAndNonce(env.signer, map[common.Address]types.Transactions{
+		testWorkSender: {testCheapTransfer(t, 0)},
+	})
+	env.commitTransactions(w.mux, txs, w.coinbase, env.deadline)
+	if len(env.txs) != 0 {
+		t.Errorf("transactions committed after the deadline: %d", len(env.txs))
+	}
+}
+
+// Tests that a finished round reports its execution and wait times.
+func TestRecordRound(t *testing.T) {
+	var (
+		execCount, execSum = roundExecTimer.Count(), roundExecTimer.Sum()
+		waitCount, waitSum = roundWaitTimer.Count(), roundWaitTimer.Sum()
+	)
+	work := &Work{
+		execElapsed: 30 * time.Millisecond,
+		pushedAt:    time.Now().Add(-50 * time.Millisecond),
+	}
+	recordRound(work, big.NewInt(1))
+
+	if have := roundExecTimer.Count() - execCount; have != 1 {
+		t.Errorf("exec rounds mismatch: have %d, want 1", have)
+	}
+	if have := time.Duration(roundExecTimer.Sum() - execSum); have != work.execElapsed {
+		t.Errorf("exec time mismatch: have %v, want %v", have, work.execElapsed)
+	}
+	if have := roundWaitTimer.Count() - waitCount; have != 1 {
+		t.Errorf("wait rounds mismatch: have %d, want 1", have)
+	}
+	if have := time.Duration(roundWaitTimer.Sum() - waitSum); have < 50*time.Millisecond {
+		t.Errorf("wait time mismatch: have %v, want at least %v", have, 50*time.Millisecond)
+	}
+}